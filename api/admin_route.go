@@ -0,0 +1,224 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	operatorKey      string
+	errorNotOperator = utils.NewAPIError(401, "operator.unauthorized", "This resource is reserved to PopCube operators.")
+)
+
+func initAdminRoute(router chi.Router) {
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(operatorOnly)
+		// swagger:route POST /admin/organisations/token Admin newOrganisationToken
+		//
+		// New organisation token
+		//
+		// This will create a neworganisation token. Token can be used once on /initorganisation to create
+		// the organisation and its owner.
+		//
+		// 	Responses:
+		//    201: newOrganisationTokenOk
+		// 	  401: notOperator
+		// 	  422: wrongEntity
+		// 	  default: genericError
+		r.Post("/organisations/token", newOrganisationToken)
+		r.Route("/revocations", func(r chi.Router) {
+			// swagger:route POST /admin/revocations/token Admin revokeToken
+			//
+			// Revoke token
+			//
+			// This will revoke a single token from its jti or from the token itself.
+			//
+			// 	Responses:
+			//    201: revocationObjectSuccess
+			// 	  401: notOperator
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/token", revokeToken)
+			// swagger:route POST /admin/revocations/user/{userID} Admin revokeUserTokens
+			//
+			// Revoke user tokens
+			//
+			// This will revoke all tokens issued to the user until now, including refresh tokens.
+			//
+			// 	Responses:
+			//    201: revocationObjectSuccess
+			// 	  401: notOperator
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/user/:userID", revokeUserTokens)
+			// swagger:route POST /admin/revocations/organisation/{organisationID} Admin revokeOrganisationTokens
+			//
+			// Revoke organisation tokens
+			//
+			// This will revoke all tokens issued to the users of the organisation until now, including refresh tokens.
+			//
+			// 	Responses:
+			//    201: revocationObjectSuccess
+			// 	  401: notOperator
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/organisation/:organisationID", revokeOrganisationTokens)
+		})
+	})
+}
+
+// operatorOnly allow request only if it carries the operator key in X-Operator-Key header.
+func operatorOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.Header.Get("X-Operator-Key")
+		if operatorKey == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(operatorKey)) != 1 {
+			render.JSON(w, errorNotOperator.StatusCode, errorNotOperator)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newOrganisationTokenOk response send back with a neworganisation token
+type newOrganisationTokenOk struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func newOrganisationToken(w http.ResponseWriter, r *http.Request) {
+	data := &newOrganisationRequest{}
+	if err := chiRender.Bind(r, data); err != nil {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	data.Organisation.PreSave()
+	if apperr := data.Organisation.IsValid(); apperr != nil {
+		render.JSON(w, error422.StatusCode, apperr)
+		return
+	}
+	data.Owner.PreSave()
+	if !models.IsValidUsername(data.Owner.Username) || !models.IsValidEmail(data.Owner.Email) {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	expiresAt := ExpireIn(newOrganisationTokenLifetime)
+	token, err := generateNewOrganisationToken(data.Organisation, data.Owner)
+	if err != nil {
+		render.JSON(w, 422, "Could not generate token")
+		return
+	}
+	render.JSON(w, 201, newOrganisationTokenOk{Token: token, ExpiresAt: expiresAt})
+}
+
+// revokeTokenRequest object. Either jti or token has to be provided.
+type revokeTokenRequest struct {
+	Jti   string `json:"jti"`
+	Token string `json:"token"`
+}
+
+func (rTR *revokeTokenRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+func revokeToken(w http.ResponseWriter, r *http.Request) {
+	data := &revokeTokenRequest{}
+	if err := chiRender.Bind(r, data); err != nil || (data.Jti == "" && data.Token == "") {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	revocation := models.Revocation{
+		Kind:    models.RevocationKindToken,
+		Subject: data.Jti,
+	}
+	if data.Token != "" {
+		// Token may already be expired or signed with a removed key, we only need its claims.
+		token, _, err := new(jwt.Parser).ParseUnverified(data.Token, jwt.MapClaims{})
+		if err != nil {
+			render.JSON(w, error422.StatusCode, error422)
+			return
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		revocation.Subject, _ = claims["jti"].(string)
+		revocation.ExpiresAt, _ = ClaimInt64(claims, "exp")
+		if revocation.Subject == "" {
+			render.JSON(w, error422.StatusCode, error422)
+			return
+		}
+	}
+	if err := dbStore.db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	if apperr := revoke(r.Context(), revocation); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 201, revocation)
+}
+
+func revokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	userID, err := strconv.ParseUint(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	revocation := models.Revocation{
+		Kind:      models.RevocationKindUser,
+		Subject:   strconv.FormatUint(userID, 10),
+		ExpiresAt: ExpireIn(refreshTokenLifetime),
+	}
+	if apperr := store.RefreshToken().RevokeUser(r.Context(), userID, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr := revoke(r.Context(), revocation); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 201, revocation)
+}
+
+func revokeOrganisationTokens(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisationID, err := strconv.ParseUint(chi.URLParam(r, "organisationID"), 10, 64)
+	if err != nil {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	revocation := models.Revocation{
+		Kind:      models.RevocationKindOrganisation,
+		Subject:   strconv.FormatUint(organisationID, 10),
+		ExpiresAt: ExpireIn(refreshTokenLifetime),
+	}
+	if apperr := store.RefreshToken().RevokeOrganisation(r.Context(), organisationID, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr := revoke(r.Context(), revocation); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 201, revocation)
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	oldAllowedEmailDomainKey key = "oldAllowedEmailDomain"
+)
+
+// initAllowedEmailDomainRoute set allowed email domain routes of an organisation. It has to be called inside /organisation/{organisationID}.
+func initAllowedEmailDomainRoute(router chi.Router) {
+	router.Route("/domains", func(r chi.Router) {
+		r.Use(RequirePermission(models.PermissionManage))
+		// swagger:route GET /organisation/{organisationID}/domains Organisations getAllowedEmailDomains
+		//
+		// Get allowed email domains
+		//
+		// This will return the email domains whose users can join the organisation without invitation.
+		//
+		// 	Responses:
+		//    200: allowedEmailDomainArraySuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Get("/", getAllowedEmailDomains)
+		// swagger:route POST /organisation/{organisationID}/domains Organisations newAllowedEmailDomain
+		//
+		// New allowed email domain
+		//
+		// This will allow users with an email in the domain to join the organisation. Internationalised domains
+		// can be given in unicode or punycode, they are stored in punycode.
+		//
+		// 	Responses:
+		//    201: allowedEmailDomainObjectSuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  409: alreadyExist
+		// 	  422: wrongEntity
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/", newAllowedEmailDomain)
+		r.Route("/:domainID", func(r chi.Router) {
+			r.Use(allowedEmailDomainContext)
+			// swagger:route PUT /organisation/{organisationID}/domains/{domainID} Organisations updateAllowedEmailDomain
+			//
+			// Update allowed email domain
+			//
+			// This will change whether subdomains are allowed too.
+			//
+			// 	Responses:
+			//    200: allowedEmailDomainObjectSuccess
+			// 	  403: forbidden
+			// 	  404: notFound
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Put("/", updateAllowedEmailDomain)
+			// swagger:route DELETE /organisation/{organisationID}/domains/{domainID} Organisations deleteAllowedEmailDomain
+			//
+			// Delete allowed email domain
+			//
+			// This will stop users of the domain from joining without invitation. Existing users are kept.
+			//
+			// 	Responses:
+			//    200: allowedEmailDomainObjectSuccess
+			// 	  403: forbidden
+			// 	  404: notFound
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Delete("/", deleteAllowedEmailDomain)
+		})
+	})
+}
+
+func allowedEmailDomainContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "domainID"), 10, 64)
+		if err != nil {
+			render.JSON(w, error404.StatusCode, error404)
+			return
+		}
+		oldAllowedEmailDomain, apperr := datastores.Store().AllowedEmailDomain().GetByID(r.Context(), id, dbStore.db)
+		if apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+		ctx := context.WithValue(r.Context(), oldAllowedEmailDomainKey, oldAllowedEmailDomain)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// emailDomainAllowed state if email belongs to an allowed email domain of organisation
+func emailDomainAllowed(ctx context.Context, IDOrganisation uint64, email string) (bool, *utils.AppError) {
+	allowedEmailDomains, apperr := datastores.Store().AllowedEmailDomain().GetMatching(ctx, email, dbStore.db)
+	if apperr != nil {
+		return false, apperr
+	}
+	for _, allowedEmailDomain := range allowedEmailDomains {
+		if allowedEmailDomain.IDOrganisation == IDOrganisation {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// requestAllowedEmailDomain get allowed email domain of the url. It writes the error and returns false if the domain
+// does not exist or is not in the organisation of the url and of the request token.
+func requestAllowedEmailDomain(w http.ResponseWriter, r *http.Request) (models.AllowedEmailDomain, bool) {
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	allowedEmailDomain := r.Context().Value(oldAllowedEmailDomainKey).(models.AllowedEmailDomain)
+	if allowedEmailDomain.IDOrganisation != organisation.IDOrganisation {
+		render.JSON(w, error404.StatusCode, error404)
+		return allowedEmailDomain, false
+	}
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return allowedEmailDomain, false
+	}
+	return allowedEmailDomain, true
+}
+
+func getAllowedEmailDomains(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	allowedEmailDomains, apperr := store.AllowedEmailDomain().GetByOrganisation(r.Context(), organisation.IDOrganisation, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, allowedEmailDomains)
+}
+
+func newAllowedEmailDomain(w http.ResponseWriter, r *http.Request) {
+	var AllowedEmailDomain models.AllowedEmailDomain
+	store := datastores.Store()
+	db := dbStore.db
+	err := chiRender.Bind(r, &AllowedEmailDomain)
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err != nil || AllowedEmailDomain.Domain == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	allowedEmailDomain := models.AllowedEmailDomain{
+		IDOrganisation:    organisation.IDOrganisation,
+		Domain:            AllowedEmailDomain.Domain,
+		IncludeSubdomains: AllowedEmailDomain.IncludeSubdomains,
+	}
+	if apperr := store.AllowedEmailDomain().Save(r.Context(), &allowedEmailDomain, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 201, allowedEmailDomain)
+}
+
+func updateAllowedEmailDomain(w http.ResponseWriter, r *http.Request) {
+	var AllowedEmailDomain models.AllowedEmailDomain
+	store := datastores.Store()
+	db := dbStore.db
+	err := chiRender.Bind(r, &AllowedEmailDomain)
+	allowedEmailDomain, ok := requestAllowedEmailDomain(w, r)
+	if !ok {
+		return
+	}
+	if err != nil {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	if apperr := store.AllowedEmailDomain().Update(r.Context(), &allowedEmailDomain, AllowedEmailDomain.IncludeSubdomains, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, allowedEmailDomain)
+}
+
+func deleteAllowedEmailDomain(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	allowedEmailDomain, ok := requestAllowedEmailDomain(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	if apperr := store.AllowedEmailDomain().Delete(r.Context(), &allowedEmailDomain, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, allowedEmailDomain)
+}
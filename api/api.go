@@ -9,11 +9,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/jinzhu/gorm"
 	"github.com/pressly/chi"
 	"github.com/pressly/chi/middleware"
+	chiRender "github.com/pressly/chi/render"
 	"github.com/titouanfreville/popcubeexternalapi/configs"
 	"github.com/titouanfreville/popcubeexternalapi/datastores"
 	"github.com/titouanfreville/popcubeexternalapi/models"
@@ -25,6 +28,29 @@ type saveDb struct {
 	db *gorm.DB
 }
 
+const (
+	// userTokenLifetime duration of userauth tokens. They are short lived, use refresh token to get new ones.
+	userTokenLifetime = 15 * time.Minute
+	// refreshTokenLifetime duration of refresh tokens
+	refreshTokenLifetime = 30 * 24 * time.Hour
+	// invitationTokenLifetime duration of invitation tokens
+	invitationTokenLifetime = 7 * 24 * time.Hour
+	// newOrganisationTokenLifetime duration of neworganisation tokens
+	newOrganisationTokenLifetime = 7 * 24 * time.Hour
+	// verifyEmailTokenLifetime duration of email verification tokens
+	verifyEmailTokenLifetime = 24 * time.Hour
+	// passwordResetTokenLifetime duration of password reset tokens
+	passwordResetTokenLifetime = 30 * time.Minute
+	// mfaPendingTokenLifetime time left to users to give their TOTP code after their password
+	mfaPendingTokenLifetime = 5 * time.Minute
+	// oauthCodeLifetime time left to OAuth clients to exchange an authorization code
+	oauthCodeLifetime = time.Minute
+	// oauthAccessTokenLifetime duration of access tokens given to OAuth clients
+	oauthAccessTokenLifetime = 15 * time.Minute
+	// federationStateLifetime time left to users to login on the identity provider of their organisation
+	federationStateLifetime = 10 * time.Minute
+)
+
 // Key type to be sure the context key is the one we want.
 type key string
 
@@ -44,16 +70,39 @@ var (
 	secret           string
 	hmacSampleSecret []byte
 	tokenAuth        *JwtAuth
+	tokenIssuer      string
 	userToken        *jwt.Token
 	encoding         = base32.NewEncoding("ybndrfg8ejkmcpqxot1uwisza345h769")
 	render           = renderPackage.New()
 	routes           = flag.Bool("routes", false, "Generate router documentation")
 	dbStore          = saveDb{}
 	error401         = utils.NewAPIError(401, "unauthorized", "You did not login into the app. Please login to access those resources")
+	error403         = utils.NewAPIError(403, "forbidden", "You don't have the right to access this resource.")
+	error404         = utils.NewAPIError(404, "not.found", "Requested resource does not exist.")
+	error409         = utils.NewAPIError(409, "conflict", "Resource conflicts with an existing one.")
 	error422         = utils.NewAPIError(422, "parse.request.body", "Request json object not correct.")
 	error503         = utils.NewAPIError(503, "database.maintenance", "Database is currently in maintenance state. We are doing our best to get it back online ASAP.")
+	error504         = utils.NewAPIError(504, "request.timeout", "Request took too long to be answered. Please try again later.")
+	// errorEmailNotVerified login refused because organisation requires verified emails
+	errorEmailNotVerified = utils.NewAPIError(403, "email.not.verified", "Your organisation requires a verified email to login. Please check your mailbox.")
 )
 
+// renderAppError answer an error. Datastore errors are answered the same way whatever datastore is used.
+func renderAppError(w http.ResponseWriter, apperr *utils.AppError) {
+	switch apperr.Kind {
+	case utils.ErrorNotFound:
+		render.JSON(w, error404.StatusCode, error404)
+	case utils.ErrorConflict:
+		render.JSON(w, error409.StatusCode, error409)
+	case utils.ErrorUnavailable:
+		render.JSON(w, error503.StatusCode, error503)
+	case utils.ErrorTimeout:
+		render.JSON(w, error504.StatusCode, error504)
+	default:
+		render.JSON(w, apperr.StatusCode, apperr)
+	}
+}
+
 func newRandomString(length int) string {
 	var b bytes.Buffer
 	str := make([]byte, length+8)
@@ -65,10 +114,9 @@ func newRandomString(length int) string {
 	return b.String()
 }
 
-func generateNewOrganisationToken(organisation models.Organisation, owner models.User) {
-	hmacSampleSecret = []byte(secret)
-	tokenAuth = New("HS256", hmacSampleSecret, hmacSampleSecret)
-	claims := jwt.MapClaims{
+// generateNewOrganisationToken create the token letting its bearer create organisation and its owner once.
+func generateNewOrganisationToken(organisation models.Organisation, owner models.User) (string, error) {
+	claims := Claims{
 		"organisation_name":   organisation.OrganisationName,
 		"organisation_stack":  organisation.DockerStack,
 		"organisation_domain": organisation.Domain,
@@ -79,38 +127,51 @@ func generateNewOrganisationToken(organisation models.Organisation, owner models
 		"authorise":           "this token let you create new organisation and a new user in an iner DB",
 		"randomValue":         newRandomString(20),
 	}
-	unsignedToken := *jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := unsignedToken.SignedString(hmacSampleSecret)
-	log.Print("Tolken new organisation && role : ")
-	log.Print(tokenString)
+	claims.SetIssuedNow().SetExpiryIn(newOrganisationTokenLifetime)
+	_, tokenString, err := tokenAuth.Encode(claims)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// GenerateNewOrganisationToken create a neworganisation token outside of a running api (used by command line).
+func GenerateNewOrganisationToken(organisation models.Organisation, owner models.User) (string, error) {
+	if tokenAuth == nil {
+		_, _, secret = configs.InitConfig()
+		requireSigningSecret()
+		initAuth()
+	}
+	return generateNewOrganisationToken(organisation, owner)
 }
 
 // createUserToken create JWT auth token for current login user
-// func createUserToken(user models.User, role models.Role) (string, error) {
-// 	claims := jwt.MapClaims{
-// 		"name":  user.Username,
-// 		"email": user.Email,
-// 		"type":  "userauth",
-// 	}
-// 	unsignedToken := *jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-// 	tokenString, err := unsignedToken.SignedString(hmacSampleSecret)
-
-// 	if err != nil {
-// 		return "", err
-// 	}
-
-// 	return tokenString, nil
-// }
+func createUserToken(user models.User) (string, error) {
+	claims := Claims{
+		"name":            user.Username,
+		"email":           user.Email,
+		"user_id":         user.IDUser,
+		"organisation_id": user.IDOrganisation,
+		"type":            "userauth",
+	}
+	claims.SetIssuedNow().SetExpiryIn(userTokenLifetime)
+	_, tokenString, err := tokenAuth.Encode(claims)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
 
-// createInviteToken create JWT auth token for current invitation
-func createInviteToken(inviteMail string, organisationName string) (string, error) {
-	claims := jwt.MapClaims{
-		"email":        inviteMail,
-		"organisation": organisationName,
-		"type":         "invitation",
+// createInviteToken create JWT auth token for current invitation. Token expire with the invitation.
+func createInviteToken(invitation models.Invitation, organisationName string) (string, error) {
+	claims := Claims{
+		"email":         invitation.Email,
+		"organisation":  organisationName,
+		"invitation_id": invitation.IDInvitation,
+		"type":          "invitation",
 	}
-	unsignedToken := *jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := unsignedToken.SignedString(hmacSampleSecret)
+	claims.SetIssuedNow().SetExpiry(time.Unix(invitation.ExpiresAt, 0))
+	_, tokenString, err := tokenAuth.Encode(claims)
 
 	if err != nil {
 		return "", err
@@ -119,6 +180,70 @@ func createInviteToken(inviteMail string, organisationName string) (string, erro
 	return tokenString, nil
 }
 
+// tokenClaims get claims of the token verified for current request
+func tokenClaims(r *http.Request) jwt.MapClaims {
+	if token, ok := r.Context().Value(jwtTokenKey).(*jwt.Token); ok && token != nil {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			return claims
+		}
+	}
+	return jwt.MapClaims{}
+}
+
+// initAuth initialise the JWT authenticator used to sign and verify tokens.
+// HS256 use the shared secret. Other algorithms load PEM keys, so inner stacks only need public keys. Previous keys
+// and secrets still verify tokens they signed, so keys and secrets can be rotated.
+func initAuth() {
+	keyInfo := configs.InitJwtConfig()
+	var current *Key
+	var err error
+	if keyInfo.SigningKey == "" {
+		hmacSampleSecret = []byte(secret)
+		current, err = NewHMACKey(keyInfo.KeyID, keyInfo.Algorithm, hmacSampleSecret)
+	} else {
+		current, err = LoadKeyFromPEM(keyInfo.KeyID, keyInfo.Algorithm, keyInfo.SigningKey)
+	}
+	if err != nil {
+		log.Fatal("Can't load jwt signing key: " + err.Error())
+	}
+	previous := []*Key{}
+	for _, keyPath := range keyInfo.VerificationKeys {
+		kid := ""
+		if i := strings.Index(keyPath, "="); i >= 0 {
+			kid, keyPath = keyPath[:i], keyPath[i+1:]
+		}
+		key, err := LoadKeyFromPEM(kid, "", keyPath)
+		if err != nil {
+			log.Fatal("Can't load jwt verification key " + keyPath + ": " + err.Error())
+		}
+		previous = append(previous, key)
+	}
+	// Previous secrets verify tokens with the HMAC algorithm in use, or HS256 default one when api moved to keys.
+	hmacAlgorithm := keyInfo.Algorithm
+	if _, ok := jwt.GetSigningMethod(hmacAlgorithm).(*jwt.SigningMethodHMAC); !ok {
+		hmacAlgorithm = "HS256"
+	}
+	for _, previousSecret := range keyInfo.PreviousSecrets {
+		key, err := NewHMACKey("", hmacAlgorithm, []byte(previousSecret))
+		if err != nil {
+			log.Fatal("Can't use jwt previous secret: " + err.Error())
+		}
+		previous = append(previous, key)
+	}
+	tokenAuth = NewWithKeyring(NewKeyring(current, previous...))
+	tokenAuth.SetRevocationChecker(revocations)
+	tokenIssuer = keyInfo.Issuer
+	operatorKey = configs.InitOperatorConfig()
+}
+
+// requireSigningSecret stop api when tokens would be signed with the dev secret anyone can read in the sources,
+// unless it runs in dev mode.
+func requireSigningSecret() {
+	if !configs.SigningSecretConfigured() && !configs.DevMode() {
+		log.Fatal("No jwt secret or key set: set POPCUBESECRET or POPCUBE_JWT_KEY, or POPCUBE_DEV_MODE=true to use the dev secret.")
+	}
+}
+
 // newRouter initialise api serveur.
 func newRouter() *chi.Mux {
 	return chi.NewRouter()
@@ -131,7 +256,7 @@ func initMiddleware(router *chi.Mux) {
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.StripSlashes)
-	router.Use(middleware.Timeout(5 * 1000))
+	router.Use(middleware.Timeout(5 * time.Second))
 	router.Use(middleware.Heartbeat("/heartbeat"))
 	router.Use(middleware.CloseNotify)
 }
@@ -140,9 +265,27 @@ func initMiddleware(router *chi.Mux) {
 func initVersionRouting(router *chi.Mux) {
 	router.Route("/alpha", func(router chi.Router) {
 		router.Use(apiVersionContext("alpha"))
+		// swagger:route POST /login Login login
+		//
+		// Try to log user in
+		//
+		// Login user with provided USERNAME or EMAIL && Password. If user enabled two-factor authentication,
+		// answer is a short lived mfa_pending token to exchange on /auth/mfa/verify with a TOTP code.
+		//
+		// Responses:
+		// 		200: loginOk
+		// 		404: incorrectIds
+		// 	  422: wrongEntity
+		// 	  503: databaseError
+		// 	  default: genericError
+		router.Post("/login", loginMiddleware)
+		initAuthRoute(router)
+		initAdminRoute(router)
 		initOrganisationRoute(router)
+		initInvitationRoute(router)
 		// basicRoutes(router)
 		initUserRoute(router)
+		initDiscoverRoute(router)
 		initDevGetter(router)
 	})
 }
@@ -195,43 +338,25 @@ func basicRoutes(router *chi.Mux) {
 	router.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
 		panic("C'est la panique, panique, panique. Sur le périphérique")
 	})
-	// swagger:route POST /login Login login
-	//
-	// Try to log user in
-	//
-	// Login user with provided USERNAME && Password
-	//
-	// Responses:
-	// 		200: loginOk
-	// 		404: incorrectIds
-	// 	  422: wrongEntity
-	// 	  503: databaseError
-	// 	  default: genericError
-	// router.Post("/login", loginMiddleware)
-	// swagger:route POST /initorganisation Init initOrganisation
-	//
-	// Try to log user in
-	//
-	// Login user with provided USERNAME && Password
-	//
-	// Responses:
-	// 		200: initOk
-	// 	  503: databaseError
-	// 	  default: genericError
-	// router.Post("/initorganisation", initOrganisation)
+	router.Route("/initorganisation", func(r chi.Router) {
+		r.Use(tokenAuth.Verifier)
+		// swagger:route POST /initorganisation Init initOrganisation
+		//
+		// Init organisation
+		//
+		// Create organisation and its owner from a neworganisation token. Token can only be used once.
+		// Response contains owner first login password.
+		//
+		// Responses:
+		// 		201: initOk
+		// 		401: unauthorized
+		// 		409: alreadyExist
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/", initOrganisation)
+	})
 	// router.Route("/publicuser", func(r chi.Router) {
-	// swagger:route POST /publicuser/new Users newPublicUser
-	//
-	// New user
-	//
-	// This will create an user for organisation if organisation is Public OR Email match parametetered emails
-	//
-	// 	Responses:
-	//    201: userObjectSuccess
-	// 	  422: wrongEntity
-	// 	  503: databaseError
-	// 	  default: genericError
-	// r.Post("/new", newPublicUser)
+	// Public signup is POST /organisation/{organisationName}/signup.
 	// r.Route("/newfrominvite", func(r chi.Router) {
 	// 	r.Use(tokenAuth.Verifier)
 	// 	r.Use(allowUserCreationFromToken)
@@ -273,136 +398,156 @@ func (lR *loginRequest) Bind(r *http.Request) error {
 	return nil
 }
 
+// loginOk response send back on successful login
+type loginOk struct {
+	User         models.User `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
+}
+
+// mfaRequiredOk response send back on successful password check when user has two-factor authentication
+type mfaRequiredOk struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
 // loginMiddleware login funcion providing user && jwt auth token
-// func loginMiddleware(w http.ResponseWriter, r *http.Request) {
-// 	// var data struct {
-// 	// 	Login    string      `json:"login"`
-// 	// 	Password string      `json:"password"`
-// 	// 	OmitID   interface{} `json:"id,omitempty"`
-// 	// }
-// 	store := datastores.Store()
-// 	response := loginOk{}
-// 	db := dbStore.db
-// 	data := &loginRequest{}
-// 	err := chiRender.Bind(r, data)
-// 	if err != nil {
-// 		log.Print("422 Here - loginMiddleware")
-// 		render.JSON(w, error422.StatusCode, error422)
-// 		return
-// 	}
-// 	if err := db.DB().Ping(); err == nil {
-// 		user, err := store.User().Login(data.Login, data.Password, db)
-// 		if err == nil {
-// 			var terr error
-// 			// role can't be empty if user exist => foreign key constraint
-// 			role := datastores.Store().Role().GetByID(user.IDRole, dbStore.db)
-// 			response.User = user
-// 			response.Token, terr = createUserToken(user, role)
-// 			if terr == nil {
-// 				render.JSON(w, 200, response)
-// 				return
-// 			}
-// 			render.JSON(w, 422, "Could not generate token")
-// 		}
-// 		render.JSON(w, err.StatusCode, err)
-// 		return
-// 	}
-// 	render.JSON(w, error503.StatusCode, error503)
+func loginMiddleware(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &loginRequest{}
+	err := chiRender.Bind(r, data)
+	if err != nil || data.Login == "" || data.Password == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := store.User().Login(r.Context(), data.Login, data.Password, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	organisation, apperr := store.Organisation().GetByID(r.Context(), user.IDOrganisation, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if !user.EmailVerified && organisation.RequireVerifiedEmail {
+		render.JSON(w, errorEmailNotVerified.StatusCode, errorEmailNotVerified)
+		return
+	}
+	if user.MFAEnabled {
+		token, err := createMFAPendingToken(user)
+		if err != nil {
+			render.JSON(w, 422, "Could not generate token")
+			return
+		}
+		render.JSON(w, 200, mfaRequiredOk{MFARequired: true, MFAToken: token, ExpiresAt: ExpireIn(mfaPendingTokenLifetime)})
+		return
+	}
+	completeLogin(w, r, user)
+}
 
-// }
+// completeLogin send back userauth and refresh tokens to a fully authenticated user
+func completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	store := datastores.Store()
+	db := dbStore.db
+	response := loginOk{User: user}
+	var err error
+	response.Token, err = createUserToken(user)
+	if err != nil {
+		render.JSON(w, 422, "Could not generate token")
+		return
+	}
+	clearToken, refreshToken := newRefreshToken(user, newRandomString(26))
+	if apperr := store.RefreshToken().Save(r.Context(), &refreshToken, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	response.RefreshToken = clearToken
+	render.JSON(w, 200, response)
+}
 
-// func initOrganisation(w http.ResponseWriter, r *http.Request) {
-// 	// Verify token
-// 	ctx := r.Context()
-// 	if jwtErr, ok := ctx.Value(jwtErrorKey).(error); ok {
-// 		if jwtErr != nil {
-// 			render.JSON(w, 401, "Token not found. You Are not allowed to proceed without token.")
-// 			return
-// 		}
-// 	}
-// 	jwtToken, ok := ctx.Value(jwtTokenKey).(*jwt.Token)
-// 	if !ok || jwtToken == nil || !jwtToken.Valid {
-// 		render.JSON(w, 401, "token is not valid or does not exist")
-// 		return
-// 	}
-// 	tokenType, ok := jwtToken.Claims.(jwt.MapClaims)["type"]
-// 	if !ok {
-// 		render.JSON(w, 401, "Token is not valid. Type is undifined")
-// 		return
-// 	}
-// 	if tokenType != "neworganisation" {
-// 		render.JSON(w, 401, "Token is not an init organisation one")
-// 		return
-// 	}
-// 	// Token passed. Initialising organisation
-// 	store := datastores.Store()
-// 	db := dbStore.db
-// 	organisation := models.Organisation{
-// 		OrganisationName: jwtToken.Claims.(jwt.MapClaims)["organisation_name"].(string),
-// 		DockerStack:      jwtToken.Claims.(jwt.MapClaims)["organisation_stack"].(int),
-// 		Domain:           jwtToken.Claims.(jwt.MapClaims)["organisation_domain"].(string),
-// 		Public:           jwtToken.Claims.(jwt.MapClaims)["public"].(bool),
-// 	}
-// 	user := models.User{
-// 		Username: jwtToken.Claims.(jwt.MapClaims)["owner"].(string),
-// 		Email:    jwtToken.Claims.(jwt.MapClaims)["owner_mail"].(string),
-// 		Password: jwtToken.Claims.(jwt.MapClaims)["owner_password"].(string),
-// 		// Owner role should always have ID 1 as it is the first one created into the DB.
-// 		IDRole: 1,
-// 	}
-// 	if err := db.DB().Ping(); err != nil {
-// 		render.JSON(w, error503.StatusCode, error503)
-// 		return
-// 	}
-// 	appErr := store.Organisation().Save(&organisation, db)
-// 	if appErr != nil {
-// 		render.JSON(w, appErr.StatusCode, appErr)
-// 		return
-// 	}
-// 	appErr = store.User().Save(&user, db)
-// 	if appErr != nil {
-// 		render.JSON(w, appErr.StatusCode, appErr)
-// 		return
-// 	}
-// 	res := initOk{
-// 		Organisation: organisation,
-// 		Owner:        user,
-// 	}
-// 	render.JSON(w, 201, res)
-// }
+// initOk response send back when organisation is initialised
+type initOk struct {
+	Organisation models.Organisation `json:"organisation"`
+	Owner        models.User         `json:"owner"`
+	// Owner first login password. Owner should change it.
+	Password string `json:"password"`
+}
 
-// func newPublicUser(w http.ResponseWriter, r *http.Request) {
-// 	var User models.User
-// 	store := datastores.Store()
-// 	db := dbStore.db
-// 	err := chiRender.Bind(r, &User)
-// 	organisation := store.Organisation().Get(db)
-// 	allowedWebMails := store.AllowedWebMails().GetAll(db)
-// 	isAuthorizedMail := false
-// 	for _, authorizedMail := range allowedWebMails {
-// 		filter := "*" + authorizedMail.Domain
-// 		ok, _ := regexp.MatchString(filter, User.Email)
-// 		isAuthorizedMail = isAuthorizedMail || ok
-// 	}
-// 	if !isAuthorizedMail && !organisation.Public {
-// 		render.JSON(w, 401, "You can't sign up if organisation is not public or your email domain was unauthorized.")
-// 	}
-// 	if err != nil || User == (models.EmptyUser) {
-// 		log.Print("422 here. New Public User")
-// 		render.JSON(w, error422.StatusCode, error422)
-// 	} else {
-// 		if err := db.DB().Ping(); err == nil {
-// 			err := store.User().Save(&User, db)
-// 			if err == nil {
-// 				render.JSON(w, 201, User)
-// 			} else {
-// 				render.JSON(w, err.StatusCode, err)
-// 			}
-// 		} else {
-// 			render.JSON(w, error503.StatusCode, error503)
-// 		}
-// 	}
-// }
+func initOrganisation(w http.ResponseWriter, r *http.Request) {
+	// Verify token
+	ctx := r.Context()
+	if jwtErr, ok := ctx.Value(jwtErrorKey).(error); ok {
+		if jwtErr != nil {
+			render.JSON(w, 401, "Token not found. You Are not allowed to proceed without token.")
+			return
+		}
+	}
+	jwtToken, ok := ctx.Value(jwtTokenKey).(*jwt.Token)
+	if !ok || jwtToken == nil || !jwtToken.Valid {
+		render.JSON(w, 401, "token is not valid or does not exist")
+		return
+	}
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	tokenType, ok := claims["type"]
+	if !ok {
+		render.JSON(w, 401, "Token is not valid. Type is undifined")
+		return
+	}
+	if tokenType != "neworganisation" {
+		render.JSON(w, 401, "Token is not an init organisation one")
+		return
+	}
+	jti, _ := claims["jti"].(string)
+	exp, _ := ClaimInt64(claims, "exp")
+	stack, _ := ClaimInt64(claims, "organisation_stack")
+	if jti == "" {
+		render.JSON(w, 401, "Token is not valid. Id is undifined")
+		return
+	}
+	// Token passed. Initialising organisation
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := models.Organisation{
+		DockerStack: int(stack),
+	}
+	organisation.OrganisationName, _ = claims["organisation_name"].(string)
+	organisation.Domain, _ = claims["organisation_domain"].(string)
+	organisation.Public, _ = claims["public"].(bool)
+	password := newRandomString(20)
+	user := models.User{
+		Password: password,
+	}
+	user.Username, _ = claims["owner"].(string)
+	user.Email, _ = claims["owner_mail"].(string)
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	consumed := models.Revocation{
+		Kind:      models.RevocationKindToken,
+		Subject:   jti,
+		ExpiresAt: exp,
+	}
+	if apperr := store.Organisation().Bootstrap(r.Context(), &organisation, &user, &consumed, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	revocations.add(consumed)
+	sendVerificationEmail(user, r.Header.Get("Accept-Language"))
+	res := initOk{
+		Organisation: organisation,
+		Owner:        user,
+		Password:     password,
+	}
+	render.JSON(w, 201, res)
+}
 
 // StartAPI initialise the api with provided host and port.
 func StartAPI(hostname string, port string, DbConnectionInfo *configs.DbConnection) {
@@ -415,9 +560,14 @@ func StartAPI(hostname string, port string, DbConnectionInfo *configs.DbConnecti
 	host := DbConnectionInfo.Host
 	dbport := DbConnectionInfo.Port
 	dbStore.db = datastores.Store().InitConnection(user, db, pass, host, dbport)
-	// initAuth()
+	requireSigningSecret()
+	initAuth()
+	initMail()
+	federationAllowLoopback = configs.DevMode()
 	initMiddleware(router)
 	basicRoutes(router)
+	initWellKnownRoute(router)
+	initOAuthRoute(router)
 	initVersionRouting(router)
 	// Passing -routes to the program will generate docs for the above
 	// router definition. See the `routes.json` file in this folder for
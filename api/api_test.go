@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pressly/chi"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+// newTestRouter set the api up on a new memory store and give its router. Tokens are signed with a test secret.
+func newTestRouter(t *testing.T) *chi.Mux {
+	t.Helper()
+	datastores.UseStore(datastores.NewMemoryStore())
+	dbStore.db = datastores.Store().InitConnection("", "", "", "", "")
+	secret = "popcube test secret"
+	revocations = newRevocationList()
+	initAuth()
+	router := newRouter()
+	initWellKnownRoute(router)
+	initOAuthRoute(router)
+	initVersionRouting(router)
+	return router
+}
+
+// newTestOrganisation save an organisation in the test store
+func newTestOrganisation(t *testing.T, name string, public bool) models.Organisation {
+	t.Helper()
+	organisation := models.Organisation{OrganisationName: name, DockerStack: len(name), Public: public}
+	if apperr := datastores.Store().Organisation().Save(context.Background(), &organisation, dbStore.db); apperr != nil {
+		t.Fatalf("save organisation: %v", apperr)
+	}
+	return organisation
+}
+
+// newTestUser save an user of organisation with role in the test store. Password is "Password1!".
+func newTestUser(t *testing.T, organisation models.Organisation, username string, roleName string) models.User {
+	t.Helper()
+	ctx := context.Background()
+	role, apperr := datastores.Store().Role().GetByName(ctx, organisation.IDOrganisation, roleName, dbStore.db)
+	if apperr != nil {
+		t.Fatalf("get role %s: %v", roleName, apperr)
+	}
+	user := models.User{
+		Username:       username,
+		Email:          username + "@popcube.xyz",
+		EmailVerified:  true,
+		Password:       "Password1!",
+		NickName:       username,
+		IDOrganisation: organisation.IDOrganisation,
+		IDRole:         role.IDRole,
+	}
+	if apperr := datastores.Store().User().Save(ctx, &user, dbStore.db); apperr != nil {
+		t.Fatalf("save user: %v", apperr)
+	}
+	return user
+}
+
+// doJSON send body as json to router and give the recorded answer. Token is sent as bearer if not empty.
+func doJSON(router http.Handler, method string, target string, token string, body interface{}) *httptest.ResponseRecorder {
+	payload := []byte{}
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	request := httptest.NewRequest(method, target, bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// decodeBody decode the json answer of recorder in v
+func decodeBody(t *testing.T, recorder *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", recorder.Body.String(), err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "login", false)
+	alice := newTestUser(t, organisation, "alice", models.RoleMember)
+	cases := []struct {
+		name   string
+		body   map[string]string
+		status int
+		id     string
+	}{
+		{name: "username", body: map[string]string{"login": "alice", "password": "Password1!"}, status: 200},
+		{name: "email in capitals", body: map[string]string{"login": "ALICE@popcube.xyz", "password": "Password1!"}, status: 200},
+		{name: "wrong password", body: map[string]string{"login": "alice", "password": "Password2!"}, status: 404, id: "wrong.user.password"},
+		{name: "unknown user", body: map[string]string{"login": "bob", "password": "Password1!"}, status: 404, id: "wrong.user.password"},
+		{name: "missing password", body: map[string]string{"login": "alice"}, status: 422, id: error422.ID},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := doJSON(router, "POST", "/alpha/login", "", c.body)
+			if recorder.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", recorder.Code, c.status, recorder.Body.String())
+			}
+			if c.status != 200 {
+				var apperr struct{ ID string }
+				decodeBody(t, recorder, &apperr)
+				if apperr.ID != c.id {
+					t.Errorf("error %q, want %q", apperr.ID, c.id)
+				}
+				return
+			}
+			var answer loginOk
+			decodeBody(t, recorder, &answer)
+			if answer.Token == "" || answer.RefreshToken == "" || answer.User.IDUser != alice.IDUser {
+				t.Errorf("unexpected answer %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoginRequiresVerifiedEmailWhenOrganisationAsksIt(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "verified", false)
+	newTestUser(t, organisation, "alice", models.RoleMember)
+	store := datastores.Store()
+	policies := organisation
+	policies.RequireVerifiedEmail = true
+	if apperr := store.Organisation().Update(context.Background(), &organisation, &policies, dbStore.db); apperr != nil {
+		t.Fatal(apperr)
+	}
+	bob := models.User{Username: "bob", Email: "bob@popcube.xyz", NickName: "bob", Password: "Password1!", IDOrganisation: organisation.IDOrganisation}
+	if apperr := store.User().Save(context.Background(), &bob, dbStore.db); apperr != nil {
+		t.Fatal(apperr)
+	}
+	if recorder := doJSON(router, "POST", "/alpha/login", "", map[string]string{"login": "bob", "password": "Password1!"}); recorder.Code != errorEmailNotVerified.StatusCode {
+		t.Errorf("unverified user logged in: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := doJSON(router, "POST", "/alpha/login", "", map[string]string{"login": "alice", "password": "Password1!"}); recorder.Code != 200 {
+		t.Errorf("verified user can't login: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+// login log user in and give its tokens
+func login(t *testing.T, router http.Handler, username string) loginOk {
+	t.Helper()
+	recorder := doJSON(router, "POST", "/alpha/login", "", map[string]string{"login": username, "password": "Password1!"})
+	if recorder.Code != 200 {
+		t.Fatalf("login %s: %d %s", username, recorder.Code, recorder.Body.String())
+	}
+	answer := loginOk{}
+	decodeBody(t, recorder, &answer)
+	return answer
+}
+
+func TestInitOrganisation(t *testing.T) {
+	router := newTestRouter(t)
+	basicRoutes(router)
+	newTestOrganisation(t, "taken", false)
+	for name, want := range map[string]int{"created": 201, "taken": error409.StatusCode} {
+		organisation := models.Organisation{OrganisationName: name, DockerStack: len(name)}
+		owner := models.User{Username: "owner", Email: "owner@" + name + ".xyz"}
+		token, err := generateNewOrganisationToken(organisation, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := doJSON(router, "POST", "/initorganisation", token, nil)
+		if recorder.Code != want {
+			t.Errorf("%s: status %d, want %d: %s", name, recorder.Code, want, recorder.Body.String())
+		}
+		if want == error409.StatusCode {
+			apperr := struct{ ID string }{}
+			decodeBody(t, recorder, &apperr)
+			if apperr.ID != error409.ID {
+				t.Errorf("%s: store error was sent back: %s", name, recorder.Body.String())
+			}
+		}
+	}
+}
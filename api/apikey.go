@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+const (
+	// apiKeyHeader header carrying API keys of service accounts
+	apiKeyHeader = "X-API-Key"
+	// apiKeyTouchPeriod minimal time between two updates of the last use date of a key, so each request does not write
+	apiKeyTouchPeriod = time.Minute
+)
+
+// APIKeyVerifier middleware will verify an API key passed in X-API-Key header.
+// It sets in context the same "jwt" and "jwt.err" values as Verify, with claims describing the service account,
+// so Authenticator and handlers work the same whatever credential was used. It has to be used after Verifier.
+// Requests without API key are left untouched.
+func APIKeyVerifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clearKey := r.Header.Get(apiKeyHeader)
+		if clearKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := verifyAPIKey(r.Context(), clearKey)
+		ctx := tokenAuth.SetContext(r.Context(), token, err)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// verifyAPIKey check an API key and build the token describing its service account.
+// Token "iat" is the key creation date, so revoking the organisation tokens also revokes older keys.
+func verifyAPIKey(ctx context.Context, clearKey string) (*jwt.Token, error) {
+	prefix := models.APIKeyPrefixOf(clearKey)
+	if prefix == "" {
+		return nil, ErrUnauthorized
+	}
+	store := datastores.Store()
+	db := dbStore.db
+	if db == nil || db.DB().Ping() != nil {
+		return nil, ErrUnauthorized
+	}
+	apiKey, apperr := store.ServiceAccount().GetAPIKeyByPrefix(ctx, prefix, db)
+	if apperr != nil || subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(models.HashToken(clearKey))) != 1 {
+		return nil, ErrUnauthorized
+	}
+	if apiKey.Revoked {
+		return nil, ErrRevoked
+	}
+	if apiKey.IsExpired() {
+		return nil, ErrExpired
+	}
+	serviceAccount, apperr := store.ServiceAccount().GetByID(ctx, apiKey.IDServiceAccount, db)
+	if apperr != nil || serviceAccount.Disabled {
+		return nil, ErrRevoked
+	}
+	if now := EpochNow(); now-apiKey.LastUsedAt >= int64(apiKeyTouchPeriod.Seconds()) {
+		store.ServiceAccount().TouchAPIKey(ctx, &apiKey, now, db)
+	}
+	token := &jwt.Token{
+		Claims: jwt.MapClaims{
+			"name":               serviceAccount.Name,
+			"service_account_id": serviceAccount.IDServiceAccount,
+			"api_key_id":         apiKey.IDAPIKey,
+			"organisation_id":    serviceAccount.IDOrganisation,
+			"scope":              apiKey.Scopes,
+			"type":               "userauth",
+			"jti":                apiKey.Prefix,
+			"iat":                apiKey.CreatedAt,
+		},
+		Valid: true,
+	}
+	if tokenAuth.IsRevoked(token) {
+		return token, ErrRevoked
+	}
+	return token, nil
+}
+
+// newAPIKey generate an API key for service account. It returns the clear key to send once and the model to store.
+func newAPIKey(serviceAccount models.ServiceAccount) (string, models.APIKey) {
+	prefix := models.APIKeyPrefix + newRandomString(models.APIKeyPrefixLength-len(models.APIKeyPrefix))
+	clearKey := prefix + "_" + newRandomString(32)
+	return clearKey, models.APIKey{
+		IDServiceAccount: serviceAccount.IDServiceAccount,
+		Prefix:           prefix,
+		KeyHash:          models.HashToken(clearKey),
+	}
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	errorInvalidRefreshToken  = utils.NewAPIError(401, "refresh.token.invalid", "Refresh token is invalid, expired or was revoked. Please login again.")
+	errorInvalidPasswordReset = utils.NewAPIError(401, "password.reset.invalid", "Password reset link is invalid, expired or was already used.")
+	errorInvalidPassword      = utils.NewAPIError(422, "password.invalid", "Password must be between 8 and 72 characters long.")
+	// passwordResetEmailThrottle limit password reset emails sent to an address
+	passwordResetEmailThrottle = newThrottle(3, time.Hour)
+	// passwordResetIPThrottle limit password reset emails asked from an address
+	passwordResetIPThrottle = newThrottle(20, time.Hour)
+)
+
+func initAuthRoute(router chi.Router) {
+	router.Route("/auth", func(r chi.Router) {
+		// swagger:route POST /auth/refresh Auth refreshToken
+		//
+		// Refresh access token
+		//
+		// Exchange a refresh token for a new access token and a new refresh token. A refresh token can only be used once,
+		// using it again will revoke every token from the same login.
+		//
+		// 	Responses:
+		//    200: loginOk
+		// 	  401: invalidRefreshToken
+		// 	  422: wrongEntity
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/refresh", refreshToken)
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			// swagger:route POST /auth/logout Auth logout
+			//
+			// Logout
+			//
+			// Revoke provided refresh token and all tokens obtained from the same login. Access token sent as
+			// bearer is revoked too, so it stops working before it expires.
+			//
+			// 	Responses:
+			//    200: generalOk
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/logout", logout)
+		})
+		// swagger:route POST /auth/forgot Auth forgotPassword
+		//
+		// Forgot password
+		//
+		// Send a password reset link to the email if it belongs to an user. Answer is always the same,
+		// so it can not be used to know if an account exists.
+		//
+		// 	Responses:
+		//    200: generalOk
+		// 	  422: wrongEntity
+		// 	  default: genericError
+		r.Post("/forgot", forgotPassword)
+		// swagger:route POST /auth/reset Auth resetPassword
+		//
+		// Reset password
+		//
+		// Set a new password from a password reset token. Token can only be used once and every session
+		// of the user is revoked.
+		//
+		// 	Responses:
+		//    200: generalOk
+		// 	  401: invalidPasswordReset
+		// 	  422: wrongEntity
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/reset", resetPassword)
+		initMFARoute(r)
+		initFederationRoute(r)
+	})
+}
+
+// refreshTokenRequest object
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (rTR *refreshTokenRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// newRefreshToken build a refresh token for user in provided family. It returns the clear token to send to the user
+// and the model to store.
+func newRefreshToken(user models.User, family string) (string, models.RefreshToken) {
+	clearToken := newRandomString(48)
+	now := time.Now().UTC()
+	return clearToken, models.RefreshToken{
+		TokenHash: models.HashToken(clearToken),
+		Family:    family,
+		IDUser:    user.IDUser,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(refreshTokenLifetime).Unix(),
+	}
+}
+
+func refreshToken(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &refreshTokenRequest{}
+	if err := chiRender.Bind(r, data); err != nil || data.RefreshToken == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	oldToken, apperr := store.RefreshToken().GetByToken(r.Context(), data.RefreshToken, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr != nil || oldToken.Revoked || oldToken.IsExpired() {
+		render.JSON(w, errorInvalidRefreshToken.StatusCode, errorInvalidRefreshToken)
+		return
+	}
+	// Token was already exchanged: it leaked or was stolen. Kill the whole login.
+	if oldToken.Rotated {
+		store.RefreshToken().RevokeFamily(r.Context(), oldToken.Family, db)
+		render.JSON(w, errorInvalidRefreshToken.StatusCode, errorInvalidRefreshToken)
+		return
+	}
+	user, apperr := store.User().GetByID(r.Context(), oldToken.IDUser, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr != nil || user.Deleted {
+		store.RefreshToken().RevokeFamily(r.Context(), oldToken.Family, db)
+		render.JSON(w, errorInvalidRefreshToken.StatusCode, errorInvalidRefreshToken)
+		return
+	}
+	clearToken, newToken := newRefreshToken(user, oldToken.Family)
+	if apperr := store.RefreshToken().Rotate(r.Context(), &oldToken, &newToken, db); apperr != nil {
+		if apperr.StatusCode == 401 {
+			store.RefreshToken().RevokeFamily(r.Context(), oldToken.Family, db)
+			render.JSON(w, errorInvalidRefreshToken.StatusCode, errorInvalidRefreshToken)
+			return
+		}
+		renderAppError(w, apperr)
+		return
+	}
+	token, err := createUserToken(user)
+	if err != nil {
+		render.JSON(w, 422, "Could not generate token")
+		return
+	}
+	render.JSON(w, 200, loginOk{User: user, Token: token, RefreshToken: clearToken})
+}
+
+func logout(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &refreshTokenRequest{}
+	if err := chiRender.Bind(r, data); err != nil || data.RefreshToken == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	// Unknown tokens are ignored so logout can safely be called twice.
+	oldToken, apperr := store.RefreshToken().GetByToken(r.Context(), data.RefreshToken, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr == nil {
+		if apperr := store.RefreshToken().RevokeFamily(r.Context(), oldToken.Family, db); apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+	}
+	// Only a valid access token is revoked: claims of others can not be trusted.
+	jwtErr, _ := r.Context().Value(jwtErrorKey).(error)
+	claims := tokenClaims(r)
+	if jti, ok := claims["jti"].(string); ok && jwtErr == nil && claims["type"] == "userauth" {
+		exp, _ := ClaimInt64(claims, "exp")
+		if apperr := revoke(r.Context(), models.Revocation{Kind: models.RevocationKindToken, Subject: jti, ExpiresAt: exp}); apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+	}
+	render.JSON(w, 200, "Logged out.")
+}
+
+// forgotPasswordRequest object
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (fPR *forgotPasswordRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// resetPasswordRequest object
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (rPR *resetPasswordRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+func forgotPassword(w http.ResponseWriter, r *http.Request) {
+	data := &forgotPasswordRequest{}
+	if err := chiRender.Bind(r, data); err != nil || data.Email == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	email := strings.ToLower(data.Email)
+	// Throttled and failed requests get the same answer, they just do not send anything. Failures are only logged.
+	if passwordResetIPThrottle.Allow(clientIP(r)) && passwordResetEmailThrottle.Allow(email) {
+		if apperr := sendPasswordReset(r, email); apperr != nil {
+			log.Print("Could not send password reset email: " + apperr.Error())
+		}
+	}
+	render.JSON(w, 200, "If this email belongs to an account, a password reset link was sent to it.")
+}
+
+// sendPasswordReset create a password reset token for the user owning email and send it to them. Unknown and deleted
+// users are not an error.
+func sendPasswordReset(r *http.Request, email string) *utils.AppError {
+	store := datastores.Store()
+	db := dbStore.db
+	if err := db.DB().Ping(); err != nil {
+		return error503
+	}
+	user, apperr := store.User().GetByEmail(r.Context(), email, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		return apperr
+	}
+	if apperr != nil || user.Deleted {
+		return nil
+	}
+	clearToken := newRandomString(48)
+	now := time.Now().UTC()
+	passwordReset := models.PasswordReset{
+		TokenHash: models.HashToken(clearToken),
+		IDUser:    user.IDUser,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(passwordResetTokenLifetime).Unix(),
+	}
+	if apperr := store.PasswordReset().Save(r.Context(), &passwordReset, db); apperr != nil {
+		return apperr
+	}
+	sendPasswordResetEmail(user, clearToken, r.Header.Get("Accept-Language"))
+	return nil
+}
+
+func resetPassword(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &resetPasswordRequest{}
+	if err := chiRender.Bind(r, data); err != nil || data.Token == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if !models.IsValidPassword(data.Password) {
+		render.JSON(w, errorInvalidPassword.StatusCode, errorInvalidPassword)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	passwordReset, apperr := store.PasswordReset().GetByToken(r.Context(), data.Token, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr != nil || passwordReset.Used || passwordReset.IsExpired() {
+		render.JSON(w, errorInvalidPasswordReset.StatusCode, errorInvalidPasswordReset)
+		return
+	}
+	if apperr := store.PasswordReset().Consume(r.Context(), &passwordReset, models.HashPassword(data.Password), db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	// Access tokens issued before the reset stop working at once.
+	revoke(r.Context(), models.Revocation{
+		Kind:      models.RevocationKindUser,
+		Subject:   strconv.FormatUint(passwordReset.IDUser, 10),
+		ExpiresAt: ExpireIn(refreshTokenLifetime),
+	})
+	if user, apperr := store.User().GetByID(r.Context(), passwordReset.IDUser, db); apperr == nil {
+		sendPasswordChangedEmail(user, r.Header.Get("Accept-Language"))
+	}
+	render.JSON(w, 200, "Password was reset. Please login again.")
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "refresh", false)
+	alice := newTestUser(t, organisation, "alice", models.RoleMember)
+	first := login(t, router, "alice")
+
+	recorder := doJSON(router, "POST", "/alpha/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	if recorder.Code != 200 {
+		t.Fatalf("refresh: %d %s", recorder.Code, recorder.Body.String())
+	}
+	second := loginOk{}
+	decodeBody(t, recorder, &second)
+	if second.Token == "" || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken || second.User.IDUser != alice.IDUser {
+		t.Fatalf("unexpected refresh answer %s", recorder.Body.String())
+	}
+
+	// Exchanging a rotated token again means it was stolen: the whole login is revoked.
+	recorder = doJSON(router, "POST", "/alpha/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	if recorder.Code != errorInvalidRefreshToken.StatusCode {
+		t.Fatalf("rotated token was accepted: %d %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = doJSON(router, "POST", "/alpha/auth/refresh", "", map[string]string{"refresh_token": second.RefreshToken})
+	if recorder.Code != errorInvalidRefreshToken.StatusCode {
+		t.Fatalf("token of a revoked login was accepted: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	for _, refreshToken := range []string{"", "unknown"} {
+		recorder = doJSON(router, "POST", "/alpha/auth/refresh", "", map[string]string{"refresh_token": refreshToken})
+		if recorder.Code != 422 && recorder.Code != errorInvalidRefreshToken.StatusCode {
+			t.Errorf("refresh token %q: %d %s", refreshToken, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestPasswordResetRevokesOlderTokensOnly(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "reset", false)
+	alice := newTestUser(t, organisation, "alice", models.RoleMember)
+	before := login(t, router, "alice")
+
+	clearToken := newRandomString(48)
+	passwordReset := models.PasswordReset{TokenHash: models.HashToken(clearToken), IDUser: alice.IDUser, IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	if apperr := datastores.Store().PasswordReset().Save(context.Background(), &passwordReset, dbStore.db); apperr != nil {
+		t.Fatal(apperr)
+	}
+	if recorder := doJSON(router, "POST", "/alpha/auth/reset", "", resetPasswordRequest{Token: clearToken, Password: "Password2!"}); recorder.Code != 200 {
+		t.Fatalf("reset: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := doJSON(router, "GET", "/alpha/user", before.Token, nil); recorder.Code != 401 {
+		t.Errorf("token issued before reset still works: %d %s", recorder.Code, recorder.Body.String())
+	}
+	// Login right after the reset, in the same second as it or not, gives working tokens.
+	recorder := doJSON(router, "POST", "/alpha/login", "", map[string]string{"login": "alice", "password": "Password2!"})
+	if recorder.Code != 200 {
+		t.Fatalf("login after reset: %d %s", recorder.Code, recorder.Body.String())
+	}
+	after := loginOk{}
+	decodeBody(t, recorder, &after)
+	if recorder := doJSON(router, "GET", "/alpha/user", after.Token, nil); recorder.Code != 200 {
+		t.Errorf("token issued after reset is refused: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "logout", false)
+	newTestUser(t, organisation, "alice", models.RoleMember)
+	session, other := login(t, router, "alice"), login(t, router, "alice")
+
+	if recorder := doJSON(router, "POST", "/alpha/auth/logout", session.Token, map[string]string{"refresh_token": session.RefreshToken}); recorder.Code != 200 {
+		t.Fatalf("logout: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := doJSON(router, "GET", "/alpha/user", session.Token, nil); recorder.Code != 401 {
+		t.Errorf("access token works after logout: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := doJSON(router, "POST", "/alpha/auth/refresh", "", map[string]string{"refresh_token": session.RefreshToken}); recorder.Code != errorInvalidRefreshToken.StatusCode {
+		t.Errorf("refresh token works after logout: %d %s", recorder.Code, recorder.Body.String())
+	}
+	// Other logins of the user are kept.
+	if recorder := doJSON(router, "GET", "/alpha/user", other.Token, nil); recorder.Code != 200 {
+		t.Errorf("other login was logged out: %d %s", recorder.Code, recorder.Body.String())
+	}
+	// Logout can be called again, without access token.
+	if recorder := doJSON(router, "POST", "/alpha/auth/logout", "", map[string]string{"refresh_token": session.RefreshToken}); recorder.Code != 200 {
+		t.Errorf("second logout: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	// discoverIPThrottle limit discovery requests from an address, so it can not be used to scan emails
+	discoverIPThrottle = newThrottle(30, time.Hour)
+	// discoverEmailThrottle limit organisation emails sent to an address
+	discoverEmailThrottle = newThrottle(3, time.Hour)
+)
+
+func initDiscoverRoute(router chi.Router) {
+	router.Route("/discover", func(r chi.Router) {
+		r.Use(tokenAuth.Verifier)
+		// swagger:route POST /discover Organisations discover
+		//
+		// Discover organisations
+		//
+		// Give the organisations an email can join, with the routing information of their stack: public ones
+		// and the ones allowing its domain. Memberships and invitations are only listed to an user logged in
+		// with this email. Otherwise they are sent by email to the address, so the answer is the same whether
+		// the address has an account or not.
+		//
+		// 	Responses:
+		//    200: discoverOk
+		// 	  422: wrongEntity
+		// 	  429: tooManyRequests
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/", discover)
+	})
+}
+
+// discoverRequest object
+type discoverRequest struct {
+	Email string `json:"email"`
+}
+
+func (dR *discoverRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// discoveredOrganisation organisation an email can connect to, and why
+type discoveredOrganisation struct {
+	Name        string `json:"name"`
+	Domain      string `json:"domain,omitempty"`
+	DockerStack int    `json:"docker_stack"`
+	// Anyone can join
+	Public bool `json:"public"`
+	// Email belongs to an allowed email domain of the organisation
+	AllowedDomain bool `json:"allowed_domain"`
+	// Email has an account in the organisation. Only given to logged in users.
+	Member bool `json:"member,omitempty"`
+	// Email has a pending invitation in the organisation. Only given to logged in users.
+	Invited bool `json:"invited,omitempty"`
+}
+
+// discoverOk response send back by discovery
+type discoverOk struct {
+	Email         string                   `json:"email"`
+	Organisations []discoveredOrganisation `json:"organisations"`
+}
+
+// discoveredOrganisations collect organisations found for an email, keeping each once
+type discoveredOrganisations map[uint64]*discoveredOrganisation
+
+func (found discoveredOrganisations) add(organisation models.Organisation) *discoveredOrganisation {
+	if discovered, ok := found[organisation.IDOrganisation]; ok {
+		return discovered
+	}
+	discovered := &discoveredOrganisation{
+		Name:        organisation.OrganisationName,
+		Domain:      organisation.Domain,
+		DockerStack: organisation.DockerStack,
+		Public:      organisation.Public,
+	}
+	found[organisation.IDOrganisation] = discovered
+	return discovered
+}
+
+// byName sort discovered organisations by name
+type byName []discoveredOrganisation
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+
+// list get organisations found. Memberships and invitations are left out unless they are shown to the owner of the email.
+func (found discoveredOrganisations) list(owner bool) []discoveredOrganisation {
+	organisations := []discoveredOrganisation{}
+	for _, discovered := range found {
+		if owner {
+			organisations = append(organisations, *discovered)
+			continue
+		}
+		if discovered.Public || discovered.AllowedDomain {
+			open := *discovered
+			open.Member, open.Invited = false, false
+			organisations = append(organisations, open)
+		}
+	}
+	sort.Sort(byName(organisations))
+	return organisations
+}
+
+// private get organisations email is a member of or invited to
+func (found discoveredOrganisations) private() []discoveredOrganisation {
+	organisations := []discoveredOrganisation{}
+	for _, discovered := range found {
+		if discovered.Member || discovered.Invited {
+			organisations = append(organisations, *discovered)
+		}
+	}
+	sort.Sort(byName(organisations))
+	return organisations
+}
+
+func discover(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &discoverRequest{}
+	err := chiRender.Bind(r, data)
+	email := strings.ToLower(strings.TrimSpace(data.Email))
+	if err != nil || !models.IsValidEmail(email) {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if !discoverIPThrottle.Allow(clientIP(r)) {
+		render.JSON(w, errorTooManyRequests.StatusCode, errorTooManyRequests)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	organisations, apperr := store.Organisation().Get(r.Context(), db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	found := discoveredOrganisations{}
+	for _, organisation := range organisations {
+		if organisation.Public {
+			found.add(organisation)
+		}
+	}
+	// Organisations are all loaded already: rows pointing to an organisation which does not exist anymore are skipped.
+	byID := map[uint64]models.Organisation{}
+	for _, organisation := range organisations {
+		byID[organisation.IDOrganisation] = organisation
+	}
+	allowedEmailDomains, apperr := store.AllowedEmailDomain().GetMatching(r.Context(), email, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	for _, allowedEmailDomain := range allowedEmailDomains {
+		if organisation, ok := byID[allowedEmailDomain.IDOrganisation]; ok {
+			found.add(organisation).AllowedDomain = true
+		}
+	}
+	user, apperr := store.User().GetByEmail(r.Context(), email, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	if organisation, ok := byID[user.IDOrganisation]; apperr == nil && ok && !user.Deleted {
+		found.add(organisation).Member = true
+	}
+	invitations, apperr := store.Invitation().GetPendingByEmail(r.Context(), email, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	for _, invitation := range invitations {
+		if organisation, ok := byID[invitation.IDOrganisation]; ok {
+			found.add(organisation).Invited = true
+		}
+	}
+	claims := tokenClaims(r)
+	jwtErr, _ := r.Context().Value(jwtErrorKey).(error)
+	owner := jwtErr == nil && claims["type"] == "userauth" && claims["email"] == email
+	if private := found.private(); !owner && len(private) > 0 && discoverEmailThrottle.Allow(email) {
+		sendOrganisationsEmail(email, private, r.Header.Get("Accept-Language"))
+	}
+	render.JSON(w, 200, discoverOk{Email: email, Organisations: found.list(owner)})
+}
@@ -0,0 +1,338 @@
+package api
+
+// OpenID Connect client used to login users with the identity provider of their organisation.
+// Provider endpoints and keys are discovered from its issuer and cached. Providers are set by organisation admins:
+// they are only reached over https on public addresses, so they can not be used to call internal services.
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+const (
+	// federationHTTPTimeout maximal duration of a call to an identity provider
+	federationHTTPTimeout = 10 * time.Second
+	// federationCacheLifetime how long discovery documents and keys of providers are kept
+	federationCacheLifetime = time.Hour
+	// federationKeysRefreshPeriod minimal time between two key downloads when a token uses an unknown key
+	federationKeysRefreshPeriod = time.Minute
+	// federationMaxResponseSize maximal size of answers read from identity providers
+	federationMaxResponseSize = 1 << 20
+)
+
+var (
+	errFederationDiscovery = errors.New("federation: invalid provider discovery document")
+	errFederationToken     = errors.New("federation: token request refused")
+	errFederationIDToken   = errors.New("federation: invalid id_token")
+	errFederationAddress   = errors.New("federation: provider address is not public")
+	// federationAllowLoopback let providers be reached on the local machine over plain http, to test against a
+	// stub provider. It is only set in dev mode.
+	federationAllowLoopback = false
+	// federationClient check addresses when connecting, so names resolving to internal addresses are refused too.
+	federationClient = &http.Client{
+		Timeout: federationHTTPTimeout,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: federationHTTPTimeout, Control: federationDialControl}).DialContext,
+			TLSHandshakeTimeout: federationHTTPTimeout,
+		},
+	}
+	federationProviders = &providerCache{providers: map[string]*upstreamProvider{}}
+)
+
+// federationAddressAllowed state if an identity provider can be reached at ip: private, link local and other
+// internal addresses are refused. Loopback ones are only allowed in dev mode.
+func federationAddressAllowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return federationAllowLoopback
+	}
+	return !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// federationDialControl refuse connections to addresses identity providers can not use
+func federationDialControl(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !federationAddressAllowed(net.ParseIP(host)) {
+		return errFederationAddress
+	}
+	return nil
+}
+
+// federationEndpointAllowed state if an url given by a provider can be called: https, or plain http on the local
+// machine in dev mode. Addresses are checked when connecting.
+func federationEndpointAllowed(endpoint string) bool {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.User != nil {
+		return false
+	}
+	if parsed.Scheme == "https" {
+		return true
+	}
+	return federationAllowLoopback && models.IsValidRedirectURI(endpoint)
+}
+
+// providerMetadata part of an OpenID Connect discovery document used to login
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// upstreamProvider discovered endpoints and keys of an identity provider
+type upstreamProvider struct {
+	metadata      providerMetadata
+	keys          map[string]interface{}
+	fetchedAt     time.Time
+	keysFetchedAt time.Time
+}
+
+// providerCache providers discovered so far, by issuer
+type providerCache struct {
+	sync.Mutex
+	providers map[string]*upstreamProvider
+}
+
+// getJSON get url and decode its json answer in v
+func getJSON(target string, v interface{}) error {
+	response, err := federationClient.Get(target)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return errors.New("federation: " + target + " answered " + response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, federationMaxResponseSize)).Decode(v)
+}
+
+// fetchProviderKeys download signing keys of a provider. Keys which can not be used to verify signatures are left out.
+func fetchProviderKeys(jwksURI string) (map[string]interface{}, error) {
+	set := JSONWebKeySet{}
+	if err := getJSON(jwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// discover get endpoints and keys of the provider of issuer, from cache if they are recent enough
+func (pc *providerCache) discover(issuer string) (*upstreamProvider, error) {
+	pc.Lock()
+	provider, ok := pc.providers[issuer]
+	pc.Unlock()
+	if ok && time.Since(provider.fetchedAt) < federationCacheLifetime {
+		return provider, nil
+	}
+	if !federationEndpointAllowed(issuer) {
+		return nil, errFederationDiscovery
+	}
+	metadata := providerMetadata{}
+	if err := getJSON(issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, err
+	}
+	// OpenID Connect Discovery 1.0 section 4.3: issuer must be the one the document was asked for.
+	if strings.TrimRight(metadata.Issuer, "/") != issuer {
+		return nil, errFederationDiscovery
+	}
+	// Client secret is sent to token endpoint: endpoints must follow the same rules as the issuer.
+	for _, endpoint := range []string{metadata.AuthorizationEndpoint, metadata.TokenEndpoint, metadata.JWKSURI} {
+		if !federationEndpointAllowed(endpoint) {
+			return nil, errFederationDiscovery
+		}
+	}
+	keys, err := fetchProviderKeys(metadata.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	provider = &upstreamProvider{metadata: metadata, keys: keys, fetchedAt: now, keysFetchedAt: now}
+	pc.Lock()
+	pc.providers[issuer] = provider
+	pc.Unlock()
+	return provider, nil
+}
+
+// key get the provider key with kid. Keys are downloaded again if kid is unknown, as provider may have rotated them.
+func (pc *providerCache) key(provider *upstreamProvider, kid string) (interface{}, error) {
+	pc.Lock()
+	key, ok := provider.keys[kid]
+	stale := time.Since(provider.keysFetchedAt) >= federationKeysRefreshPeriod
+	if !ok && stale {
+		// Mark refresh now so concurrent requests with an unknown kid do not all download keys.
+		provider.keysFetchedAt = time.Now()
+	}
+	pc.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, ErrUnknownKey
+	}
+	keys, err := fetchProviderKeys(provider.metadata.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	pc.Lock()
+	provider.keys = keys
+	key, ok = keys[kid]
+	pc.Unlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// providerTokenResponse part of the token endpoint answer used to login
+type providerTokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// exchangeProviderCode exchange the code given by provider for an id_token
+func exchangeProviderCode(provider *upstreamProvider, identityProvider models.IdentityProvider, code string, redirectURI string, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {models.GrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	if identityProvider.ClientSecret == "" {
+		form.Set("client_id", identityProvider.ClientID)
+	}
+	request, err := http.NewRequest("POST", provider.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if identityProvider.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(identityProvider.ClientID), url.QueryEscape(identityProvider.ClientSecret))
+	}
+	response, err := federationClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return "", errFederationToken
+	}
+	token := providerTokenResponse{}
+	if err := json.NewDecoder(io.LimitReader(response.Body, federationMaxResponseSize)).Decode(&token); err != nil || token.IDToken == "" {
+		return "", errFederationToken
+	}
+	return token.IDToken, nil
+}
+
+// audienceContains state if "aud" claim, a string or an array, contains clientID
+func audienceContains(audience interface{}, clientID string) bool {
+	switch aud := audience.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, value := range aud {
+			if value == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyProviderIDToken check signature and claims of an id_token given by provider, as required by
+// OpenID Connect Core 1.0 section 3.1.3.7.
+func verifyProviderIDToken(provider *upstreamProvider, identityProvider models.IdentityProvider, rawToken string, nonce string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(rawToken, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := federationProviders.key(provider, kid)
+		if err != nil {
+			return nil, err
+		}
+		// Refuse "none" and HMAC: provider keys are public.
+		if t.Method == nil || !keyMatchMethod(key, t.Method) {
+			return nil, ErrAlgorithmMismatch
+		}
+		return key, nil
+	})
+	if err != nil || token == nil || !token.Valid {
+		return nil, errFederationIDToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errFederationIDToken
+	}
+	if _, ok := ClaimInt64(claims, "exp"); !ok {
+		return nil, errFederationIDToken
+	}
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+	tokenNonce, _ := claims["nonce"].(string)
+	if issuer != provider.metadata.Issuer || subject == "" || tokenNonce != nonce || !audienceContains(claims["aud"], identityProvider.ClientID) {
+		return nil, errFederationIDToken
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != identityProvider.ClientID {
+		return nil, errFederationIDToken
+	}
+	return claims, nil
+}
+
+// federatedIdentityClaims claims of an id_token used to find or create the user
+type federatedIdentityClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	GivenName         string
+	FamilyName        string
+}
+
+// readFederatedIdentityClaims get user claims from a verified id_token
+func readFederatedIdentityClaims(claims jwt.MapClaims) federatedIdentityClaims {
+	identity := federatedIdentityClaims{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Email = strings.ToLower(identity.Email)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	identity.GivenName, _ = claims["given_name"].(string)
+	identity.FamilyName, _ = claims["family_name"].(string)
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	return identity
+}
+
+// pkceChallenge compute the S256 challenge of a PKCE verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,449 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// federationCookie cookie holding the state of a login on an identity provider
+	federationCookie = "popcube_federation"
+	// federationScope scopes asked to identity providers
+	federationScope = "openid profile email"
+)
+
+var (
+	errorIdentityProviderUnavailable = utils.NewAPIError(502, "identity.provider.unavailable", "Identity provider of the organisation can not be reached.")
+	errorFederatedAccountNotFound    = utils.NewAPIError(403, "federated.account.not.found", "No account is linked to this identity. Ask an administrator to invite you.")
+	errorFederatedEmailUsed          = utils.NewAPIError(409, "federated.email.used", "An account already uses this email and can not be linked to this identity.")
+	errorFederatedClaimsMissing      = utils.NewAPIError(422, "federated.claims.missing", "Identity provider did not give an email for this identity.")
+)
+
+// initIdentityProviderRoute set identity provider routes of an organisation. It has to be called inside /organisation/{organisationID}.
+func initIdentityProviderRoute(router chi.Router) {
+	router.Route("/identityprovider", func(r chi.Router) {
+		r.Use(RequirePermission(models.PermissionManage))
+		// swagger:route GET /organisation/{organisationID}/identityprovider Organisations getIdentityProvider
+		//
+		// Get identity provider
+		//
+		// This will return the OpenID Connect provider organisation users can login with. Client secret is never sent back.
+		//
+		// 	Responses:
+		//    200: identityProviderObjectSuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Get("/", getIdentityProvider)
+		// swagger:route PUT /organisation/{organisationID}/identityprovider Organisations setIdentityProvider
+		//
+		// Set identity provider
+		//
+		// This will set the OpenID Connect provider organisation users can login with. Register
+		// {api}/{version}/auth/federation/callback as redirect uri on the provider. Client secret is kept if none is given.
+		//
+		// 	Responses:
+		//    200: identityProviderObjectSuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  422: wrongEntity
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Put("/", setIdentityProvider)
+		// swagger:route DELETE /organisation/{organisationID}/identityprovider Organisations deleteIdentityProvider
+		//
+		// Delete identity provider
+		//
+		// This will remove the identity provider. Users created from it keep their accounts.
+		//
+		// 	Responses:
+		//    200: identityProviderObjectSuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Delete("/", deleteIdentityProvider)
+	})
+}
+
+// initFederationRoute set routes to login with the identity provider of an organisation. It has to be called inside /auth.
+func initFederationRoute(router chi.Router) {
+	router.Route("/federation", func(r chi.Router) {
+		// swagger:route GET /auth/federation/{organisationID}/login Auth federatedLogin
+		//
+		// Login with identity provider
+		//
+		// Redirect the user to the identity provider of the organisation.
+		//
+		// 	Responses:
+		//    302: redirect
+		// 	  404: notFound
+		// 	  502: identityProviderUnavailable
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Get("/:organisationID/login", federatedLogin)
+		// swagger:route GET /auth/federation/callback Auth federatedCallback
+		//
+		// Identity provider callback
+		//
+		// Identity provider sends the user back here. User is found from its identity, linked from a verified email,
+		// or created if provider allows it. Answer redirects to the front end login page with userauth and refresh
+		// tokens, or mfa token, in fragment. Errors are given in fragment too. Users of an allowed email domain
+		// always get an account.
+		//
+		// 	Responses:
+		//    302: redirect
+		// 	  default: genericError
+		r.Get("/callback", federatedCallback)
+	})
+}
+
+func getIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	identityProvider, apperr := store.IdentityProvider().GetByOrganisation(r.Context(), organisation.IDOrganisation, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, identityProvider)
+}
+
+// identityProviderRequest object
+type identityProviderRequest struct {
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	AutoCreate   bool   `json:"auto_create"`
+	Enabled      bool   `json:"enabled"`
+}
+
+func (iPR *identityProviderRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+func setIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &identityProviderRequest{}
+	err := chiRender.Bind(r, data)
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err != nil || !models.IsValidIssuer(data.Issuer) || data.ClientID == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	identityProvider := models.IdentityProvider{
+		IDOrganisation: organisation.IDOrganisation,
+		Name:           data.Name,
+		Issuer:         data.Issuer,
+		ClientID:       data.ClientID,
+		ClientSecret:   data.ClientSecret,
+		AutoCreate:     data.AutoCreate,
+		Enabled:        data.Enabled,
+	}
+	if apperr := store.IdentityProvider().Save(r.Context(), &identityProvider, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, identityProvider)
+}
+
+func deleteIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	identityProvider, apperr := store.IdentityProvider().GetByOrganisation(r.Context(), organisation.IDOrganisation, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr := store.IdentityProvider().Delete(r.Context(), &identityProvider, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, identityProvider)
+}
+
+// federationPath path of federation routes in current api version
+func federationPath(r *http.Request) string {
+	version, _ := r.Context().Value(apiVersionKey).(string)
+	return "/" + version + "/auth/federation"
+}
+
+// federatedLoginRedirect send user back to the front end login page with values in fragment, so they do not reach server logs
+func federatedLoginRedirect(w http.ResponseWriter, r *http.Request, values url.Values) {
+	http.Redirect(w, r, mailConfig.PublicURL+"/login/federated#"+values.Encode(), http.StatusFound)
+}
+
+func federatedLogin(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	id, err := strconv.ParseUint(chi.URLParam(r, "organisationID"), 10, 64)
+	if err != nil {
+		render.JSON(w, error404.StatusCode, error404)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	identityProvider, apperr := store.IdentityProvider().GetByOrganisation(r.Context(), id, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if !identityProvider.Enabled {
+		render.JSON(w, error404.StatusCode, error404)
+		return
+	}
+	provider, err := federationProviders.discover(identityProvider.Issuer)
+	if err != nil {
+		render.JSON(w, errorIdentityProviderUnavailable.StatusCode, errorIdentityProviderUnavailable)
+		return
+	}
+	state := newRandomString(26)
+	nonce := newRandomString(26)
+	verifier := newRandomString(64)
+	// Login state stays in an http only cookie so PKCE verifier never goes through the provider.
+	claims := Claims{
+		"organisation_id":      identityProvider.IDOrganisation,
+		"identity_provider_id": identityProvider.IDIdentityProvider,
+		"state":                state,
+		"nonce":                nonce,
+		"code_verifier":        verifier,
+		"type":                 "federation_state",
+	}
+	claims.SetIssuedNow().SetExpiryIn(federationStateLifetime)
+	_, cookieValue, err := tokenAuth.Encode(claims)
+	if err != nil {
+		render.JSON(w, 422, "Could not generate token")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationCookie,
+		Value:    cookieValue,
+		Path:     federationPath(r),
+		MaxAge:   int(federationStateLifetime.Seconds()),
+		Secure:   strings.HasPrefix(tokenIssuer, "https://"),
+		HttpOnly: true,
+	})
+	redirectWithParams(w, r, provider.metadata.AuthorizationEndpoint, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {identityProvider.ClientID},
+		"redirect_uri":          {tokenIssuer + federationPath(r) + "/callback"},
+		"scope":                 {federationScope},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {models.CodeChallengeS256},
+	})
+}
+
+func federatedCallback(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	query := r.URL.Query()
+	fail := func(code string, description string) {
+		federatedLoginRedirect(w, r, url.Values{"error": {code}, "error_description": {description}})
+	}
+	cookie, err := r.Cookie(federationCookie)
+	// Login state can only be used once.
+	http.SetCookie(w, &http.Cookie{Name: federationCookie, Path: federationPath(r), MaxAge: -1, HttpOnly: true})
+	if err != nil {
+		fail("invalid_request", "Login session is missing or expired.")
+		return
+	}
+	claims, ok := activeToken(cookie.Value)
+	expectedState, _ := claims["state"].(string)
+	if !ok || claims["type"] != "federation_state" || subtle.ConstantTimeCompare([]byte(expectedState), []byte(query.Get("state"))) != 1 {
+		fail("invalid_request", "Login session is missing or expired.")
+		return
+	}
+	if query.Get("error") != "" {
+		fail("access_denied", "Identity provider refused the login.")
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		fail("temporarily_unavailable", error503.Message)
+		return
+	}
+	organisationID, _ := ClaimInt64(claims, "organisation_id")
+	identityProviderID, _ := ClaimInt64(claims, "identity_provider_id")
+	identityProvider, apperr := store.IdentityProvider().GetByOrganisation(r.Context(), uint64(organisationID), db)
+	if apperr != nil && apperr.Kind == utils.ErrorUnavailable {
+		fail("temporarily_unavailable", error503.Message)
+		return
+	}
+	if apperr != nil || identityProvider.IDIdentityProvider != uint64(identityProviderID) || !identityProvider.Enabled {
+		fail("access_denied", "Identity provider is not enabled anymore.")
+		return
+	}
+	provider, err := federationProviders.discover(identityProvider.Issuer)
+	if err != nil {
+		fail("temporarily_unavailable", errorIdentityProviderUnavailable.Message)
+		return
+	}
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["code_verifier"].(string)
+	rawIDToken, err := exchangeProviderCode(provider, identityProvider, query.Get("code"), tokenIssuer+federationPath(r)+"/callback", verifier)
+	if err != nil {
+		fail("access_denied", "Identity provider refused the authorization code.")
+		return
+	}
+	idTokenClaims, err := verifyProviderIDToken(provider, identityProvider, rawIDToken, nonce)
+	if err != nil {
+		fail("access_denied", "Identity provider gave an invalid id_token.")
+		return
+	}
+	user, apperr := federatedUser(r.Context(), identityProvider, readFederatedIdentityClaims(idTokenClaims))
+	if apperr != nil {
+		fail(apperr.ID, apperr.Message)
+		return
+	}
+	organisation, apperr := store.Organisation().GetByID(r.Context(), user.IDOrganisation, db)
+	if apperr != nil {
+		fail(apperr.ID, apperr.Message)
+		return
+	}
+	if !user.EmailVerified && organisation.RequireVerifiedEmail {
+		fail(errorEmailNotVerified.ID, errorEmailNotVerified.Message)
+		return
+	}
+	if user.MFAEnabled {
+		token, err := createMFAPendingToken(user)
+		if err != nil {
+			fail("server_error", "Could not generate token")
+			return
+		}
+		federatedLoginRedirect(w, r, url.Values{"mfa_required": {"true"}, "mfa_token": {token}})
+		return
+	}
+	token, err := createUserToken(user)
+	if err != nil {
+		fail("server_error", "Could not generate token")
+		return
+	}
+	clearToken, refreshToken := newRefreshToken(user, newRandomString(26))
+	if apperr := store.RefreshToken().Save(r.Context(), &refreshToken, db); apperr != nil {
+		fail("server_error", "Could not save refresh token")
+		return
+	}
+	federatedLoginRedirect(w, r, url.Values{"token": {token}, "refresh_token": {clearToken}})
+}
+
+// federatedUser get the user of a provider identity. Identity is linked to the user of the organisation with the same
+// verified email, or a new user is created if provider allows it or email belongs to an allowed domain.
+func federatedUser(ctx context.Context, identityProvider models.IdentityProvider, claims federatedIdentityClaims) (models.User, *utils.AppError) {
+	store := datastores.Store()
+	db := dbStore.db
+	identity, apperr := store.IdentityProvider().GetIdentity(ctx, identityProvider.IDIdentityProvider, claims.Subject, db)
+	if apperr == nil {
+		user, apperr := store.User().GetByID(ctx, identity.IDUser, db)
+		if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+			return models.EmptyUser, apperr
+		}
+		if apperr != nil || user.Deleted || user.IDOrganisation != identityProvider.IDOrganisation {
+			return models.EmptyUser, errorFederatedAccountNotFound
+		}
+		return user, nil
+	}
+	if apperr.Kind != utils.ErrorNotFound {
+		return models.EmptyUser, apperr
+	}
+	identity = models.FederatedIdentity{IDIdentityProvider: identityProvider.IDIdentityProvider, Subject: claims.Subject}
+	if claims.Email == "" {
+		return models.EmptyUser, errorFederatedClaimsMissing
+	}
+	user, apperr := store.User().GetByEmail(ctx, claims.Email, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		return models.EmptyUser, apperr
+	}
+	if apperr == nil {
+		// Linking an unverified email would let anyone take over the account.
+		if !claims.EmailVerified || user.Deleted || user.IDOrganisation != identityProvider.IDOrganisation {
+			return models.EmptyUser, errorFederatedEmailUsed
+		}
+		identity.IDUser = user.IDUser
+		if apperr := store.IdentityProvider().Link(ctx, &identity, db); apperr != nil {
+			return models.EmptyUser, apperr
+		}
+		return user, nil
+	}
+	// Users of an allowed email domain join the organisation even if provider does not create accounts.
+	if !identityProvider.AutoCreate {
+		domainAllowed, apperr := emailDomainAllowed(ctx, identityProvider.IDOrganisation, claims.Email)
+		if apperr != nil {
+			return models.EmptyUser, apperr
+		}
+		if !claims.EmailVerified || !domainAllowed {
+			return models.EmptyUser, errorFederatedAccountNotFound
+		}
+	}
+	username := models.FederatedUsername(claims.PreferredUsername, claims.Email)
+	if username == "" {
+		username = "user"
+	}
+	if _, apperr := store.User().GetByUserName(ctx, username, db); apperr == nil {
+		username = username + "_" + newRandomString(6)
+	}
+	user = models.User{
+		Username:       username,
+		Email:          claims.Email,
+		EmailVerified:  claims.EmailVerified,
+		FirstName:      truncateRunes(claims.GivenName, 64),
+		LastName:       truncateRunes(claims.FamilyName, 64),
+		IDOrganisation: identityProvider.IDOrganisation,
+		// Federated users login through their provider. They can still reset a password later.
+		Password: newRandomString(32),
+	}
+	if apperr := store.IdentityProvider().CreateUser(ctx, &user, &identity, db); apperr != nil {
+		return models.EmptyUser, apperr
+	}
+	return user, nil
+}
+
+// truncateRunes cut s to at most max runes
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+// stubProvider OpenID Connect provider answering with the identity set in it
+type stubProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	kid      string
+	clientID string
+	// metadata override discovery document fields when set
+	metadata map[string]string
+	// subject, email and emailVerified of the identity logged in
+	subject       string
+	email         string
+	emailVerified bool
+	// challenges PKCE challenges received by authorization endpoint, by code
+	challenges map[string]string
+	nonces     map[string]string
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubProvider{key: key, kid: "stub", clientID: "popcube", metadata: map[string]string{}, challenges: map[string]string{}, nonces: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/token", stub.token)
+	stub.server = httptest.NewServer(mux)
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (stub *stubProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	metadata := map[string]string{
+		"issuer":                 stub.server.URL,
+		"authorization_endpoint": stub.server.URL + "/authorize",
+		"token_endpoint":         stub.server.URL + "/token",
+		"jwks_uri":               stub.server.URL + "/jwks",
+	}
+	for field, value := range stub.metadata {
+		metadata[field] = value
+	}
+	json.NewEncoder(w).Encode(metadata)
+}
+
+func (stub *stubProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	key, _ := NewAsymmetricKey(stub.kid, "RS256", stub.key)
+	jwk, _ := key.PublicJWK()
+	json.NewEncoder(w).Encode(JSONWebKeySet{Keys: []JSONWebKey{jwk}})
+}
+
+func (stub *stubProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	code := r.PostForm.Get("code")
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != stub.clientID || clientSecret != "secret" || pkceChallenge(r.PostForm.Get("code_verifier")) != stub.challenges[code] {
+		w.WriteHeader(400)
+		return
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            stub.server.URL,
+		"sub":            stub.subject,
+		"aud":            stub.clientID,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          stub.nonces[code],
+		"email":          stub.email,
+		"email_verified": stub.emailVerified,
+	})
+	token.Header["kid"] = stub.kid
+	idToken, _ := token.SignedString(stub.key)
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// login go through federated login of organisation and give the values sent back to the front end
+func (stub *stubProvider) login(t *testing.T, router http.Handler, organisation models.Organisation) url.Values {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/alpha/auth/federation/"+strconv.FormatUint(organisation.IDOrganisation, 10)+"/login", nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login answered %d: %s", recorder.Code, recorder.Body.String())
+	}
+	location, _ := url.Parse(recorder.Header().Get("Location"))
+	if location.Scheme+"://"+location.Host+location.Path != stub.server.URL+"/authorize" {
+		t.Fatalf("login redirected to %s", location)
+	}
+	query := location.Query()
+	if query.Get("client_id") != stub.clientID || query.Get("code_challenge_method") != models.CodeChallengeS256 {
+		t.Fatalf("unexpected authorization request %s", location)
+	}
+	// Provider authenticates the user and sends it back with a code.
+	code := newRandomString(10)
+	stub.challenges[code] = query.Get("code_challenge")
+	stub.nonces[code] = query.Get("nonce")
+	callback := httptest.NewRequest("GET", "/alpha/auth/federation/callback?"+url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, callback)
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("callback answered %d: %s", recorder.Code, recorder.Body.String())
+	}
+	location, _ = url.Parse(recorder.Header().Get("Location"))
+	values, _ := url.ParseQuery(location.Fragment)
+	return values
+}
+
+func newTestIdentityProvider(t *testing.T, stub *stubProvider, organisation models.Organisation, autoCreate bool) models.IdentityProvider {
+	t.Helper()
+	identityProvider := models.IdentityProvider{
+		IDOrganisation: organisation.IDOrganisation,
+		Issuer:         stub.server.URL,
+		ClientID:       stub.clientID,
+		ClientSecret:   "secret",
+		AutoCreate:     autoCreate,
+		Enabled:        true,
+	}
+	if apperr := datastores.Store().IdentityProvider().Save(context.Background(), &identityProvider, dbStore.db); apperr != nil {
+		t.Fatalf("save identity provider: %v", apperr)
+	}
+	return identityProvider
+}
+
+// allowLoopbackProviders let stub providers be reached while test runs
+func allowLoopbackProviders(t *testing.T) {
+	federationAllowLoopback = true
+	federationProviders = &providerCache{providers: map[string]*upstreamProvider{}}
+	t.Cleanup(func() { federationAllowLoopback = false })
+}
+
+func TestFederatedLoginCreatesThenLinksUsers(t *testing.T) {
+	router := newTestRouter(t)
+	allowLoopbackProviders(t)
+	stub := newStubProvider(t)
+	organisation := newTestOrganisation(t, "federated", false)
+	identityProvider := newTestIdentityProvider(t, stub, organisation, true)
+	ctx := context.Background()
+
+	stub.subject, stub.email, stub.emailVerified = "subject-1", "new@federated.xyz", true
+	values := stub.login(t, router, organisation)
+	if values.Get("token") == "" || values.Get("refresh_token") == "" {
+		t.Fatalf("expected tokens, got %v", values)
+	}
+	created, apperr := datastores.Store().User().GetByEmail(ctx, "new@federated.xyz", dbStore.db)
+	if apperr != nil || created.IDOrganisation != organisation.IDOrganisation || !created.EmailVerified {
+		t.Fatalf("user was not created: %+v %v", created, apperr)
+	}
+	// Same identity logs in the same user.
+	if values := stub.login(t, router, organisation); values.Get("token") == "" {
+		t.Fatalf("second login failed: %v", values)
+	}
+
+	existing := newTestUser(t, organisation, "existing", models.RoleMember)
+	stub.subject, stub.email = "subject-2", existing.Email
+	if values := stub.login(t, router, organisation); values.Get("token") == "" {
+		t.Fatalf("link failed: %v", values)
+	}
+	identity, apperr := datastores.Store().IdentityProvider().GetIdentity(ctx, identityProvider.IDIdentityProvider, "subject-2", dbStore.db)
+	if apperr != nil || identity.IDUser != existing.IDUser {
+		t.Fatalf("identity was not linked to existing user: %+v %v", identity, apperr)
+	}
+
+	// Unverified emails are never linked.
+	other := newTestUser(t, organisation, "other", models.RoleMember)
+	stub.subject, stub.email, stub.emailVerified = "subject-3", other.Email, false
+	if values := stub.login(t, router, organisation); values.Get("error") != errorFederatedEmailUsed.ID {
+		t.Fatalf("unverified email was linked: %v", values)
+	}
+}
+
+func TestFederationRefusesInternalEndpoints(t *testing.T) {
+	newTestRouter(t)
+	stub := newStubProvider(t)
+	federationProviders = &providerCache{providers: map[string]*upstreamProvider{}}
+	if _, err := federationProviders.discover(stub.server.URL); err == nil {
+		t.Fatal("provider on the local machine was reached outside dev mode")
+	}
+	allowLoopbackProviders(t)
+	for field, endpoint := range map[string]string{
+		"token_endpoint": "http://10.0.0.1/token",
+		"jwks_uri":       "ftp://" + stub.server.Listener.Addr().String() + "/jwks",
+	} {
+		stub.metadata = map[string]string{field: endpoint}
+		federationProviders = &providerCache{providers: map[string]*upstreamProvider{}}
+		if _, err := federationProviders.discover(stub.server.URL); err != errFederationDiscovery {
+			t.Errorf("%s %s was accepted: %v", field, endpoint, err)
+		}
+	}
+	for _, address := range []string{"10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "0.0.0.0"} {
+		if federationAddressAllowed(net.ParseIP(address)) {
+			t.Errorf("%s is allowed", address)
+		}
+	}
+	if !federationAddressAllowed(net.ParseIP("93.184.216.34")) {
+		t.Error("public address is refused")
+	}
+}
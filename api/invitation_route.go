@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+const (
+	oldInvitationKey key = "oldInvitation"
+)
+
+func initInvitationRoute(router chi.Router) {
+	router.Route("/invitations", func(r chi.Router) {
+		r.Route("/accept", func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			r.Use(allowUserCreationFromToken)
+			// swagger:route POST /invitations/accept Invitations acceptInvitation
+			//
+			// Accept invitation
+			//
+			// This will create the invited user from provided user object and invitation token.
+			// An invitation can only be accepted once. Email is the invited one and is verified by the token.
+			//
+			// 	Responses:
+			//    201: userObjectSuccess
+			// 	  401: unauthorized
+			// 	  404: notFound
+			// 	  409: invitationNotPending
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/", acceptInvitation)
+		})
+		r.Route("/:invitationID", func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			r.Use(APIKeyVerifier)
+			r.Use(Authenticator)
+			r.Use(RequirePermission(models.PermissionInvite))
+			r.Use(invitationContext)
+			// swagger:route DELETE /invitations/{invitationID} Invitations revokeInvitation
+			//
+			// Revoke invitation
+			//
+			// This will cancel a pending invitation. Its token can not be used anymore.
+			//
+			// 	Responses:
+			//    200: invitationObjectSuccess
+			// 	  403: forbidden
+			// 	  404: notFound
+			// 	  409: invitationNotPending
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Delete("/", revokeInvitation)
+		})
+	})
+}
+
+func invitationContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "invitationID"), 10, 64)
+		if err != nil {
+			render.JSON(w, error404.StatusCode, error404)
+			return
+		}
+		oldInvitation, apperr := datastores.Store().Invitation().GetByID(r.Context(), id, dbStore.db)
+		if apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+		ctx := context.WithValue(r.Context(), oldInvitationKey, oldInvitation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func revokeInvitation(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	invitation := r.Context().Value(oldInvitationKey).(models.Invitation)
+	if organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id"); uint64(organisationID) != invitation.IDOrganisation {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	if apperr := store.Invitation().Revoke(r.Context(), &invitation, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, invitation)
+}
+
+func acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	data := &signupRequest{}
+	store := datastores.Store()
+	db := dbStore.db
+	claims := tokenClaims(r)
+	invitationID, _ := ClaimInt64(claims, "invitation_id")
+	email, _ := claims["email"].(string)
+
+	err := chiRender.Bind(r, data)
+	if err != nil {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	invitation, apperr := store.Invitation().GetByID(r.Context(), uint64(invitationID), db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if invitation.Email != email {
+		render.JSON(w, error401.StatusCode, error401)
+		return
+	}
+	// Invitation token was sent to the invited address: it proves the user owns it.
+	User := data.toUser(invitation.IDOrganisation)
+	User.EmailVerified = true
+	if apperr := store.Invitation().Accept(r.Context(), &invitation, &User, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		exp, _ := ClaimInt64(claims, "exp")
+		revoke(r.Context(), models.Revocation{Kind: models.RevocationKindToken, Subject: jti, ExpiresAt: exp})
+	}
+	render.JSON(w, 201, User)
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -21,35 +22,66 @@ var (
 	ErrUnauthorized = errors.New("jwtauth: unauthorized token")
 	// ErrExpired expired token error
 	ErrExpired = errors.New("jwtauth: expired token")
+	// ErrRevoked revoked token error
+	ErrRevoked = errors.New("jwtauth: revoked token")
 )
 
+// RevocationChecker tell if a token with valid signature was revoked
+type RevocationChecker interface {
+	IsRevoked(claims jwt.MapClaims) bool
+}
+
 // JwtAuth struct to store JWT auth informations
 type JwtAuth struct {
-	signKey   []byte
-	verifyKey []byte
-	signer    jwt.SigningMethod
-	parser    *jwt.Parser
+	keyring     *Keyring
+	parser      *jwt.Parser
+	revocations RevocationChecker
 }
 
 // New creates a JwtAuth authenticator instance that provides middleware handlers
 // and encoding/decoding functions for JWT signing.
+// signKey and verifyKey are either HMAC secret or PEM encoded keys for asymmetric algorithms.
 func New(alg string, signKey []byte, verifyKey []byte) *JwtAuth {
-	return &JwtAuth{
-		signKey:   signKey,
-		verifyKey: verifyKey,
-		signer:    jwt.GetSigningMethod(alg),
-	}
+	return NewWithParser(alg, nil, signKey, verifyKey)
 }
 
 // NewWithParser is the same as New, except it supports custom parser settings
 // introduced in ver. 2.4.0 of jwt-go
 func NewWithParser(alg string, parser *jwt.Parser, signKey []byte, verifyKey []byte) *JwtAuth {
-	return &JwtAuth{
-		signKey:   signKey,
-		verifyKey: verifyKey,
-		signer:    jwt.GetSigningMethod(alg),
-		parser:    parser,
+	var key *Key
+	var err error
+	if _, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC); ok {
+		key, err = NewHMACKey("", alg, signKey)
+	} else {
+		keyData := signKey
+		if len(keyData) == 0 {
+			keyData = verifyKey
+		}
+		var parsedKey interface{}
+		if parsedKey, err = parsePEMKey(keyData); err == nil {
+			key, err = NewAsymmetricKey("", alg, parsedKey)
+		}
+	}
+	if err != nil {
+		log.Print("jwtauth: can not use provided key: " + err.Error())
+		return nil
 	}
+	return &JwtAuth{keyring: NewKeyring(key), parser: parser}
+}
+
+// NewWithKeyring creates a JwtAuth signing with keyring current key and verifying with any of its keys.
+func NewWithKeyring(keyring *Keyring) *JwtAuth {
+	return &JwtAuth{keyring: keyring}
+}
+
+// SetRevocationChecker set the revocation list consulted by Verify
+func (ja *JwtAuth) SetRevocationChecker(revocations RevocationChecker) {
+	ja.revocations = revocations
+}
+
+// Keyring get keys used by authenticator
+func (ja *JwtAuth) Keyring() *Keyring {
+	return ja.keyring
 }
 
 // Verifier middleware will verify a JWT passed by a client request.
@@ -125,7 +157,7 @@ func (ja *JwtAuth) Verify(paramAliases ...string) func(http.Handler) http.Handle
 				return
 			}
 
-			if token == nil || !token.Valid || token.Method != ja.signer {
+			if token == nil || !token.Valid {
 				err = ErrUnauthorized
 				ctx = ja.SetContext(ctx, token, err)
 				next.ServeHTTP(w, r.WithContext(ctx))
@@ -140,6 +172,14 @@ func (ja *JwtAuth) Verify(paramAliases ...string) func(http.Handler) http.Handle
 				return
 			}
 
+			// Check token was not revoked
+			if ja.IsRevoked(token) {
+				err = ErrRevoked
+				ctx = ja.SetContext(ctx, token, err)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			// Valid! pass it down the context to an authenticator middleware
 			ctx = ja.SetContext(ctx, token, err)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -155,11 +195,20 @@ func (ja *JwtAuth) SetContext(ctx context.Context, t *jwt.Token, err error) cont
 	return ctx
 }
 
-// Encode encode claims
+// Encode encode claims with keyring current key. Key id is set in "kid" header.
+// A "jti" is added to claims if not provided so the token can be revoked.
 func (ja *JwtAuth) Encode(claims Claims) (t *jwt.Token, tokenString string, err error) {
-	t = jwt.New(ja.signer)
+	key := ja.keyring.Current()
+	if !key.CanSign() {
+		return nil, "", ErrInvalidKey
+	}
+	if _, ok := claims["jti"]; !ok {
+		claims.SetID(newRandomString(26))
+	}
+	t = jwt.New(key.Method)
+	t.Header["kid"] = key.ID
 	t.Claims = claims
-	tokenString, err = t.SignedString(ja.signKey)
+	tokenString, err = t.SignedString(key.SignKey)
 	t.Raw = tokenString
 	return
 }
@@ -172,12 +221,18 @@ func (ja *JwtAuth) Decode(tokenString string) (t *jwt.Token, err error) {
 	return jwt.Parse(tokenString, ja.keyFunc)
 }
 
+// keyFunc select verification key from token "kid" header. Token must use the algorithm of the key
+// so a public key can never be used as an HMAC secret.
 func (ja *JwtAuth) keyFunc(t *jwt.Token) (interface{}, error) {
-	if ja.verifyKey != nil && len(ja.verifyKey) > 0 {
-		return ja.verifyKey, nil
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ja.keyring.Get(kid)
+	if !ok {
+		return nil, ErrUnknownKey
 	}
-	return ja.signKey, nil
-
+	if t.Method == nil || t.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.VerifyKey, nil
 }
 
 // IsExpired check if token is expired
@@ -202,12 +257,25 @@ func (ja *JwtAuth) IsExpired(t *jwt.Token) bool {
 	return false
 }
 
+// IsRevoked check token against revocation list
+func (ja *JwtAuth) IsRevoked(t *jwt.Token) bool {
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok || ja.revocations == nil {
+		return false
+	}
+	return ja.revocations.IsRevoked(claims)
+}
+
 // Authenticator validate that user has a valid user auth token before letting him access.
 func Authenticator(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
 		if jwtErr, ok := ctx.Value(jwtErrorKey).(error); ok {
+			if jwtErr == ErrRevoked {
+				render.JSON(w, 401, "Token was revoked. Please login again.")
+				return
+			}
 			if jwtErr != nil {
 				render.JSON(w, 401, "Token not found. You Are not allowed to proceed without token.")
 				return
@@ -237,6 +305,39 @@ func Authenticator(next http.Handler) http.Handler {
 	})
 }
 
+// tokenTypeOnly let request pass only if it carries a valid token of provided type. It has to be used after Verifier.
+func tokenTypeOnly(tokenType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if jwtErr, ok := ctx.Value(jwtErrorKey).(error); ok {
+				if jwtErr == ErrRevoked {
+					render.JSON(w, 401, "Token was already used or revoked.")
+					return
+				}
+				if jwtErr != nil {
+					render.JSON(w, 401, "Token not found. You Are not allowed to proceed without token.")
+					return
+				}
+			}
+
+			jwtToken, ok := ctx.Value(jwtTokenKey).(*jwt.Token)
+			if !ok || jwtToken == nil || !jwtToken.Valid {
+				render.JSON(w, 401, "token is not valid or does not exist")
+				return
+			}
+
+			if jwtToken.Claims.(jwt.MapClaims)["type"] != tokenType {
+				render.JSON(w, 401, "Token is not a "+tokenType+" one")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // allowUserCreationFromToken check the provided token is an invitation one
 func allowUserCreationFromToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -273,7 +374,7 @@ func allowUserCreationFromToken(next http.Handler) http.Handler {
 		// render.JSON(w, 401, "Token is not valid. Organisation is undifined")
 		// return
 		// }
-		// apiOrganisation := datastores.Store().Organisation().Get(dbStore.db)
+		// apiOrganisation := datastores.Store().Organisation().Get(r.Context(), dbStore.db)
 
 		// if tokenOrganisation != apiOrganisation.OrganisationName {
 		// 	render.JSON(w, 401, "Token is not valid. Organisation does not match current organsisation")
@@ -304,6 +405,12 @@ func (c Claims) Get(k string) (interface{}, bool) {
 	return v, ok
 }
 
+// SetID Set token id ("jti") in the claims
+func (c Claims) SetID(jti string) Claims {
+	c["jti"] = jti
+	return c
+}
+
 // SetIssuedAt Set issued at ("iat") to specified time in the claims
 func (c Claims) SetIssuedAt(tm time.Time) Claims {
 	c["iat"] = tm.UTC().Unix()
@@ -329,6 +436,24 @@ func (c Claims) SetExpiryIn(tm time.Duration) Claims {
 	return c
 }
 
+// ClaimInt64 Helper function reading a numeric claim whatever the way it was decoded
+func ClaimInt64(claims jwt.MapClaims, k string) (int64, bool) {
+	switch v := claims[k].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
 // EpochNow Helper function that returns the NumericDate time value used by the spec
 func EpochNow() int64 {
 	return time.Now().UTC().Unix()
@@ -0,0 +1,404 @@
+package api
+
+// Keys and keyring used by JwtAuth. Keyring contains one signing key and the previous keys still accepted
+// for verification, so keys can be rotated without killing live sessions.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"sync"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// ErrUnknownKey token was signed with a key not present in keyring
+	ErrUnknownKey = errors.New("jwtauth: unknown signing key")
+	// ErrAlgorithmMismatch token algorithm is not the one of the key it claims to be signed with
+	ErrAlgorithmMismatch = errors.New("jwtauth: algorithm does not match key")
+	// ErrInvalidKey provided key can not be used with requested algorithm
+	ErrInvalidKey = errors.New("jwtauth: invalid key for algorithm")
+	// SigningMethodEdDSA Ed25519 signing method. jwt-go does not provide it.
+	SigningMethodEdDSA = &signingMethodEdDSA{}
+)
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// Key signing and verification material for one key id.
+type Key struct {
+	// ID of the key, sent as "kid" header in tokens
+	ID string
+	// Method used to sign with this key
+	Method jwt.SigningMethod
+	// SignKey private key (or secret for HMAC). Nil for keys only used to verify.
+	SignKey interface{}
+	// VerifyKey public key (or secret for HMAC)
+	VerifyKey interface{}
+}
+
+// CanSign state if key can be used to sign tokens
+func (k *Key) CanSign() bool {
+	return k.SignKey != nil
+}
+
+// IsSymmetric state if key is a shared secret
+func (k *Key) IsSymmetric() bool {
+	_, ok := k.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// NewHMACKey create a key from a shared secret
+func NewHMACKey(kid string, alg string, secret []byte) (*Key, error) {
+	method, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC)
+	if !ok || len(secret) == 0 {
+		return nil, ErrInvalidKey
+	}
+	if kid == "" {
+		sum := sha256.Sum256(secret)
+		kid = "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8])
+	}
+	return &Key{ID: kid, Method: method, SignKey: secret, VerifyKey: secret}, nil
+}
+
+// NewAsymmetricKey create a key from a private or a public key. If alg is empty, it is guessed from the key type.
+// If kid is empty, it is computed from the public key so it stays the same when the key is moved to previous keys.
+func NewAsymmetricKey(kid string, alg string, key interface{}) (*Key, error) {
+	var signKey interface{}
+	var verifyKey interface{}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signKey, verifyKey = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		signKey, verifyKey = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		signKey, verifyKey = k, k.Public()
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		verifyKey = k
+	default:
+		return nil, ErrInvalidKey
+	}
+	if alg == "" {
+		alg = defaultAlgorithm(verifyKey)
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil || !keyMatchMethod(verifyKey, method) {
+		return nil, ErrInvalidKey
+	}
+	if kid == "" {
+		der, err := x509.MarshalPKIXPublicKey(verifyKey)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		kid = base64.RawURLEncoding.EncodeToString(sum[:12])
+	}
+	return &Key{ID: kid, Method: method, SignKey: signKey, VerifyKey: verifyKey}, nil
+}
+
+// LoadKeyFromPEM read a PEM encoded private or public key from file. Supported keys are RSA, ECDSA and Ed25519.
+func LoadKeyFromPEM(kid string, alg string, path string) (*Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePEMKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewAsymmetricKey(kid, alg, key)
+}
+
+func parsePEMKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return nil, ErrInvalidKey
+}
+
+func defaultAlgorithm(publicKey interface{}) string {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return "RS256"
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P384():
+			return "ES384"
+		case elliptic.P521():
+			return "ES512"
+		}
+		return "ES256"
+	case ed25519.PublicKey:
+		return "EdDSA"
+	}
+	return ""
+}
+
+func keyMatchMethod(publicKey interface{}, method jwt.SigningMethod) bool {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		if ecMethod, ok := method.(*jwt.SigningMethodECDSA); ok {
+			return k.Curve.Params().BitSize == ecMethod.CurveBits
+		}
+	case ed25519.PublicKey:
+		return method == SigningMethodEdDSA
+	}
+	return false
+}
+
+// JSONWebKey public part of a key as described by RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet set of public keys
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PublicJWK get the public JWK of key. Returns false for symmetric keys which must never be published.
+func (k *Key) PublicJWK() (JSONWebKey, bool) {
+	jwk := JSONWebKey{Use: "sig", Kid: k.ID, Alg: k.Method.Alg()}
+	switch pub := k.VerifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(padBytes(pub.X.Bytes(), size))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(padBytes(pub.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return jwk, false
+	}
+	return jwk, true
+}
+
+// PublicKey get the public key described by jwk. Used to verify tokens of other issuers.
+func (jwk JSONWebKey) PublicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, ErrInvalidKey
+		}
+		e, err := decode(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, ErrInvalidKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrInvalidKey
+		}
+		x, errX := decode(jwk.X)
+		y, errY := decode(jwk.Y)
+		if errX != nil || errY != nil {
+			return nil, ErrInvalidKey
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrInvalidKey
+		}
+		return pub, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil || jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// padBytes left pad b with zeros up to size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// Keyring set of keys known by JwtAuth. Tokens are signed with the current key and verified with any key of the ring.
+type Keyring struct {
+	mutex   sync.RWMutex
+	current *Key
+	keys    []*Key
+}
+
+// NewKeyring create a keyring signing with current and still accepting tokens signed by previous keys
+func NewKeyring(current *Key, previous ...*Key) *Keyring {
+	kr := &Keyring{}
+	for _, key := range previous {
+		kr.add(key)
+	}
+	kr.add(current)
+	kr.current = current
+	return kr
+}
+
+// add insert key first in the ring, replacing key with the same id
+func (kr *Keyring) add(key *Key) {
+	keys := []*Key{key}
+	for _, k := range kr.keys {
+		if k.ID != key.ID {
+			keys = append(keys, k)
+		}
+	}
+	kr.keys = keys
+}
+
+// Current get the key used to sign new tokens
+func (kr *Keyring) Current() *Key {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+	return kr.current
+}
+
+// Get find key from its id
+func (kr *Keyring) Get(kid string) (*Key, bool) {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+	for _, k := range kr.keys {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// Keys list all keys, current one first
+func (kr *Keyring) Keys() []*Key {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+	keys := make([]*Key, len(kr.keys))
+	copy(keys, kr.keys)
+	return keys
+}
+
+// JWKS get the public keys of the ring, current one first
+func (kr *Keyring) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, k := range kr.Keys() {
+		if jwk, ok := k.PublicJWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Rotate make key the signing key. Former current key is kept to verify tokens it signed.
+func (kr *Keyring) Rotate(key *Key) error {
+	if !key.CanSign() {
+		return ErrInvalidKey
+	}
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	kr.add(key)
+	kr.current = key
+	return nil
+}
+
+// Remove drop a previous key. Tokens signed with it are no more accepted. Current key can not be removed.
+func (kr *Keyring) Remove(kid string) {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	keys := []*Key{}
+	for _, k := range kr.keys {
+		if k.ID != kid || k == kr.current {
+			keys = append(keys, k)
+		}
+	}
+	kr.keys = keys
+}
+
+// signingMethodEdDSA implements jwt.SigningMethod for Ed25519 keys
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	sig, err := privateKey.Sign(rand.Reader, []byte(signingString), crypto.Hash(0))
+	if err != nil {
+		return "", err
+	}
+	return jwt.EncodeSegment(sig), nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"log"
+
+	"github.com/titouanfreville/popcubeexternalapi/configs"
+	"github.com/titouanfreville/popcubeexternalapi/mailer"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+var (
+	mailSender    mailer.Mailer = mailer.LogMailer{}
+	mailTemplates *mailer.Templates
+	mailConfig    = configs.MailInfo{}
+)
+
+// initMail load email templates and start the queue sending emails through configured backend
+func initMail() {
+	mailConfig = configs.InitMailConfig()
+	templates, err := mailer.LoadTemplates(mailConfig.TemplatesDir, mailConfig.DefaultLocale)
+	if err != nil {
+		log.Print("Can't load mail templates: " + err.Error())
+	}
+	mailTemplates = templates
+	mailSender = mailer.NewQueue(newMailer(mailConfig), mailConfig.QueueSize, mailConfig.MaxAttempts, mailConfig.RetryDelay)
+}
+
+// newMailer build the mailer delivering emails with configured backend
+func newMailer(mailInfo configs.MailInfo) mailer.Mailer {
+	switch mailInfo.Backend {
+	case "smtp":
+		return mailer.SMTPMailer{
+			Host:       mailInfo.SMTPHost,
+			Port:       mailInfo.SMTPPort,
+			Username:   mailInfo.SMTPUsername,
+			Password:   mailInfo.SMTPPassword,
+			From:       mailInfo.From,
+			RequireTLS: mailInfo.SMTPRequireTLS,
+		}
+	case "file":
+		return mailer.FileMailer{Dir: mailInfo.FileDir, From: mailInfo.From}
+	case "log":
+	default:
+		log.Print("Unknown mail backend " + mailInfo.Backend + ", emails will only be logged")
+	}
+	return mailer.LogMailer{}
+}
+
+// sendMail render message of provided type in the first available locale of preferences and queue it.
+// Failures are logged: emails are never required for a request to succeed.
+func sendMail(messageType string, to string, data map[string]interface{}, preferences ...string) {
+	if mailTemplates == nil {
+		log.Print("Mail templates are not loaded, can't send " + messageType + " email")
+		return
+	}
+	message, err := mailTemplates.Render(messageType, data, preferences...)
+	if err != nil {
+		log.Print("Could not render " + messageType + " email: " + err.Error())
+		return
+	}
+	message.To = to
+	if err := mailSender.Send(message); err != nil {
+		log.Print("Could not send " + messageType + " email: " + err.Error())
+	}
+}
+
+// createVerifyEmailToken create the single-use token proving user owns its email
+func createVerifyEmailToken(user models.User) (string, error) {
+	claims := Claims{
+		"user_id": user.IDUser,
+		"email":   user.Email,
+		"type":    "verifyemail",
+	}
+	claims.SetIssuedNow().SetExpiryIn(verifyEmailTokenLifetime)
+	_, tokenString, err := tokenAuth.Encode(claims)
+	return tokenString, err
+}
+
+// sendVerificationEmail send user the link to verify its email. acceptLanguage is used if user has no locale.
+func sendVerificationEmail(user models.User, acceptLanguage string) {
+	token, err := createVerifyEmailToken(user)
+	if err != nil {
+		log.Print("Could not generate verification token: " + err.Error())
+		return
+	}
+	sendMail("verify_email", user.Email, map[string]interface{}{
+		"Username": user.Username,
+		"Link":     mailConfig.PublicURL + "/verify?token=" + token,
+	}, user.Locale, acceptLanguage)
+}
+
+// sendPasswordResetEmail send user the link to choose a new password
+func sendPasswordResetEmail(user models.User, token string, acceptLanguage string) {
+	sendMail("password_reset", user.Email, map[string]interface{}{
+		"Username": user.Username,
+		"Link":     mailConfig.PublicURL + "/reset?token=" + token,
+	}, user.Locale, acceptLanguage)
+}
+
+// sendPasswordChangedEmail notify user its password was changed
+func sendPasswordChangedEmail(user models.User, acceptLanguage string) {
+	sendMail("password_changed", user.Email, map[string]interface{}{
+		"Username": user.Username,
+	}, user.Locale, acceptLanguage)
+}
+
+// sendInvitationEmail send the invitation link to invited email, in the language of the inviter
+func sendInvitationEmail(invitation models.Invitation, organisation models.Organisation, inviter models.User, message string, token string, acceptLanguage string) {
+	sendMail("invitation", invitation.Email, map[string]interface{}{
+		"Inviter":      inviter.Username,
+		"Organisation": organisation.OrganisationName,
+		"Message":      message,
+		"Link":         mailConfig.PublicURL + "/invitations/accept?token=" + token,
+	}, inviter.Locale, acceptLanguage)
+}
+
+// sendOrganisationsEmail send an email the organisations it is a member of or invited to
+func sendOrganisationsEmail(email string, organisations []discoveredOrganisation, acceptLanguage string) {
+	sendMail("organisations", email, map[string]interface{}{
+		"Email":         email,
+		"Organisations": organisations,
+		"Link":          mailConfig.PublicURL + "/login",
+	}, acceptLanguage)
+}
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/skip2/go-qrcode"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// mfaIssuer name shown by authenticator applications
+	mfaIssuer = "PopCube"
+	// mfaQRSize size in pixels of enrolment QR codes
+	mfaQRSize = 256
+)
+
+var (
+	errorMFAInvalidCode = utils.NewAPIError(401, "mfa.code.invalid", "Two-factor authentication code is not valid.")
+	errorMFANotEnrolled = utils.NewAPIError(409, "mfa.not.enrolled", "Two-factor authentication enrolment was not started or is already confirmed.")
+	errorMFANotEnabled  = utils.NewAPIError(409, "mfa.not.enabled", "Two-factor authentication is not enabled.")
+	// mfaCodeThrottle limit codes tried for an user, TOTP codes are short enough to be brute forced
+	mfaCodeThrottle = newThrottle(5, 5*time.Minute)
+)
+
+func initMFARoute(router chi.Router) {
+	router.Route("/mfa", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			r.Use(Authenticator)
+			// swagger:route POST /auth/mfa/enrol Auth enrolMFA
+			//
+			// Start two-factor authentication enrolment
+			//
+			// Generate a new TOTP secret for the user. Two-factor authentication is only enabled once a code
+			// generated from the secret is given on /auth/mfa/confirm.
+			//
+			// 	Responses:
+			//    201: mfaEnrolOk
+			// 	  401: unauthorized
+			// 	  409: mfaAlreadyEnabled
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/enrol", enrolMFA)
+			// swagger:route GET /auth/mfa/qr Auth getMFAQRCode
+			//
+			// Get enrolment QR code
+			//
+			// Get the provisioning URI of the pending enrolment as a PNG QR code.
+			//
+			// 	Responses:
+			//    200: pngImage
+			// 	  401: unauthorized
+			// 	  409: mfaNotEnrolled
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Get("/qr", getMFAQRCode)
+			// swagger:route POST /auth/mfa/confirm Auth confirmMFA
+			//
+			// Confirm two-factor authentication enrolment
+			//
+			// Enable two-factor authentication from a TOTP code. Answer holds recovery codes, they are only shown once.
+			//
+			// 	Responses:
+			//    200: mfaRecoveryCodesOk
+			// 	  401: mfaInvalidCode
+			// 	  409: mfaNotEnrolled
+			// 	  422: wrongEntity
+			// 	  429: tooManyRequests
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/confirm", confirmMFA)
+			// swagger:route POST /auth/mfa/disable Auth disableMFA
+			//
+			// Disable two-factor authentication
+			//
+			// Disable two-factor authentication from a TOTP code or a recovery code.
+			//
+			// 	Responses:
+			//    200: generalOk
+			// 	  401: mfaInvalidCode
+			// 	  409: mfaNotEnabled
+			// 	  422: wrongEntity
+			// 	  429: tooManyRequests
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/disable", disableMFA)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			r.Use(tokenTypeOnly("mfa_pending"))
+			// swagger:route POST /auth/mfa/verify Auth verifyMFA
+			//
+			// Finish login with two-factor authentication
+			//
+			// Exchange the mfa_pending token given by /login and a TOTP code or a recovery code for userauth and
+			// refresh tokens. A mfa_pending token can only be used once.
+			//
+			// 	Responses:
+			//    200: loginOk
+			// 	  401: mfaInvalidCode
+			// 	  422: wrongEntity
+			// 	  429: tooManyRequests
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/verify", verifyMFA)
+		})
+	})
+}
+
+// createMFAPendingToken create the token proving user gave a correct password, waiting for its TOTP code
+func createMFAPendingToken(user models.User) (string, error) {
+	claims := Claims{
+		"user_id": user.IDUser,
+		"type":    "mfa_pending",
+	}
+	claims.SetIssuedNow().SetExpiryIn(mfaPendingTokenLifetime)
+	_, tokenString, err := tokenAuth.Encode(claims)
+	return tokenString, err
+}
+
+// newRecoveryCodes generate recovery codes. It returns the clear codes to send to the user and the models to store.
+func newRecoveryCodes() ([]string, []models.RecoveryCode) {
+	clearCodes := make([]string, models.RecoveryCodeCount)
+	recoveryCodes := make([]models.RecoveryCode, models.RecoveryCodeCount)
+	for i := range clearCodes {
+		code := newRandomString(16)
+		clearCodes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		recoveryCodes[i] = models.RecoveryCode{CodeHash: models.HashToken(models.NormalizeRecoveryCode(code))}
+	}
+	return clearCodes, recoveryCodes
+}
+
+// tokenUser load the user owning request token. It returns an empty user if user does not exist anymore, and an
+// error only if datastore failed.
+func tokenUser(r *http.Request) (models.User, *utils.AppError) {
+	userID, _ := ClaimInt64(tokenClaims(r), "user_id")
+	user, apperr := datastores.Store().User().GetByID(r.Context(), uint64(userID), dbStore.db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		return models.EmptyUser, apperr
+	}
+	if apperr != nil || user.Deleted {
+		return models.EmptyUser, nil
+	}
+	return user, nil
+}
+
+// checkMFACode check a TOTP code, or a recovery code if code is empty, and consume it.
+func checkMFACode(ctx context.Context, user *models.User, code string, recoveryCode string) *utils.AppError {
+	store := datastores.Store()
+	db := dbStore.db
+	if !mfaCodeThrottle.Allow(strconv.FormatUint(user.IDUser, 10)) {
+		return errorTooManyRequests
+	}
+	if code != "" {
+		step := utils.ValidateTOTP(user.MFASecret, code, time.Now())
+		if step == 0 {
+			return errorMFAInvalidCode
+		}
+		return store.MFA().UseTOTPStep(ctx, user, step, db)
+	}
+	return store.MFA().UseRecoveryCode(ctx, user, recoveryCode, db)
+}
+
+// mfaEnrolOk response send back when enrolment starts
+type mfaEnrolOk struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// mfaRecoveryCodesOk response send back when two-factor authentication is enabled
+type mfaRecoveryCodesOk struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// mfaCodeRequest object. Either code or recovery_code has to be provided.
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (mCR *mfaCodeRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+func enrolMFA(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := tokenUser(r)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if user.IDUser == 0 {
+		render.JSON(w, error401.StatusCode, error401)
+		return
+	}
+	secret := utils.NewTOTPSecret()
+	if apperr := store.MFA().Enrol(r.Context(), &user, secret, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 201, mfaEnrolOk{Secret: secret, URI: utils.TOTPURI(mfaIssuer, user.Email, secret)})
+}
+
+func getMFAQRCode(w http.ResponseWriter, r *http.Request) {
+	db := dbStore.db
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := tokenUser(r)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if user.IDUser == 0 {
+		render.JSON(w, error401.StatusCode, error401)
+		return
+	}
+	// Secret of an enabled device is never shown again.
+	if user.MFAEnabled || user.MFASecret == "" {
+		render.JSON(w, errorMFANotEnrolled.StatusCode, errorMFANotEnrolled)
+		return
+	}
+	png, err := qrcode.Encode(utils.TOTPURI(mfaIssuer, user.Email, user.MFASecret), qrcode.Medium, mfaQRSize)
+	if err != nil {
+		render.JSON(w, 500, "Could not generate QR code")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(png)
+}
+
+func confirmMFA(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &mfaCodeRequest{}
+	if err := chiRender.Bind(r, data); err != nil || data.Code == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := tokenUser(r)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if user.IDUser == 0 {
+		render.JSON(w, error401.StatusCode, error401)
+		return
+	}
+	if user.MFAEnabled || user.MFASecret == "" {
+		render.JSON(w, errorMFANotEnrolled.StatusCode, errorMFANotEnrolled)
+		return
+	}
+	if !mfaCodeThrottle.Allow(strconv.FormatUint(user.IDUser, 10)) {
+		render.JSON(w, errorTooManyRequests.StatusCode, errorTooManyRequests)
+		return
+	}
+	step := utils.ValidateTOTP(user.MFASecret, data.Code, time.Now())
+	if step == 0 {
+		render.JSON(w, errorMFAInvalidCode.StatusCode, errorMFAInvalidCode)
+		return
+	}
+	clearCodes, recoveryCodes := newRecoveryCodes()
+	if apperr := store.MFA().Enable(r.Context(), &user, recoveryCodes, step, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, 200, mfaRecoveryCodesOk{RecoveryCodes: clearCodes})
+}
+
+func disableMFA(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &mfaCodeRequest{}
+	if err := chiRender.Bind(r, data); err != nil || (data.Code == "" && data.RecoveryCode == "") {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := tokenUser(r)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if user.IDUser == 0 {
+		render.JSON(w, error401.StatusCode, error401)
+		return
+	}
+	if !user.MFAEnabled {
+		render.JSON(w, errorMFANotEnabled.StatusCode, errorMFANotEnabled)
+		return
+	}
+	if apperr := checkMFACode(r.Context(), &user, data.Code, data.RecoveryCode); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr := store.MFA().Disable(r.Context(), &user, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, "Two-factor authentication disabled.")
+}
+
+func verifyMFA(w http.ResponseWriter, r *http.Request) {
+	db := dbStore.db
+	claims := tokenClaims(r)
+	data := &mfaCodeRequest{}
+	if err := chiRender.Bind(r, data); err != nil || (data.Code == "" && data.RecoveryCode == "") {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := tokenUser(r)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if user.IDUser == 0 || !user.MFAEnabled {
+		render.JSON(w, error401.StatusCode, error401)
+		return
+	}
+	if apperr := checkMFACode(r.Context(), &user, data.Code, data.RecoveryCode); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		exp, _ := ClaimInt64(claims, "exp")
+		revoke(r.Context(), models.Revocation{Kind: models.RevocationKindToken, Subject: jti, ExpiresAt: exp})
+	}
+	completeLogin(w, r, user)
+}
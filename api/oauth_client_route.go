@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+const (
+	oldOAuthClientKey key = "oldOAuthClient"
+)
+
+// initOAuthClientRoute set OAuth client registration routes of an organisation. It has to be called inside /organisation/{organisationID}.
+func initOAuthClientRoute(router chi.Router) {
+	router.Route("/oauthclients", func(r chi.Router) {
+		r.Use(RequirePermission(models.PermissionManage))
+		// swagger:route GET /organisation/{organisationID}/oauthclients Organisations getOAuthClients
+		//
+		// Get OAuth clients
+		//
+		// This will return all the OAuth clients registered for the organisation.
+		//
+		// 	Responses:
+		//    200: oauthClientArraySuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Get("/", getOAuthClients)
+		// swagger:route POST /organisation/{organisationID}/oauthclients Organisations newOAuthClient
+		//
+		// New OAuth client
+		//
+		// This will register an OAuth client for the organisation. Answer holds the client secret of confidential
+		// clients, it is only shown once.
+		//
+		// 	Responses:
+		//    201: newOAuthClientOk
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  422: wrongEntity
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/", newOAuthClient)
+		r.Route("/:oauthClientID", func(r chi.Router) {
+			r.Use(oauthClientContext)
+			// swagger:route DELETE /organisation/{organisationID}/oauthclients/{oauthClientID} Organisations revokeOAuthClient
+			//
+			// Revoke OAuth client
+			//
+			// This will revoke the client and every token it was given.
+			//
+			// 	Responses:
+			//    200: oauthClientObjectSuccess
+			// 	  403: forbidden
+			// 	  404: notFound
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Delete("/", revokeOAuthClient)
+		})
+	})
+}
+
+func oauthClientContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "oauthClientID"), 10, 64)
+		if err != nil {
+			render.JSON(w, error404.StatusCode, error404)
+			return
+		}
+		oldOAuthClient, apperr := datastores.Store().OAuth().GetClientByID(r.Context(), id, dbStore.db)
+		if apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+		ctx := context.WithValue(r.Context(), oldOAuthClientKey, oldOAuthClient)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getOAuthClients(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	clients, apperr := store.OAuth().GetClientsByOrganisation(r.Context(), organisation.IDOrganisation, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, clients)
+}
+
+// newOAuthClientRequest object
+type newOAuthClientRequest struct {
+	Name string `json:"name"`
+	// Public clients have no secret and must use PKCE
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// authorization_code and/or client_credentials. Default is authorization_code.
+	GrantTypes []string `json:"grant_types"`
+	Scopes     []string `json:"scopes"`
+}
+
+func (nOCR *newOAuthClientRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// newOAuthClientOk response send back when an OAuth client is registered
+type newOAuthClientOk struct {
+	Client       models.OAuthClient `json:"client"`
+	ClientSecret string             `json:"client_secret,omitempty"`
+}
+
+func newOAuthClient(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &newOAuthClientRequest{}
+	err := chiRender.Bind(r, data)
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err != nil || data.Name == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	client := models.OAuthClient{
+		IDOrganisation:  organisation.IDOrganisation,
+		ClientID:        newRandomString(24),
+		Name:            data.Name,
+		Public:          data.Public,
+		RedirectURIList: data.RedirectURIs,
+		GrantList:       data.GrantTypes,
+		ScopeList:       data.Scopes,
+	}
+	if len(client.GrantList) == 0 {
+		client.GrantList = []string{models.GrantAuthorizationCode}
+	}
+	clearSecret := ""
+	if !client.Public {
+		clearSecret = newRandomString(48)
+		client.SecretHash = models.HashToken(clearSecret)
+	}
+	if apperr := store.OAuth().SaveClient(r.Context(), &client, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, 201, newOAuthClientOk{Client: client, ClientSecret: clearSecret})
+}
+
+func revokeOAuthClient(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	client := r.Context().Value(oldOAuthClientKey).(models.OAuthClient)
+	if client.IDOrganisation != organisation.IDOrganisation {
+		render.JSON(w, error404.StatusCode, error404)
+		return
+	}
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	if apperr := store.OAuth().RevokeClient(r.Context(), &client, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr := revoke(r.Context(), models.Revocation{Kind: models.RevocationKindClient, Subject: client.ClientID, ExpiresAt: ExpireIn(oauthAccessTokenLifetime)}); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, client)
+}
@@ -0,0 +1,603 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pressly/chi"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// errIDTokenSigningKey current signing key is a shared secret, relying parties can not verify id_tokens it signs
+var errIDTokenSigningKey = errors.New("oauth: id_token needs an asymmetric signing key")
+
+// initOAuthRoute set OAuth2 authorization server and OpenID Connect provider routes. Inner stacks use them to login PopCube users.
+func initOAuthRoute(router chi.Router) {
+	router.Route("/oauth", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			// swagger:route GET /oauth/authorize OAuth authorize
+			//
+			// Authorize client
+			//
+			// Authorization endpoint of the authorization code flow. PKCE with S256 is required. User is identified
+			// by its userauth token and sent to the login page if it has none, unless prompt is none. Only users of
+			// the client organisation can authorise it. Answer redirects to the client with a code or an error.
+			// Codes asked with openid scope also give an id_token carrying nonce. openid scope is refused while
+			// tokens are signed with a shared secret, as relying parties could not verify id_tokens.
+			//
+			// 	Responses:
+			//    302: redirect
+			// 	  400: oauthError
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Get("/authorize", authorize)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			r.Use(tokenTypeOnly("oauth_access"))
+			// swagger:route GET /oauth/userinfo OAuth userInfo
+			//
+			// Get user info
+			//
+			// OpenID Connect userinfo endpoint. Access token must be given as Bearer and carry openid scope.
+			// Profile claims are given with profile scope, email ones with email scope.
+			//
+			// 	Responses:
+			//    200: userInfoOk
+			// 	  401: incorrectIds
+			// 	  403: oauthError
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Get("/userinfo", userInfo)
+			// swagger:route POST /oauth/userinfo OAuth userInfoPost
+			//
+			// Get user info
+			//
+			// Same as GET /oauth/userinfo.
+			//
+			// 	Responses:
+			//    200: userInfoOk
+			// 	  401: incorrectIds
+			// 	  403: oauthError
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/userinfo", userInfo)
+		})
+		// swagger:route POST /oauth/token OAuth oauthToken
+		//
+		// Get access token
+		//
+		// Token endpoint for authorization_code and client_credentials grants. Clients authenticate with HTTP basic
+		// or client_id and client_secret form values. Public clients only give their client_id.
+		//
+		// 	Responses:
+		//    200: oauthTokenOk
+		// 	  400: oauthError
+		// 	  401: oauthError
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/token", oauthToken)
+		// swagger:route POST /oauth/introspect OAuth introspectToken
+		//
+		// Introspect token
+		//
+		// Tell if a token is active and give its claims. Only confidential clients can introspect, and only tokens
+		// of their organisation.
+		//
+		// 	Responses:
+		//    200: introspectionOk
+		// 	  401: oauthError
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/introspect", introspectToken)
+		// swagger:route POST /oauth/revoke OAuth revokeOAuthToken
+		//
+		// Revoke token
+		//
+		// Revoke a token issued to the calling client. Answer is the same whether the token was valid or not.
+		//
+		// 	Responses:
+		//    200: generalOk
+		// 	  401: oauthError
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/revoke", revokeOAuthToken)
+	})
+}
+
+// oauthErrorResponse error answer defined by RFC 6749
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// oauthError send an OAuth2 error
+func oauthError(w http.ResponseWriter, status int, code string, description string) {
+	render.JSON(w, status, oauthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// oauthStoreError send datastore error as an OAuth2 error
+func oauthStoreError(w http.ResponseWriter, apperr *utils.AppError) {
+	if apperr.Kind == utils.ErrorUnavailable {
+		oauthError(w, error503.StatusCode, "temporarily_unavailable", error503.Message)
+		return
+	}
+	if apperr.Kind == utils.ErrorTimeout {
+		oauthError(w, error504.StatusCode, "temporarily_unavailable", error504.Message)
+		return
+	}
+	oauthError(w, 500, "server_error", apperr.Message)
+}
+
+// redirectWithParams redirect to uri with params added to its query. Empty params are left out.
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		oauthError(w, 400, "invalid_request", "redirect_uri is not valid.")
+		return
+	}
+	query := target.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			query[k] = v
+		}
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// sessionUser get the user logged in with the userauth token of the request
+func sessionUser(r *http.Request) (models.User, bool) {
+	if jwtErr, ok := r.Context().Value(jwtErrorKey).(error); ok && jwtErr != nil {
+		return models.EmptyUser, false
+	}
+	if tokenClaims(r)["type"] != "userauth" {
+		return models.EmptyUser, false
+	}
+	user, apperr := tokenUser(r)
+	return user, apperr == nil && user.IDUser != 0
+}
+
+// authenticateClient get the client calling the request from HTTP basic credentials or form values.
+// Public clients are authenticated from their client_id alone.
+func authenticateClient(r *http.Request) (models.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1: credentials are form encoded before basic encoding.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" {
+		return models.EmptyOAuthClient, false
+	}
+	client, apperr := datastores.Store().OAuth().GetClientByClientID(r.Context(), clientID, dbStore.db)
+	if apperr != nil || client.Revoked {
+		return models.EmptyOAuthClient, false
+	}
+	if client.Public {
+		return client, secret == ""
+	}
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(models.HashToken(secret))) != 1 {
+		return models.EmptyOAuthClient, false
+	}
+	return client, true
+}
+
+// verifyCodeChallenge check PKCE verifier against the S256 challenge given on authorization
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// createOAuthAccessToken create the access token of a client, for user if one is provided. It returns the token and its jti.
+func createOAuthAccessToken(client models.OAuthClient, user *models.User, scope string) (string, string, error) {
+	jti := newRandomString(26)
+	claims := Claims{
+		"iss":             tokenIssuer,
+		"aud":             client.ClientID,
+		"sub":             client.ClientID,
+		"client_id":       client.ClientID,
+		"organisation_id": client.IDOrganisation,
+		"scope":           scope,
+		"type":            "oauth_access",
+	}
+	if user != nil {
+		claims["sub"] = strconv.FormatUint(user.IDUser, 10)
+		claims["user_id"] = user.IDUser
+		claims["name"] = user.Username
+	}
+	claims.SetID(jti).SetIssuedNow().SetExpiryIn(oauthAccessTokenLifetime)
+	_, tokenString, err := tokenAuth.Encode(claims)
+	return tokenString, jti, err
+}
+
+// userInfoOk OpenID Connect claims of an user. Only claims allowed by the granted scope are filled.
+type userInfoOk struct {
+	Subject           string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Nickname          string `json:"nickname,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// newUserInfo build the claims of user allowed by space separated scope
+func newUserInfo(user models.User, scope string) userInfoOk {
+	info := userInfoOk{Subject: strconv.FormatUint(user.IDUser, 10)}
+	if models.HasScope(scope, models.ScopeProfile) {
+		info.PreferredUsername = user.Username
+		info.Nickname = user.NickName
+		info.GivenName = user.FirstName
+		info.FamilyName = user.LastName
+		info.Locale = user.Locale
+	}
+	if models.HasScope(scope, models.ScopeEmail) {
+		emailVerified := user.EmailVerified
+		info.Email = user.Email
+		info.EmailVerified = &emailVerified
+	}
+	return info
+}
+
+// openIDEnabled state if id_tokens can be issued: they must be signed with a key published in the JWKS (RSA, EC or EdDSA).
+// OpenID Connect would require an HMAC id_token to be keyed with the client secret, which is only stored hashed.
+func openIDEnabled() bool {
+	return !tokenAuth.Keyring().Current().IsSymmetric()
+}
+
+// createIDToken create the OpenID Connect id_token given with the access token of a code asked with openid scope
+func createIDToken(client models.OAuthClient, user models.User, code models.OAuthCode) (string, error) {
+	if !openIDEnabled() {
+		return "", errIDTokenSigningKey
+	}
+	info := newUserInfo(user, code.Scope)
+	claims := Claims{
+		"iss":       tokenIssuer,
+		"sub":       info.Subject,
+		"aud":       client.ClientID,
+		"azp":       client.ClientID,
+		"auth_time": code.AuthTime,
+		"type":      "id_token",
+	}
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+	profile := map[string]string{
+		"preferred_username": info.PreferredUsername,
+		"nickname":           info.Nickname,
+		"given_name":         info.GivenName,
+		"family_name":        info.FamilyName,
+		"locale":             info.Locale,
+		"email":              info.Email,
+	}
+	for claim, value := range profile {
+		if value != "" {
+			claims[claim] = value
+		}
+	}
+	if info.EmailVerified != nil {
+		claims["email_verified"] = *info.EmailVerified
+	}
+	claims.SetIssuedNow().SetExpiryIn(oauthAccessTokenLifetime)
+	_, tokenString, err := tokenAuth.Encode(claims)
+	return tokenString, err
+}
+
+func authorize(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	query := r.URL.Query()
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	client, apperr := store.OAuth().GetClientByClientID(r.Context(), query.Get("client_id"), db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	redirectURI := query.Get("redirect_uri")
+	// Errors are never sent to an uri which was not registered for the client.
+	if apperr != nil || client.Revoked || !client.HasRedirectURI(redirectURI) {
+		oauthError(w, 400, "invalid_request", "Unknown client_id or redirect_uri.")
+		return
+	}
+	state := query.Get("state")
+	fail := func(code string, description string) {
+		redirectWithParams(w, r, redirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {state}})
+	}
+	if query.Get("response_type") != "code" {
+		fail("unsupported_response_type", "Only code response type is supported.")
+		return
+	}
+	if !client.HasGrant(models.GrantAuthorizationCode) {
+		fail("unauthorized_client", "Client can not use authorization code grant.")
+		return
+	}
+	challenge := query.Get("code_challenge")
+	if len(challenge) != 43 || query.Get("code_challenge_method") != models.CodeChallengeS256 {
+		fail("invalid_request", "PKCE code_challenge with S256 method is required.")
+		return
+	}
+	scope, ok := client.AllowedScope(query.Get("scope"))
+	if !ok {
+		fail("invalid_scope", "Requested scope is not allowed for this client.")
+		return
+	}
+	if models.HasScope(scope, models.ScopeOpenID) && !openIDEnabled() {
+		fail("invalid_scope", "OpenID Connect is not available: tokens are not signed with a public key.")
+		return
+	}
+	user, ok := sessionUser(r)
+	if !ok && query.Get("prompt") == "none" {
+		fail("login_required", "User is not logged in.")
+		return
+	}
+	if !ok {
+		// User comes back here once logged in on the front end.
+		http.Redirect(w, r, mailConfig.PublicURL+"/login?next="+url.QueryEscape(tokenIssuer+r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	if user.IDOrganisation != client.IDOrganisation {
+		fail("access_denied", "User does not belong to the client organisation.")
+		return
+	}
+	authTime, _ := ClaimInt64(tokenClaims(r), "iat")
+	clearCode := newRandomString(32)
+	code := models.OAuthCode{
+		CodeHash:      models.HashToken(clearCode),
+		IDOAuthClient: client.IDOAuthClient,
+		IDUser:        user.IDUser,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		CodeChallenge: challenge,
+		ExpiresAt:     ExpireIn(oauthCodeLifetime),
+		Nonce:         query.Get("nonce"),
+		AuthTime:      authTime,
+	}
+	if apperr := store.OAuth().SaveCode(r.Context(), &code, db); apperr != nil {
+		fail("server_error", "Could not save authorization code.")
+		return
+	}
+	redirectWithParams(w, r, redirectURI, url.Values{"code": {clearCode}, "state": {state}})
+}
+
+// oauthTokenOk response send back by token endpoint
+type oauthTokenOk struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+func oauthToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, 400, "invalid_request", "Request body must be form encoded.")
+		return
+	}
+	if err := dbStore.db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	client, ok := authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(w, 401, "invalid_client", "Client authentication failed.")
+		return
+	}
+	switch r.PostForm.Get("grant_type") {
+	case models.GrantAuthorizationCode:
+		exchangeAuthorizationCode(w, r, client)
+	case models.GrantClientCredentials:
+		clientCredentials(w, r, client)
+	default:
+		oauthError(w, 400, "unsupported_grant_type", "Grant type is not supported.")
+	}
+}
+
+func exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client models.OAuthClient) {
+	store := datastores.Store()
+	db := dbStore.db
+	if !client.HasGrant(models.GrantAuthorizationCode) {
+		oauthError(w, 400, "unauthorized_client", "Client can not use authorization code grant.")
+		return
+	}
+	code, apperr := store.OAuth().GetCode(r.Context(), r.PostForm.Get("code"), db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		oauthStoreError(w, apperr)
+		return
+	}
+	if apperr != nil || code.IDOAuthClient != client.IDOAuthClient || code.IsExpired() ||
+		code.RedirectURI != r.PostForm.Get("redirect_uri") || !verifyCodeChallenge(code.CodeChallenge, r.PostForm.Get("code_verifier")) {
+		oauthError(w, 400, "invalid_grant", "Authorization code is invalid or expired.")
+		return
+	}
+	if code.Used {
+		// Code was stolen or replayed: token obtained with it is revoked too.
+		if code.TokenID != "" {
+			revoke(r.Context(), models.Revocation{Kind: models.RevocationKindToken, Subject: code.TokenID, ExpiresAt: ExpireIn(oauthAccessTokenLifetime)})
+		}
+		oauthError(w, 400, "invalid_grant", "Authorization code was already used.")
+		return
+	}
+	user, apperr := store.User().GetByID(r.Context(), code.IDUser, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		oauthStoreError(w, apperr)
+		return
+	}
+	if apperr != nil || user.Deleted || user.IDOrganisation != client.IDOrganisation {
+		oauthError(w, 400, "invalid_grant", "Authorization code is invalid or expired.")
+		return
+	}
+	token, jti, err := createOAuthAccessToken(client, &user, code.Scope)
+	if err != nil {
+		oauthError(w, 500, "server_error", "Could not generate token.")
+		return
+	}
+	response := oauthTokenOk{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(oauthAccessTokenLifetime.Seconds()), Scope: code.Scope}
+	if models.HasScope(code.Scope, models.ScopeOpenID) {
+		if response.IDToken, err = createIDToken(client, user, code); err != nil {
+			oauthError(w, 500, "server_error", "Could not generate token.")
+			return
+		}
+	}
+	if apperr := store.OAuth().ConsumeCode(r.Context(), &code, jti, db); apperr != nil {
+		oauthError(w, 400, "invalid_grant", "Authorization code was already used.")
+		return
+	}
+	render.JSON(w, 200, response)
+}
+
+func clientCredentials(w http.ResponseWriter, r *http.Request, client models.OAuthClient) {
+	if client.Public || !client.HasGrant(models.GrantClientCredentials) {
+		oauthError(w, 400, "unauthorized_client", "Client can not use client credentials grant.")
+		return
+	}
+	scope, ok := client.AllowedScope(r.PostForm.Get("scope"))
+	if !ok {
+		oauthError(w, 400, "invalid_scope", "Requested scope is not allowed for this client.")
+		return
+	}
+	token, _, err := createOAuthAccessToken(client, nil, scope)
+	if err != nil {
+		oauthError(w, 500, "server_error", "Could not generate token.")
+		return
+	}
+	render.JSON(w, 200, oauthTokenOk{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(oauthAccessTokenLifetime.Seconds()), Scope: scope})
+}
+
+// introspectionOk response send back by introspection endpoint, as defined by RFC 7662
+type introspectionOk struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// activeToken decode a token and state if it can still be used
+func activeToken(tokenString string) (jwt.MapClaims, bool) {
+	token, err := tokenAuth.Decode(tokenString)
+	if err != nil || token == nil || !token.Valid || tokenAuth.IsExpired(token) || tokenAuth.IsRevoked(token) {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+func introspectToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("token") == "" {
+		oauthError(w, 400, "invalid_request", "token is required.")
+		return
+	}
+	if err := dbStore.db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	client, ok := authenticateClient(r)
+	if !ok || client.Public {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(w, 401, "invalid_client", "Client authentication failed.")
+		return
+	}
+	claims, ok := activeToken(r.PostForm.Get("token"))
+	organisationID, _ := ClaimInt64(claims, "organisation_id")
+	if !ok || uint64(organisationID) != client.IDOrganisation {
+		render.JSON(w, 200, introspectionOk{Active: false})
+		return
+	}
+	response := introspectionOk{Active: true}
+	response.Scope, _ = claims["scope"].(string)
+	response.ClientID, _ = claims["client_id"].(string)
+	response.Username, _ = claims["name"].(string)
+	response.Subject, _ = claims["sub"].(string)
+	response.Audience, _ = claims["aud"].(string)
+	response.Issuer, _ = claims["iss"].(string)
+	response.TokenType, _ = claims["type"].(string)
+	response.ExpiresAt, _ = ClaimInt64(claims, "exp")
+	response.IssuedAt, _ = ClaimInt64(claims, "iat")
+	response.ID, _ = claims["jti"].(string)
+	render.JSON(w, 200, response)
+}
+
+func revokeOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("token") == "" {
+		oauthError(w, 400, "invalid_request", "token is required.")
+		return
+	}
+	if err := dbStore.db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	client, ok := authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(w, 401, "invalid_client", "Client authentication failed.")
+		return
+	}
+	// Invalid, expired or foreign tokens are ignored, as required by RFC 7009.
+	claims, ok := activeToken(r.PostForm.Get("token"))
+	if jti, _ := claims["jti"].(string); ok && jti != "" && claims["client_id"] == client.ClientID {
+		exp, _ := ClaimInt64(claims, "exp")
+		if apperr := revoke(r.Context(), models.Revocation{Kind: models.RevocationKindToken, Subject: jti, ExpiresAt: exp}); apperr != nil {
+			oauthError(w, 503, "temporarily_unavailable", "Could not revoke token.")
+			return
+		}
+	}
+	w.WriteHeader(200)
+}
+
+func userInfo(w http.ResponseWriter, r *http.Request) {
+	claims := tokenClaims(r)
+	scope, _ := claims["scope"].(string)
+	userID, _ := ClaimInt64(claims, "user_id")
+	if !models.HasScope(scope, models.ScopeOpenID) || userID == 0 {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		oauthError(w, 403, "insufficient_scope", "Token was not granted openid scope.")
+		return
+	}
+	if err := dbStore.db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := tokenUser(r)
+	if apperr != nil {
+		oauthStoreError(w, apperr)
+		return
+	}
+	organisationID, _ := ClaimInt64(claims, "organisation_id")
+	if user.IDUser == 0 || user.IDOrganisation != uint64(organisationID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(w, 401, "invalid_token", "User of the token does not exist anymore.")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, 200, newUserInfo(user, scope))
+}
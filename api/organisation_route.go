@@ -17,86 +17,145 @@ const (
 
 func initOrganisationRoute(router chi.Router) {
 	router.Route("/organisation", func(r chi.Router) {
-		// r.Use(tokenAuth.Verifier)
-		// r.Use(Authenticator)
-		// swagger:route GET /organisation Organisations getAllOrganisation
-		//
-		// Get organisations
-		//
-		// This will get all the organisations available in the organisation.
-		//
-		// 	Responses:
-		//    200: organisationObjectSuccess
-		// 	  503: databaseError
-		// 	  default: genericError
-		r.Get("/", getAllOrganisation)
-		// swagger:route POST /organisation Organisations newOrganisation
-		//
-		// New organisation
-		//
-		// This will create an organisation for organisation organisations library.
-		//
-		// 	Responses:
-		//    201: organisationObjectSuccess
-		// 	  422: wrongEntity
-		// 	  503: databaseError
-		// 	  default: genericError
-		r.Post("/", newOrganisation)
-		// swagger:route GET /organisation/all Organisations getAllOrganisation1
-		//
-		// Get organisations
-		//
-		// This will get all the organisations available in the organisation.
-		//
-		// 	Responses:
-		//    200: organisationObjectSuccess
-		// 	  503: databaseError
-		// 	  default: genericError
-		r.Get("/all", getAllOrganisation)
-		// swagger:route POST /organisation/new Organisations newOrganisation1
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			r.Use(APIKeyVerifier)
+			r.Use(Authenticator)
+			r.Use(RequirePermission(models.PermissionRead))
+			// swagger:route GET /organisation Organisations getAllOrganisation
+			//
+			// Get organisations
+			//
+			// This will get the organisation of the authenticated user.
+			//
+			// 	Responses:
+			//    200: organisationObjectSuccess
+			// 	  403: forbidden
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Get("/", getAllOrganisation)
+			// swagger:route GET /organisation/all Organisations getAllOrganisation1
+			//
+			// Get organisations
+			//
+			// This will get the organisation of the authenticated user.
+			//
+			// 	Responses:
+			//    200: organisationObjectSuccess
+			// 	  403: forbidden
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Get("/all", getAllOrganisation)
+		})
+		r.Group(func(r chi.Router) {
+			// Organisations are not created by their users: owners use /initorganisation.
+			r.Use(operatorOnly)
+			// swagger:route POST /organisation Organisations newOrganisation
+			//
+			// New organisation
+			//
+			// This will create an organisation for organisation organisations library.
+			//
+			// 	Responses:
+			//    201: organisationObjectSuccess
+			// 	  401: notOperator
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/", newOrganisation)
+			// swagger:route POST /organisation/new Organisations newOrganisation1
+			//
+			// New organisation
+			//
+			// This will create an organisation for organisation organisations library.
+			//
+			// 	Responses:
+			//    201: organisationObjectSuccess
+			// 	  401: notOperator
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/new", newOrganisation)
+		})
+		// swagger:route POST /organisation/{organisationName}/signup Organisations signup
 		//
-		// New organisation
+		// Sign up
 		//
-		// This will create an organisation for organisation organisations library.
+		// This will create an account in the organisation. Anyone can join a public organisation. Private ones
+		// only accept users with an email in an allowed domain, who get no role until their email is verified.
+		// Invited users use POST /invitations/accept. Disposable email domains are refused and requests are
+		// throttled by address. Account email is unverified until the link sent by email is used.
 		//
 		// 	Responses:
-		//    201: organisationObjectSuccess
+		//    201: userObjectSuccess
+		// 	  403: signupNotAllowed
+		// 	  404: notFound
 		// 	  422: wrongEntity
+		// 	  429: tooManyRequests
 		// 	  503: databaseError
 		// 	  default: genericError
-		r.Post("/new", newOrganisation)
+		r.Post("/:organisationName/signup", signup)
 		r.Route("/:organisationID", func(r chi.Router) {
-			r.Use(organisationContext)
-			// swagger:route PUT /organisation/{organisationID} Organisations updateOrganisation
-			//
-			// Get organisation from link
-			//
-			// This will return the organisation object corresponding to provided link
-			//
-			// 	Responses:
-			//    200: organisationObjectSuccess
-			// 	  503: databaseError
-			// 	  default: genericError
-			r.Put("/update", updateOrganisation)
+			r.Group(func(r chi.Router) {
+				r.Use(tokenAuth.Verifier)
+				r.Use(APIKeyVerifier)
+				r.Use(Authenticator)
+				r.Use(organisationContext)
+				r.Route("/update", func(r chi.Router) {
+					r.Use(RequirePermission(models.PermissionManage))
+					// swagger:route PUT /organisation/{organisationID}/update Organisations updateOrganisation
+					//
+					// Update organisation
+					//
+					// This will return the new organisation object. Fields not given keep their values, policies
+					// given as false are turned off.
+					//
+					// 	Responses:
+					//    200: organisationObjectSuccess
+					// 	  403: forbidden
+					// 	  404: notFound
+					// 	  422: wrongEntity
+					// 	  503: databaseError
+					// 	  default: genericError
+					r.Put("/", updateOrganisation)
+				})
+				r.Route("/invitations", func(r chi.Router) {
+					r.Use(RequirePermission(models.PermissionInvite))
+					// swagger:route GET /organisation/{organisationID}/invitations Organisations getOrganisationInvitations
+					//
+					// Get organisation invitations
+					//
+					// This will return all the invitations sent for the organisation, whatever their status.
+					//
+					// 	Responses:
+					//    200: invitationArraySuccess
+					// 	  403: forbidden
+					// 	  404: notFound
+					// 	  503: databaseError
+					// 	  default: genericError
+					r.Get("/", getOrganisationInvitations)
+				})
+				initServiceAccountRoute(r)
+				initOAuthClientRoute(r)
+				initIdentityProviderRoute(r)
+				initAllowedEmailDomainRoute(r)
+			})
 		})
 	})
 }
 
-// func canManageOrganisation(token *jwt.Token) bool {
-// 	store := datastores.Store()
-// 	db := dbStore.db
-// 	userName := token.Claims.(jwt.MapClaims)["name"].(string)
-// 	user := store.User().GetByUserName(userName, db)
-// 	userRights := store.Role().GetByID(user.IDRole, db)
-// 	return userRights.CanManage
-// }
-
+// organisationContext get organisation of the url. Requests stop there if it does not exist.
 func organisationContext(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id, err := strconv.ParseUint(chi.URLParam(r, "organisationID"), 10, 64)
-		oldOrganisation := models.EmptyOrganisation
-		if err == nil {
-			oldOrganisation = datastores.Store().Organisation().GetByID(id, dbStore.db)
+		if err != nil {
+			render.JSON(w, error404.StatusCode, error404)
+			return
+		}
+		oldOrganisation, apperr := datastores.Store().Organisation().GetByID(r.Context(), id, dbStore.db)
+		if apperr != nil {
+			renderAppError(w, apperr)
+			return
 		}
 		ctx := context.WithValue(r.Context(), oldOrganisationKey, oldOrganisation)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -110,24 +169,27 @@ func getAllOrganisation(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, error503.StatusCode, error503)
 		return
 	}
-	result := store.Organisation().Get(db)
-	render.JSON(w, 200, result)
+	// Users only see their own organisation: others are not disclosed.
+	organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id")
+	organisation, apperr := store.Organisation().GetByID(r.Context(), uint64(organisationID), db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, []models.Organisation{organisation})
 }
 
 type newOrganisationRequest struct {
-	Organisation models.Organisation
-	Owner        models.User
+	Organisation models.Organisation `json:"organisation"`
+	Owner        models.User         `json:"owner"`
+}
+
+func (nOR *newOrganisationRequest) Bind(r *http.Request) error {
+	return nil
 }
 
 func newOrganisation(w http.ResponseWriter, r *http.Request) {
 	var Organisation models.Organisation
-	// token := r.Context().Value(jwtTokenKey).(*jwt.Token)
-	// if !canManageOrganisation(token) {
-	// 	res := error401
-	// 	res.Message = "You don't have the right to manage organisation."
-	// 	render.JSON(w, error401.StatusCode, error401)
-	// 	return
-	// }
 	store := datastores.Store()
 	db := dbStore.db
 	err := chiRender.Bind(r, &Organisation)
@@ -139,38 +201,61 @@ func newOrganisation(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, error503.StatusCode, error503)
 		return
 	}
-	apperr := store.Organisation().Save(&Organisation, db)
+	apperr := store.Organisation().Save(r.Context(), &Organisation, db)
 	if apperr != nil {
-		render.JSON(w, apperr.StatusCode, apperr)
+		renderAppError(w, apperr)
 		return
 	}
 	render.JSON(w, 201, Organisation)
 }
 
 func updateOrganisation(w http.ResponseWriter, r *http.Request) {
-	var Organisation models.Organisation
 	store := datastores.Store()
 	db := dbStore.db
-	// token := r.Context().Value(jwtTokenKey).(*jwt.Token)
-	// if !canManageOrganisation(token) {
-	// 	res := error401
-	// 	res.Message = "You don't have the right to manage organisation."
-	// 	render.JSON(w, error401.StatusCode, error401)
-	// 	return
-	// }
-	err := chiRender.Bind(r, &Organisation)
 	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
-	if err != nil || Organisation == (models.EmptyOrganisation) {
+	// Body is read over current values, so fields it does not give are kept and policies can be set to false.
+	Organisation := organisation
+	err := chiRender.Bind(r, &Organisation)
+	Organisation.IDOrganisation = organisation.IDOrganisation
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err != nil {
 		render.JSON(w, error422.StatusCode, error422)
+		return
 	}
 	if err := db.DB().Ping(); err != nil {
 		render.JSON(w, error503.StatusCode, error503)
 		return
 	}
-	apperr := store.Organisation().Update(&organisation, &Organisation, db)
+	apperr := store.Organisation().Update(r.Context(), &organisation, &Organisation, db)
 	if apperr != nil {
-		render.JSON(w, apperr.StatusCode, apperr)
+		renderAppError(w, apperr)
 		return
 	}
 	render.JSON(w, 200, organisation)
 }
+
+func getOrganisationInvitations(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	invitations, apperr := store.Invitation().GetByOrganisation(r.Context(), organisation.IDOrganisation, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	for i := range invitations {
+		invitations[i].Status = invitations[i].CurrentStatus()
+	}
+	render.JSON(w, 200, invitations)
+}
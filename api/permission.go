@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	userRoleKey key = "userRole"
+)
+
+var (
+	// errorMFARequired organisation requires two-factor authentication for admins
+	errorMFARequired = utils.NewAPIError(403, "mfa.required", "Your organisation requires two-factor authentication to use admin rights. Please enable it first.")
+)
+
+// RequirePermission allow request only if the role of the authenticated user grants permission.
+// It has to be used after Authenticator. Role is put in request context for handlers.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			db := dbStore.db
+			if err := db.DB().Ping(); err != nil {
+				render.JSON(w, error503.StatusCode, error503)
+				return
+			}
+			user, role, apperr := currentRole(r)
+			if apperr != nil {
+				renderAppError(w, apperr)
+				return
+			}
+			if !role.HasPermission(permission) {
+				render.JSON(w, error403.StatusCode, error403)
+				return
+			}
+			// Service accounts have no user: their keys are their only factor.
+			if role.IsAdmin() && user.IDUser != 0 && !user.MFAEnabled {
+				organisation, apperr := datastores.Store().Organisation().GetByID(r.Context(), user.IDOrganisation, db)
+				if apperr != nil {
+					renderAppError(w, apperr)
+					return
+				}
+				if organisation.RequireAdminMFA {
+					render.JSON(w, errorMFARequired.StatusCode, errorMFARequired)
+					return
+				}
+			}
+			ctx := context.WithValue(r.Context(), userRoleKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// currentRole load the user owning request token and its role. Role is read from database so rights changes apply at once.
+// Service accounts get an empty user and a role made of their key scopes. Users which can not be trusted get a forbidden error.
+func currentRole(r *http.Request) (models.User, models.Role, *utils.AppError) {
+	store := datastores.Store()
+	db := dbStore.db
+	claims := tokenClaims(r)
+	organisationID, _ := ClaimInt64(claims, "organisation_id")
+	if _, ok := ClaimInt64(claims, "service_account_id"); ok {
+		scope, _ := claims["scope"].(string)
+		if organisationID == 0 {
+			return models.EmptyUser, models.EmptyRole, error403
+		}
+		return models.EmptyUser, models.ScopesRole(uint64(organisationID), strings.Fields(scope)), nil
+	}
+	userID, ok := ClaimInt64(claims, "user_id")
+	if !ok {
+		return models.EmptyUser, models.EmptyRole, error403
+	}
+	user, apperr := store.User().GetByID(r.Context(), uint64(userID), db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		return models.EmptyUser, models.EmptyRole, apperr
+	}
+	if apperr != nil || user.Deleted || user.IDRole == 0 || user.IDOrganisation != uint64(organisationID) {
+		return models.EmptyUser, models.EmptyRole, error403
+	}
+	role, apperr := store.Role().GetByID(r.Context(), user.IDRole, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		return models.EmptyUser, models.EmptyRole, apperr
+	}
+	if apperr != nil || role.IDOrganisation != user.IDOrganisation {
+		return models.EmptyUser, models.EmptyRole, error403
+	}
+	return user, role, nil
+}
+
+// sameOrganisation state if request token was issued for provided organisation
+func sameOrganisation(r *http.Request, organisation models.Organisation) bool {
+	organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id")
+	return organisation.IDOrganisation != 0 && uint64(organisationID) == organisation.IDOrganisation
+}
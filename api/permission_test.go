@@ -0,0 +1,52 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+func TestPermissions(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "popcube", false)
+	other := newTestOrganisation(t, "other", false)
+	newTestUser(t, organisation, "member", models.RoleMember)
+	newTestUser(t, organisation, "admin", models.RoleAdmin)
+	newTestUser(t, other, "stranger", models.RoleOwner)
+	tokens := map[string]string{}
+	for _, username := range []string{"member", "admin", "stranger"} {
+		tokens[username] = login(t, router, username).Token
+	}
+	update := "/alpha/organisation/" + strconv.FormatUint(organisation.IDOrganisation, 10) + "/update"
+
+	cases := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		body   interface{}
+		status int
+	}{
+		{name: "anonymous reads users", method: "GET", target: "/alpha/user", status: 401},
+		{name: "member reads users", method: "GET", target: "/alpha/user", token: "member", status: 200},
+		{name: "member creates user", method: "POST", target: "/alpha/user", token: "member", body: signupBody("bob", "bob@popcube.xyz"), status: 403},
+		{name: "admin creates user", method: "POST", target: "/alpha/user", token: "admin", body: signupBody("carol", "carol@popcube.xyz"), status: 201},
+		{name: "member updates organisation", method: "PUT", target: update, token: "member", body: map[string]bool{"public": true}, status: 403},
+		{name: "owner of another organisation updates it", method: "PUT", target: update, token: "stranger", body: map[string]bool{"public": true}, status: 403},
+	}
+	recorder := doJSON(router, "GET", "/alpha/user", tokens["stranger"], nil)
+	users := []models.User{}
+	decodeBody(t, recorder, &users)
+	if len(users) != 1 || users[0].Username != "stranger" {
+		t.Errorf("users of other organisations are listed: %s", recorder.Body.String())
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := doJSON(router, c.method, c.target, tokens[c.token], c.body)
+			if recorder.Code != c.status {
+				t.Errorf("status %d, want %d: %s", recorder.Code, c.status, recorder.Body.String())
+			}
+		})
+	}
+}
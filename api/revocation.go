@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// revocationRefreshPeriod how often revocations made by other api instances are loaded
+	revocationRefreshPeriod = 30 * time.Second
+)
+
+var (
+	revocations = newRevocationList()
+)
+
+// revocationList in-process cache of the revocation list stored in database. Verify consult it on each request,
+// so database is only read every revocationRefreshPeriod.
+type revocationList struct {
+	mutex         sync.RWMutex
+	tokens        map[string]bool
+	users         map[uint64]int64
+	organisations map[uint64]int64
+	clients       map[string]int64
+	loadedAt      time.Time
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{
+		tokens:        map[string]bool{},
+		users:         map[uint64]int64{},
+		organisations: map[uint64]int64{},
+		clients:       map[string]int64{},
+	}
+}
+
+// IsRevoked implements RevocationChecker. Dates are in seconds: tokens issued in the second of an user, organisation or
+// client revocation are revoked too. revoke only answers once that second is over, so tokens issued after it are valid.
+func (rl *revocationList) IsRevoked(claims jwt.MapClaims) bool {
+	rl.refreshIfStale()
+	rl.mutex.RLock()
+	defer rl.mutex.RUnlock()
+	if jti, ok := claims["jti"].(string); ok && rl.tokens[jti] {
+		return true
+	}
+	issuedAt, _ := ClaimInt64(claims, "iat")
+	if userID, ok := ClaimInt64(claims, "user_id"); ok {
+		if revokedAt, ok := rl.users[uint64(userID)]; ok && issuedAt <= revokedAt {
+			return true
+		}
+	}
+	if organisationID, ok := ClaimInt64(claims, "organisation_id"); ok {
+		if revokedAt, ok := rl.organisations[uint64(organisationID)]; ok && issuedAt <= revokedAt {
+			return true
+		}
+	}
+	if clientID, ok := claims["client_id"].(string); ok {
+		if revokedAt, ok := rl.clients[clientID]; ok && issuedAt <= revokedAt {
+			return true
+		}
+	}
+	return false
+}
+
+// add put a revocation in cache without waiting next refresh
+func (rl *revocationList) add(revocation models.Revocation) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	switch revocation.Kind {
+	case models.RevocationKindToken:
+		rl.tokens[revocation.Subject] = true
+	case models.RevocationKindUser:
+		if id, err := strconv.ParseUint(revocation.Subject, 10, 64); err == nil {
+			rl.users[id] = revocation.RevokedAt
+		}
+	case models.RevocationKindOrganisation:
+		if id, err := strconv.ParseUint(revocation.Subject, 10, 64); err == nil {
+			rl.organisations[id] = revocation.RevokedAt
+		}
+	case models.RevocationKindClient:
+		rl.clients[revocation.Subject] = revocation.RevokedAt
+	}
+}
+
+// refreshIfStale reload the list from database if it is older than revocationRefreshPeriod.
+// If database can not be reached, the last known list is kept.
+func (rl *revocationList) refreshIfStale() {
+	rl.mutex.RLock()
+	stale := time.Since(rl.loadedAt) > revocationRefreshPeriod
+	rl.mutex.RUnlock()
+	if !stale {
+		return
+	}
+	rl.mutex.Lock()
+	if time.Since(rl.loadedAt) <= revocationRefreshPeriod {
+		rl.mutex.Unlock()
+		return
+	}
+	// Set date first so concurrent requests do not all hit the database.
+	rl.loadedAt = time.Now()
+	rl.mutex.Unlock()
+
+	db := dbStore.db
+	if db == nil || db.DB().Ping() != nil {
+		log.Print("Can't refresh token revocation list")
+		return
+	}
+	// List is shared by every request: loading it does not stop with the one which started it.
+	active, apperr := datastores.Store().Revocation().GetActive(context.Background(), EpochNow(), db)
+	if apperr != nil {
+		log.Print("Can't refresh token revocation list")
+		return
+	}
+	fresh := newRevocationList()
+	fresh.loadedAt = rl.loadedAt
+	for _, revocation := range active {
+		fresh.add(revocation)
+	}
+	rl.mutex.Lock()
+	rl.tokens, rl.users, rl.organisations, rl.clients = fresh.tokens, fresh.users, fresh.organisations, fresh.clients
+	rl.mutex.Unlock()
+}
+
+// revoke save revocation in database and cache. User, organisation and client revocations return once their second
+// is over, so tokens issued after them, as on login after a password reset, take a later "iat" and stay valid.
+func revoke(ctx context.Context, revocation models.Revocation) *utils.AppError {
+	if apperr := datastores.Store().Revocation().Save(ctx, &revocation, dbStore.db); apperr != nil {
+		return apperr
+	}
+	revocations.add(revocation)
+	if revocation.Kind != models.RevocationKindToken {
+		time.Sleep(time.Until(time.Unix(revocation.RevokedAt+1, 0)))
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	oldServiceAccountKey key = "oldServiceAccount"
+	oldAPIKeyKey         key = "oldAPIKey"
+)
+
+var (
+	errorServiceAccountDisabled = utils.NewAPIError(409, "service.account.disabled", "Service account is disabled.")
+)
+
+// initServiceAccountRoute set service account routes of an organisation. It has to be called inside /organisation/{organisationID}.
+func initServiceAccountRoute(router chi.Router) {
+	router.Route("/serviceaccounts", func(r chi.Router) {
+		r.Use(RequirePermission(models.PermissionManage))
+		// swagger:route GET /organisation/{organisationID}/serviceaccounts Organisations getServiceAccounts
+		//
+		// Get service accounts
+		//
+		// This will return all the service accounts of the organisation.
+		//
+		// 	Responses:
+		//    200: serviceAccountArraySuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Get("/", getServiceAccounts)
+		// swagger:route POST /organisation/{organisationID}/serviceaccounts Organisations newServiceAccount
+		//
+		// New service account
+		//
+		// This will create a service account in the organisation. Use its keys in X-API-Key header.
+		//
+		// 	Responses:
+		//    201: serviceAccountObjectSuccess
+		// 	  403: forbidden
+		// 	  404: notFound
+		// 	  422: wrongEntity
+		// 	  503: databaseError
+		// 	  default: genericError
+		r.Post("/", newServiceAccount)
+		r.Route("/:serviceAccountID", func(r chi.Router) {
+			r.Use(serviceAccountContext)
+			// swagger:route DELETE /organisation/{organisationID}/serviceaccounts/{serviceAccountID} Organisations disableServiceAccount
+			//
+			// Disable service account
+			//
+			// This will disable the service account and revoke all its keys.
+			//
+			// 	Responses:
+			//    200: serviceAccountObjectSuccess
+			// 	  403: forbidden
+			// 	  404: notFound
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Delete("/", disableServiceAccount)
+			// swagger:route GET /organisation/{organisationID}/serviceaccounts/{serviceAccountID}/keys Organisations getAPIKeys
+			//
+			// Get API keys
+			//
+			// This will return the keys of the service account. Only their prefix is shown.
+			//
+			// 	Responses:
+			//    200: apiKeyArraySuccess
+			// 	  403: forbidden
+			// 	  404: notFound
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Get("/keys", getAPIKeys)
+			// swagger:route POST /organisation/{organisationID}/serviceaccounts/{serviceAccountID}/keys Organisations newAPIKey
+			//
+			// New API key
+			//
+			// This will create a key for the service account. Scopes can not grant more than the rights of the creator.
+			// Answer holds the key, it is only shown once.
+			//
+			// 	Responses:
+			//    201: newAPIKeyOk
+			// 	  403: forbidden
+			// 	  404: notFound
+			// 	  409: serviceAccountDisabled
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/keys", createAPIKey)
+			r.Route("/keys/:apiKeyID", func(r chi.Router) {
+				r.Use(apiKeyContext)
+				// swagger:route DELETE /organisation/{organisationID}/serviceaccounts/{serviceAccountID}/keys/{apiKeyID} Organisations revokeAPIKey
+				//
+				// Revoke API key
+				//
+				// This will revoke the key. It can not be used anymore.
+				//
+				// 	Responses:
+				//    200: apiKeyObjectSuccess
+				// 	  403: forbidden
+				// 	  404: notFound
+				// 	  503: databaseError
+				// 	  default: genericError
+				r.Delete("/", revokeAPIKey)
+			})
+		})
+	})
+}
+
+func serviceAccountContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "serviceAccountID"), 10, 64)
+		if err != nil {
+			render.JSON(w, error404.StatusCode, error404)
+			return
+		}
+		oldServiceAccount, apperr := datastores.Store().ServiceAccount().GetByID(r.Context(), id, dbStore.db)
+		if apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+		ctx := context.WithValue(r.Context(), oldServiceAccountKey, oldServiceAccount)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func apiKeyContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "apiKeyID"), 10, 64)
+		if err != nil {
+			render.JSON(w, error404.StatusCode, error404)
+			return
+		}
+		oldAPIKey, apperr := datastores.Store().ServiceAccount().GetAPIKeyByID(r.Context(), id, dbStore.db)
+		if apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+		ctx := context.WithValue(r.Context(), oldAPIKeyKey, oldAPIKey)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestServiceAccount get service account of the url. It writes the error and returns false if the account
+// does not exist or is not in the organisation of the url and of the request token.
+func requestServiceAccount(w http.ResponseWriter, r *http.Request) (models.ServiceAccount, bool) {
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	serviceAccount := r.Context().Value(oldServiceAccountKey).(models.ServiceAccount)
+	if serviceAccount.IDOrganisation != organisation.IDOrganisation {
+		render.JSON(w, error404.StatusCode, error404)
+		return serviceAccount, false
+	}
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return serviceAccount, false
+	}
+	return serviceAccount, true
+}
+
+func getServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	serviceAccounts, apperr := store.ServiceAccount().GetByOrganisation(r.Context(), organisation.IDOrganisation, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, serviceAccounts)
+}
+
+func newServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var ServiceAccount models.ServiceAccount
+	store := datastores.Store()
+	db := dbStore.db
+	err := chiRender.Bind(r, &ServiceAccount)
+	organisation := r.Context().Value(oldOrganisationKey).(models.Organisation)
+	if !sameOrganisation(r, organisation) {
+		render.JSON(w, error403.StatusCode, error403)
+		return
+	}
+	if err != nil || ServiceAccount.Name == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	serviceAccount := models.ServiceAccount{
+		IDOrganisation: organisation.IDOrganisation,
+		Name:           ServiceAccount.Name,
+		Description:    ServiceAccount.Description,
+	}
+	if apperr := store.ServiceAccount().Save(r.Context(), &serviceAccount, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 201, serviceAccount)
+}
+
+func disableServiceAccount(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	serviceAccount, ok := requestServiceAccount(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	if apperr := store.ServiceAccount().Disable(r.Context(), &serviceAccount, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, serviceAccount)
+}
+
+func getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	serviceAccount, ok := requestServiceAccount(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	apiKeys, apperr := store.ServiceAccount().GetAPIKeys(r.Context(), serviceAccount.IDServiceAccount, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, apiKeys)
+}
+
+// newAPIKeyRequest object. Key does not expire if expires_in is 0.
+type newAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Permissions given to the key: manage, manage_user or invite
+	Scopes []string `json:"scopes"`
+	// Key lifetime in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+func (nAKR *newAPIKeyRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// newAPIKeyOk response send back when an API key is created
+type newAPIKeyOk struct {
+	APIKey models.APIKey `json:"api_key"`
+	Key    string        `json:"key"`
+}
+
+func createAPIKey(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &newAPIKeyRequest{}
+	serviceAccount, ok := requestServiceAccount(w, r)
+	if !ok {
+		return
+	}
+	if err := chiRender.Bind(r, data); err != nil || data.ExpiresIn < 0 {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	// A key can not do more than the one who created it.
+	role := r.Context().Value(userRoleKey).(models.Role)
+	for _, scope := range data.Scopes {
+		if !role.HasPermission(scope) {
+			render.JSON(w, error403.StatusCode, error403)
+			return
+		}
+	}
+	if serviceAccount.Disabled {
+		render.JSON(w, errorServiceAccountDisabled.StatusCode, errorServiceAccountDisabled)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	clearKey, apiKey := newAPIKey(serviceAccount)
+	apiKey.Name = data.Name
+	apiKey.ScopeList = data.Scopes
+	if data.ExpiresIn > 0 {
+		apiKey.ExpiresAt = ExpireIn(time.Duration(data.ExpiresIn) * time.Second)
+	}
+	if apperr := store.ServiceAccount().SaveAPIKey(r.Context(), &apiKey, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, 201, newAPIKeyOk{APIKey: apiKey, Key: clearKey})
+}
+
+func revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	serviceAccount, ok := requestServiceAccount(w, r)
+	if !ok {
+		return
+	}
+	apiKey := r.Context().Value(oldAPIKeyKey).(models.APIKey)
+	if apiKey.IDServiceAccount != serviceAccount.IDServiceAccount {
+		render.JSON(w, error404.StatusCode, error404)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	if apperr := store.ServiceAccount().RevokeAPIKey(r.Context(), &apiKey, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, apiKey)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pressly/chi"
+	chiRender "github.com/pressly/chi/render"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	errorSignupNotAllowed = utils.NewAPIError(403, "signup.not.allowed", "This organisation only accepts invited users, with their invitation, or users of its email domains.")
+	errorDisposableEmail  = utils.NewAPIError(422, "signup.email.disposable", "Disposable email addresses can not be used to sign up.")
+	// signupIPThrottle limit accounts created from an address
+	signupIPThrottle = newThrottle(10, time.Hour)
+)
+
+// signupRequest fields an user chooses when its account is created, by signup, user creation or invitation
+type signupRequest struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Avatar    string `json:"avatar"`
+	NickName  string `json:"nickname"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Locale    string `json:"locale"`
+}
+
+func (sR *signupRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// toUser build the user of organisation the request creates. Id, role, email verification and two-factor
+// authentication are set by the server only.
+func (sR *signupRequest) toUser(IDOrganisation uint64) models.User {
+	return models.User{
+		Username:       sR.Username,
+		Email:          strings.ToLower(strings.TrimSpace(sR.Email)),
+		Password:       sR.Password,
+		Avatar:         sR.Avatar,
+		NickName:       sR.NickName,
+		FirstName:      sR.FirstName,
+		LastName:       sR.LastName,
+		Locale:         sR.Locale,
+		IDOrganisation: IDOrganisation,
+	}
+}
+
+// signup create an account in the organisation named by the {organisationName} url segment. Anyone can join a
+// public organisation. Private ones only accept users of their allowed email domains: those accounts stay pending,
+// without role, until their email is verified. Invited users join through /invitations/accept with their token.
+// Accounts are created with an unverified email and a verification email is sent.
+func signup(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &signupRequest{}
+	if err := chiRender.Bind(r, data); err != nil || data.Username == "" || data.Email == "" || data.Password == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if !models.IsValidPassword(data.Password) {
+		render.JSON(w, errorInvalidPassword.StatusCode, errorInvalidPassword)
+		return
+	}
+	if !signupIPThrottle.Allow(clientIP(r)) {
+		render.JSON(w, errorTooManyRequests.StatusCode, errorTooManyRequests)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	organisation, apperr := store.Organisation().GetByName(r.Context(), chi.URLParam(r, "organisationName"), db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	user := data.toUser(organisation.IDOrganisation)
+	email := user.Email
+	domainAllowed, apperr := emailDomainAllowed(r.Context(), organisation.IDOrganisation, email)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	if !organisation.Public && !domainAllowed {
+		render.JSON(w, errorSignupNotAllowed.StatusCode, errorSignupNotAllowed)
+		return
+	}
+	// Domains chosen by the organisation are trusted even if they look disposable.
+	if !domainAllowed && models.IsDisposableEmail(email) {
+		render.JSON(w, errorDisposableEmail.StatusCode, errorDisposableEmail)
+		return
+	}
+	// Anyone can type an address of an allowed domain: the role waits for the address to be proven.
+	user.Pending = !organisation.Public
+	if apperr := store.User().Save(r.Context(), &user, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	sendVerificationEmail(user, r.Header.Get("Accept-Language"))
+	render.JSON(w, 201, user)
+}
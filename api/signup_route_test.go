@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+func signupBody(username string, email string) signupRequest {
+	return signupRequest{Username: username, Email: email, Password: "Password1!", NickName: username}
+}
+
+func TestSignupPublicOrganisation(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "public", true)
+	recorder := doJSON(router, "POST", "/alpha/organisation/public/signup", "", signupBody("alice", "alice@popcube.xyz"))
+	if recorder.Code != 201 {
+		t.Fatalf("signup: %d %s", recorder.Code, recorder.Body.String())
+	}
+	user := models.User{}
+	decodeBody(t, recorder, &user)
+	member, _ := datastores.Store().Role().GetByName(context.Background(), organisation.IDOrganisation, models.RoleMember, dbStore.db)
+	if user.IDRole != member.IDRole || user.EmailVerified {
+		t.Errorf("signed up user has role %d, verified %v", user.IDRole, user.EmailVerified)
+	}
+	if recorder := doJSON(router, "POST", "/alpha/organisation/public/signup", "", signupBody("alice", "other@popcube.xyz")); recorder.Code != 409 {
+		t.Errorf("taken username: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestSignupPrivateOrganisation(t *testing.T) {
+	router := newTestRouter(t)
+	organisation := newTestOrganisation(t, "private", false)
+	inviter := newTestUser(t, organisation, "inviter", models.RoleAdmin)
+	ctx := context.Background()
+	store := datastores.Store()
+
+	if recorder := doJSON(router, "POST", "/alpha/organisation/private/signup", "", signupBody("alice", "alice@elsewhere.xyz")); recorder.Code != errorSignupNotAllowed.StatusCode {
+		t.Fatalf("signup without allowed domain: %d %s", recorder.Code, recorder.Body.String())
+	}
+	// Knowing an invited address is not enough: invitations are claimed with their token only.
+	invitation := models.Invitation{IDInviter: inviter.IDUser, Email: "invited@elsewhere.xyz", IDOrganisation: organisation.IDOrganisation, Role: models.RoleAdmin, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	if apperr := store.Invitation().Save(ctx, &invitation, dbStore.db); apperr != nil {
+		t.Fatal(apperr)
+	}
+	if recorder := doJSON(router, "POST", "/alpha/organisation/private/signup", "", signupBody("invited", "invited@elsewhere.xyz")); recorder.Code != errorSignupNotAllowed.StatusCode {
+		t.Fatalf("signup with invited email: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	domain := models.AllowedEmailDomain{IDOrganisation: organisation.IDOrganisation, Domain: "private.xyz"}
+	if apperr := store.AllowedEmailDomain().Save(ctx, &domain, dbStore.db); apperr != nil {
+		t.Fatal(apperr)
+	}
+	recorder := doJSON(router, "POST", "/alpha/organisation/private/signup", "", signupBody("bob", "bob@private.xyz"))
+	if recorder.Code != 201 {
+		t.Fatalf("signup with allowed domain: %d %s", recorder.Code, recorder.Body.String())
+	}
+	bob := models.User{}
+	decodeBody(t, recorder, &bob)
+	if bob.IDRole != 0 {
+		t.Fatalf("unverified domain user got role %d", bob.IDRole)
+	}
+	if recorder := doJSON(router, "GET", "/alpha/user", login(t, router, "bob").Token, nil); recorder.Code != 403 {
+		t.Fatalf("pending user read users: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	verifyToken, err := createVerifyEmailToken(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder := doJSON(router, "POST", "/alpha/user/verify?token="+verifyToken, "", nil); recorder.Code != 200 {
+		t.Fatalf("verify: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := doJSON(router, "GET", "/alpha/user", login(t, router, "bob").Token, nil); recorder.Code != 200 {
+		t.Fatalf("verified user can't read users: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
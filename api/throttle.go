@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	errorTooManyRequests = utils.NewAPIError(429, "too.many.requests", "Too many requests. Please try again later.")
+)
+
+// throttle limit how many times an action can be done for a key (email, ip, ...) during a sliding window.
+// It is kept in memory, so each api instance apply its own limits.
+type throttle struct {
+	mutex    sync.Mutex
+	limit    int
+	window   time.Duration
+	hits     map[string][]time.Time
+	prunedAt time.Time
+}
+
+func newThrottle(limit int, window time.Duration) *throttle {
+	return &throttle{
+		limit:  limit,
+		window: window,
+		hits:   map[string][]time.Time{},
+	}
+}
+
+// Allow record a hit for key and state if it is under the limit
+func (t *throttle) Allow(key string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(t.prunedAt) > t.window {
+		t.prune(now)
+	}
+	t.hits[key] = recentHits(t.hits[key], now, t.window)
+	if len(t.hits[key]) >= t.limit {
+		return false
+	}
+	t.hits[key] = append(t.hits[key], now)
+	return true
+}
+
+// prune forget keys without hits in window
+func (t *throttle) prune(now time.Time) {
+	t.prunedAt = now
+	for key, hits := range t.hits {
+		if recent := recentHits(hits, now, t.window); len(recent) > 0 {
+			t.hits[key] = recent
+			continue
+		}
+		delete(t.hits, key)
+	}
+}
+
+func recentHits(hits []time.Time, now time.Time, window time.Duration) []time.Time {
+	recent := hits[:0]
+	for _, hit := range hits {
+		if now.Sub(hit) < window {
+			recent = append(recent, hit)
+		}
+	}
+	return recent
+}
+
+// clientIP get address of the caller. RealIP middleware already replaced RemoteAddr with forwarded address if any.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
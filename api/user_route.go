@@ -4,11 +4,14 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pressly/chi"
 	chiRender "github.com/pressly/chi/render"
 	"github.com/titouanfreville/popcubeexternalapi/datastores"
 	"github.com/titouanfreville/popcubeexternalapi/models"
+	"github.com/titouanfreville/popcubeexternalapi/utils"
 )
 
 const (
@@ -21,173 +24,237 @@ const (
 	oldUserKey   key = "oldUser"
 )
 
+var (
+	// verificationEmailThrottle limit verification emails sent to an address
+	verificationEmailThrottle = newThrottle(3, time.Hour)
+	// verificationIPThrottle limit verification emails asked from an address
+	verificationIPThrottle = newThrottle(20, time.Hour)
+)
+
 func initUserRoute(router chi.Router) {
 	router.Route("/user", func(r chi.Router) {
-		// r.Use(tokenAuth.Verifier)
-		// r.Use(Authenticator)
-		// swagger:route GET /user Users getAllUser
-		//
-		// Get users
-		//
-		// This will get all the users available in the organisation.
-		//
-		// 	Responses:
-		//    200: userArraySuccess
-		// 	  503: databaseError
-		// 	  default: genericError
-		r.Get("/", getAllUser)
-		// swagger:route POST /user Users newUser
-		//
-		// New user
-		//
-		// This will create an user for organisation users library.
-		//
-		// 	Responses:
-		//    201: userObjectSuccess
-		// 	  422: wrongEntity
-		// 	  503: databaseError
-		// 	  default: genericError
-		r.Post("/", newUser)
-		// swagger:route POST /user/invite Users inviteUser
-		//
-		// Invite user
-		//
-		// This will create an invitation token for a user.
-		//
-		// 	Responses:
-		//    201: userObjectSuccess
-		// 	  422: wrongEntity
-		// 	  503: databaseError
-		// 	  default: genericError
-		// r.Post("/invite", inviteUser)
-		// swagger:route GET /user/all Users getDeletedUser
-		//
-		// Get deleted user
-		//
-		// This will get all the deleted users still present in database.
-		//
-		// 	Responses:
-		//    200: userArraySuccess
-		// 	  503: databaseError
-		// 	  default: genericError
-		r.Get("/deleted", getDeletedUser)
-		// swagger:route POST /user/role Users getUserFromRole
-		//
-		// Get users from its role
-		//
-		// This will return the users having provided role.
-		//
-		// 	Responses:
-		//    200: userArraySuccess
-		// 	  422: wrongEntity
-		// 	  503: databaseError
-		// 	  default: genericError
-		// r.Post("/role", getUserFromRole)
-		// swagger:route GET /user/date Users getOrderedByDate
-		//
-		// Get user ordered by date
-		//
-		// This will get all the users ordered by date.
-		//
-		// 	Responses:
-		//    200: userArraySuccess
-		// 	  503: databaseError
-		// 	  default: genericError
-		r.Get("/date", getOrderedByDate)
-		r.Route("/email/", func(r chi.Router) {
-			r.Route("/:userEmail", func(r chi.Router) {
-				r.Use(userContext)
-				r.Get("/", getUserFromEmail)
-			})
-		})
-		r.Route("/nickname/", func(r chi.Router) {
-			r.Route("/:nickName", func(r chi.Router) {
-				r.Use(userContext)
-				// swagger:route GET /user/nickname/{nickName} Users getUserFromNickName
+		r.Route("/verify", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(tokenAuth.Verify("token"))
+				r.Use(tokenTypeOnly("verifyemail"))
+				// swagger:route POST /user/verify Users verifyEmail
 				//
-				// Get user from nickname
+				// Verify email
 				//
-				// This will return the user object corresponding to provided nickname
+				// This will mark the email of the user as verified. Token is the one sent by email, provided
+				// as token query parameter or bearer. It can only be used once. Users who signed up to a private
+				// organisation through its email domains get the member role.
 				//
 				// 	Responses:
 				//    200: userObjectSuccess
+				// 	  401: unauthorized
 				// 	  503: databaseError
 				// 	  default: genericError
-				r.Get("/", getUserFromNickName)
+				r.Post("/", verifyEmail)
 			})
+			// swagger:route POST /user/verify/resend Users resendVerification
+			//
+			// Resend verification email
+			//
+			// This will send a new verification link if the email belongs to an unverified user.
+			// Answer is the same whether the email is known or not.
+			//
+			// 	Responses:
+			//    200: resendVerificationOk
+			// 	  422: wrongEntity
+			// 	  429: tooManyRequests
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Post("/resend", resendVerification)
 		})
-		r.Route("/firstname/", func(r chi.Router) {
-			r.Route("/:firstName", func(r chi.Router) {
-				r.Use(userContext)
-				// swagger:route GET /user/firstname/{firstName} Users getUserFromFirstName
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuth.Verifier)
+			r.Use(APIKeyVerifier)
+			r.Use(Authenticator)
+			// swagger:route POST /user Users newUser
+			//
+			// New user
+			//
+			// This will create an user for organisation users library.
+			//
+			// 	Responses:
+			//    201: userObjectSuccess
+			// 	  403: forbidden
+			// 	  422: wrongEntity
+			// 	  503: databaseError
+			// 	  default: genericError
+			r.Group(func(r chi.Router) {
+				r.Use(RequirePermission(models.PermissionManageUser))
+				r.Post("/", newUser)
+			})
+			r.Route("/invite", func(r chi.Router) {
+				r.Use(RequirePermission(models.PermissionInvite))
+				// swagger:route POST /user/invite Users inviteUser
 				//
-				// Get user from firstname
+				// Invite user
 				//
-				// This will return the user object corresponding to provided firstname
+				// This will record an invitation into current user organisation and create its invitation token.
 				//
 				// 	Responses:
-				//    200: userObjectSuccess
+				//    201: inviteOk
+				// 	  403: forbidden
+				// 	  409: alreadyExist
+				// 	  422: wrongEntity
 				// 	  503: databaseError
 				// 	  default: genericError
-				r.Get("/", getUserFromFirstName)
+				r.Post("/", inviteUser)
 			})
-		})
-		r.Route("/lastname/", func(r chi.Router) {
-			r.Route("/:lastName", func(r chi.Router) {
-				r.Use(userContext)
-				// swagger:route GET /user/lastname/{lastName} Users getUserFromLastName
+			// Users are only read by members of their organisation.
+			r.Group(func(r chi.Router) {
+				r.Use(RequirePermission(models.PermissionRead))
+				// swagger:route GET /user Users getAllUser
 				//
-				// Get user from lastname
+				// Get users
 				//
-				// This will return the user object corresponding to provided lastname
+				// This will get all the users available in the organisation.
 				//
 				// 	Responses:
-				//    200: userObjectSuccess
+				//    200: userArraySuccess
+				// 	  403: forbidden
+				// 	  503: databaseError
+				// 	  default: genericError
+				r.Get("/", getAllUser)
+				// swagger:route GET /user/all Users getDeletedUser
+				//
+				// Get deleted user
+				//
+				// This will get all the deleted users still present in database.
+				//
+				// 	Responses:
+				//    200: userArraySuccess
+				// 	  403: forbidden
+				// 	  503: databaseError
+				// 	  default: genericError
+				r.Get("/deleted", getDeletedUser)
+				// swagger:route POST /user/role Users getUserFromRole
+				//
+				// Get users from its role
+				//
+				// This will return the users having provided role.
+				//
+				// 	Responses:
+				//    200: userArraySuccess
+				// 	  422: wrongEntity
 				// 	  503: databaseError
 				// 	  default: genericError
-				r.Get("/", getUserFromLastName)
+				// r.Post("/role", getUserFromRole)
+				// swagger:route GET /user/date Users getOrderedByDate
+				//
+				// Get user ordered by date
+				//
+				// This will get all the users ordered by date.
+				//
+				// 	Responses:
+				//    200: userArraySuccess
+				// 	  403: forbidden
+				// 	  503: databaseError
+				// 	  default: genericError
+				r.Get("/date", getOrderedByDate)
+				r.Route("/email/", func(r chi.Router) {
+					r.Route("/:userEmail", func(r chi.Router) {
+						r.Use(userContext)
+						r.Get("/", getUserFromEmail)
+					})
+				})
+				r.Route("/nickname/", func(r chi.Router) {
+					r.Route("/:nickName", func(r chi.Router) {
+						r.Use(userContext)
+						// swagger:route GET /user/nickname/{nickName} Users getUserFromNickName
+						//
+						// Get user from nickname
+						//
+						// This will return the user object corresponding to provided nickname
+						//
+						// 	Responses:
+						//    200: userObjectSuccess
+						// 	  403: forbidden
+						// 	  503: databaseError
+						// 	  default: genericError
+						r.Get("/", getUserFromNickName)
+					})
+				})
+				r.Route("/firstname/", func(r chi.Router) {
+					r.Route("/:firstName", func(r chi.Router) {
+						r.Use(userContext)
+						// swagger:route GET /user/firstname/{firstName} Users getUserFromFirstName
+						//
+						// Get user from firstname
+						//
+						// This will return the user object corresponding to provided firstname
+						//
+						// 	Responses:
+						//    200: userObjectSuccess
+						// 	  403: forbidden
+						// 	  503: databaseError
+						// 	  default: genericError
+						r.Get("/", getUserFromFirstName)
+					})
+				})
+				r.Route("/lastname/", func(r chi.Router) {
+					r.Route("/:lastName", func(r chi.Router) {
+						r.Use(userContext)
+						// swagger:route GET /user/lastname/{lastName} Users getUserFromLastName
+						//
+						// Get user from lastname
+						//
+						// This will return the user object corresponding to provided lastname
+						//
+						// 	Responses:
+						//    200: userObjectSuccess
+						// 	  403: forbidden
+						// 	  503: databaseError
+						// 	  default: genericError
+						r.Get("/", getUserFromLastName)
+					})
+				})
+				r.Route("/:userID", func(r chi.Router) {
+					r.Use(userContext)
+					// swagger:route GET /user/userName} Users getUserFromName
+					//
+					// Get user from username
+					//
+					// This will return the user object corresponding to provided username
+					//
+					// 	Responses:
+					//    200: userObjectSuccess
+					// 	  403: forbidden
+					// 	  503: databaseError
+					// 	  default: genericError
+					r.Get("/", getUserFromName)
+					// swagger:route PUT /user/{userID} Users updateUser
+					//
+					// Update user
+					//
+					// This will return the new user object
+					//
+					// 	Responses:
+					//    200: userObjectSuccess
+					// 	  422: wrongEntity
+					// 	  503: databaseError
+					// 	  default: genericError
+					// r.Put("/", updateUser)
+					// swagger:route PUT /user/{userID} Users deleteUser
+					//
+					// Delete user
+					//
+					// This will return a delete specific mesage
+					//
+					// 	Responses:
+					//    200: deleteMessage
+					// 	  422: wrongEntity
+					// 	  503: databaseError
+					// 	  default: deleteMessage
+					// r.Delete("/", deleteUser)
+					// initUserParameterRoute(r)
+					//initMemberOverUser(r)
+				})
 			})
 		})
-		r.Route("/:userID", func(r chi.Router) {
-			r.Use(userContext)
-			// swagger:route GET /user/userName} Users getUserFromName
-			//
-			// Get user from username
-			//
-			// This will return the user object corresponding to provided username
-			//
-			// 	Responses:
-			//    200: userObjectSuccess
-			// 	  503: databaseError
-			// 	  default: genericError
-			r.Get("/", getUserFromName)
-			// swagger:route PUT /user/{userID} Users updateUser
-			//
-			// Update user
-			//
-			// This will return the new user object
-			//
-			// 	Responses:
-			//    200: userObjectSuccess
-			// 	  422: wrongEntity
-			// 	  503: databaseError
-			// 	  default: genericError
-			// r.Put("/", updateUser)
-			// swagger:route PUT /user/{userID} Users deleteUser
-			//
-			// Delete user
-			//
-			// This will return a delete specific mesage
-			//
-			// 	Responses:
-			//    200: deleteMessage
-			// 	  422: wrongEntity
-			// 	  503: databaseError
-			// 	  default: deleteMessage
-			// r.Delete("/", deleteUser)
-			// initUserParameterRoute(r)
-			//initMemberOverUser(r)
-		})
 	})
 }
 
@@ -204,58 +271,50 @@ func userContext(next http.Handler) http.Handler {
 		lastName := chi.URLParam(r, "lastName")
 		email := chi.URLParam(r, "email")
 		date, _ := strconv.ParseInt(chi.URLParam(r, "date"), 10, 64)
-		oldUser := models.EmptyUser
 		ctx := context.WithValue(r.Context(), userNameKey, name)
 		ctx = context.WithValue(ctx, nickNameKey, nickName)
 		ctx = context.WithValue(ctx, firstNameKey, firstName)
 		ctx = context.WithValue(ctx, lastNameKey, lastName)
 		ctx = context.WithValue(ctx, userEmailKey, email)
 		ctx = context.WithValue(ctx, userDateKey, date)
+		oldUser := models.EmptyUser
+		var apperr *utils.AppError
 		if err == nil {
-			oldUser = datastores.Store().User().GetByID(userID, dbStore.db)
-		} else {
-			oldUser = datastores.Store().User().GetByUserName(userName, dbStore.db)
+			oldUser, apperr = datastores.Store().User().GetByID(r.Context(), userID, dbStore.db)
+		} else if userName != "" {
+			oldUser, apperr = datastores.Store().User().GetByUserName(r.Context(), userName, dbStore.db)
+		}
+		if apperr != nil {
+			renderAppError(w, apperr)
+			return
 		}
 		ctx = context.WithValue(ctx, oldUserKey, oldUser)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// func canManageUser(place string, self bool, currentUser string, token *jwt.Token) bool {
-// 	store := datastores.Store()
-// 	db := dbStore.db
-// 	userName := token.Claims.(jwt.MapClaims)["name"].(string)
-// 	user := store.User().GetByUserName(userName, db)
-// 	userRights := store.Role().GetByID(user.IDRole, db)
-// 	if self && currentUser == userName {
-// 		return true
-// 	}
-// 	if place == "organisation" || place == "global" {
-// 		return userRights.CanManageUser
-// 	}
-// 	chanel := store.Channel().GetByName(place, db)
-// 	member := store.Member().GetChannelMember(&user, &chanel, db)
-// 	channelRights := store.Role().GetByID(member.IDRole, db)
-// 	if channelRights == models.EmptyRole {
-// 		channelRights = userRights
-// 	}
-// 	return channelRights.CanManageUser
-// }
+// organisationUsers keep users of the organisation request token was issued for
+func organisationUsers(r *http.Request, users []models.User) []models.User {
+	organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id")
+	result := []models.User{}
+	for _, user := range users {
+		if user.IDOrganisation == uint64(organisationID) {
+			result = append(result, user)
+		}
+	}
+	return result
+}
 
-// func canInviteUser(place string, token *jwt.Token) bool {
-// 	store := datastores.Store()
-// 	db := dbStore.db
-// 	userName := token.Claims.(jwt.MapClaims)["name"].(string)
-// 	user := store.User().GetByUserName(userName, db)
-// 	userRights := store.Role().GetByID(user.IDRole, db)
-// 	if place == "organisation" || place == "global" {
-// 		return userRights.CanInvite
-// 	}
-// 	chanel := store.Channel().GetByName(place, db)
-// 	member := store.Member().GetChannelMember(&user, &chanel, db)
-// 	channelRights := store.Role().GetByID(member.IDRole, db)
-// 	return channelRights.CanInvite
-// }
+// renderOrganisationUser send user back if it belongs to the organisation request token was issued for. Users of
+// other organisations are not found, so their existence is not disclosed.
+func renderOrganisationUser(w http.ResponseWriter, r *http.Request, user models.User) {
+	organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id")
+	if user.IDOrganisation != uint64(organisationID) {
+		render.JSON(w, error404.StatusCode, error404)
+		return
+	}
+	render.JSON(w, 200, user)
+}
 
 func getAllUser(w http.ResponseWriter, r *http.Request) {
 	store := datastores.Store()
@@ -264,7 +323,12 @@ func getAllUser(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, error503.StatusCode, error503)
 		return
 	}
-	result := store.User().GetAll(db)
+	organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id")
+	result, apperr := store.User().GetByOrganisation(r.Context(), uint64(organisationID), db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
 	render.JSON(w, 200, result)
 
 }
@@ -276,7 +340,12 @@ func getDeletedUser(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, error503.StatusCode, error503)
 		return
 	}
-	result := store.User().GetDeleted(db)
+	organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id")
+	result, apperr := store.User().GetDeleted(r.Context(), uint64(organisationID), db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
 	render.JSON(w, 200, result)
 
 }
@@ -289,8 +358,12 @@ func getUserFromName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.Context().Value(userNameKey).(string)
-	user := store.User().GetByUserName(name, db)
-	render.JSON(w, 200, user)
+	user, apperr := store.User().GetByUserName(r.Context(), name, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	renderOrganisationUser(w, r, user)
 }
 
 func getUserFromNickName(w http.ResponseWriter, r *http.Request) {
@@ -301,8 +374,12 @@ func getUserFromNickName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.Context().Value(nickNameKey).(string)
-	user := store.User().GetByNickName(name, db)
-	render.JSON(w, 200, user)
+	user, apperr := store.User().GetByNickName(r.Context(), name, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	renderOrganisationUser(w, r, user)
 }
 
 func getUserFromFirstName(w http.ResponseWriter, r *http.Request) {
@@ -313,8 +390,12 @@ func getUserFromFirstName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.Context().Value(firstNameKey).(string)
-	user := store.User().GetByFirstName(name, db)
-	render.JSON(w, 200, user)
+	user, apperr := store.User().GetByFirstName(r.Context(), name, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, organisationUsers(r, user))
 }
 
 func getUserFromLastName(w http.ResponseWriter, r *http.Request) {
@@ -325,8 +406,12 @@ func getUserFromLastName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.Context().Value(lastNameKey).(string)
-	user := store.User().GetByLastName(name, db)
-	render.JSON(w, 200, user)
+	user, apperr := store.User().GetByLastName(r.Context(), name, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, organisationUsers(r, user))
 }
 
 func getUserFromEmail(w http.ResponseWriter, r *http.Request) {
@@ -337,8 +422,12 @@ func getUserFromEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	email := r.Context().Value(userEmailKey).(string)
-	user := store.User().GetByEmail(email, db)
-	render.JSON(w, 200, user)
+	user, apperr := store.User().GetByEmail(r.Context(), email, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	renderOrganisationUser(w, r, user)
 }
 
 func getOrderedByDate(w http.ResponseWriter, r *http.Request) {
@@ -348,9 +437,12 @@ func getOrderedByDate(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, error503.StatusCode, error503)
 		return
 	}
-	date := r.Context().Value(userDateKey).(int)
-	user := store.User().GetOrderedByDate(date, db)
-	render.JSON(w, 200, user)
+	user, apperr := store.User().GetOrderedByDate(r.Context(), 0, db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	render.JSON(w, 200, organisationUsers(r, user))
 }
 
 // func getUserFromRole(w http.ResponseWriter, r *http.Request) {
@@ -367,23 +459,16 @@ func getOrderedByDate(w http.ResponseWriter, r *http.Request) {
 // 		render.JSON(w, error503.StatusCode, error503)
 // 		return
 // 	}
-// 	role := store.User().GetByRole(&Role, db)
+// 	role := store.User().GetByRole(r.Context(), &Role, db)
 // 	render.JSON(w, 200, role)
 // }
 
 func newUser(w http.ResponseWriter, r *http.Request) {
-	var User models.User
+	data := &signupRequest{}
 	store := datastores.Store()
-	// token := r.Context().Value(jwtTokenKey).(*jwt.Token)
-	// if !canManageUser("global", false, "", token) {
-	// 	res := error401
-	// 	res.Message = "You don't have the right to manage user."
-	// 	render.JSON(w, error401.StatusCode, error401)
-	// 	return
-	// }
 	db := dbStore.db
 
-	err := chiRender.Bind(r, &User)
+	err := chiRender.Bind(r, data)
 	if err != nil {
 		render.JSON(w, error422.StatusCode, error422)
 		return
@@ -392,60 +477,172 @@ func newUser(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, error503.StatusCode, error503)
 		return
 	}
-	apperr := store.User().Save(&User, db)
-	if err == nil {
+	// Users are created in the organisation of their creator, with the default member role.
+	organisationID, _ := ClaimInt64(tokenClaims(r), "organisation_id")
+	User := data.toUser(uint64(organisationID))
+	apperr := store.User().Save(r.Context(), &User, db)
+	if apperr == nil {
+		sendVerificationEmail(User, r.Header.Get("Accept-Language"))
 		render.JSON(w, 201, User)
 		return
 	}
-	render.JSON(w, apperr.StatusCode, apperr)
+	renderAppError(w, apperr)
 
 }
 
+func verifyEmail(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	claims := tokenClaims(r)
+	userID, _ := ClaimInt64(claims, "user_id")
+	email, _ := claims["email"].(string)
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := store.User().GetByID(r.Context(), uint64(userID), db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	// Token is only valid for the email it was sent to.
+	if apperr != nil || user.Deleted || user.Email != email {
+		render.JSON(w, error401.StatusCode, error401)
+		return
+	}
+	if !user.EmailVerified {
+		if apperr := store.User().VerifyEmail(r.Context(), &user, db); apperr != nil {
+			renderAppError(w, apperr)
+			return
+		}
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		exp, _ := ClaimInt64(claims, "exp")
+		revoke(r.Context(), models.Revocation{Kind: models.RevocationKindToken, Subject: jti, ExpiresAt: exp})
+	}
+	render.JSON(w, 200, user)
+}
+
+// resendVerificationRequest request
+type resendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+func (rVR *resendVerificationRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// resendVerificationOk response send back whatever happened, so emails of users are not disclosed
+type resendVerificationOk struct {
+	Message string `json:"message"`
+}
+
+func resendVerification(w http.ResponseWriter, r *http.Request) {
+	store := datastores.Store()
+	db := dbStore.db
+	data := &resendVerificationRequest{}
+	if err := chiRender.Bind(r, data); err != nil || data.Email == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	email := strings.ToLower(data.Email)
+	if !verificationIPThrottle.Allow(clientIP(r)) || !verificationEmailThrottle.Allow(email) {
+		render.JSON(w, errorTooManyRequests.StatusCode, errorTooManyRequests)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	user, apperr := store.User().GetByEmail(r.Context(), email, db)
+	if apperr != nil && apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr == nil && !user.Deleted && !user.EmailVerified {
+		sendVerificationEmail(user, r.Header.Get("Accept-Language"))
+	}
+	render.JSON(w, 200, resendVerificationOk{Message: "If this email has to be verified, a new link was sent to it."})
+}
+
 // inviteUser request
-// type inviteUserRequest struct {
-// 	Email   string      `json:"email"`
-// 	Message string      `json:"message"`
-// 	OmitID  interface{} `json:"id,omitempty"`
-// }
+type inviteUserRequest struct {
+	Email   string      `json:"email"`
+	Role    string      `json:"role"`
+	Message string      `json:"message"`
+	OmitID  interface{} `json:"id,omitempty"`
+}
 
-// func (iU inviteUserRequest) Bind(r *http.Request) error {
-// 	return nil
-// }
+func (iU *inviteUserRequest) Bind(r *http.Request) error {
+	return nil
+}
 
-// func inviteUser(w http.ResponseWriter, r *http.Request) {
-// 	var iUR inviteUserRequest
-// 	store := datastores.Store()
-// 	db := dbStore.db
-// 	organisation := store.Organisation().Get(db)
-// 	response := inviteOk{}
+// inviteOk response send back when an invitation is created
+type inviteOk struct {
+	Invitation models.Invitation `json:"invitation"`
+	Token      string            `json:"token"`
+}
 
-// 	token := r.Context().Value(jwtTokenKey).(*jwt.Token)
-// 	if !canManageUser("global", false, "", token) || !canInviteUser("global", token) {
-// 		res := error401
-// 		res.Message = "You don't have the right to manage user."
-// 		render.JSON(w, error401.StatusCode, error401)
-// 		return
-// 	}
+func inviteUser(w http.ResponseWriter, r *http.Request) {
+	var iUR inviteUserRequest
+	store := datastores.Store()
+	db := dbStore.db
+	claims := tokenClaims(r)
+	inviterID, _ := ClaimInt64(claims, "user_id")
+	serviceAccountID, _ := ClaimInt64(claims, "service_account_id")
+	organisationID, _ := ClaimInt64(claims, "organisation_id")
 
-// 	err := chiRender.Bind(r, &iUR)
-// 	if err != nil || iUR.Email == "" {
-// 		render.JSON(w, error422.StatusCode, error422)
-// 		return
-// 	}
-// 	if err := db.DB().Ping(); err == nil {
-// 		var terr error
-// 		response.Email = iUR.Email
-// 		response.Organisation = organisation.OrganisationName
-// 		response.Token, terr = createInviteToken(iUR.Email, organisation.OrganisationName)
-// 		if terr == nil {
-// 			render.JSON(w, 201, response)
-// 			return
-// 		}
-// 		render.JSON(w, 422, "Could not generate token")
-// 		return
-// 	}
-// 	render.JSON(w, error503.StatusCode, error503)
-// }
+	err := chiRender.Bind(r, &iUR)
+	if err != nil || iUR.Email == "" {
+		render.JSON(w, error422.StatusCode, error422)
+		return
+	}
+	if err := db.DB().Ping(); err != nil {
+		render.JSON(w, error503.StatusCode, error503)
+		return
+	}
+	organisation, apperr := store.Organisation().GetByID(r.Context(), uint64(organisationID), db)
+	if apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	_, apperr = store.User().GetByEmail(r.Context(), strings.ToLower(iUR.Email), db)
+	if apperr == nil {
+		apperr := utils.NewAPIError(409, "user.already.exist", "An user already use this email.")
+		renderAppError(w, apperr)
+		return
+	}
+	if apperr.Kind != utils.ErrorNotFound {
+		renderAppError(w, apperr)
+		return
+	}
+	invitation := models.Invitation{
+		IDInviter:               uint64(inviterID),
+		IDInviterServiceAccount: uint64(serviceAccountID),
+		Email:                   iUR.Email,
+		IDOrganisation:          organisation.IDOrganisation,
+		Role:                    iUR.Role,
+		ExpiresAt:               ExpireIn(invitationTokenLifetime),
+	}
+	if apperr := store.Invitation().Save(r.Context(), &invitation, db); apperr != nil {
+		renderAppError(w, apperr)
+		return
+	}
+	token, terr := createInviteToken(invitation, organisation.OrganisationName)
+	if terr != nil {
+		render.JSON(w, 422, "Could not generate token")
+		return
+	}
+	inviter := models.EmptyUser
+	if inviterID != 0 {
+		inviter, _ = store.User().GetByID(r.Context(), uint64(inviterID), db)
+	} else {
+		// Service accounts invite under their own name.
+		inviter.Username, _ = claims["name"].(string)
+	}
+	sendInvitationEmail(invitation, organisation, inviter, iUR.Message, token, r.Header.Get("Accept-Language"))
+	render.JSON(w, 201, inviteOk{Invitation: invitation, Token: token})
+}
 
 // func updateUser(w http.ResponseWriter, r *http.Request) {
 // 	var User models.User
@@ -468,7 +665,7 @@ func newUser(w http.ResponseWriter, r *http.Request) {
 // 		render.JSON(w, error503.StatusCode, error503)
 // 		return
 // 	}
-// 	apperr := store.User().Update(&user, &User, db)
+// 	apperr := store.User().Update(r.Context(), &user, &User, db)
 // 	if apperr != nil {
 // 		render.JSON(w, apperr.StatusCode, apperr)
 // 		return
@@ -494,7 +691,7 @@ func newUser(w http.ResponseWriter, r *http.Request) {
 // 		render.JSON(w, error503.StatusCode, error503)
 // 		return
 // 	}
-// 	apperr := store.User().Delete(&user, db)
+// 	apperr := store.User().Delete(r.Context(), &user, db)
 // 	if apperr != nil {
 // 		message.Success = false
 // 		message.Message = apperr.Message
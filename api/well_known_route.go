@@ -0,0 +1,141 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pressly/chi"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+const (
+	// jwksMaxAge how long clients can cache published keys, in seconds. Keep it under the time a new key
+	// is published before being used to sign.
+	jwksMaxAge = 900
+)
+
+// initWellKnownRoute set /.well-known routes used by inner stacks to trust issued tokens
+func initWellKnownRoute(router chi.Router) {
+	router.Route("/.well-known", func(r chi.Router) {
+		// swagger:route GET /.well-known/jwks.json Keys getJWKS
+		//
+		// Get public keys
+		//
+		// This will return the public keys used to verify tokens issued by this api: current signing key
+		// and previous keys still accepted. Shared secrets are never published.
+		//
+		// 	Responses:
+		//    200: jwksOk
+		// 	  default: genericError
+		r.Get("/jwks.json", getJWKS)
+		// swagger:route GET /.well-known/oauth-authorization-server Keys getOAuthMetadata
+		//
+		// Get OAuth server metadata
+		//
+		// This will return the endpoints and features of the OAuth2 authorization server, as defined by RFC 8414.
+		//
+		// 	Responses:
+		//    200: oauthMetadataOk
+		// 	  default: genericError
+		r.Get("/oauth-authorization-server", getOAuthMetadata)
+		// swagger:route GET /.well-known/openid-configuration Keys getOpenIDConfiguration
+		//
+		// Get OpenID Connect configuration
+		//
+		// This will return the OpenID Connect provider metadata, as defined by OpenID Connect Discovery 1.0.
+		// Not found while tokens are signed with a shared secret, as id_tokens can not be issued.
+		//
+		// 	Responses:
+		//    200: openIDConfigurationOk
+		// 	  404: notFound
+		// 	  default: genericError
+		r.Get("/openid-configuration", getOpenIDConfiguration)
+	})
+}
+
+// oauthMetadataOk authorization server metadata
+type oauthMetadataOk struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// oauthMetadata build the authorization server metadata. OpenID Connect configuration extends it, so both
+// documents always advertise the same endpoints and features.
+func oauthMetadata() oauthMetadataOk {
+	return oauthMetadataOk{
+		Issuer:                            tokenIssuer,
+		AuthorizationEndpoint:             tokenIssuer + "/oauth/authorize",
+		TokenEndpoint:                     tokenIssuer + "/oauth/token",
+		IntrospectionEndpoint:             tokenIssuer + "/oauth/introspect",
+		RevocationEndpoint:                tokenIssuer + "/oauth/revoke",
+		JWKSURI:                           tokenIssuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{models.GrantAuthorizationCode, models.GrantClientCredentials},
+		CodeChallengeMethodsSupported:     []string{models.CodeChallengeS256},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+func getOAuthMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(jwksMaxAge))
+	render.JSON(w, 200, oauthMetadata())
+}
+
+// openIDConfigurationOk OpenID Connect provider metadata
+type openIDConfigurationOk struct {
+	oauthMetadataOk
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+func getOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	// Only the algorithm of the published signing key is advertised. Shared secrets are never published.
+	signingKey, ok := tokenAuth.Keyring().Current().PublicJWK()
+	if !ok {
+		render.JSON(w, error404.StatusCode, error404)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(jwksMaxAge))
+	render.JSON(w, 200, openIDConfigurationOk{
+		oauthMetadataOk:                  oauthMetadata(),
+		UserInfoEndpoint:                 tokenIssuer + "/oauth/userinfo",
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{signingKey.Alg},
+		ScopesSupported:                  []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail},
+		ClaimsSupported: []string{"iss", "sub", "aud", "azp", "exp", "iat", "auth_time", "nonce",
+			"preferred_username", "nickname", "given_name", "family_name", "locale", "email", "email_verified"},
+	})
+}
+
+func getJWKS(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(tokenAuth.Keyring().JWKS())
+	if err != nil {
+		render.JSON(w, 500, "Could not build key set")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(jwksMaxAge))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.WriteHeader(200)
+	w.Write(body)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"reflect"
+	"testing"
+)
+
+func TestOpenIDConfigurationExtendsOAuthMetadata(t *testing.T) {
+	router := newTestRouter(t)
+	if recorder := doJSON(router, "GET", "/.well-known/openid-configuration", "", nil); recorder.Code != 404 {
+		t.Fatalf("configuration published while tokens are signed with a secret: %d", recorder.Code)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewAsymmetricKey("test", "RS256", rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenAuth = NewWithKeyring(NewKeyring(key))
+
+	oauth, openID := map[string]interface{}{}, map[string]interface{}{}
+	decodeBody(t, doJSON(router, "GET", "/.well-known/oauth-authorization-server", "", nil), &oauth)
+	decodeBody(t, doJSON(router, "GET", "/.well-known/openid-configuration", "", nil), &openID)
+	for field, value := range oauth {
+		if !reflect.DeepEqual(value, openID[field]) {
+			t.Errorf("%s is %v in OAuth metadata and %v in OpenID configuration", field, value, openID[field])
+		}
+	}
+	if algs, _ := openID["id_token_signing_alg_values_supported"].([]interface{}); len(algs) != 1 || algs[0] != "RS256" {
+		t.Errorf("advertised id_token algorithms are %v", openID["id_token_signing_alg_values_supported"])
+	}
+}
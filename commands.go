@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/api"
+	"github.com/titouanfreville/popcubeexternalapi/datastores"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+)
+
+// runCommand run the sub command provided on command line if any. Returns false when api should be served.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "neworganisation":
+		newOrganisationCommand(args[1:])
+	case "migrate":
+		migrateCommand(args[1:])
+	default:
+		return false
+	}
+	return true
+}
+
+// newOrganisationCommand print a neworganisation token for provided organisation and owner.
+func newOrganisationCommand(args []string) {
+	flags := flag.NewFlagSet("neworganisation", flag.ExitOnError)
+	name := flags.String("name", "", "Organisation name")
+	stack := flags.Int("stack", 0, "Docker stack of the organisation")
+	domain := flags.String("domain", "", "Domain name of the organisation")
+	public := flags.Bool("public", false, "Let anyone join the organisation")
+	owner := flags.String("owner", "", "User name of the organisation owner")
+	ownerMail := flags.String("owner-mail", "", "Email of the organisation owner")
+	flags.Parse(args)
+
+	organisation := models.Organisation{
+		OrganisationName: *name,
+		DockerStack:      *stack,
+		Domain:           *domain,
+		Public:           *public,
+	}
+	user := models.User{
+		Username: *owner,
+		Email:    *ownerMail,
+	}
+	organisation.PreSave()
+	user.PreSave()
+	if appErr := organisation.IsValid(); appErr != nil {
+		log.Fatal("Organisation is not valid: " + appErr.ID)
+	}
+	if !models.IsValidUsername(user.Username) || !models.IsValidEmail(user.Email) {
+		log.Fatal("Owner user name or email is not valid")
+	}
+	token, err := api.GenerateNewOrganisationToken(organisation, user)
+	if err != nil {
+		log.Fatal("Could not generate token: " + err.Error())
+	}
+	fmt.Fprintln(os.Stdout, token)
+}
+
+// migrateCommand apply or revert database schema migrations, or list them. "up" apply every pending migration, "down"
+// revert the last one applied and "to N" apply or revert migrations until schema is at version N.
+func migrateCommand(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: popcubeexternalapi migrate up|down|status|to N")
+	}
+	flags.Parse(args)
+
+	useDatastore()
+	store := datastores.Store()
+	db := store.InitConnection(DbConnectionInfo.User, DbConnectionInfo.Database, DbConnectionInfo.Password, DbConnectionInfo.Host, DbConnectionInfo.Port)
+	if db == nil {
+		log.Fatal("Can't connect to database")
+	}
+	defer store.CloseConnection(db)
+	ctx := context.Background()
+	version, apperr := store.Migration().Version(ctx, db)
+	if apperr != nil {
+		log.Fatal("Can't get schema version: " + apperr.Error())
+	}
+
+	target := version
+	switch flags.Arg(0) {
+	case "up":
+		target = datastores.SchemaVersion
+	case "down":
+		if version == 0 {
+			log.Fatal("No migration to revert")
+		}
+		target = version - 1
+	case "to":
+		var err error
+		if target, err = strconv.Atoi(flags.Arg(1)); err != nil {
+			flags.Usage()
+			os.Exit(2)
+		}
+	case "status":
+		migrationStatus(ctx, version, db)
+		return
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if apperr := store.Migration().MigrateTo(ctx, target, db); apperr != nil {
+		log.Fatal("Migration failed: " + apperr.Error())
+	}
+	fmt.Fprintf(os.Stdout, "Schema is at version %d\n", target)
+}
+
+// migrationStatus print schema version and the state of each migration
+func migrationStatus(ctx context.Context, version int, db *gorm.DB) {
+	status, apperr := datastores.Store().Migration().Status(ctx, db)
+	if apperr != nil {
+		log.Fatal("Can't get migrations: " + apperr.Error())
+	}
+	fmt.Fprintf(os.Stdout, "Schema is at version %d, api needs version %d\n", version, datastores.SchemaVersion)
+	for _, migration := range status {
+		state := "pending"
+		if migration.AppliedAt != 0 {
+			state = "applied " + time.Unix(migration.AppliedAt, 0).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(os.Stdout, "%4d  %-24s %s\n", migration.Version, migration.Name, state)
+	}
+}
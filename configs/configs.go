@@ -3,11 +3,19 @@ package configs
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // DbConnection information to connect to DB
 type DbConnection struct {
-	User     string
+	// Backend datastore used: sql or memory. Memory one loses everything when api stops.
+	Backend string
+	// Driver sql driver of the database: mysql, postgres or sqlite. Postgres sslmode is read from PGSSLMODE.
+	Driver string
+	User   string
+	// Database name of the database. Sqlite one is the path of its file, other connection settings are not used.
 	Database string
 	Password string
 	Host     string
@@ -20,10 +28,58 @@ type APIServerInfo struct {
 	Port     string
 }
 
+// JwtKeyInfo information on keys used to sign and verify JWT
+type JwtKeyInfo struct {
+	// Algorithm used to sign tokens. HS256 use the shared secret, others need a PEM signing key.
+	Algorithm string
+	// KeyID of the signing key. Computed from the key if empty.
+	KeyID string
+	// SigningKey path to the PEM private key
+	SigningKey string
+	// VerificationKeys previous keys still accepted. Each entry is a PEM path, optionally prefixed by "kid=".
+	VerificationKeys []string
+	// PreviousSecrets shared secrets replaced by POPCUBESECRET, still accepted for HMAC tokens. Their key id is
+	// computed from them, as for the secret when no KeyID is set.
+	PreviousSecrets []string
+	// Issuer public url of this api, set as "iss" of tokens given to OAuth clients
+	Issuer string
+}
+
+// MailInfo information used to send emails
+type MailInfo struct {
+	// Backend used to deliver emails: smtp, file or log
+	Backend string
+	// From address emails are sent from
+	From string
+	// SMTPHost, SMTPPort, SMTPUsername and SMTPPassword locate the smtp server and the account used on it
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// SMTPRequireTLS refuse to send emails if smtp server does not offer STARTTLS
+	SMTPRequireTLS bool
+	// FileDir directory emails are dropped in with file backend
+	FileDir string
+	// TemplatesDir directory holding email templates and their translations
+	TemplatesDir string
+	// DefaultLocale locale used when recipient preferences are unknown or not available
+	DefaultLocale string
+	// QueueSize number of emails waiting to be sent before new ones are refused
+	QueueSize int
+	// MaxAttempts number of times sending an email is tried
+	MaxAttempts int
+	// RetryDelay delay before first retry. It doubles after each failure.
+	RetryDelay time.Duration
+	// PublicURL base url of the PopCube front end, used to build links sent by email
+	PublicURL string
+}
+
 // InitConfig get configuration for project
 func InitConfig() (DbConnection, APIServerInfo, string) {
 	// Default configurations
 	dbConnection := DbConnection{
+		Backend:  "sql",
+		Driver:   "mysql",
 		User:     "root",
 		Database: "popcube_test",
 		Password: "popcube_dev",
@@ -34,7 +90,7 @@ func InitConfig() (DbConnection, APIServerInfo, string) {
 		Hostname: "",
 		Port:     "3000",
 	}
-	// Dev secret
+	// Dev secret. Only used in dev mode: api refuses to start with it otherwise.
 	secret := "AAAAB3NzaC1yc2EAAAADAQABAAACAQCtdGt4uK8e1CEcTVZXSRJ9pRHxdeYBxq4oTh20DKH7exoikkEPbSAn34ZJPVVRdPMndg8Qg5xxHnwAtYvzYbxNWAxqYqvvvCKLJtjTS2dMeNLVz3FYD80MSJX3Tr5gpK7hHq9EEWB99onqMKDHlF3ZM3dBjwZH3mP7sWlqcdKc6lP9MGPsrpnXmBx3C4CSB7muMl8hF+4263gtS1oXHT0E16NFP3IgBNmvYavmOYSlqHs9NU7lZtNVbLbIZ2SCVrOJlcSKddvaMzIhXgRIK58VzbsqqaeVBTMrxrJopjLha2aTSe9luxOJZCf1foQKVf7eWPp4FK/zSSDMJbSX6+vsE1jFbuFF2dYmf8QW1UdDslZtQuCLzB4rqBmOiFx77DIyuZMMt5bjTi02nPYZL5Fo4vupcoV552QC6jyUG3nAoY28yPGmhKBb0EpbCd/qiroIAs5mXhaPGZriqq8DDRbqstHkubfXjDkZ6vWRDnCUfSioMky/bEC1X2KaMt/E0tpw8aWiIZXAble+CIWfo2HUj2GE/Y3Gf8f/A14Ec2E+Uz4xARcTL4UfopNU2P3Bxhz/KoIZFXYacKBphATsp+HB6sMKF5HJ+tn6mS0JFdgIpcClVMliap4zz6M92FOyyRW0wBHua6gOI+5nEMS2BDLBwTmw5otXOTFV8DaFNQzaiQ"
 	// Default host for DB in Docker containers
 	if os.Getenv("ENVTYPE") == "container" {
@@ -55,6 +111,16 @@ func InitConfig() (DbConnection, APIServerInfo, string) {
 		log.Print("<><><><> Setting api hostname \n")
 		APIServer.Hostname = apiHostname
 	}
+	if driver := os.Getenv("POPCUBE_DB_DRIVER"); driver != "" {
+		log.Print("<><><><> Setting db driver \n")
+		dbConnection.Driver = driver
+		if driver == "postgres" {
+			dbConnection.Port = "5432"
+		}
+		if driver == "sqlite" {
+			dbConnection.Database = "popcube.db"
+		}
+	}
 	// Will be erased if user is not root
 	if dbRootPassword := os.Getenv("MYSQL_ROOT_PASSWORD"); dbRootPassword != "" {
 		log.Print("<><><><> Setting db root password \n")
@@ -70,6 +136,10 @@ func InitConfig() (DbConnection, APIServerInfo, string) {
 		log.Print("<><><><> Setting db name \n")
 		dbConnection.Database = dbName
 	}
+	if dbFile := os.Getenv("POPCUBE_DB_FILE"); dbFile != "" {
+		log.Print("<><><><> Setting db file \n")
+		dbConnection.Database = dbFile
+	}
 	if dbPort := os.Getenv("MYSQL_PORT"); dbPort != "" {
 		log.Print("<><><><> Setting db port \n")
 		dbConnection.Port = dbPort
@@ -78,7 +148,129 @@ func InitConfig() (DbConnection, APIServerInfo, string) {
 		log.Print("<><><><> Setting db host \n")
 		dbConnection.Host = dbHost
 	}
+	if backend := os.Getenv("POPCUBE_DATASTORE"); backend != "" {
+		log.Print("<><><><> Setting datastore backend \n")
+		dbConnection.Backend = backend
+	}
 
 	// Return new configs
 	return dbConnection, APIServer, secret
 }
+
+// InitJwtConfig get configuration for token signing keys
+func InitJwtConfig() JwtKeyInfo {
+	keyInfo := JwtKeyInfo{
+		Algorithm: "HS256",
+		Issuer:    "http://localhost:3000",
+	}
+	if alg := os.Getenv("POPCUBE_JWT_ALG"); alg != "" {
+		log.Print("<><><><> Setting jwt algorithm \n")
+		keyInfo.Algorithm = alg
+	}
+	if kid := os.Getenv("POPCUBE_JWT_KEY_ID"); kid != "" {
+		keyInfo.KeyID = kid
+	}
+	if keyPath := os.Getenv("POPCUBE_JWT_KEY"); keyPath != "" {
+		log.Print("<><><><> Setting jwt signing key \n")
+		keyInfo.SigningKey = keyPath
+	}
+	if verifyKeys := os.Getenv("POPCUBE_JWT_VERIFY_KEYS"); verifyKeys != "" {
+		log.Print("<><><><> Setting jwt verification keys \n")
+		for _, keyPath := range strings.Split(verifyKeys, ",") {
+			if keyPath = strings.TrimSpace(keyPath); keyPath != "" {
+				keyInfo.VerificationKeys = append(keyInfo.VerificationKeys, keyPath)
+			}
+		}
+	}
+	if previousSecrets := os.Getenv("POPCUBE_JWT_PREVIOUS_SECRETS"); previousSecrets != "" {
+		log.Print("<><><><> Setting jwt previous secrets \n")
+		for _, previousSecret := range strings.Split(previousSecrets, ",") {
+			if previousSecret = strings.TrimSpace(previousSecret); previousSecret != "" {
+				keyInfo.PreviousSecrets = append(keyInfo.PreviousSecrets, previousSecret)
+			}
+		}
+	}
+	if issuer := os.Getenv("POPCUBE_JWT_ISSUER"); issuer != "" {
+		log.Print("<><><><> Setting jwt issuer \n")
+		keyInfo.Issuer = strings.TrimRight(issuer, "/")
+	}
+	return keyInfo
+}
+
+// DevMode state if api runs for development, set by POPCUBE_DEV_MODE=true. Shortcuts only safe on a developer machine,
+// as identity providers reached on the local machine or the dev jwt secret, are refused otherwise.
+func DevMode() bool {
+	return os.Getenv("POPCUBE_DEV_MODE") == "true"
+}
+
+// SigningSecretConfigured state if tokens are signed with a secret or key of the operator, set by POPCUBESECRET or
+// POPCUBE_JWT_KEY. Otherwise the dev secret, published with the sources, is used.
+func SigningSecretConfigured() bool {
+	return os.Getenv("POPCUBESECRET") != "" || os.Getenv("POPCUBE_JWT_KEY") != ""
+}
+
+// InitOperatorConfig get the key PopCube operators use to call administration endpoints. Empty key disable them.
+func InitOperatorConfig() string {
+	return os.Getenv("POPCUBE_OPERATOR_KEY")
+}
+
+// InitMailConfig get configuration for emails sent by the api
+func InitMailConfig() MailInfo {
+	mailInfo := MailInfo{
+		Backend:        "log",
+		From:           "PopCube <no-reply@popcube.xyz>",
+		SMTPPort:       "587",
+		SMTPRequireTLS: true,
+		FileDir:        "mails",
+		TemplatesDir:   "templates/mail",
+		DefaultLocale:  "en",
+		QueueSize:      256,
+		MaxAttempts:    5,
+		RetryDelay:     2 * time.Second,
+		PublicURL:      "http://localhost:3000",
+	}
+	if backend := os.Getenv("POPCUBE_MAIL_BACKEND"); backend != "" {
+		log.Print("<><><><> Setting mail backend \n")
+		mailInfo.Backend = backend
+	}
+	if from := os.Getenv("POPCUBE_MAIL_FROM"); from != "" {
+		log.Print("<><><><> Setting mail sender \n")
+		mailInfo.From = from
+	}
+	if smtpHost := os.Getenv("POPCUBE_SMTP_HOST"); smtpHost != "" {
+		log.Print("<><><><> Setting smtp server \n")
+		mailInfo.SMTPHost = smtpHost
+	}
+	if smtpPort := os.Getenv("POPCUBE_SMTP_PORT"); smtpPort != "" {
+		mailInfo.SMTPPort = smtpPort
+	}
+	if smtpUsername := os.Getenv("POPCUBE_SMTP_USERNAME"); smtpUsername != "" {
+		log.Print("<><><><> Setting smtp account \n")
+		mailInfo.SMTPUsername = smtpUsername
+		mailInfo.SMTPPassword = os.Getenv("POPCUBE_SMTP_PASSWORD")
+	}
+	if requireTLS := os.Getenv("POPCUBE_SMTP_REQUIRE_TLS"); requireTLS != "" {
+		mailInfo.SMTPRequireTLS = requireTLS != "false" && requireTLS != "0"
+	}
+	if fileDir := os.Getenv("POPCUBE_MAIL_DIR"); fileDir != "" {
+		mailInfo.FileDir = fileDir
+	}
+	if templatesDir := os.Getenv("POPCUBE_MAIL_TEMPLATES"); templatesDir != "" {
+		log.Print("<><><><> Setting mail templates \n")
+		mailInfo.TemplatesDir = templatesDir
+	}
+	if locale := os.Getenv("POPCUBE_MAIL_LOCALE"); locale != "" {
+		mailInfo.DefaultLocale = locale
+	}
+	if queueSize, err := strconv.Atoi(os.Getenv("POPCUBE_MAIL_QUEUE_SIZE")); err == nil && queueSize > 0 {
+		mailInfo.QueueSize = queueSize
+	}
+	if maxAttempts, err := strconv.Atoi(os.Getenv("POPCUBE_MAIL_MAX_ATTEMPTS")); err == nil && maxAttempts > 0 {
+		mailInfo.MaxAttempts = maxAttempts
+	}
+	if publicURL := os.Getenv("POPCUBE_PUBLIC_URL"); publicURL != "" {
+		log.Print("<><><><> Setting public url \n")
+		mailInfo.PublicURL = strings.TrimRight(publicURL, "/")
+	}
+	return mailInfo
+}
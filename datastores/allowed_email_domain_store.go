@@ -0,0 +1,103 @@
+package datastores
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// AllowedEmailDomainStoreImpl Used to implement AllowedEmailDomainStore interface
+type AllowedEmailDomainStoreImpl struct{}
+
+// AllowedEmailDomain Generate the struct for allowed email domain store
+func (s StoreImpl) AllowedEmailDomain() AllowedEmailDomainStore {
+	return AllowedEmailDomainStoreImpl{}
+}
+
+// Save Use to save allowed email domain in DB
+func (aedsi AllowedEmailDomainStoreImpl) Save(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	allowedEmailDomain.PreSave()
+	if appError := allowedEmailDomain.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("allowedEmailDomainStoreImpl.Save.allowedEmailDomain.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(allowedEmailDomain) {
+		transaction.Rollback()
+		return u.NewLocAppError("allowedEmailDomainStoreImpl.Save", "save.transaction.create.already_exist", nil, "Domain: "+allowedEmailDomain.Domain)
+	}
+	if !transaction.Where(quoteNames(transaction, "idOrganisation = ? AND domain = ?"), allowedEmailDomain.IDOrganisation, allowedEmailDomain.Domain).First(&models.AllowedEmailDomain{}).RecordNotFound() {
+		transaction.Rollback()
+		return u.NewAPIError(409, "allowed.email.domain.exist", "Domain is already allowed for this organisation.")
+	}
+	if err := transaction.Create(allowedEmailDomain).Error; err != nil {
+		transaction.Rollback()
+		return storeError("allowedEmailDomainStoreImpl.Save", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// Update change the subdomain rule of an allowed email domain. Domain itself can not change.
+func (aedsi AllowedEmailDomainStoreImpl) Update(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, includeSubdomains bool, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Model(&models.AllowedEmailDomain{}).Where(quoteNames(db, "idAllowedEmailDomain = ?"), allowedEmailDomain.IDAllowedEmailDomain).Update("includeSubdomains", includeSubdomains).Error; err != nil {
+		return storeError("allowedEmailDomainStoreImpl.Update", "update.transaction.updates.encounterError :", err)
+	}
+	allowedEmailDomain.IncludeSubdomains = includeSubdomains
+	return nil
+}
+
+// GetByID get allowed email domain from its id
+func (aedsi AllowedEmailDomainStoreImpl) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.AllowedEmailDomain, *u.AppError) {
+	db = withContext(ctx, db)
+	allowedEmailDomain := models.EmptyAllowedEmailDomain
+	if err := db.Where(quoteNames(db, "idAllowedEmailDomain = ?"), ID).First(&allowedEmailDomain).Error; err != nil {
+		return models.EmptyAllowedEmailDomain, storeError("allowedEmailDomainStoreImpl.GetByID", "get.transaction.find.encounterError :", err)
+	}
+	return allowedEmailDomain, nil
+}
+
+// GetByOrganisation get all allowed email domains of an organisation
+func (aedsi AllowedEmailDomainStoreImpl) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.AllowedEmailDomain, *u.AppError) {
+	db = withContext(ctx, db)
+	allowedEmailDomains := []models.AllowedEmailDomain{}
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), IDOrganisation).Order("domain").Find(&allowedEmailDomains).Error; err != nil {
+		return allowedEmailDomains, storeError("allowedEmailDomainStoreImpl.GetByOrganisation", "get.transaction.find.encounterError :", err)
+	}
+	return allowedEmailDomains, nil
+}
+
+// GetMatching get allowed email domains, of every organisation, matching email
+func (aedsi AllowedEmailDomainStoreImpl) GetMatching(ctx context.Context, email string, db *gorm.DB) ([]models.AllowedEmailDomain, *u.AppError) {
+	db = withContext(ctx, db)
+	matching := []models.AllowedEmailDomain{}
+	domains := models.ParentDomains(models.EmailDomain(email))
+	if len(domains) == 0 {
+		return matching, nil
+	}
+	candidates := []models.AllowedEmailDomain{}
+	if err := db.Where("domain IN (?)", domains).Find(&candidates).Error; err != nil {
+		return matching, storeError("allowedEmailDomainStoreImpl.GetMatching", "get.transaction.find.encounterError :", err)
+	}
+	for _, candidate := range candidates {
+		if candidate.Matches(email) {
+			matching = append(matching, candidate)
+		}
+	}
+	return matching, nil
+}
+
+// Delete remove allowed email domain
+func (aedsi AllowedEmailDomainStoreImpl) Delete(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	if err := transaction.Delete(allowedEmailDomain).Error; err != nil {
+		transaction.Rollback()
+		return storeError("allowedEmailDomainStoreImpl.Delete", "update.transaction.delete.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
@@ -1,45 +1,136 @@
 package datastores
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/titouanfreville/popcubeexternalapi/models"
 	u "github.com/titouanfreville/popcubeexternalapi/utils"
 
-	// Importing sql driver. They are used by gorm package and used by default from blank.
-	_ "github.com/go-sql-driver/mysql"
+	// Mysql, postgres and sqlite drivers are used by gorm package. Their errors are classified by storeError. Sqlite
+	// one is written in go, so api still builds without cgo.
+	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+const (
+	// mysqlDuplicateEntry error number of mysql when a row breaks an unique index
+	mysqlDuplicateEntry = 1062
+	// postgresUniqueViolation error code of postgres when a row breaks an unique index
+	postgresUniqueViolation pq.ErrorCode = "23505"
+	// postgresConnectionException error class of postgres when connection to the server failed
+	postgresConnectionException pq.ErrorClass = "08"
+	// sqliteBusy primary result code of sqlite when database stayed locked longer than busy timeout
+	sqliteBusy = 5
+	// sqliteConstraintUnique and sqliteConstraintPrimaryKey extended result codes of sqlite when a row breaks an
+	// unique index
+	sqliteConstraintUnique     = 2067
+	sqliteConstraintPrimaryKey = 1555
+	// sqliteDriver name sqlite driver registers under
+	sqliteDriver = "sqlite"
+	// sqliteBusyTimeout milliseconds a sqlite connection waits for a lock before failing, as long as requests may last
+	sqliteBusyTimeout = 5000
 )
 
 // StoreInterface interface the Stores and usefull DB functions
 type StoreInterface interface {
 	Organisation() OrganisationStore
 	User() UserStore
+	RefreshToken() RefreshTokenStore
+	Revocation() RevocationStore
+	Invitation() InvitationStore
+	Role() RoleStore
+	PasswordReset() PasswordResetStore
+	MFA() MFAStore
+	ServiceAccount() ServiceAccountStore
+	OAuth() OAuthStore
+	IdentityProvider() IdentityProviderStore
+	AllowedEmailDomain() AllowedEmailDomainStore
+	Migration() MigrationStore
 	InitConnection(user string, dbname string, password string, host string, port string) *gorm.DB
-	InitDatabase(user string, dbname string, password string, host string, port string)
+	InitDatabase(user string, dbname string, password string, host string, port string) *u.AppError
 	CloseConnection(*gorm.DB)
 }
 
-// StoreImpl implement store interface
-type StoreImpl struct{}
+// StoreImpl implement store interface on a sql database
+type StoreImpl struct {
+	// Driver sql driver used to reach the database: mysql (default), postgres or sqlite
+	Driver string
+}
+
+var (
+	// currentStore store given by Store
+	currentStore StoreInterface = StoreImpl{}
+	// ErrUnknownBackend datastore backend asked does not exist
+	ErrUnknownBackend = errors.New("unknown datastore backend")
+	// ErrUnknownDriver sql driver asked is not supported
+	ErrUnknownDriver = errors.New("unknown database driver")
+	// registerCallbacks change gorm default callbacks once: they are shared by all connections, as the ones bound to
+	// a context
+	registerCallbacks sync.Once
+	// mixedCaseName names with upper case letters in sql fragments
+	mixedCaseName = regexp.MustCompile(`\b[a-z][a-z0-9_]*[A-Z][A-Za-z0-9_]*\b`)
+)
 
 // Store init store
 func Store() StoreInterface {
-	return StoreImpl{}
+	return currentStore
+}
+
+// UseStore set the store given by Store. It must be called before the api serves requests, tests can use it to
+// run on a memory store.
+func UseStore(store StoreInterface) {
+	currentStore = store
 }
 
-// InitConnection init Database connection && database models
+// NewStore get store of a backend: "sql" (default) keep data in a database reached with driver, "memory" in memory.
+// "mysql" backend is the sql one, as configured before drivers could be chosen.
+func NewStore(backend string, driver string) (StoreInterface, error) {
+	switch backend {
+	case "", "sql", "mysql":
+		switch driver {
+		case "", "mysql", "postgres", "sqlite":
+			return StoreImpl{Driver: driver}, nil
+		}
+		return nil, ErrUnknownDriver
+	case "memory":
+		return NewMemoryStore(), nil
+	}
+	return nil, ErrUnknownBackend
+}
+
+// InitConnection init Database connection && database models. Sqlite database is the file named dbname, other
+// settings are not used by it.
 func (store StoreImpl) InitConnection(user string, dbname string, password string, host string, port string) *gorm.DB {
-	connectionChain := user + ":" + password + "@(" + host + ":" + port + ")/" + dbname + "?charset=utf8&parseTime=True&loc=Local"
-	db, _ := gorm.Open("mysql", connectionChain)
+	dialect, driverName, connectionChain := "mysql", "mysql", mysqlConnectionChain(user, dbname, password, host, port)
+	switch store.Driver {
+	case "postgres":
+		dialect, driverName, connectionChain = "postgres", "postgres", postgresConnectionChain(user, dbname, password, host, port)
+	case "sqlite":
+		dialect, driverName, connectionChain = "sqlite3", sqliteDriver, sqliteConnectionChain(dbname)
+	}
+	db, _ := gorm.Open(dialect, driverName, connectionChain)
 
-	// Will not set CreatedAt and LastUpdate on .Create() call
-	db.Callback().Create().Remove("gorm:update_time_stamp")
-	// db.Callback().Create().Remove("gorm:save_associations")
+	registerCallbacks.Do(func() {
+		// Will not set CreatedAt and LastUpdate on .Create() call
+		gorm.DefaultCallback.Create().Remove("gorm:update_time_stamp")
+		// gorm.DefaultCallback.Create().Remove("gorm:save_associations")
 
-	// Will not update LastUpdate on .Save() call
-	db.Callback().Update().Remove("gorm:update_time_stamp")
-	// db.Callback().Update().Remove("gorm:save_associations")
+		// Will not update LastUpdate on .Save() call
+		gorm.DefaultCallback.Update().Remove("gorm:update_time_stamp")
+		// gorm.DefaultCallback.Update().Remove("gorm:save_associations")
+	})
 
 	if err := db.DB().Ping(); err != nil {
 		log.Print("Can't connect to database")
@@ -49,12 +140,25 @@ func (store StoreImpl) InitConnection(user string, dbname string, password strin
 	return db
 }
 
-// InitDatabase initialise a connection to the database and the database.
-func (store StoreImpl) InitDatabase(user string, dbname string, password string, host string, port string) {
+// InitDatabase initialise a connection to the database and check its schema. Schema is changed by migrate command
+// only: an error is returned when it is not at SchemaVersion, so api does not serve against tables it does not know.
+func (store StoreImpl) InitDatabase(user string, dbname string, password string, host string, port string) *u.AppError {
 	db := store.InitConnection(user, dbname, password, host, port)
-	db.Debug().DB().Ping()
-	// Create correct tables
-	db.AutoMigrate(&models.Organisation{}, &models.User{})
+	if db == nil {
+		return u.NewStoreError(u.ErrorUnavailable, "storeImpl.InitDatabase", "store.database.unavailable", host)
+	}
+	version, apperr := store.Migration().Version(context.Background(), db)
+	if apperr != nil {
+		return apperr
+	}
+	if version != SchemaVersion {
+		return u.NewLocAppError("storeImpl.InitDatabase", "store.schema.outdated", nil, fmt.Sprintf("schema is at version %d, api needs version %d: run migrate command", version, SchemaVersion))
+	}
+	// Organisations created before roles existed get their default ones.
+	organisations, _ := store.Organisation().Get(context.Background(), db)
+	for _, organisation := range organisations {
+		store.Role().SeedDefaults(context.Background(), organisation.IDOrganisation, db)
+	}
 
 	// Will not set CreatedAt and LastUpdate on .Create() call
 	db.Callback().Create().Remove("gorm:update_time_stamp")
@@ -65,6 +169,7 @@ func (store StoreImpl) InitDatabase(user string, dbname string, password string,
 	// db.Callback().Update().Remove("gorm:save_associations")
 
 	db.Debug().DB().Ping()
+	return nil
 }
 
 // CloseConnection close database connection
@@ -72,32 +177,303 @@ func (store StoreImpl) CloseConnection(db *gorm.DB) {
 	defer db.Close()
 }
 
+// storeError get the error of a failed query. Missing rows, broken unique indexes, unreachable database and requests
+// which are over get their kind, so handlers answer 404, 409, 503 and 504. Other errors are internal ones, id prefixing
+// their message.
+func storeError(where string, id string, err error) *u.AppError {
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return u.NewStoreError(u.ErrorTimeout, where, "store.context.timeout", err.Error())
+	}
+	if err == gorm.ErrRecordNotFound {
+		return u.NewStoreError(u.ErrorNotFound, where, "store.record.not_found", "")
+	}
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateEntry {
+		return u.NewStoreError(u.ErrorConflict, where, "store.record.duplicate", err.Error())
+	}
+	pqErr, isPqErr := err.(*pq.Error)
+	if isPqErr && pqErr.Code == postgresUniqueViolation {
+		return u.NewStoreError(u.ErrorConflict, where, "store.record.duplicate", err.Error())
+	}
+	if isPqErr && pqErr.Code.Class() == postgresConnectionException {
+		return u.NewStoreError(u.ErrorUnavailable, where, "store.database.unavailable", err.Error())
+	}
+	sqliteErr, isSqliteErr := err.(*sqlite.Error)
+	if isSqliteErr && (sqliteErr.Code() == sqliteConstraintUnique || sqliteErr.Code() == sqliteConstraintPrimaryKey) {
+		return u.NewStoreError(u.ErrorConflict, where, "store.record.duplicate", err.Error())
+	}
+	if isSqliteErr && sqliteErr.Code()&0xff == sqliteBusy {
+		return u.NewStoreError(u.ErrorTimeout, where, "store.database.busy", err.Error())
+	}
+	if _, ok := err.(net.Error); ok || err == driver.ErrBadConn || err == mysql.ErrInvalidConn || strings.HasSuffix(err.Error(), "database is closed") {
+		return u.NewStoreError(u.ErrorUnavailable, where, "store.database.unavailable", err.Error())
+	}
+	return u.NewLocAppError(where, id+err.Error(), nil, "")
+}
+
+// mysqlConnectionChain connection string of mysql driver
+func mysqlConnectionChain(user string, dbname string, password string, host string, port string) string {
+	return user + ":" + password + "@(" + host + ":" + port + ")/" + dbname + "?charset=utf8&parseTime=True&loc=Local"
+}
+
+// postgresConnectionChain connection string of postgres driver. Values are quoted, so they can hold spaces. Other
+// settings, as sslmode, are read by the driver from PG* environment variables.
+func postgresConnectionChain(user string, dbname string, password string, host string, port string) string {
+	settings := []string{"host", host, "port", port, "user", user, "password", password, "dbname", dbname}
+	connectionChain := []string{}
+	for i := 0; i < len(settings); i += 2 {
+		value := strings.Replace(strings.Replace(settings[i+1], `\`, `\\`, -1), `'`, `\'`, -1)
+		connectionChain = append(connectionChain, settings[i]+"='"+value+"'")
+	}
+	return strings.Join(connectionChain, " ")
+}
+
+// sqliteConnectionChain connection string of sqlite driver. Pragmas are run in order on each new connection: busy
+// timeout makes it wait for locks instead of failing at once, WAL journal lets reads go on while a write runs, and
+// foreign keys are only checked when asked. Transactions take the write lock when they begin: stores read then write
+// in them, and two transactions both waiting to upgrade their read lock would fail without waiting.
+func sqliteConnectionChain(file string) string {
+	pragmas := []string{"busy_timeout(" + strconv.Itoa(sqliteBusyTimeout) + ")", "journal_mode(WAL)", "foreign_keys(1)"}
+	return "file:" + file + "?_pragma=" + strings.Join(pragmas, "&_pragma=") + "&_txlock=immediate"
+}
+
+// quoteNames quote names with upper case letters of a sql fragment, as the camel case columns of the schema. Postgres
+// folds unquoted names to lower case: conditions naming them would not match otherwise.
+func quoteNames(db *gorm.DB, fragment string) string {
+	return mixedCaseName.ReplaceAllStringFunc(fragment, db.Dialect().Quote)
+}
+
+// contextDB database running statements under a context: drivers give a statement up when it ends, even once it is
+// sent. Postgres and sqlite ones cancel it, mysql one closes its connection. Transactions begun on it are bound to the
+// context too.
+type contextDB struct {
+	ctx context.Context
+	db  *sql.DB
+}
+
+func (cdb contextDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return cdb.db.ExecContext(cdb.ctx, query, args...)
+}
+
+func (cdb contextDB) Prepare(query string) (*sql.Stmt, error) {
+	return cdb.db.PrepareContext(cdb.ctx, query)
+}
+
+func (cdb contextDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return cdb.db.QueryContext(cdb.ctx, query, args...)
+}
+
+func (cdb contextDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return cdb.db.QueryRowContext(cdb.ctx, query, args...)
+}
+
+func (cdb contextDB) Begin() (*sql.Tx, error) {
+	return cdb.db.BeginTx(cdb.ctx, nil)
+}
+
+// BeginTx begin a transaction bound to the context of cdb: gorm begins them under background context.
+func (cdb contextDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return cdb.db.BeginTx(cdb.ctx, opts)
+}
+
+// contextTx transaction running statements under the context it was begun with
+type contextTx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func (ct contextTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return ct.tx.ExecContext(ct.ctx, query, args...)
+}
+
+func (ct contextTx) Prepare(query string) (*sql.Stmt, error) {
+	return ct.tx.PrepareContext(ct.ctx, query)
+}
+
+func (ct contextTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return ct.tx.QueryContext(ct.ctx, query, args...)
+}
+
+func (ct contextTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return ct.tx.QueryRowContext(ct.ctx, query, args...)
+}
+
+func (ct contextTx) Commit() error {
+	return ct.tx.Commit()
+}
+
+func (ct contextTx) Rollback() error {
+	return ct.tx.Rollback()
+}
+
+// withContext get a connection running queries under ctx. Connections which are not a database, as transactions, are
+// given back as they are: they are already bound to the context of the store call which begun them.
+func withContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	sqlDB, ok := db.CommonDB().(*sql.DB)
+	if !ok {
+		return db
+	}
+	// Opening a connection on an existing database does not fail: it is not pinged.
+	contextConnection, _ := gorm.Open(db.Dialect().GetName(), contextDB{ctx: ctx, db: sqlDB})
+	return contextConnection
+}
+
+// begin begin a transaction on db. Statements of a transaction begun on a connection bound to a context run under it
+// too, so they are stopped when it ends.
+func begin(db *gorm.DB) *gorm.DB {
+	transaction := db.Begin()
+	cdb, ok := db.CommonDB().(contextDB)
+	if !ok || transaction.Error != nil {
+		return transaction
+	}
+	contextTransaction, _ := gorm.Open(db.Dialect().GetName(), contextTx{ctx: cdb.ctx, tx: transaction.CommonDB().(*sql.Tx)})
+	return contextTransaction
+}
+
+// contextError get the error of a store call whose context is over, so it does nothing
+func contextError(ctx context.Context, where string) *u.AppError {
+	if err := ctx.Err(); err != nil {
+		return storeError(where, "", err)
+	}
+	return nil
+}
+
 /*OrganisationStore interface the organisation communication
 Organisation is unique in the database. So they are no use of providing an user to get.
 Delete is useless as we will down the docker stack in case an organisation leace.
 */
 type OrganisationStore interface {
-	Save(organisation *models.Organisation, db *gorm.DB) *u.AppError
-	Update(organisation *models.Organisation, newOrganisation *models.Organisation, db *gorm.DB) *u.AppError
-	Get(db *gorm.DB) []models.Organisation
-	GetByID(ID uint64, db *gorm.DB) models.Organisation
-	GeByName(name string, db *gorm.DB) models.Organisation
+	Save(ctx context.Context, organisation *models.Organisation, db *gorm.DB) *u.AppError
+	Update(ctx context.Context, organisation *models.Organisation, newOrganisation *models.Organisation, db *gorm.DB) *u.AppError
+	Get(ctx context.Context, db *gorm.DB) ([]models.Organisation, *u.AppError)
+	GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Organisation, *u.AppError)
+	GetByName(ctx context.Context, name string, db *gorm.DB) (models.Organisation, *u.AppError)
+	Bootstrap(ctx context.Context, organisation *models.Organisation, owner *models.User, consumed *models.Revocation, db *gorm.DB) *u.AppError
 }
 
 /*UserStore interface the user communication*/
 type UserStore interface {
-	Save(user *models.User, db *gorm.DB) *u.AppError
-	Update(user *models.User, newUser *models.User, db *gorm.DB) *u.AppError
-	GetByID(ID uint64, db *gorm.DB) models.User
-	GetByUserName(userName string, db *gorm.DB) models.User
-	GetByEmail(userEmail string, db *gorm.DB) models.User
-	GetOrderedByDate(userDate int, db *gorm.DB) []models.User
-	GetDeleted(db *gorm.DB) []models.User
-	GetByNickName(nickName string, db *gorm.DB) models.User
-	GetByFirstName(firstName string, db *gorm.DB) []models.User
-	GetByLastName(lastName string, db *gorm.DB) []models.User
-	GetByOrganisation(role *models.Organisation, db *gorm.DB) []models.User
-	GetAll(db *gorm.DB) []models.User
-	Delete(user *models.User, db *gorm.DB) *u.AppError
-	// Login(userName string, pass string, db *gorm.DB) (models.User, *u.AppError)
+	Save(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError
+	Update(ctx context.Context, user *models.User, newUser *models.User, db *gorm.DB) *u.AppError
+	GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.User, *u.AppError)
+	GetByUserName(ctx context.Context, userName string, db *gorm.DB) (models.User, *u.AppError)
+	GetByEmail(ctx context.Context, userEmail string, db *gorm.DB) (models.User, *u.AppError)
+	GetOrderedByDate(ctx context.Context, userDate int, db *gorm.DB) ([]models.User, *u.AppError)
+	GetDeleted(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.User, *u.AppError)
+	GetByNickName(ctx context.Context, nickName string, db *gorm.DB) (models.User, *u.AppError)
+	GetByFirstName(ctx context.Context, firstName string, db *gorm.DB) ([]models.User, *u.AppError)
+	GetByLastName(ctx context.Context, lastName string, db *gorm.DB) ([]models.User, *u.AppError)
+	GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.User, *u.AppError)
+	GetAll(ctx context.Context, db *gorm.DB) ([]models.User, *u.AppError)
+	Delete(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError
+	Login(ctx context.Context, login string, pass string, db *gorm.DB) (models.User, *u.AppError)
+	VerifyEmail(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError
+}
+
+/*RefreshTokenStore interface the refresh token communication*/
+type RefreshTokenStore interface {
+	Save(ctx context.Context, refreshToken *models.RefreshToken, db *gorm.DB) *u.AppError
+	GetByToken(ctx context.Context, token string, db *gorm.DB) (models.RefreshToken, *u.AppError)
+	Rotate(ctx context.Context, refreshToken *models.RefreshToken, newRefreshToken *models.RefreshToken, db *gorm.DB) *u.AppError
+	RevokeFamily(ctx context.Context, family string, db *gorm.DB) *u.AppError
+	RevokeUser(ctx context.Context, IDUser uint64, db *gorm.DB) *u.AppError
+	RevokeOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) *u.AppError
+}
+
+/*RevocationStore interface the token revocation list communication*/
+type RevocationStore interface {
+	Save(ctx context.Context, revocation *models.Revocation, db *gorm.DB) *u.AppError
+	GetActive(ctx context.Context, date int64, db *gorm.DB) ([]models.Revocation, *u.AppError)
+	GetBySubject(ctx context.Context, kind string, subject string, db *gorm.DB) (models.Revocation, *u.AppError)
+	DeleteExpired(ctx context.Context, db *gorm.DB) *u.AppError
+}
+
+/*InvitationStore interface the invitation communication*/
+type InvitationStore interface {
+	Save(ctx context.Context, invitation *models.Invitation, db *gorm.DB) *u.AppError
+	GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Invitation, *u.AppError)
+	GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.Invitation, *u.AppError)
+	GetPendingByEmail(ctx context.Context, email string, db *gorm.DB) ([]models.Invitation, *u.AppError)
+	Revoke(ctx context.Context, invitation *models.Invitation, db *gorm.DB) *u.AppError
+	Accept(ctx context.Context, invitation *models.Invitation, user *models.User, db *gorm.DB) *u.AppError
+}
+
+/*RoleStore interface the role communication*/
+type RoleStore interface {
+	Save(ctx context.Context, role *models.Role, db *gorm.DB) *u.AppError
+	Update(ctx context.Context, role *models.Role, newRole *models.Role, db *gorm.DB) *u.AppError
+	GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Role, *u.AppError)
+	GetByName(ctx context.Context, IDOrganisation uint64, roleName string, db *gorm.DB) (models.Role, *u.AppError)
+	GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.Role, *u.AppError)
+	SeedDefaults(ctx context.Context, IDOrganisation uint64, db *gorm.DB) *u.AppError
+}
+
+/*PasswordResetStore interface the password reset communication*/
+type PasswordResetStore interface {
+	Save(ctx context.Context, passwordReset *models.PasswordReset, db *gorm.DB) *u.AppError
+	GetByToken(ctx context.Context, token string, db *gorm.DB) (models.PasswordReset, *u.AppError)
+	Consume(ctx context.Context, passwordReset *models.PasswordReset, passwordHash string, db *gorm.DB) *u.AppError
+}
+
+/*MFAStore interface the two-factor authentication communication*/
+type MFAStore interface {
+	Enrol(ctx context.Context, user *models.User, secret string, db *gorm.DB) *u.AppError
+	Enable(ctx context.Context, user *models.User, recoveryCodes []models.RecoveryCode, step int64, db *gorm.DB) *u.AppError
+	Disable(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError
+	UseTOTPStep(ctx context.Context, user *models.User, step int64, db *gorm.DB) *u.AppError
+	UseRecoveryCode(ctx context.Context, user *models.User, code string, db *gorm.DB) *u.AppError
+}
+
+/*ServiceAccountStore interface the service account and api key communication*/
+type ServiceAccountStore interface {
+	Save(ctx context.Context, serviceAccount *models.ServiceAccount, db *gorm.DB) *u.AppError
+	GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.ServiceAccount, *u.AppError)
+	GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.ServiceAccount, *u.AppError)
+	Disable(ctx context.Context, serviceAccount *models.ServiceAccount, db *gorm.DB) *u.AppError
+	SaveAPIKey(ctx context.Context, apiKey *models.APIKey, db *gorm.DB) *u.AppError
+	GetAPIKeyByID(ctx context.Context, ID uint64, db *gorm.DB) (models.APIKey, *u.AppError)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string, db *gorm.DB) (models.APIKey, *u.AppError)
+	GetAPIKeys(ctx context.Context, IDServiceAccount uint64, db *gorm.DB) ([]models.APIKey, *u.AppError)
+	RevokeAPIKey(ctx context.Context, apiKey *models.APIKey, db *gorm.DB) *u.AppError
+	TouchAPIKey(ctx context.Context, apiKey *models.APIKey, date int64, db *gorm.DB) *u.AppError
+}
+
+/*OAuthStore interface the oauth clients and authorization codes communication*/
+type OAuthStore interface {
+	SaveClient(ctx context.Context, client *models.OAuthClient, db *gorm.DB) *u.AppError
+	GetClientByID(ctx context.Context, ID uint64, db *gorm.DB) (models.OAuthClient, *u.AppError)
+	GetClientByClientID(ctx context.Context, clientID string, db *gorm.DB) (models.OAuthClient, *u.AppError)
+	GetClientsByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.OAuthClient, *u.AppError)
+	RevokeClient(ctx context.Context, client *models.OAuthClient, db *gorm.DB) *u.AppError
+	SaveCode(ctx context.Context, code *models.OAuthCode, db *gorm.DB) *u.AppError
+	GetCode(ctx context.Context, code string, db *gorm.DB) (models.OAuthCode, *u.AppError)
+	ConsumeCode(ctx context.Context, code *models.OAuthCode, tokenID string, db *gorm.DB) *u.AppError
+}
+
+/*IdentityProviderStore interface the identity provider and federated identity communication*/
+type IdentityProviderStore interface {
+	Save(ctx context.Context, identityProvider *models.IdentityProvider, db *gorm.DB) *u.AppError
+	GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) (models.IdentityProvider, *u.AppError)
+	Delete(ctx context.Context, identityProvider *models.IdentityProvider, db *gorm.DB) *u.AppError
+	GetIdentity(ctx context.Context, IDIdentityProvider uint64, subject string, db *gorm.DB) (models.FederatedIdentity, *u.AppError)
+	Link(ctx context.Context, identity *models.FederatedIdentity, db *gorm.DB) *u.AppError
+	CreateUser(ctx context.Context, user *models.User, identity *models.FederatedIdentity, db *gorm.DB) *u.AppError
+}
+
+/*AllowedEmailDomainStore interface the allowed email domain communication*/
+type AllowedEmailDomainStore interface {
+	Save(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, db *gorm.DB) *u.AppError
+	Update(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, includeSubdomains bool, db *gorm.DB) *u.AppError
+	GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.AllowedEmailDomain, *u.AppError)
+	GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.AllowedEmailDomain, *u.AppError)
+	GetMatching(ctx context.Context, email string, db *gorm.DB) ([]models.AllowedEmailDomain, *u.AppError)
+	Delete(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, db *gorm.DB) *u.AppError
+}
+
+/*MigrationStore interface the database schema migrations communication
+Version 0 is an empty database, SchemaVersion the schema api works with.
+*/
+type MigrationStore interface {
+	Version(ctx context.Context, db *gorm.DB) (int, *u.AppError)
+	Status(ctx context.Context, db *gorm.DB) ([]MigrationStatus, *u.AppError)
+	MigrateTo(ctx context.Context, version int, db *gorm.DB) *u.AppError
 }
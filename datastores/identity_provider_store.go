@@ -0,0 +1,140 @@
+package datastores
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// IdentityProviderStoreImpl Used to implement IdentityProviderStore interface
+type IdentityProviderStoreImpl struct{}
+
+// IdentityProvider Generate the struct for identity provider store
+func (s StoreImpl) IdentityProvider() IdentityProviderStore {
+	return IdentityProviderStoreImpl{}
+}
+
+// Save create identity provider of the organisation, or replace the existing one. Client secret is kept if none is given.
+func (ipsi IdentityProviderStoreImpl) Save(ctx context.Context, identityProvider *models.IdentityProvider, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	identityProvider.PreSave()
+	if appError := identityProvider.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("identityProviderStoreImpl.Save.identityProvider.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	old := models.EmptyIdentityProvider
+	if transaction.Where(quoteNames(transaction, "idOrganisation = ?"), identityProvider.IDOrganisation).First(&old).RecordNotFound() {
+		identityProvider.IDIdentityProvider = 0
+		if err := transaction.Create(identityProvider).Error; err != nil {
+			transaction.Rollback()
+			return storeError("identityProviderStoreImpl.Save", "save.transaction.create.encounterError :", err)
+		}
+		transaction.Commit()
+		return nil
+	}
+	identityProvider.IDIdentityProvider = old.IDIdentityProvider
+	identityProvider.CreatedAt = old.CreatedAt
+	if identityProvider.ClientSecret == "" {
+		identityProvider.ClientSecret = old.ClientSecret
+	}
+	if old.Issuer != identityProvider.Issuer {
+		// Subjects are only unique inside an issuer: links to the previous one are meaningless.
+		if err := transaction.Where(quoteNames(transaction, "idIdentityProvider = ?"), old.IDIdentityProvider).Delete(&models.FederatedIdentity{}).Error; err != nil {
+			transaction.Rollback()
+			return storeError("identityProviderStoreImpl.Save", "update.transaction.delete.encounterError :", err)
+		}
+	}
+	if err := transaction.Save(identityProvider).Error; err != nil {
+		transaction.Rollback()
+		return storeError("identityProviderStoreImpl.Save", "update.transaction.updates.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetByOrganisation get identity provider of an organisation
+func (ipsi IdentityProviderStoreImpl) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) (models.IdentityProvider, *u.AppError) {
+	db = withContext(ctx, db)
+	identityProvider := models.EmptyIdentityProvider
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), IDOrganisation).First(&identityProvider).Error; err != nil {
+		return models.EmptyIdentityProvider, storeError("identityProviderStoreImpl.GetByOrganisation", "get.transaction.find.encounterError :", err)
+	}
+	return identityProvider, nil
+}
+
+// Delete remove identity provider and the links of users to it. Users keep their accounts.
+func (ipsi IdentityProviderStoreImpl) Delete(ctx context.Context, identityProvider *models.IdentityProvider, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	if err := transaction.Where(quoteNames(transaction, "idIdentityProvider = ?"), identityProvider.IDIdentityProvider).Delete(&models.FederatedIdentity{}).Error; err != nil {
+		transaction.Rollback()
+		return storeError("identityProviderStoreImpl.Delete", "update.transaction.delete.encounterError :", err)
+	}
+	if err := transaction.Delete(identityProvider).Error; err != nil {
+		transaction.Rollback()
+		return storeError("identityProviderStoreImpl.Delete", "update.transaction.delete.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetIdentity get link of a provider subject to an user
+func (ipsi IdentityProviderStoreImpl) GetIdentity(ctx context.Context, IDIdentityProvider uint64, subject string, db *gorm.DB) (models.FederatedIdentity, *u.AppError) {
+	db = withContext(ctx, db)
+	identity := models.EmptyFederatedIdentity
+	if err := db.Where(quoteNames(db, "idIdentityProvider = ? AND subject = ?"), IDIdentityProvider, subject).First(&identity).Error; err != nil {
+		return models.EmptyFederatedIdentity, storeError("identityProviderStoreImpl.GetIdentity", "get.transaction.find.encounterError :", err)
+	}
+	return identity, nil
+}
+
+// Link link an existing user to a provider subject
+func (ipsi IdentityProviderStoreImpl) Link(ctx context.Context, identity *models.FederatedIdentity, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	identity.PreSave()
+	if appError := identity.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("identityProviderStoreImpl.Link.identity.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if err := transaction.Create(identity).Error; err != nil {
+		transaction.Rollback()
+		return storeError("identityProviderStoreImpl.Link", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// CreateUser create an user logging in for the first time with provider, and its link, in a single transaction
+func (ipsi IdentityProviderStoreImpl) CreateUser(ctx context.Context, user *models.User, identity *models.FederatedIdentity, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	user.PreSave()
+	if appError := user.IsValid(false); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("identityProviderStoreImpl.CreateUser.user.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if user.IDRole == 0 {
+		role := models.EmptyRole
+		transaction.Where(quoteNames(transaction, "idOrganisation = ? AND roleName = ?"), user.IDOrganisation, models.RoleMember).First(&role)
+		user.IDRole = role.IDRole
+	}
+	if err := transaction.Create(user).Error; err != nil {
+		transaction.Rollback()
+		return storeError("identityProviderStoreImpl.CreateUser", "save.transaction.create.encounterError :", err)
+	}
+	identity.IDUser = user.IDUser
+	identity.PreSave()
+	if appError := identity.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("identityProviderStoreImpl.CreateUser.identity.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if err := transaction.Create(identity).Error; err != nil {
+		transaction.Rollback()
+		return storeError("identityProviderStoreImpl.CreateUser", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
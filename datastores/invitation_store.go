@@ -0,0 +1,122 @@
+package datastores
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// InvitationStoreImpl Used to implement InvitationStore interface
+type InvitationStoreImpl struct{}
+
+// Invitation Generate the struct for invitation store
+func (s StoreImpl) Invitation() InvitationStore {
+	return InvitationStoreImpl{}
+}
+
+// Save Use to save invitation in DB
+func (isi InvitationStoreImpl) Save(ctx context.Context, invitation *models.Invitation, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	invitation.PreSave()
+	if appError := invitation.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("invitationStoreImpl.Save.invitation.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(invitation) {
+		transaction.Rollback()
+		return u.NewLocAppError("invitationStoreImpl.Save", "save.transaction.create.already_exist", nil, "Email: "+invitation.Email)
+	}
+	if err := transaction.Create(invitation).Error; err != nil {
+		transaction.Rollback()
+		return storeError("invitationStoreImpl.Save", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetByID get invitation from its id
+func (isi InvitationStoreImpl) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Invitation, *u.AppError) {
+	db = withContext(ctx, db)
+	invitation := models.EmptyInvitation
+	if err := db.Where(quoteNames(db, "idInvitation = ?"), ID).First(&invitation).Error; err != nil {
+		return models.EmptyInvitation, storeError("invitationStoreImpl.GetByID", "get.transaction.find.encounterError :", err)
+	}
+	return invitation, nil
+}
+
+// GetByOrganisation get all invitations of an organisation
+func (isi InvitationStoreImpl) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.Invitation, *u.AppError) {
+	db = withContext(ctx, db)
+	invitations := []models.Invitation{}
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), IDOrganisation).Order(quoteNames(db, "invitedAt desc")).Find(&invitations).Error; err != nil {
+		return invitations, storeError("invitationStoreImpl.GetByOrganisation", "get.transaction.find.encounterError :", err)
+	}
+	return invitations, nil
+}
+
+// GetPendingByEmail get invitations of an email which can still be accepted
+func (isi InvitationStoreImpl) GetPendingByEmail(ctx context.Context, email string, db *gorm.DB) ([]models.Invitation, *u.AppError) {
+	db = withContext(ctx, db)
+	invitations := []models.Invitation{}
+	if err := db.Where(quoteNames(db, "email = ? AND status = ? AND expiresAt >= ?"), email, models.InvitationStatusPending, time.Now().UTC().Unix()).Find(&invitations).Error; err != nil {
+		return invitations, storeError("invitationStoreImpl.GetPendingByEmail", "get.transaction.find.encounterError :", err)
+	}
+	return invitations, nil
+}
+
+// Revoke cancel a pending invitation
+func (isi InvitationStoreImpl) Revoke(ctx context.Context, invitation *models.Invitation, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	result := db.Model(&models.Invitation{}).
+		Where(quoteNames(db, "idInvitation = ? AND status = ?"), invitation.IDInvitation, models.InvitationStatusPending).
+		Update("status", models.InvitationStatusRevoked)
+	if result.Error != nil {
+		return storeError("invitationStoreImpl.Revoke", "update.transaction.updates.encounterError :", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return u.NewAPIError(409, "invitation.not.pending", "Invitation was already accepted or revoked.")
+	}
+	invitation.Status = models.InvitationStatusRevoked
+	return nil
+}
+
+// Accept consume invitation and create the invited user in a single transaction. Invitation can only be accepted once.
+func (isi InvitationStoreImpl) Accept(ctx context.Context, invitation *models.Invitation, user *models.User, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	user.Email = invitation.Email
+	user.IDOrganisation = invitation.IDOrganisation
+	user.PreSave()
+	if appError := user.IsValid(false); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("invitationStoreImpl.Accept.user.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	result := transaction.Model(&models.Invitation{}).
+		Where(quoteNames(transaction, "idInvitation = ? AND status = ? AND expiresAt >= ?"), invitation.IDInvitation, models.InvitationStatusPending, time.Now().UTC().Unix()).
+		Update("status", models.InvitationStatusAccepted)
+	if result.Error != nil {
+		transaction.Rollback()
+		return storeError("invitationStoreImpl.Accept", "update.transaction.updates.encounterError :", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		transaction.Rollback()
+		return u.NewAPIError(409, "invitation.not.pending", "Invitation was already accepted, revoked or is expired.")
+	}
+	role := models.EmptyRole
+	if transaction.Where(quoteNames(transaction, "idOrganisation = ? AND roleName = ?"), invitation.IDOrganisation, invitation.Role).First(&role).RecordNotFound() {
+		transaction.Rollback()
+		return u.NewLocAppError("invitationStoreImpl.Accept", "model.invitation.is_valid.role.app_error", nil, "Role: "+invitation.Role)
+	}
+	user.IDRole = role.IDRole
+	if err := transaction.Create(user).Error; err != nil {
+		transaction.Rollback()
+		return storeError("invitationStoreImpl.Accept", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	invitation.Status = models.InvitationStatusAccepted
+	return nil
+}
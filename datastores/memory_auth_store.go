@@ -0,0 +1,1063 @@
+package datastores
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// RefreshTokenMemoryStore implement RefreshTokenStore interface in memory
+type RefreshTokenMemoryStore struct {
+	data *memoryData
+}
+
+// RefreshToken Generate the struct for refresh token memory store
+func (store MemoryStore) RefreshToken() RefreshTokenStore {
+	return RefreshTokenMemoryStore{store.data}
+}
+
+// RevocationMemoryStore implement RevocationStore interface in memory
+type RevocationMemoryStore struct {
+	data *memoryData
+}
+
+// Revocation Generate the struct for revocation memory store
+func (store MemoryStore) Revocation() RevocationStore {
+	return RevocationMemoryStore{store.data}
+}
+
+// PasswordResetMemoryStore implement PasswordResetStore interface in memory
+type PasswordResetMemoryStore struct {
+	data *memoryData
+}
+
+// PasswordReset Generate the struct for password reset memory store
+func (store MemoryStore) PasswordReset() PasswordResetStore {
+	return PasswordResetMemoryStore{store.data}
+}
+
+// MFAMemoryStore implement MFAStore interface in memory
+type MFAMemoryStore struct {
+	data *memoryData
+}
+
+// MFA Generate the struct for two-factor authentication memory store
+func (store MemoryStore) MFA() MFAStore {
+	return MFAMemoryStore{store.data}
+}
+
+// ServiceAccountMemoryStore implement ServiceAccountStore interface in memory
+type ServiceAccountMemoryStore struct {
+	data *memoryData
+}
+
+// ServiceAccount Generate the struct for service account memory store
+func (store MemoryStore) ServiceAccount() ServiceAccountStore {
+	return ServiceAccountMemoryStore{store.data}
+}
+
+// OAuthMemoryStore implement OAuthStore interface in memory
+type OAuthMemoryStore struct {
+	data *memoryData
+}
+
+// OAuth Generate the struct for oauth memory store
+func (store MemoryStore) OAuth() OAuthStore {
+	return OAuthMemoryStore{store.data}
+}
+
+// IdentityProviderMemoryStore implement IdentityProviderStore interface in memory
+type IdentityProviderMemoryStore struct {
+	data *memoryData
+}
+
+// IdentityProvider Generate the struct for identity provider memory store
+func (store MemoryStore) IdentityProvider() IdentityProviderStore {
+	return IdentityProviderMemoryStore{store.data}
+}
+
+// AllowedEmailDomainMemoryStore implement AllowedEmailDomainStore interface in memory
+type AllowedEmailDomainMemoryStore struct {
+	data *memoryData
+}
+
+// AllowedEmailDomain Generate the struct for allowed email domain memory store
+func (store MemoryStore) AllowedEmailDomain() AllowedEmailDomainStore {
+	return AllowedEmailDomainMemoryStore{store.data}
+}
+
+// createRefreshToken insert refresh token, checking its unique index
+func (data *memoryData) createRefreshToken(where string, refreshToken *models.RefreshToken) *u.AppError {
+	for _, existing := range data.refreshTokens {
+		if existing.TokenHash == refreshToken.TokenHash {
+			return errDuplicate(where, "tokenHash", refreshToken.Family)
+		}
+	}
+	refreshToken.IDRefreshToken = data.nextID()
+	data.refreshTokens = append(data.refreshTokens, *refreshToken)
+	return nil
+}
+
+// findRevocation get revocation of a subject
+func (data *memoryData) findRevocation(kind string, subject string) (models.Revocation, bool) {
+	for _, revocation := range data.revocations {
+		if revocation.Kind == kind && revocation.Subject == subject {
+			return revocation, true
+		}
+	}
+	return models.EmptyRevocation, false
+}
+
+// Save Use to save refresh token in memory
+func (rtsm RefreshTokenMemoryStore) Save(ctx context.Context, refreshToken *models.RefreshToken, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "refreshTokenMemoryStore.Save"); err != nil {
+		return err
+	}
+	rtsm.data.Lock()
+	defer rtsm.data.Unlock()
+	refreshToken.PreSave()
+	if appError := refreshToken.IsValid(); appError != nil {
+		return u.NewLocAppError("refreshTokenMemoryStore.Save.refreshToken.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if refreshToken.IDRefreshToken != 0 {
+		return u.NewLocAppError("refreshTokenMemoryStore.Save", "save.transaction.create.already_exist", nil, "Family: "+refreshToken.Family)
+	}
+	if err := rtsm.data.createRefreshToken("refreshTokenMemoryStore.Save", refreshToken); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetByToken get refresh token from its clear value
+func (rtsm RefreshTokenMemoryStore) GetByToken(ctx context.Context, token string, db *gorm.DB) (models.RefreshToken, *u.AppError) {
+	if err := contextError(ctx, "refreshTokenMemoryStore.GetByToken"); err != nil {
+		return models.EmptyRefreshToken, err
+	}
+	rtsm.data.Lock()
+	defer rtsm.data.Unlock()
+	tokenHash := models.HashToken(token)
+	for _, refreshToken := range rtsm.data.refreshTokens {
+		if refreshToken.TokenHash == tokenHash {
+			return refreshToken, nil
+		}
+	}
+	return models.EmptyRefreshToken, errNotFound("refreshTokenMemoryStore.GetByToken")
+}
+
+// Rotate mark refresh token as used and save the one replacing it. It fails if refresh token was already
+// rotated or revoked, so a refresh token can only be used once.
+func (rtsm RefreshTokenMemoryStore) Rotate(ctx context.Context, refreshToken *models.RefreshToken, newRefreshToken *models.RefreshToken, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "refreshTokenMemoryStore.Rotate"); err != nil {
+		return err
+	}
+	rtsm.data.Lock()
+	defer rtsm.data.Unlock()
+	newRefreshToken.PreSave()
+	if appError := newRefreshToken.IsValid(); appError != nil {
+		return u.NewLocAppError("refreshTokenMemoryStore.Rotate.newRefreshToken.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	for i, existing := range rtsm.data.refreshTokens {
+		if existing.IDRefreshToken != refreshToken.IDRefreshToken || existing.Rotated || existing.Revoked {
+			continue
+		}
+		if err := rtsm.data.createRefreshToken("refreshTokenMemoryStore.Rotate", newRefreshToken); err != nil {
+			return err
+		}
+		rtsm.data.refreshTokens[i].Rotated = true
+		refreshToken.Rotated = true
+		return nil
+	}
+	return u.NewAPIError(401, "refresh.token.reused", "Refresh token was already used.")
+}
+
+// revoke revoke refresh tokens matching filter
+func (rtsm RefreshTokenMemoryStore) revoke(filter func(refreshToken models.RefreshToken) bool) {
+	rtsm.data.Lock()
+	defer rtsm.data.Unlock()
+	for i, refreshToken := range rtsm.data.refreshTokens {
+		if filter(refreshToken) {
+			rtsm.data.refreshTokens[i].Revoked = true
+		}
+	}
+}
+
+// RevokeFamily revoke every refresh token of a family
+func (rtsm RefreshTokenMemoryStore) RevokeFamily(ctx context.Context, family string, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "refreshTokenMemoryStore.RevokeFamily"); err != nil {
+		return err
+	}
+	rtsm.revoke(func(refreshToken models.RefreshToken) bool { return refreshToken.Family == family })
+	return nil
+}
+
+// RevokeUser revoke every refresh token of an user
+func (rtsm RefreshTokenMemoryStore) RevokeUser(ctx context.Context, IDUser uint64, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "refreshTokenMemoryStore.RevokeUser"); err != nil {
+		return err
+	}
+	rtsm.revoke(func(refreshToken models.RefreshToken) bool { return refreshToken.IDUser == IDUser })
+	return nil
+}
+
+// RevokeOrganisation revoke every refresh token of the users of an organisation
+func (rtsm RefreshTokenMemoryStore) RevokeOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "refreshTokenMemoryStore.RevokeOrganisation"); err != nil {
+		return err
+	}
+	rtsm.data.Lock()
+	members := map[uint64]bool{}
+	for _, user := range rtsm.data.users {
+		if user.IDOrganisation == IDOrganisation {
+			members[user.IDUser] = true
+		}
+	}
+	rtsm.data.Unlock()
+	rtsm.revoke(func(refreshToken models.RefreshToken) bool { return members[refreshToken.IDUser] })
+	return nil
+}
+
+// Save Use to save revocation in memory. Revoking a subject again keeps the longest revocation.
+func (rsm RevocationMemoryStore) Save(ctx context.Context, revocation *models.Revocation, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "revocationMemoryStore.Save"); err != nil {
+		return err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	revocation.PreSave()
+	if appError := revocation.IsValid(); appError != nil {
+		return u.NewLocAppError("revocationMemoryStore.Save.revocation.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	for i, existing := range rsm.data.revocations {
+		if existing.Kind != revocation.Kind || existing.Subject != revocation.Subject {
+			continue
+		}
+		if revocation.ExpiresAt != 0 && existing.ExpiresAt != 0 && existing.ExpiresAt > revocation.ExpiresAt {
+			revocation.ExpiresAt = existing.ExpiresAt
+		}
+		if existing.ExpiresAt == 0 {
+			revocation.ExpiresAt = 0
+		}
+		rsm.data.revocations[i].RevokedAt = revocation.RevokedAt
+		rsm.data.revocations[i].ExpiresAt = revocation.ExpiresAt
+		revocation.IDRevocation = existing.IDRevocation
+		return nil
+	}
+	revocation.IDRevocation = rsm.data.nextID()
+	rsm.data.revocations = append(rsm.data.revocations, *revocation)
+	return nil
+}
+
+// GetActive get revocations which did not expire at date
+func (rsm RevocationMemoryStore) GetActive(ctx context.Context, date int64, db *gorm.DB) ([]models.Revocation, *u.AppError) {
+	if err := contextError(ctx, "revocationMemoryStore.GetActive"); err != nil {
+		return []models.Revocation{}, err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	revocations := []models.Revocation{}
+	for _, revocation := range rsm.data.revocations {
+		if revocation.ExpiresAt == 0 || revocation.ExpiresAt > date {
+			revocations = append(revocations, revocation)
+		}
+	}
+	return revocations, nil
+}
+
+// GetBySubject get revocation of a subject
+func (rsm RevocationMemoryStore) GetBySubject(ctx context.Context, kind string, subject string, db *gorm.DB) (models.Revocation, *u.AppError) {
+	if err := contextError(ctx, "revocationMemoryStore.GetBySubject"); err != nil {
+		return models.EmptyRevocation, err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	if revocation, ok := rsm.data.findRevocation(kind, subject); ok {
+		return revocation, nil
+	}
+	return models.EmptyRevocation, errNotFound("revocationMemoryStore.GetBySubject")
+}
+
+// DeleteExpired remove revocations of tokens which expired anyway
+func (rsm RevocationMemoryStore) DeleteExpired(ctx context.Context, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "revocationMemoryStore.DeleteExpired"); err != nil {
+		return err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	now := time.Now().UTC().Unix()
+	revocations := []models.Revocation{}
+	for _, revocation := range rsm.data.revocations {
+		if revocation.ExpiresAt == 0 || revocation.ExpiresAt >= now {
+			revocations = append(revocations, revocation)
+		}
+	}
+	rsm.data.revocations = revocations
+	return nil
+}
+
+// Save Use to save password reset in memory. Previous resets of the user which were not used can not be used anymore.
+func (prsm PasswordResetMemoryStore) Save(ctx context.Context, passwordReset *models.PasswordReset, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "passwordResetMemoryStore.Save"); err != nil {
+		return err
+	}
+	prsm.data.Lock()
+	defer prsm.data.Unlock()
+	passwordReset.PreSave()
+	if appError := passwordReset.IsValid(); appError != nil {
+		return u.NewLocAppError("passwordResetMemoryStore.Save.passwordReset.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if passwordReset.IDPasswordReset != 0 {
+		return u.NewLocAppError("passwordResetMemoryStore.Save", "save.transaction.create.already_exist", nil, "")
+	}
+	for _, existing := range prsm.data.passwordResets {
+		if existing.TokenHash == passwordReset.TokenHash {
+			return errDuplicate("passwordResetMemoryStore.Save", "tokenHash", passwordReset.IDUser)
+		}
+	}
+	for i := range prsm.data.passwordResets {
+		if prsm.data.passwordResets[i].IDUser == passwordReset.IDUser {
+			prsm.data.passwordResets[i].Used = true
+		}
+	}
+	passwordReset.IDPasswordReset = prsm.data.nextID()
+	prsm.data.passwordResets = append(prsm.data.passwordResets, *passwordReset)
+	return nil
+}
+
+// GetByToken get password reset from its clear value
+func (prsm PasswordResetMemoryStore) GetByToken(ctx context.Context, token string, db *gorm.DB) (models.PasswordReset, *u.AppError) {
+	if err := contextError(ctx, "passwordResetMemoryStore.GetByToken"); err != nil {
+		return models.EmptyPasswordReset, err
+	}
+	prsm.data.Lock()
+	defer prsm.data.Unlock()
+	tokenHash := models.HashToken(token)
+	for _, passwordReset := range prsm.data.passwordResets {
+		if passwordReset.TokenHash == tokenHash {
+			return passwordReset, nil
+		}
+	}
+	return models.EmptyPasswordReset, errNotFound("passwordResetMemoryStore.GetByToken")
+}
+
+// Consume mark password reset as used, set the new password hash of its user and revoke every refresh token
+// of the user. It fails if reset was already used or is expired, so a reset token can only be used once.
+func (prsm PasswordResetMemoryStore) Consume(ctx context.Context, passwordReset *models.PasswordReset, passwordHash string, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "passwordResetMemoryStore.Consume"); err != nil {
+		return err
+	}
+	prsm.data.Lock()
+	defer prsm.data.Unlock()
+	if !models.IsHashedPassword(passwordHash) {
+		return u.NewLocAppError("passwordResetMemoryStore.Consume", "model.user.is_valid.password.app_error", nil, "")
+	}
+	now := time.Now().UTC().Unix()
+	for i, existing := range prsm.data.passwordResets {
+		if existing.IDPasswordReset != passwordReset.IDPasswordReset || existing.Used || existing.ExpiresAt < now {
+			continue
+		}
+		prsm.data.passwordResets[i].Used = true
+		if j := prsm.data.userIndex(existing.IDUser); j >= 0 {
+			prsm.data.users[j].Password = passwordHash
+		}
+		for j := range prsm.data.refreshTokens {
+			if prsm.data.refreshTokens[j].IDUser == existing.IDUser {
+				prsm.data.refreshTokens[j].Revoked = true
+			}
+		}
+		passwordReset.Used = true
+		return nil
+	}
+	return u.NewAPIError(401, "password.reset.invalid", "Password reset link is invalid, expired or was already used.")
+}
+
+// Enrol save a new TOTP secret for user. Two-factor authentication is only enabled once Enable is called.
+func (msm MFAMemoryStore) Enrol(ctx context.Context, user *models.User, secret string, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "mFAMemoryStore.Enrol"); err != nil {
+		return err
+	}
+	if user.MFAEnabled {
+		return u.NewAPIError(409, "mfa.already.enabled", "Two-factor authentication is already enabled. Disable it first.")
+	}
+	msm.data.Lock()
+	defer msm.data.Unlock()
+	if i := msm.data.userIndex(user.IDUser); i >= 0 {
+		msm.data.users[i].MFASecret = secret
+	}
+	user.MFASecret = secret
+	return nil
+}
+
+// removeRecoveryCodes remove recovery codes of an user
+func (data *memoryData) removeRecoveryCodes(IDUser uint64) {
+	recoveryCodes := []models.RecoveryCode{}
+	for _, recoveryCode := range data.recoveryCodes {
+		if recoveryCode.IDUser != IDUser {
+			recoveryCodes = append(recoveryCodes, recoveryCode)
+		}
+	}
+	data.recoveryCodes = recoveryCodes
+}
+
+// Enable turn two-factor authentication on and replace recovery codes of the user.
+// step is the TOTP step of the code confirming enrolment.
+func (msm MFAMemoryStore) Enable(ctx context.Context, user *models.User, recoveryCodes []models.RecoveryCode, step int64, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "mFAMemoryStore.Enable"); err != nil {
+		return err
+	}
+	msm.data.Lock()
+	defer msm.data.Unlock()
+	for i := range recoveryCodes {
+		recoveryCodes[i].IDUser = user.IDUser
+		if appError := recoveryCodes[i].IsValid(); appError != nil {
+			return u.NewLocAppError("mfaMemoryStore.Enable.recoveryCode.PreSave", appError.ID, nil, appError.DetailedError)
+		}
+	}
+	if i := msm.data.userIndex(user.IDUser); i >= 0 {
+		msm.data.users[i].MFAEnabled = true
+		msm.data.users[i].MFALastStep = step
+	}
+	msm.data.removeRecoveryCodes(user.IDUser)
+	for i := range recoveryCodes {
+		recoveryCodes[i].IDRecoveryCode = msm.data.nextID()
+		msm.data.recoveryCodes = append(msm.data.recoveryCodes, recoveryCodes[i])
+	}
+	user.MFAEnabled = true
+	user.MFALastStep = step
+	return nil
+}
+
+// Disable turn two-factor authentication off, forgetting secret and recovery codes of the user
+func (msm MFAMemoryStore) Disable(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "mFAMemoryStore.Disable"); err != nil {
+		return err
+	}
+	msm.data.Lock()
+	defer msm.data.Unlock()
+	if i := msm.data.userIndex(user.IDUser); i >= 0 {
+		msm.data.users[i].MFAEnabled = false
+		msm.data.users[i].MFASecret = ""
+		msm.data.users[i].MFALastStep = 0
+	}
+	msm.data.removeRecoveryCodes(user.IDUser)
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.MFALastStep = 0
+	return nil
+}
+
+// UseTOTPStep record the step of an accepted TOTP code. It fails if this step or a later one was already used.
+func (msm MFAMemoryStore) UseTOTPStep(ctx context.Context, user *models.User, step int64, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "mFAMemoryStore.UseTOTPStep"); err != nil {
+		return err
+	}
+	msm.data.Lock()
+	defer msm.data.Unlock()
+	i := msm.data.userIndex(user.IDUser)
+	if i < 0 || msm.data.users[i].MFALastStep >= step {
+		return u.NewAPIError(401, "mfa.code.invalid", "Two-factor authentication code is not valid.")
+	}
+	msm.data.users[i].MFALastStep = step
+	user.MFALastStep = step
+	return nil
+}
+
+// UseRecoveryCode consume a recovery code of the user. It fails if code is unknown or was already used.
+func (msm MFAMemoryStore) UseRecoveryCode(ctx context.Context, user *models.User, code string, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "mFAMemoryStore.UseRecoveryCode"); err != nil {
+		return err
+	}
+	msm.data.Lock()
+	defer msm.data.Unlock()
+	codeHash := models.HashToken(models.NormalizeRecoveryCode(code))
+	for i, recoveryCode := range msm.data.recoveryCodes {
+		if recoveryCode.IDUser == user.IDUser && recoveryCode.CodeHash == codeHash && !recoveryCode.Used {
+			msm.data.recoveryCodes[i].Used = true
+			return nil
+		}
+	}
+	return u.NewAPIError(401, "mfa.code.invalid", "Two-factor authentication code is not valid.")
+}
+
+// Save Use to save service account in memory
+func (sasm ServiceAccountMemoryStore) Save(ctx context.Context, serviceAccount *models.ServiceAccount, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "serviceAccountMemoryStore.Save"); err != nil {
+		return err
+	}
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	serviceAccount.PreSave()
+	if appError := serviceAccount.IsValid(); appError != nil {
+		return u.NewLocAppError("serviceAccountMemoryStore.Save.serviceAccount.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if serviceAccount.IDServiceAccount != 0 {
+		return u.NewLocAppError("serviceAccountMemoryStore.Save", "save.transaction.create.already_exist", nil, "Name: "+serviceAccount.Name)
+	}
+	for _, existing := range sasm.data.serviceAccounts {
+		if existing.IDOrganisation == serviceAccount.IDOrganisation && existing.Name == serviceAccount.Name {
+			return errDuplicate("serviceAccountMemoryStore.Save", "idx_service_account_organisation_name", serviceAccount.Name)
+		}
+	}
+	serviceAccount.IDServiceAccount = sasm.data.nextID()
+	sasm.data.serviceAccounts = append(sasm.data.serviceAccounts, *serviceAccount)
+	return nil
+}
+
+// GetByID get service account from its id
+func (sasm ServiceAccountMemoryStore) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.ServiceAccount, *u.AppError) {
+	if err := contextError(ctx, "serviceAccountMemoryStore.GetByID"); err != nil {
+		return models.EmptyServiceAccount, err
+	}
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	for _, serviceAccount := range sasm.data.serviceAccounts {
+		if serviceAccount.IDServiceAccount == ID {
+			return serviceAccount, nil
+		}
+	}
+	return models.EmptyServiceAccount, errNotFound("serviceAccountMemoryStore.GetByID")
+}
+
+// GetByOrganisation get all service accounts of an organisation
+func (sasm ServiceAccountMemoryStore) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.ServiceAccount, *u.AppError) {
+	if err := contextError(ctx, "serviceAccountMemoryStore.GetByOrganisation"); err != nil {
+		return []models.ServiceAccount{}, err
+	}
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	serviceAccounts := []models.ServiceAccount{}
+	for _, serviceAccount := range sasm.data.serviceAccounts {
+		if serviceAccount.IDOrganisation == IDOrganisation {
+			serviceAccounts = append(serviceAccounts, serviceAccount)
+		}
+	}
+	sortRows(serviceAccounts, func(i, j int) bool { return serviceAccounts[i].Name < serviceAccounts[j].Name })
+	return serviceAccounts, nil
+}
+
+// Disable disable service account and revoke all its keys
+func (sasm ServiceAccountMemoryStore) Disable(ctx context.Context, serviceAccount *models.ServiceAccount, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "serviceAccountMemoryStore.Disable"); err != nil {
+		return err
+	}
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	for i := range sasm.data.serviceAccounts {
+		if sasm.data.serviceAccounts[i].IDServiceAccount == serviceAccount.IDServiceAccount {
+			sasm.data.serviceAccounts[i].Disabled = true
+		}
+	}
+	for i := range sasm.data.apiKeys {
+		if sasm.data.apiKeys[i].IDServiceAccount == serviceAccount.IDServiceAccount {
+			sasm.data.apiKeys[i].Revoked = true
+		}
+	}
+	serviceAccount.Disabled = true
+	return nil
+}
+
+// SaveAPIKey Use to save api key in memory
+func (sasm ServiceAccountMemoryStore) SaveAPIKey(ctx context.Context, apiKey *models.APIKey, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "serviceAccountMemoryStore.SaveAPIKey"); err != nil {
+		return err
+	}
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	apiKey.PreSave()
+	if appError := apiKey.IsValid(); appError != nil {
+		return u.NewLocAppError("serviceAccountMemoryStore.SaveAPIKey.apiKey.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if apiKey.IDAPIKey != 0 {
+		return u.NewLocAppError("serviceAccountMemoryStore.SaveAPIKey", "save.transaction.create.already_exist", nil, "Prefix: "+apiKey.Prefix)
+	}
+	for _, existing := range sasm.data.apiKeys {
+		if existing.Prefix == apiKey.Prefix {
+			return errDuplicate("serviceAccountMemoryStore.SaveAPIKey", "prefix", apiKey.Prefix)
+		}
+	}
+	apiKey.IDAPIKey = sasm.data.nextID()
+	sasm.data.apiKeys = append(sasm.data.apiKeys, *apiKey)
+	return nil
+}
+
+// findAPIKey get first api key matching filter
+func (sasm ServiceAccountMemoryStore) findAPIKey(where string, filter func(apiKey models.APIKey) bool) (models.APIKey, *u.AppError) {
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	for _, apiKey := range sasm.data.apiKeys {
+		if filter(apiKey) {
+			apiKey.AfterFind()
+			return apiKey, nil
+		}
+	}
+	return models.EmptyAPIKey, errNotFound(where)
+}
+
+// GetAPIKeyByID get api key from its id
+func (sasm ServiceAccountMemoryStore) GetAPIKeyByID(ctx context.Context, ID uint64, db *gorm.DB) (models.APIKey, *u.AppError) {
+	if err := contextError(ctx, "serviceAccountMemoryStore.GetAPIKeyByID"); err != nil {
+		return models.EmptyAPIKey, err
+	}
+	return sasm.findAPIKey("serviceAccountMemoryStore.GetAPIKeyByID", func(apiKey models.APIKey) bool { return apiKey.IDAPIKey == ID })
+}
+
+// GetAPIKeyByPrefix get api key from its visible prefix
+func (sasm ServiceAccountMemoryStore) GetAPIKeyByPrefix(ctx context.Context, prefix string, db *gorm.DB) (models.APIKey, *u.AppError) {
+	if err := contextError(ctx, "serviceAccountMemoryStore.GetAPIKeyByPrefix"); err != nil {
+		return models.EmptyAPIKey, err
+	}
+	return sasm.findAPIKey("serviceAccountMemoryStore.GetAPIKeyByPrefix", func(apiKey models.APIKey) bool { return apiKey.Prefix == prefix })
+}
+
+// GetAPIKeys get all keys of a service account, latest first
+func (sasm ServiceAccountMemoryStore) GetAPIKeys(ctx context.Context, IDServiceAccount uint64, db *gorm.DB) ([]models.APIKey, *u.AppError) {
+	if err := contextError(ctx, "serviceAccountMemoryStore.GetAPIKeys"); err != nil {
+		return []models.APIKey{}, err
+	}
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	apiKeys := []models.APIKey{}
+	for _, apiKey := range sasm.data.apiKeys {
+		if apiKey.IDServiceAccount == IDServiceAccount {
+			apiKey.AfterFind()
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+	sortRows(apiKeys, func(i, j int) bool { return apiKeys[i].CreatedAt > apiKeys[j].CreatedAt })
+	return apiKeys, nil
+}
+
+// updateAPIKey apply change to stored api key
+func (sasm ServiceAccountMemoryStore) updateAPIKey(IDAPIKey uint64, change func(apiKey *models.APIKey)) {
+	sasm.data.Lock()
+	defer sasm.data.Unlock()
+	for i := range sasm.data.apiKeys {
+		if sasm.data.apiKeys[i].IDAPIKey == IDAPIKey {
+			change(&sasm.data.apiKeys[i])
+		}
+	}
+}
+
+// RevokeAPIKey revoke an api key. It can not be used anymore.
+func (sasm ServiceAccountMemoryStore) RevokeAPIKey(ctx context.Context, apiKey *models.APIKey, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "serviceAccountMemoryStore.RevokeAPIKey"); err != nil {
+		return err
+	}
+	sasm.updateAPIKey(apiKey.IDAPIKey, func(stored *models.APIKey) { stored.Revoked = true })
+	apiKey.Revoked = true
+	return nil
+}
+
+// TouchAPIKey record the date api key was last used
+func (sasm ServiceAccountMemoryStore) TouchAPIKey(ctx context.Context, apiKey *models.APIKey, date int64, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "serviceAccountMemoryStore.TouchAPIKey"); err != nil {
+		return err
+	}
+	sasm.updateAPIKey(apiKey.IDAPIKey, func(stored *models.APIKey) { stored.LastUsedAt = date })
+	apiKey.LastUsedAt = date
+	return nil
+}
+
+// SaveClient Use to save oauth client in memory
+func (osm OAuthMemoryStore) SaveClient(ctx context.Context, client *models.OAuthClient, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "oauthMemoryStore.SaveClient"); err != nil {
+		return err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	client.PreSave()
+	if appError := client.IsValid(); appError != nil {
+		return u.NewLocAppError("oauthMemoryStore.SaveClient.client.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if client.IDOAuthClient != 0 {
+		return u.NewLocAppError("oauthMemoryStore.SaveClient", "save.transaction.create.already_exist", nil, "Client ID: "+client.ClientID)
+	}
+	for _, existing := range osm.data.oauthClients {
+		if existing.ClientID == client.ClientID {
+			return errDuplicate("oauthMemoryStore.SaveClient", "clientID", client.ClientID)
+		}
+	}
+	client.IDOAuthClient = osm.data.nextID()
+	osm.data.oauthClients = append(osm.data.oauthClients, *client)
+	return nil
+}
+
+// findClients get oauth clients matching filter, in creation order
+func (osm OAuthMemoryStore) findClients(filter func(client models.OAuthClient) bool) []models.OAuthClient {
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	clients := []models.OAuthClient{}
+	for _, client := range osm.data.oauthClients {
+		if filter(client) {
+			client.AfterFind()
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// GetClientByID get oauth client from its database id
+func (osm OAuthMemoryStore) GetClientByID(ctx context.Context, ID uint64, db *gorm.DB) (models.OAuthClient, *u.AppError) {
+	if err := contextError(ctx, "oauthMemoryStore.GetClientByID"); err != nil {
+		return models.EmptyOAuthClient, err
+	}
+	if clients := osm.findClients(func(client models.OAuthClient) bool { return client.IDOAuthClient == ID }); len(clients) > 0 {
+		return clients[0], nil
+	}
+	return models.EmptyOAuthClient, errNotFound("oauthMemoryStore.GetClientByID")
+}
+
+// GetClientByClientID get oauth client from its public identifier
+func (osm OAuthMemoryStore) GetClientByClientID(ctx context.Context, clientID string, db *gorm.DB) (models.OAuthClient, *u.AppError) {
+	if err := contextError(ctx, "oauthMemoryStore.GetClientByClientID"); err != nil {
+		return models.EmptyOAuthClient, err
+	}
+	if clients := osm.findClients(func(client models.OAuthClient) bool { return client.ClientID == clientID }); len(clients) > 0 {
+		return clients[0], nil
+	}
+	return models.EmptyOAuthClient, errNotFound("oauthMemoryStore.GetClientByClientID")
+}
+
+// GetClientsByOrganisation get all oauth clients of an organisation
+func (osm OAuthMemoryStore) GetClientsByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.OAuthClient, *u.AppError) {
+	if err := contextError(ctx, "oauthMemoryStore.GetClientsByOrganisation"); err != nil {
+		return []models.OAuthClient{}, err
+	}
+	clients := osm.findClients(func(client models.OAuthClient) bool { return client.IDOrganisation == IDOrganisation })
+	sortRows(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+	return clients, nil
+}
+
+// RevokeClient revoke an oauth client. It can not get tokens anymore.
+func (osm OAuthMemoryStore) RevokeClient(ctx context.Context, client *models.OAuthClient, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "oauthMemoryStore.RevokeClient"); err != nil {
+		return err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	for i := range osm.data.oauthClients {
+		if osm.data.oauthClients[i].IDOAuthClient == client.IDOAuthClient {
+			osm.data.oauthClients[i].Revoked = true
+		}
+	}
+	client.Revoked = true
+	return nil
+}
+
+// SaveCode Use to save authorization code in memory
+func (osm OAuthMemoryStore) SaveCode(ctx context.Context, code *models.OAuthCode, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "oauthMemoryStore.SaveCode"); err != nil {
+		return err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	if appError := code.IsValid(); appError != nil {
+		return u.NewLocAppError("oauthMemoryStore.SaveCode.code.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	for _, existing := range osm.data.oauthCodes {
+		if existing.CodeHash == code.CodeHash {
+			return errDuplicate("oauthMemoryStore.SaveCode", "codeHash", code.IDOAuthClient)
+		}
+	}
+	code.IDOAuthCode = osm.data.nextID()
+	osm.data.oauthCodes = append(osm.data.oauthCodes, *code)
+	return nil
+}
+
+// GetCode get authorization code from its clear value
+func (osm OAuthMemoryStore) GetCode(ctx context.Context, code string, db *gorm.DB) (models.OAuthCode, *u.AppError) {
+	if err := contextError(ctx, "oauthMemoryStore.GetCode"); err != nil {
+		return models.EmptyOAuthCode, err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	codeHash := models.HashToken(code)
+	for _, oauthCode := range osm.data.oauthCodes {
+		if oauthCode.CodeHash == codeHash {
+			return oauthCode, nil
+		}
+	}
+	return models.EmptyOAuthCode, errNotFound("oauthMemoryStore.GetCode")
+}
+
+// ConsumeCode mark authorization code as exchanged for the token identified by tokenID. It fails if code was
+// already used, so a code can only be exchanged once.
+func (osm OAuthMemoryStore) ConsumeCode(ctx context.Context, code *models.OAuthCode, tokenID string, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "oauthMemoryStore.ConsumeCode"); err != nil {
+		return err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	for i, existing := range osm.data.oauthCodes {
+		if existing.IDOAuthCode == code.IDOAuthCode && !existing.Used {
+			osm.data.oauthCodes[i].Used = true
+			osm.data.oauthCodes[i].TokenID = tokenID
+			code.Used = true
+			code.TokenID = tokenID
+			return nil
+		}
+	}
+	return u.NewAPIError(400, "invalid_grant", "Authorization code was already used.")
+}
+
+// removeFederatedIdentities remove links of users to an identity provider
+func (data *memoryData) removeFederatedIdentities(IDIdentityProvider uint64) {
+	identities := []models.FederatedIdentity{}
+	for _, identity := range data.federatedIdentities {
+		if identity.IDIdentityProvider != IDIdentityProvider {
+			identities = append(identities, identity)
+		}
+	}
+	data.federatedIdentities = identities
+}
+
+// checkFederatedIdentity check unique index of links to identity providers
+func (data *memoryData) checkFederatedIdentity(where string, identity *models.FederatedIdentity) *u.AppError {
+	for _, existing := range data.federatedIdentities {
+		if existing.IDIdentityProvider == identity.IDIdentityProvider && existing.Subject == identity.Subject {
+			return errDuplicate(where, "idx_federated_identity_subject", identity.Subject)
+		}
+	}
+	return nil
+}
+
+// Save create identity provider of the organisation, or replace the existing one. Client secret is kept if none is given.
+func (ipsm IdentityProviderMemoryStore) Save(ctx context.Context, identityProvider *models.IdentityProvider, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "identityProviderMemoryStore.Save"); err != nil {
+		return err
+	}
+	ipsm.data.Lock()
+	defer ipsm.data.Unlock()
+	identityProvider.PreSave()
+	if appError := identityProvider.IsValid(); appError != nil {
+		return u.NewLocAppError("identityProviderMemoryStore.Save.identityProvider.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	for i, old := range ipsm.data.identityProviders {
+		if old.IDOrganisation != identityProvider.IDOrganisation {
+			continue
+		}
+		identityProvider.IDIdentityProvider = old.IDIdentityProvider
+		identityProvider.CreatedAt = old.CreatedAt
+		if identityProvider.ClientSecret == "" {
+			identityProvider.ClientSecret = old.ClientSecret
+		}
+		if old.Issuer != identityProvider.Issuer {
+			// Subjects are only unique inside an issuer: links to the previous one are meaningless.
+			ipsm.data.removeFederatedIdentities(old.IDIdentityProvider)
+		}
+		ipsm.data.identityProviders[i] = *identityProvider
+		return nil
+	}
+	identityProvider.IDIdentityProvider = ipsm.data.nextID()
+	ipsm.data.identityProviders = append(ipsm.data.identityProviders, *identityProvider)
+	return nil
+}
+
+// GetByOrganisation get identity provider of an organisation
+func (ipsm IdentityProviderMemoryStore) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) (models.IdentityProvider, *u.AppError) {
+	if err := contextError(ctx, "identityProviderMemoryStore.GetByOrganisation"); err != nil {
+		return models.EmptyIdentityProvider, err
+	}
+	ipsm.data.Lock()
+	defer ipsm.data.Unlock()
+	for _, identityProvider := range ipsm.data.identityProviders {
+		if identityProvider.IDOrganisation == IDOrganisation {
+			return identityProvider, nil
+		}
+	}
+	return models.EmptyIdentityProvider, errNotFound("identityProviderMemoryStore.GetByOrganisation")
+}
+
+// Delete remove identity provider and the links of users to it. Users keep their accounts.
+func (ipsm IdentityProviderMemoryStore) Delete(ctx context.Context, identityProvider *models.IdentityProvider, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "identityProviderMemoryStore.Delete"); err != nil {
+		return err
+	}
+	ipsm.data.Lock()
+	defer ipsm.data.Unlock()
+	ipsm.data.removeFederatedIdentities(identityProvider.IDIdentityProvider)
+	identityProviders := []models.IdentityProvider{}
+	for _, existing := range ipsm.data.identityProviders {
+		if existing.IDIdentityProvider != identityProvider.IDIdentityProvider {
+			identityProviders = append(identityProviders, existing)
+		}
+	}
+	ipsm.data.identityProviders = identityProviders
+	return nil
+}
+
+// GetIdentity get link of a provider subject to an user
+func (ipsm IdentityProviderMemoryStore) GetIdentity(ctx context.Context, IDIdentityProvider uint64, subject string, db *gorm.DB) (models.FederatedIdentity, *u.AppError) {
+	if err := contextError(ctx, "identityProviderMemoryStore.GetIdentity"); err != nil {
+		return models.EmptyFederatedIdentity, err
+	}
+	ipsm.data.Lock()
+	defer ipsm.data.Unlock()
+	for _, identity := range ipsm.data.federatedIdentities {
+		if identity.IDIdentityProvider == IDIdentityProvider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return models.EmptyFederatedIdentity, errNotFound("identityProviderMemoryStore.GetIdentity")
+}
+
+// Link link an existing user to a provider subject
+func (ipsm IdentityProviderMemoryStore) Link(ctx context.Context, identity *models.FederatedIdentity, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "identityProviderMemoryStore.Link"); err != nil {
+		return err
+	}
+	ipsm.data.Lock()
+	defer ipsm.data.Unlock()
+	identity.PreSave()
+	if appError := identity.IsValid(); appError != nil {
+		return u.NewLocAppError("identityProviderMemoryStore.Link.identity.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if err := ipsm.data.checkFederatedIdentity("identityProviderMemoryStore.Link", identity); err != nil {
+		return err
+	}
+	identity.IDFederatedIdentity = ipsm.data.nextID()
+	ipsm.data.federatedIdentities = append(ipsm.data.federatedIdentities, *identity)
+	return nil
+}
+
+// CreateUser create an user logging in for the first time with provider, and its link. Nothing is saved if
+// one of them can not be.
+func (ipsm IdentityProviderMemoryStore) CreateUser(ctx context.Context, user *models.User, identity *models.FederatedIdentity, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "identityProviderMemoryStore.CreateUser"); err != nil {
+		return err
+	}
+	ipsm.data.Lock()
+	defer ipsm.data.Unlock()
+	user.PreSave()
+	if appError := user.IsValid(false); appError != nil {
+		return u.NewLocAppError("identityProviderMemoryStore.CreateUser.user.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if user.IDRole == 0 {
+		role, _ := ipsm.data.findRole(user.IDOrganisation, models.RoleMember)
+		user.IDRole = role.IDRole
+	}
+	if err := ipsm.data.checkUser("identityProviderMemoryStore.CreateUser", user, 0); err != nil {
+		return err
+	}
+	// Link is checked with a placeholder user id: the real one is only known once user is saved.
+	identity.IDUser = ipsm.data.lastID + 1
+	identity.PreSave()
+	if appError := identity.IsValid(); appError != nil {
+		return u.NewLocAppError("identityProviderMemoryStore.CreateUser.identity.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if err := ipsm.data.checkFederatedIdentity("identityProviderMemoryStore.CreateUser", identity); err != nil {
+		return err
+	}
+	ipsm.data.createUser(user)
+	identity.IDUser = user.IDUser
+	identity.IDFederatedIdentity = ipsm.data.nextID()
+	ipsm.data.federatedIdentities = append(ipsm.data.federatedIdentities, *identity)
+	return nil
+}
+
+// Save Use to save allowed email domain in memory
+func (aedsm AllowedEmailDomainMemoryStore) Save(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "allowedEmailDomainMemoryStore.Save"); err != nil {
+		return err
+	}
+	aedsm.data.Lock()
+	defer aedsm.data.Unlock()
+	allowedEmailDomain.PreSave()
+	if appError := allowedEmailDomain.IsValid(); appError != nil {
+		return u.NewLocAppError("allowedEmailDomainMemoryStore.Save.allowedEmailDomain.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if allowedEmailDomain.IDAllowedEmailDomain != 0 {
+		return u.NewLocAppError("allowedEmailDomainMemoryStore.Save", "save.transaction.create.already_exist", nil, "Domain: "+allowedEmailDomain.Domain)
+	}
+	for _, existing := range aedsm.data.allowedEmailDomains {
+		if existing.IDOrganisation == allowedEmailDomain.IDOrganisation && existing.Domain == allowedEmailDomain.Domain {
+			return u.NewAPIError(409, "allowed.email.domain.exist", "Domain is already allowed for this organisation.")
+		}
+	}
+	allowedEmailDomain.IDAllowedEmailDomain = aedsm.data.nextID()
+	aedsm.data.allowedEmailDomains = append(aedsm.data.allowedEmailDomains, *allowedEmailDomain)
+	return nil
+}
+
+// Update change the subdomain rule of an allowed email domain. Domain itself can not change.
+func (aedsm AllowedEmailDomainMemoryStore) Update(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, includeSubdomains bool, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "allowedEmailDomainMemoryStore.Update"); err != nil {
+		return err
+	}
+	aedsm.data.Lock()
+	defer aedsm.data.Unlock()
+	for i := range aedsm.data.allowedEmailDomains {
+		if aedsm.data.allowedEmailDomains[i].IDAllowedEmailDomain == allowedEmailDomain.IDAllowedEmailDomain {
+			aedsm.data.allowedEmailDomains[i].IncludeSubdomains = includeSubdomains
+		}
+	}
+	allowedEmailDomain.IncludeSubdomains = includeSubdomains
+	return nil
+}
+
+// findAllowedEmailDomains get allowed email domains matching filter, ordered by domain
+func (aedsm AllowedEmailDomainMemoryStore) findAllowedEmailDomains(filter func(allowedEmailDomain models.AllowedEmailDomain) bool) []models.AllowedEmailDomain {
+	aedsm.data.Lock()
+	defer aedsm.data.Unlock()
+	allowedEmailDomains := []models.AllowedEmailDomain{}
+	for _, allowedEmailDomain := range aedsm.data.allowedEmailDomains {
+		if filter(allowedEmailDomain) {
+			allowedEmailDomains = append(allowedEmailDomains, allowedEmailDomain)
+		}
+	}
+	sortRows(allowedEmailDomains, func(i, j int) bool { return allowedEmailDomains[i].Domain < allowedEmailDomains[j].Domain })
+	return allowedEmailDomains
+}
+
+// GetByID get allowed email domain from its id
+func (aedsm AllowedEmailDomainMemoryStore) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.AllowedEmailDomain, *u.AppError) {
+	if err := contextError(ctx, "allowedEmailDomainMemoryStore.GetByID"); err != nil {
+		return models.EmptyAllowedEmailDomain, err
+	}
+	allowedEmailDomains := aedsm.findAllowedEmailDomains(func(allowedEmailDomain models.AllowedEmailDomain) bool {
+		return allowedEmailDomain.IDAllowedEmailDomain == ID
+	})
+	if len(allowedEmailDomains) > 0 {
+		return allowedEmailDomains[0], nil
+	}
+	return models.EmptyAllowedEmailDomain, errNotFound("allowedEmailDomainMemoryStore.GetByID")
+}
+
+// GetByOrganisation get all allowed email domains of an organisation
+func (aedsm AllowedEmailDomainMemoryStore) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.AllowedEmailDomain, *u.AppError) {
+	if err := contextError(ctx, "allowedEmailDomainMemoryStore.GetByOrganisation"); err != nil {
+		return []models.AllowedEmailDomain{}, err
+	}
+	return aedsm.findAllowedEmailDomains(func(allowedEmailDomain models.AllowedEmailDomain) bool {
+		return allowedEmailDomain.IDOrganisation == IDOrganisation
+	}), nil
+}
+
+// GetMatching get allowed email domains, of every organisation, matching email
+func (aedsm AllowedEmailDomainMemoryStore) GetMatching(ctx context.Context, email string, db *gorm.DB) ([]models.AllowedEmailDomain, *u.AppError) {
+	if err := contextError(ctx, "allowedEmailDomainMemoryStore.GetMatching"); err != nil {
+		return []models.AllowedEmailDomain{}, err
+	}
+	return aedsm.findAllowedEmailDomains(func(allowedEmailDomain models.AllowedEmailDomain) bool {
+		return allowedEmailDomain.Matches(email)
+	}), nil
+}
+
+// Delete remove allowed email domain
+func (aedsm AllowedEmailDomainMemoryStore) Delete(ctx context.Context, allowedEmailDomain *models.AllowedEmailDomain, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "allowedEmailDomainMemoryStore.Delete"); err != nil {
+		return err
+	}
+	aedsm.data.Lock()
+	defer aedsm.data.Unlock()
+	allowedEmailDomains := []models.AllowedEmailDomain{}
+	for _, existing := range aedsm.data.allowedEmailDomains {
+		if existing.IDAllowedEmailDomain != allowedEmailDomain.IDAllowedEmailDomain {
+			allowedEmailDomains = append(allowedEmailDomains, existing)
+		}
+	}
+	aedsm.data.allowedEmailDomains = allowedEmailDomains
+	return nil
+}
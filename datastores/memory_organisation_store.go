@@ -0,0 +1,711 @@
+package datastores
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// OrganisationMemoryStore implement OrganisationStore interface in memory
+type OrganisationMemoryStore struct {
+	data *memoryData
+}
+
+// Organisation Generate the struct for organisation memory store
+func (store MemoryStore) Organisation() OrganisationStore {
+	return OrganisationMemoryStore{store.data}
+}
+
+// UserMemoryStore implement UserStore interface in memory
+type UserMemoryStore struct {
+	data *memoryData
+}
+
+// User Generate the struct for user memory store
+func (store MemoryStore) User() UserStore {
+	return UserMemoryStore{store.data}
+}
+
+// RoleMemoryStore implement RoleStore interface in memory
+type RoleMemoryStore struct {
+	data *memoryData
+}
+
+// Role Generate the struct for role memory store
+func (store MemoryStore) Role() RoleStore {
+	return RoleMemoryStore{store.data}
+}
+
+// InvitationMemoryStore implement InvitationStore interface in memory
+type InvitationMemoryStore struct {
+	data *memoryData
+}
+
+// Invitation Generate the struct for invitation memory store
+func (store MemoryStore) Invitation() InvitationStore {
+	return InvitationMemoryStore{store.data}
+}
+
+// checkOrganisation check unique indexes of organisations. Row with id except is not compared.
+func (data *memoryData) checkOrganisation(where string, organisation *models.Organisation, except uint64) *u.AppError {
+	for _, existing := range data.organisations {
+		if existing.IDOrganisation == except {
+			continue
+		}
+		if existing.OrganisationName == organisation.OrganisationName {
+			return errDuplicate(where, "organisationName", organisation.OrganisationName)
+		}
+		if existing.DockerStack == organisation.DockerStack {
+			return errDuplicate(where, "dockerStack", organisation.DockerStack)
+		}
+	}
+	return nil
+}
+
+// checkUser check unique indexes of users. Row with id except is not compared. Users without nick name do not share one.
+func (data *memoryData) checkUser(where string, user *models.User, except uint64) *u.AppError {
+	for _, existing := range data.users {
+		if existing.IDUser == except {
+			continue
+		}
+		if existing.Username == user.Username {
+			return errDuplicate(where, "userName", user.Username)
+		}
+		if existing.Email == user.Email {
+			return errDuplicate(where, "email", user.Email)
+		}
+		// Empty nick names are values as any other for the unique index of sql stores.
+		if existing.NickName == user.NickName {
+			return errDuplicate(where, "nickName", user.NickName)
+		}
+	}
+	return nil
+}
+
+// createOrganisation insert organisation and its missing default roles
+func (data *memoryData) createOrganisation(organisation *models.Organisation) map[string]models.Role {
+	organisation.IDOrganisation = data.nextID()
+	data.organisations = append(data.organisations, *organisation)
+	return data.seedRoles(organisation.IDOrganisation)
+}
+
+// createUser insert user
+func (data *memoryData) createUser(user *models.User) {
+	user.IDUser = data.nextID()
+	data.users = append(data.users, *user)
+}
+
+// userIndex get position of user in rows, -1 if it does not exist
+func (data *memoryData) userIndex(IDUser uint64) int {
+	for i, user := range data.users {
+		if user.IDUser == IDUser {
+			return i
+		}
+	}
+	return -1
+}
+
+// findRole get role of an organisation from its name
+func (data *memoryData) findRole(IDOrganisation uint64, roleName string) (models.Role, bool) {
+	for _, role := range data.roles {
+		if role.IDOrganisation == IDOrganisation && role.RoleName == roleName {
+			return role, true
+		}
+	}
+	return models.EmptyRole, false
+}
+
+// seedRoles insert default roles organisation does not have yet
+func (data *memoryData) seedRoles(IDOrganisation uint64) map[string]models.Role {
+	roles := map[string]models.Role{}
+	for _, role := range models.DefaultRoles(IDOrganisation) {
+		if existing, ok := data.findRole(IDOrganisation, role.RoleName); ok {
+			roles[existing.RoleName] = existing
+			continue
+		}
+		role.IDRole = data.nextID()
+		data.roles = append(data.roles, role)
+		roles[role.RoleName] = role
+	}
+	return roles
+}
+
+// Save Use to save organisation in memory
+func (osm OrganisationMemoryStore) Save(ctx context.Context, organisation *models.Organisation, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "organisationMemoryStore.Save"); err != nil {
+		return err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	organisation.PreSave()
+	if appError := organisation.IsValid(); appError != nil {
+		return u.NewLocAppError("organisationMemoryStore.Save.organisation.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if organisation.IDOrganisation != 0 {
+		return u.NewLocAppError("organisationMemoryStore.Save", "save.transaction.create.already_exist", nil, "Organisation Name: "+organisation.OrganisationName)
+	}
+	if err := osm.data.checkOrganisation("organisationMemoryStore.Save", organisation, 0); err != nil {
+		return err
+	}
+	osm.data.createOrganisation(organisation)
+	return nil
+}
+
+// Update Used to update organisation in memory
+func (osm OrganisationMemoryStore) Update(ctx context.Context, organisation *models.Organisation, newOrganisation *models.Organisation, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "organisationMemoryStore.Update"); err != nil {
+		return err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	newOrganisation.PreSave()
+	if appError := organisation.IsValid(); appError != nil {
+		return u.NewLocAppError("organisationMemoryStore.Update.organisationOld.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	for i, existing := range osm.data.organisations {
+		if existing.IDOrganisation != organisation.IDOrganisation {
+			continue
+		}
+		updateFields(&existing, newOrganisation)
+		existing.Public = newOrganisation.Public
+		existing.RequireVerifiedEmail = newOrganisation.RequireVerifiedEmail
+		existing.RequireAdminMFA = newOrganisation.RequireAdminMFA
+		if err := osm.data.checkOrganisation("organisationMemoryStore.Update", &existing, existing.IDOrganisation); err != nil {
+			return err
+		}
+		osm.data.organisations[i] = existing
+		*organisation = existing
+	}
+	return nil
+}
+
+// Get Used to get organisations from memory
+func (osm OrganisationMemoryStore) Get(ctx context.Context, db *gorm.DB) ([]models.Organisation, *u.AppError) {
+	if err := contextError(ctx, "organisationMemoryStore.Get"); err != nil {
+		return []models.Organisation{}, err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	return append([]models.Organisation{}, osm.data.organisations...), nil
+}
+
+// GetByName Used to get organisation from memory by name
+func (osm OrganisationMemoryStore) GetByName(ctx context.Context, name string, db *gorm.DB) (models.Organisation, *u.AppError) {
+	if err := contextError(ctx, "organisationMemoryStore.GetByName"); err != nil {
+		return models.EmptyOrganisation, err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	for _, organisation := range osm.data.organisations {
+		if organisation.OrganisationName == name {
+			return organisation, nil
+		}
+	}
+	return models.EmptyOrganisation, errNotFound("organisationMemoryStore.GetByName")
+}
+
+// GetByID Used to get organisation from memory
+func (osm OrganisationMemoryStore) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Organisation, *u.AppError) {
+	if err := contextError(ctx, "organisationMemoryStore.GetByID"); err != nil {
+		return models.EmptyOrganisation, err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	for _, organisation := range osm.data.organisations {
+		if organisation.IDOrganisation == ID {
+			return organisation, nil
+		}
+	}
+	return models.EmptyOrganisation, errNotFound("organisationMemoryStore.GetByID")
+}
+
+// Bootstrap create organisation, its default roles and its owner from a neworganisation token. Nothing is saved
+// if one of them can not be, and a token can only be consumed once.
+func (osm OrganisationMemoryStore) Bootstrap(ctx context.Context, organisation *models.Organisation, owner *models.User, consumed *models.Revocation, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "organisationMemoryStore.Bootstrap"); err != nil {
+		return err
+	}
+	osm.data.Lock()
+	defer osm.data.Unlock()
+	organisation.PreSave()
+	if appError := organisation.IsValid(); appError != nil {
+		return u.NewLocAppError("organisationMemoryStore.Bootstrap.organisation.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	consumed.PreSave()
+	if appError := consumed.IsValid(); appError != nil {
+		return u.NewLocAppError("organisationMemoryStore.Bootstrap.consumed.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if _, ok := osm.data.findRevocation(consumed.Kind, consumed.Subject); ok {
+		return u.NewAPIError(409, "token.already.used", "This token was already used to create an organisation.")
+	}
+	if err := osm.data.checkOrganisation("organisationMemoryStore.Bootstrap", organisation, 0); err != nil {
+		return err
+	}
+	owner.PreSave()
+	if appError := owner.IsValid(false); appError != nil {
+		return u.NewLocAppError("organisationMemoryStore.Bootstrap.owner.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if err := osm.data.checkUser("organisationMemoryStore.Bootstrap", owner, 0); err != nil {
+		return err
+	}
+	consumed.IDRevocation = osm.data.nextID()
+	osm.data.revocations = append(osm.data.revocations, *consumed)
+	roles := osm.data.createOrganisation(organisation)
+	owner.IDOrganisation = organisation.IDOrganisation
+	owner.IDRole = roles[models.RoleOwner].IDRole
+	osm.data.createUser(owner)
+	return nil
+}
+
+// Save Use to save user in memory
+func (usm UserMemoryStore) Save(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "userMemoryStore.Save"); err != nil {
+		return err
+	}
+	usm.data.Lock()
+	defer usm.data.Unlock()
+	user.PreSave()
+	if appError := user.IsValid(false); appError != nil {
+		return u.NewLocAppError("userMemoryStore.Save.user.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if user.IDUser != 0 {
+		return u.NewLocAppError("userMemoryStore.Save", "save.transaction.create.already_exist", nil, "User Name: "+user.Username)
+	}
+	if user.IDRole == 0 && !user.Pending {
+		role, _ := usm.data.findRole(user.IDOrganisation, models.RoleMember)
+		user.IDRole = role.IDRole
+	}
+	if err := usm.data.checkUser("userMemoryStore.Save", user, 0); err != nil {
+		return err
+	}
+	usm.data.createUser(user)
+	return nil
+}
+
+// Update Used to update user in memory
+func (usm UserMemoryStore) Update(ctx context.Context, user *models.User, newUser *models.User, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "userMemoryStore.Update"); err != nil {
+		return err
+	}
+	usm.data.Lock()
+	defer usm.data.Unlock()
+	newUser.PreSave()
+	// Two-factor authentication state only changes through MFA store.
+	newUser.MFAEnabled, newUser.MFASecret, newUser.MFALastStep = false, "", 0
+	if appError := user.IsValid(false); appError != nil {
+		return u.NewLocAppError("userMemoryStore.Update.userOld.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if appError := newUser.IsValid(true); appError != nil {
+		return u.NewLocAppError("userMemoryStore.Update.userNew.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if i := usm.data.userIndex(user.IDUser); i >= 0 {
+		updated := usm.data.users[i]
+		updateFields(&updated, newUser)
+		if err := usm.data.checkUser("userMemoryStore.Update", &updated, updated.IDUser); err != nil {
+			return err
+		}
+		usm.data.users[i] = updated
+		*user = updated
+	}
+	return nil
+}
+
+// findUsers get users matching filter, in creation order
+func (usm UserMemoryStore) findUsers(filter func(user models.User) bool) []models.User {
+	usm.data.Lock()
+	defer usm.data.Unlock()
+	users := []models.User{}
+	for _, user := range usm.data.users {
+		if filter(user) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// findUser get first user matching filter
+func (usm UserMemoryStore) findUser(where string, filter func(user models.User) bool) (models.User, *u.AppError) {
+	if users := usm.findUsers(filter); len(users) > 0 {
+		return users[0], nil
+	}
+	return models.EmptyUser, errNotFound(where)
+}
+
+// GetAll Used to get users from memory
+func (usm UserMemoryStore) GetAll(ctx context.Context, db *gorm.DB) ([]models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetAll"); err != nil {
+		return []models.User{}, err
+	}
+	return usm.findUsers(func(user models.User) bool { return true }), nil
+}
+
+// GetByID Used to get user from memory
+func (usm UserMemoryStore) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetByID"); err != nil {
+		return models.EmptyUser, err
+	}
+	return usm.findUser("userMemoryStore.GetByID", func(user models.User) bool { return user.IDUser == ID })
+}
+
+// GetByUserName Used to get user from memory
+func (usm UserMemoryStore) GetByUserName(ctx context.Context, userName string, db *gorm.DB) (models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetByUserName"); err != nil {
+		return models.EmptyUser, err
+	}
+	return usm.findUser("userMemoryStore.GetByUserName", func(user models.User) bool { return user.Username == userName })
+}
+
+// Login Used to log user in. Login can either be the user name or the email.
+func (usm UserMemoryStore) Login(ctx context.Context, login string, pass string, db *gorm.DB) (models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.Login"); err != nil {
+		return models.EmptyUser, err
+	}
+	err := u.NewAPIError(404, "wrong.user.password", "Can't proceed to login. Password or user name is not correct")
+	login = strings.ToLower(login)
+	user, appError := usm.findUser("userMemoryStore.Login", func(user models.User) bool { return user.Username == login || user.Email == login })
+	if appError != nil {
+		// Still compare a password so unknown users answer in the same time as known ones.
+		models.ComparePassword(dummyPasswordHash, pass)
+		return models.EmptyUser, err
+	}
+	if user.Deleted || !models.ComparePassword(user.Password, pass) {
+		return models.EmptyUser, err
+	}
+	if models.PasswordNeedsRehash(user.Password) {
+		if hash := models.HashPassword(pass); hash != "" {
+			usm.data.Lock()
+			if i := usm.data.userIndex(user.IDUser); i >= 0 {
+				usm.data.users[i].Password = hash
+			}
+			usm.data.Unlock()
+			user.Password = hash
+		}
+	}
+	return user, nil
+}
+
+// VerifyEmail mark user email as verified
+func (usm UserMemoryStore) VerifyEmail(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "userMemoryStore.VerifyEmail"); err != nil {
+		return err
+	}
+	usm.data.Lock()
+	defer usm.data.Unlock()
+	if user.IDRole == 0 {
+		role, ok := usm.data.findRole(user.IDOrganisation, models.RoleMember)
+		if !ok {
+			return errNotFound("userMemoryStore.VerifyEmail")
+		}
+		user.IDRole = role.IDRole
+	}
+	if i := usm.data.userIndex(user.IDUser); i >= 0 {
+		usm.data.users[i].EmailVerified = true
+		usm.data.users[i].IDRole = user.IDRole
+	}
+	user.EmailVerified = true
+	return nil
+}
+
+// GetByEmail Used to get user from memory by email
+func (usm UserMemoryStore) GetByEmail(ctx context.Context, userEmail string, db *gorm.DB) (models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetByEmail"); err != nil {
+		return models.EmptyUser, err
+	}
+	return usm.findUser("userMemoryStore.GetByEmail", func(user models.User) bool { return user.Email == userEmail })
+}
+
+// GetOrderedByDate get all users ordered by user name and email
+func (usm UserMemoryStore) GetOrderedByDate(ctx context.Context, userDate int, db *gorm.DB) ([]models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetOrderedByDate"); err != nil {
+		return []models.User{}, err
+	}
+	users, _ := usm.GetAll(ctx, db)
+	sortRows(users, func(i, j int) bool {
+		if users[i].Username != users[j].Username {
+			return users[i].Username < users[j].Username
+		}
+		return users[i].Email < users[j].Email
+	})
+	return users, nil
+}
+
+// GetDeleted get deleted users of an organisation
+func (usm UserMemoryStore) GetDeleted(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetDeleted"); err != nil {
+		return []models.User{}, err
+	}
+	return usm.findUsers(func(user models.User) bool { return user.IDOrganisation == IDOrganisation && user.Deleted }), nil
+}
+
+// GetByNickName get user from nick name
+func (usm UserMemoryStore) GetByNickName(ctx context.Context, nickName string, db *gorm.DB) (models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetByNickName"); err != nil {
+		return models.EmptyUser, err
+	}
+	return usm.findUser("userMemoryStore.GetByNickName", func(user models.User) bool { return user.NickName == nickName })
+}
+
+// GetByFirstName get user by first name
+func (usm UserMemoryStore) GetByFirstName(ctx context.Context, firstName string, db *gorm.DB) ([]models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetByFirstName"); err != nil {
+		return []models.User{}, err
+	}
+	return usm.findUsers(func(user models.User) bool { return user.FirstName == firstName }), nil
+}
+
+// GetByLastName get user from last name
+func (usm UserMemoryStore) GetByLastName(ctx context.Context, lastName string, db *gorm.DB) ([]models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetByLastName"); err != nil {
+		return []models.User{}, err
+	}
+	return usm.findUsers(func(user models.User) bool { return user.LastName == lastName }), nil
+}
+
+// GetByOrganisation get users of an organisation
+func (usm UserMemoryStore) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.User, *u.AppError) {
+	if err := contextError(ctx, "userMemoryStore.GetByOrganisation"); err != nil {
+		return []models.User{}, err
+	}
+	return usm.findUsers(func(user models.User) bool { return user.IDOrganisation == IDOrganisation }), nil
+}
+
+// Delete Used to remove user from memory
+func (usm UserMemoryStore) Delete(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "userMemoryStore.Delete"); err != nil {
+		return err
+	}
+	usm.data.Lock()
+	defer usm.data.Unlock()
+	if appError := user.IsValid(true); appError != nil {
+		return u.NewLocAppError("userMemoryStore.Delete.user.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if i := usm.data.userIndex(user.IDUser); i >= 0 {
+		usm.data.users = append(usm.data.users[:i], usm.data.users[i+1:]...)
+	}
+	return nil
+}
+
+// Save Use to save role in memory
+func (rsm RoleMemoryStore) Save(ctx context.Context, role *models.Role, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "roleMemoryStore.Save"); err != nil {
+		return err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	role.PreSave()
+	if appError := role.IsValid(); appError != nil {
+		return u.NewLocAppError("roleMemoryStore.Save.role.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if role.IDRole != 0 {
+		return u.NewLocAppError("roleMemoryStore.Save", "save.transaction.create.already_exist", nil, "Role Name: "+role.RoleName)
+	}
+	if _, ok := rsm.data.findRole(role.IDOrganisation, role.RoleName); ok {
+		return errDuplicate("roleMemoryStore.Save", "idx_role_organisation_name", role.RoleName)
+	}
+	role.IDRole = rsm.data.nextID()
+	rsm.data.roles = append(rsm.data.roles, *role)
+	return nil
+}
+
+// Update change rights of a role. Name and organisation can not change.
+func (rsm RoleMemoryStore) Update(ctx context.Context, role *models.Role, newRole *models.Role, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "roleMemoryStore.Update"); err != nil {
+		return err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	if appError := role.IsValid(); appError != nil {
+		return u.NewLocAppError("roleMemoryStore.Update.roleOld.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	for i := range rsm.data.roles {
+		if rsm.data.roles[i].IDRole != role.IDRole {
+			continue
+		}
+		rsm.data.roles[i].CanManage = newRole.CanManage
+		rsm.data.roles[i].CanManageUser = newRole.CanManageUser
+		rsm.data.roles[i].CanInvite = newRole.CanInvite
+		*role = rsm.data.roles[i]
+	}
+	return nil
+}
+
+// GetByID get role from its id
+func (rsm RoleMemoryStore) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Role, *u.AppError) {
+	if err := contextError(ctx, "roleMemoryStore.GetByID"); err != nil {
+		return models.EmptyRole, err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	for _, role := range rsm.data.roles {
+		if role.IDRole == ID {
+			return role, nil
+		}
+	}
+	return models.EmptyRole, errNotFound("roleMemoryStore.GetByID")
+}
+
+// GetByName get role of an organisation from its name
+func (rsm RoleMemoryStore) GetByName(ctx context.Context, IDOrganisation uint64, roleName string, db *gorm.DB) (models.Role, *u.AppError) {
+	if err := contextError(ctx, "roleMemoryStore.GetByName"); err != nil {
+		return models.EmptyRole, err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	if role, ok := rsm.data.findRole(IDOrganisation, roleName); ok {
+		return role, nil
+	}
+	return models.EmptyRole, errNotFound("roleMemoryStore.GetByName")
+}
+
+// GetByOrganisation get all roles of an organisation
+func (rsm RoleMemoryStore) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.Role, *u.AppError) {
+	if err := contextError(ctx, "roleMemoryStore.GetByOrganisation"); err != nil {
+		return []models.Role{}, err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	roles := []models.Role{}
+	for _, role := range rsm.data.roles {
+		if role.IDOrganisation == IDOrganisation {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// SeedDefaults create default roles organisation does not have yet
+func (rsm RoleMemoryStore) SeedDefaults(ctx context.Context, IDOrganisation uint64, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "roleMemoryStore.SeedDefaults"); err != nil {
+		return err
+	}
+	rsm.data.Lock()
+	defer rsm.data.Unlock()
+	rsm.data.seedRoles(IDOrganisation)
+	return nil
+}
+
+// Save Use to save invitation in memory
+func (ism InvitationMemoryStore) Save(ctx context.Context, invitation *models.Invitation, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "invitationMemoryStore.Save"); err != nil {
+		return err
+	}
+	ism.data.Lock()
+	defer ism.data.Unlock()
+	invitation.PreSave()
+	if appError := invitation.IsValid(); appError != nil {
+		return u.NewLocAppError("invitationMemoryStore.Save.invitation.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if invitation.IDInvitation != 0 {
+		return u.NewLocAppError("invitationMemoryStore.Save", "save.transaction.create.already_exist", nil, "Email: "+invitation.Email)
+	}
+	invitation.IDInvitation = ism.data.nextID()
+	ism.data.invitations = append(ism.data.invitations, *invitation)
+	return nil
+}
+
+// GetByID get invitation from its id
+func (ism InvitationMemoryStore) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Invitation, *u.AppError) {
+	if err := contextError(ctx, "invitationMemoryStore.GetByID"); err != nil {
+		return models.EmptyInvitation, err
+	}
+	ism.data.Lock()
+	defer ism.data.Unlock()
+	for _, invitation := range ism.data.invitations {
+		if invitation.IDInvitation == ID {
+			return invitation, nil
+		}
+	}
+	return models.EmptyInvitation, errNotFound("invitationMemoryStore.GetByID")
+}
+
+// GetByOrganisation get all invitations of an organisation, latest first
+func (ism InvitationMemoryStore) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.Invitation, *u.AppError) {
+	if err := contextError(ctx, "invitationMemoryStore.GetByOrganisation"); err != nil {
+		return []models.Invitation{}, err
+	}
+	ism.data.Lock()
+	defer ism.data.Unlock()
+	invitations := []models.Invitation{}
+	for _, invitation := range ism.data.invitations {
+		if invitation.IDOrganisation == IDOrganisation {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sortRows(invitations, func(i, j int) bool { return invitations[i].InvitedAt > invitations[j].InvitedAt })
+	return invitations, nil
+}
+
+// GetPendingByEmail get invitations sent to email which can still be accepted
+func (ism InvitationMemoryStore) GetPendingByEmail(ctx context.Context, email string, db *gorm.DB) ([]models.Invitation, *u.AppError) {
+	if err := contextError(ctx, "invitationMemoryStore.GetPendingByEmail"); err != nil {
+		return []models.Invitation{}, err
+	}
+	ism.data.Lock()
+	defer ism.data.Unlock()
+	now := time.Now().UTC().Unix()
+	invitations := []models.Invitation{}
+	for _, invitation := range ism.data.invitations {
+		if invitation.Email == email && invitation.Status == models.InvitationStatusPending && invitation.ExpiresAt >= now {
+			invitations = append(invitations, invitation)
+		}
+	}
+	return invitations, nil
+}
+
+// Revoke revoke a pending invitation. It fails if invitation was already accepted or revoked.
+func (ism InvitationMemoryStore) Revoke(ctx context.Context, invitation *models.Invitation, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "invitationMemoryStore.Revoke"); err != nil {
+		return err
+	}
+	ism.data.Lock()
+	defer ism.data.Unlock()
+	for i := range ism.data.invitations {
+		if ism.data.invitations[i].IDInvitation == invitation.IDInvitation && ism.data.invitations[i].Status == models.InvitationStatusPending {
+			ism.data.invitations[i].Status = models.InvitationStatusRevoked
+			invitation.Status = models.InvitationStatusRevoked
+			return nil
+		}
+	}
+	return u.NewAPIError(409, "invitation.not.pending", "Invitation was already accepted or revoked.")
+}
+
+// Accept create the invited user with the invitation role and mark invitation as accepted. Nothing is saved if
+// one of them can not be, and an invitation can only be accepted once.
+func (ism InvitationMemoryStore) Accept(ctx context.Context, invitation *models.Invitation, user *models.User, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "invitationMemoryStore.Accept"); err != nil {
+		return err
+	}
+	ism.data.Lock()
+	defer ism.data.Unlock()
+	user.Email = invitation.Email
+	user.IDOrganisation = invitation.IDOrganisation
+	user.PreSave()
+	if appError := user.IsValid(false); appError != nil {
+		return u.NewLocAppError("invitationMemoryStore.Accept.user.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	pending := -1
+	for i, existing := range ism.data.invitations {
+		if existing.IDInvitation == invitation.IDInvitation && existing.Status == models.InvitationStatusPending && existing.ExpiresAt >= time.Now().UTC().Unix() {
+			pending = i
+		}
+	}
+	if pending < 0 {
+		return u.NewAPIError(409, "invitation.not.pending", "Invitation was already accepted, revoked or is expired.")
+	}
+	role, ok := ism.data.findRole(invitation.IDOrganisation, invitation.Role)
+	if !ok {
+		return u.NewLocAppError("invitationMemoryStore.Accept", "model.invitation.is_valid.role.app_error", nil, "Role: "+invitation.Role)
+	}
+	user.IDRole = role.IDRole
+	if err := ism.data.checkUser("invitationMemoryStore.Accept", user, 0); err != nil {
+		return err
+	}
+	ism.data.invitations[pending].Status = models.InvitationStatusAccepted
+	ism.data.createUser(user)
+	invitation.Status = models.InvitationStatusAccepted
+	return nil
+}
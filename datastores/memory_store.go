@@ -0,0 +1,200 @@
+package datastores
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// memoryDriverName name of the sql driver behind memory store connections
+const memoryDriverName = "popcube-memory"
+
+var (
+	errMemoryQuery = errors.New("memory store does not run sql queries")
+)
+
+func init() {
+	sql.Register(memoryDriverName, memoryDriver{})
+}
+
+// memoryDriver sql driver opening connections which only answer pings, so api checks on the database still work with memory store
+type memoryDriver struct{}
+
+func (md memoryDriver) Open(name string) (driver.Conn, error) {
+	return memoryConn{}, nil
+}
+
+type memoryConn struct{}
+
+func (mc memoryConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errMemoryQuery
+}
+
+func (mc memoryConn) Close() error {
+	return nil
+}
+
+func (mc memoryConn) Begin() (driver.Tx, error) {
+	return mc, nil
+}
+
+func (mc memoryConn) Commit() error {
+	return nil
+}
+
+func (mc memoryConn) Rollback() error {
+	return nil
+}
+
+// memoryData rows of memory store. Rows are kept in creation order, as databases give them back when no order is asked.
+type memoryData struct {
+	sync.Mutex
+	lastID              uint64
+	organisations       []models.Organisation
+	users               []models.User
+	refreshTokens       []models.RefreshToken
+	revocations         []models.Revocation
+	invitations         []models.Invitation
+	roles               []models.Role
+	passwordResets      []models.PasswordReset
+	recoveryCodes       []models.RecoveryCode
+	serviceAccounts     []models.ServiceAccount
+	apiKeys             []models.APIKey
+	oauthClients        []models.OAuthClient
+	oauthCodes          []models.OAuthCode
+	identityProviders   []models.IdentityProvider
+	federatedIdentities []models.FederatedIdentity
+	allowedEmailDomains []models.AllowedEmailDomain
+}
+
+// nextID get a new row id. Ids are shared by all tables: they are still unique in each one.
+func (data *memoryData) nextID() uint64 {
+	data.lastID++
+	return data.lastID
+}
+
+// MemoryStore implement store interface keeping data in memory. Everything is lost when it is dropped,
+// so it is meant for development, demonstrations and tests. It enforces the unique indexes and validations
+// of the database stores. Connections it gives are not linked to a database: they can only be pinged.
+type MemoryStore struct {
+	data *memoryData
+}
+
+// NewMemoryStore create an empty memory store
+func NewMemoryStore() MemoryStore {
+	return MemoryStore{data: &memoryData{}}
+}
+
+// InitConnection open a connection to memory store. Connection parameters are not used.
+func (store MemoryStore) InitConnection(user string, dbname string, password string, host string, port string) *gorm.DB {
+	db, err := gorm.Open("common", memoryDriverName, "")
+	if err != nil {
+		return nil
+	}
+	return db
+}
+
+// InitDatabase nothing to create in memory: default roles are seeded when organisations are saved.
+func (store MemoryStore) InitDatabase(user string, dbname string, password string, host string, port string) *u.AppError {
+	return nil
+}
+
+// CloseConnection close memory store connection. Data is kept.
+func (store MemoryStore) CloseConnection(db *gorm.DB) {
+	defer db.Close()
+}
+
+// MigrationMemoryStore implement MigrationStore interface in memory. Memory store is always at SchemaVersion: there is
+// nothing to migrate.
+type MigrationMemoryStore struct{}
+
+// Migration Generate the struct for migration memory store
+func (store MemoryStore) Migration() MigrationStore {
+	return MigrationMemoryStore{}
+}
+
+// Version get schema version of memory store
+func (msm MigrationMemoryStore) Version(ctx context.Context, db *gorm.DB) (int, *u.AppError) {
+	if err := contextError(ctx, "migrationMemoryStore.Version"); err != nil {
+		return 0, err
+	}
+	return SchemaVersion, nil
+}
+
+// Status no migration is recorded in memory store
+func (msm MigrationMemoryStore) Status(ctx context.Context, db *gorm.DB) ([]MigrationStatus, *u.AppError) {
+	if err := contextError(ctx, "migrationMemoryStore.Status"); err != nil {
+		return []MigrationStatus{}, err
+	}
+	return []MigrationStatus{}, nil
+}
+
+// MigrateTo only SchemaVersion is accepted, as memory store can not be at another one
+func (msm MigrationMemoryStore) MigrateTo(ctx context.Context, version int, db *gorm.DB) *u.AppError {
+	if err := contextError(ctx, "migrationMemoryStore.MigrateTo"); err != nil {
+		return err
+	}
+	if version != SchemaVersion {
+		return u.NewLocAppError("migrationMemoryStore.MigrateTo", "store.migration.memory", nil, "memory store is always at version "+strconv.Itoa(SchemaVersion))
+	}
+	return nil
+}
+
+// errDuplicate error given when a row breaks an unique index, as the database would
+func errDuplicate(where string, index string, value interface{}) *u.AppError {
+	return u.NewStoreError(u.ErrorConflict, where, "store.record.duplicate", fmt.Sprintf("duplicate entry '%v' for key '%s'", value, index))
+}
+
+// errNotFound error given when no row matches a query
+func errNotFound(where string) *u.AppError {
+	return u.NewStoreError(u.ErrorNotFound, where, "store.record.not_found", "")
+}
+
+// rowSorter sort a slice of rows with a less function
+type rowSorter struct {
+	rows reflect.Value
+	less func(i, j int) bool
+}
+
+func (rs rowSorter) Len() int           { return rs.rows.Len() }
+func (rs rowSorter) Less(i, j int) bool { return rs.less(i, j) }
+func (rs rowSorter) Swap(i, j int) {
+	row := reflect.ValueOf(rs.rows.Index(i).Interface())
+	rs.rows.Index(i).Set(rs.rows.Index(j))
+	rs.rows.Index(j).Set(row)
+}
+
+// sortRows sort rows, a slice, as an ORDER BY clause would. Rows which are equal keep creation order.
+func sortRows(rows interface{}, less func(i, j int) bool) {
+	sort.Stable(rowSorter{rows: reflect.ValueOf(rows), less: less})
+}
+
+// updateFields copy non zero fields of src to dst, as gorm Updates does with a struct. Primary key, ignored
+// fields and associations are kept.
+func updateFields(dst interface{}, src interface{}) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src).Elem()
+	for i := 0; i < srcValue.NumField(); i++ {
+		field := srcValue.Type().Field(i)
+		tag := field.Tag.Get("gorm")
+		if field.PkgPath != "" || tag == "-" || strings.Contains(tag, "primary_key") || field.Type.Kind() == reflect.Slice {
+			continue
+		}
+		value := srcValue.Field(i)
+		if value.Interface() == reflect.Zero(field.Type).Interface() {
+			continue
+		}
+		dstValue.Field(i).Set(value)
+	}
+}
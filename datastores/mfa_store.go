@@ -0,0 +1,112 @@
+package datastores
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// MFAStoreImpl Used to implement MFAStore interface
+type MFAStoreImpl struct{}
+
+// MFA Generate the struct for two-factor authentication store
+func (s StoreImpl) MFA() MFAStore {
+	return MFAStoreImpl{}
+}
+
+// Enrol save a new TOTP secret for user. Two-factor authentication is only enabled once Enable is called.
+func (msi MFAStoreImpl) Enrol(ctx context.Context, user *models.User, secret string, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if user.MFAEnabled {
+		return u.NewAPIError(409, "mfa.already.enabled", "Two-factor authentication is already enabled. Disable it first.")
+	}
+	if err := db.Model(&models.User{}).Where(quoteNames(db, "idUser = ?"), user.IDUser).Update("mfaSecret", secret).Error; err != nil {
+		return storeError("mfaStoreImpl.Enrol", "update.transaction.updates.encounterError :", err)
+	}
+	user.MFASecret = secret
+	return nil
+}
+
+// Enable turn two-factor authentication on and replace recovery codes of the user in a single transaction.
+// step is the TOTP step of the code confirming enrolment.
+func (msi MFAStoreImpl) Enable(ctx context.Context, user *models.User, recoveryCodes []models.RecoveryCode, step int64, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	for i := range recoveryCodes {
+		recoveryCodes[i].IDUser = user.IDUser
+		if appError := recoveryCodes[i].IsValid(); appError != nil {
+			transaction.Rollback()
+			return u.NewLocAppError("mfaStoreImpl.Enable.recoveryCode.PreSave", appError.ID, nil, appError.DetailedError)
+		}
+	}
+	updates := map[string]interface{}{"mfaEnabled": true, "mfaLastStep": step}
+	if err := transaction.Model(&models.User{}).Where(quoteNames(transaction, "idUser = ?"), user.IDUser).Updates(updates).Error; err != nil {
+		transaction.Rollback()
+		return storeError("mfaStoreImpl.Enable", "update.transaction.updates.encounterError :", err)
+	}
+	if err := transaction.Where(quoteNames(transaction, "idUser = ?"), user.IDUser).Delete(&models.RecoveryCode{}).Error; err != nil {
+		transaction.Rollback()
+		return storeError("mfaStoreImpl.Enable", "update.transaction.delete.encounterError :", err)
+	}
+	for i := range recoveryCodes {
+		if err := transaction.Create(&recoveryCodes[i]).Error; err != nil {
+			transaction.Rollback()
+			return storeError("mfaStoreImpl.Enable", "save.transaction.create.encounterError :", err)
+		}
+	}
+	transaction.Commit()
+	user.MFAEnabled = true
+	user.MFALastStep = step
+	return nil
+}
+
+// Disable turn two-factor authentication off, forgetting secret and recovery codes of the user
+func (msi MFAStoreImpl) Disable(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	updates := map[string]interface{}{"mfaEnabled": false, "mfaSecret": "", "mfaLastStep": 0}
+	if err := transaction.Model(&models.User{}).Where(quoteNames(transaction, "idUser = ?"), user.IDUser).Updates(updates).Error; err != nil {
+		transaction.Rollback()
+		return storeError("mfaStoreImpl.Disable", "update.transaction.updates.encounterError :", err)
+	}
+	if err := transaction.Where(quoteNames(transaction, "idUser = ?"), user.IDUser).Delete(&models.RecoveryCode{}).Error; err != nil {
+		transaction.Rollback()
+		return storeError("mfaStoreImpl.Disable", "update.transaction.delete.encounterError :", err)
+	}
+	transaction.Commit()
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.MFALastStep = 0
+	return nil
+}
+
+// UseTOTPStep record the step of an accepted TOTP code. It fails if this step or a later one was already used,
+// so a code can only be used once even with concurrent requests.
+func (msi MFAStoreImpl) UseTOTPStep(ctx context.Context, user *models.User, step int64, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	result := db.Model(&models.User{}).Where(quoteNames(db, "idUser = ? AND mfaLastStep < ?"), user.IDUser, step).Update("mfaLastStep", step)
+	if result.Error != nil {
+		return storeError("mfaStoreImpl.UseTOTPStep", "update.transaction.updates.encounterError :", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return u.NewAPIError(401, "mfa.code.invalid", "Two-factor authentication code is not valid.")
+	}
+	user.MFALastStep = step
+	return nil
+}
+
+// UseRecoveryCode consume a recovery code of the user. It fails if code is unknown or was already used.
+func (msi MFAStoreImpl) UseRecoveryCode(ctx context.Context, user *models.User, code string, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	result := db.Model(&models.RecoveryCode{}).
+		Where(quoteNames(db, "idUser = ? AND codeHash = ? AND used = ?"), user.IDUser, models.HashToken(models.NormalizeRecoveryCode(code)), false).
+		Update("used", true)
+	if result.Error != nil {
+		return storeError("mfaStoreImpl.UseRecoveryCode", "update.transaction.updates.encounterError :", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return u.NewAPIError(401, "mfa.code.invalid", "Two-factor authentication code is not valid.")
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package datastores
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// SchemaVersion version of the database schema this api works with. Every dialect has migrations up to it.
+const SchemaVersion = 2
+
+// migration numbered change of the database schema. Statements of a direction are run in order, in a transaction.
+type migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+	// Columns added when migration is applied to tables which miss them, after Up statements
+	Columns []migrationColumn
+	// Backfill statements run after Columns are added, to fill rows adopted from existing tables
+	Backfill []string
+}
+
+// migrationColumn column of a table, with its sql definition
+type migrationColumn struct {
+	Table      string
+	Name       string
+	Definition string
+}
+
+// dialectMigrations migrations of each gorm dialect, by version order. They are compiled in the binary.
+var dialectMigrations = map[string][]migration{
+	"mysql":    mysqlMigrations,
+	"postgres": postgresMigrations,
+	"sqlite3":  sqliteMigrations,
+}
+
+// MigrationStatus state of a migration in a database
+type MigrationStatus struct {
+	Version int
+	Name    string
+	// AppliedAt date migration was applied as unix time. 0 when it is pending.
+	AppliedAt int64
+}
+
+// MigrationStoreImpl Used to implement MigrationStore interface
+type MigrationStoreImpl struct{}
+
+// Migration Generate the struct for migration store
+func (s StoreImpl) Migration() MigrationStore {
+	return MigrationStoreImpl{}
+}
+
+// Version get schema version of the database: the highest migration applied, 0 for an empty database
+func (msi MigrationStoreImpl) Version(ctx context.Context, db *gorm.DB) (int, *u.AppError) {
+	db = withContext(ctx, db)
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, storeError("migrationStoreImpl.Version", "get.transaction.find.encounterError :", err)
+	}
+	return lastVersion(applied), nil
+}
+
+// Status get migrations known by the api and whether they are applied. Migrations applied by a newer api are listed too.
+func (msi MigrationStoreImpl) Status(ctx context.Context, db *gorm.DB) ([]MigrationStatus, *u.AppError) {
+	db = withContext(ctx, db)
+	status := []MigrationStatus{}
+	migrations, apperr := dialectMigrationList("migrationStoreImpl.Status", db)
+	if apperr != nil {
+		return status, apperr
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return status, storeError("migrationStoreImpl.Status", "get.transaction.find.encounterError :", err)
+	}
+	for _, migration := range migrations {
+		status = append(status, MigrationStatus{Version: migration.Version, Name: migration.Name, AppliedAt: applied[migration.Version].AppliedAt})
+	}
+	for version := len(migrations) + 1; version <= lastVersion(applied); version++ {
+		if row, ok := applied[version]; ok {
+			status = append(status, MigrationStatus{Version: row.Version, Name: row.Name, AppliedAt: row.AppliedAt})
+		}
+	}
+	return status, nil
+}
+
+// MigrateTo apply or revert migrations until database schema is at version. Each migration is committed on its own:
+// when one fails, the ones before it stay. Mysql commits schema changes as soon as they are run, so a failed
+// migration may be left half done there and need to be fixed by hand.
+func (msi MigrationStoreImpl) MigrateTo(ctx context.Context, version int, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	migrations, apperr := dialectMigrationList("migrationStoreImpl.MigrateTo", db)
+	if apperr != nil {
+		return apperr
+	}
+	if version < 0 || version > len(migrations) {
+		return u.NewLocAppError("migrationStoreImpl.MigrateTo", "store.migration.unknown_version", nil, "version="+strconv.Itoa(version))
+	}
+	if err := createMigrationTable(db); err != nil {
+		return storeError("migrationStoreImpl.MigrateTo", "migrate.transaction.create.encounterError :", err)
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return storeError("migrationStoreImpl.MigrateTo", "migrate.transaction.find.encounterError :", err)
+	}
+	current := lastVersion(applied)
+	if current > len(migrations) {
+		return u.NewLocAppError("migrationStoreImpl.MigrateTo", "store.migration.newer_schema", nil, fmt.Sprintf("schema is at version %d, api only knows up to %d", current, len(migrations)))
+	}
+	for ; current < version; current++ {
+		if apperr := runMigration(ctx, migrations[current], true, db); apperr != nil {
+			return apperr
+		}
+	}
+	for ; current > version; current-- {
+		if apperr := runMigration(ctx, migrations[current-1], false, db); apperr != nil {
+			return apperr
+		}
+	}
+	return nil
+}
+
+// dialectMigrationList get migrations of the database dialect
+func dialectMigrationList(where string, db *gorm.DB) ([]migration, *u.AppError) {
+	dialect := db.Dialect().GetName()
+	migrations, ok := dialectMigrations[dialect]
+	if !ok || len(migrations) != SchemaVersion {
+		return nil, u.NewLocAppError(where, "store.migration.dialect", nil, "no migrations up to version "+strconv.Itoa(SchemaVersion)+" for "+dialect)
+	}
+	return migrations, nil
+}
+
+// createMigrationTable create the table recording applied migrations. Names are quoted by the dialect, so the
+// statement is the same for all of them.
+func createMigrationTable(db *gorm.DB) error {
+	quote := db.Dialect().Quote
+	statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s integer NOT NULL, %s varchar(255) NOT NULL, %s bigint NOT NULL, PRIMARY KEY (%s))",
+		quote("schema_migrations"), quote("version"), quote("name"), quote("appliedAt"), quote("version"))
+	return db.Exec(statement).Error
+}
+
+// appliedMigrations get migrations applied to the database by version. Databases without migration table have none.
+func appliedMigrations(db *gorm.DB) (map[int]models.SchemaMigration, error) {
+	applied := map[int]models.SchemaMigration{}
+	if !db.HasTable(&models.SchemaMigration{}) {
+		return applied, nil
+	}
+	rows := []models.SchemaMigration{}
+	if err := db.Find(&rows).Error; err != nil {
+		return applied, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// lastVersion get highest version applied
+func lastVersion(applied map[int]models.SchemaMigration) int {
+	last := 0
+	for version := range applied {
+		if version > last {
+			last = version
+		}
+	}
+	return last
+}
+
+// runMigration apply or revert a migration and record it
+func runMigration(ctx context.Context, migration migration, up bool, db *gorm.DB) *u.AppError {
+	if apperr := contextError(ctx, "migrationStoreImpl.MigrateTo"); apperr != nil {
+		return apperr
+	}
+	statements := migration.Up
+	if up {
+		log.Printf("Applying migration %d %s", migration.Version, migration.Name)
+	} else {
+		statements = migration.Down
+		log.Printf("Reverting migration %d %s", migration.Version, migration.Name)
+	}
+	transaction := begin(db)
+	for _, statement := range statements {
+		if err := transaction.Exec(statement).Error; err != nil {
+			transaction.Rollback()
+			return storeError("migrationStoreImpl.MigrateTo", "migrate.transaction.exec.encounterError :", err)
+		}
+	}
+	if up {
+		if err := addMissingColumns(migration.Columns, transaction); err != nil {
+			transaction.Rollback()
+			return storeError("migrationStoreImpl.MigrateTo", "migrate.transaction.exec.encounterError :", err)
+		}
+		for _, statement := range migration.Backfill {
+			if err := transaction.Exec(statement).Error; err != nil {
+				transaction.Rollback()
+				return storeError("migrationStoreImpl.MigrateTo", "migrate.transaction.exec.encounterError :", err)
+			}
+		}
+	}
+	row := models.SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC().Unix()}
+	var err error
+	if up {
+		err = transaction.Create(&row).Error
+	} else {
+		err = transaction.Delete(&row).Error
+	}
+	if err != nil {
+		transaction.Rollback()
+		return storeError("migrationStoreImpl.MigrateTo", "migrate.transaction.record.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// addMissingColumns add columns to the tables which do not have them yet
+func addMissingColumns(columns []migrationColumn, db *gorm.DB) error {
+	quote := db.Dialect().Quote
+	for _, column := range columns {
+		if db.Dialect().HasColumn(column.Table, column.Name) {
+			continue
+		}
+		log.Printf("Adding column %s to %s", column.Name, column.Table)
+		statement := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quote(column.Table), quote(column.Name), column.Definition)
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package datastores
+
+// mysqlMigrations schema migrations of mysql and mariadb databases.
+//
+// Migration 1 creates the tables as gorm AutoMigrate did, skipping the ones which exist: databases created by
+// previous versions of the api are adopted. AutoMigrate only created the columns of the api version it ran with, so
+// the ones added to existing tables since then are added to tables missing them. Rows already there get the implicit
+// default of their columns: no password, no two-factor authentication. Organisations get their default roles and users
+// without role the member one, except the first user of organisations where nobody had a role, who becomes owner so
+// the organisation can still be managed.
+var mysqlMigrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: []string{
+			"CREATE TABLE IF NOT EXISTS `organisations` (`idOrganisation` bigint unsigned AUTO_INCREMENT, `dockerStack` int NOT NULL UNIQUE, `organisationName` varchar(255) NOT NULL UNIQUE, `public` boolean NOT NULL, `description` varchar(255), `avatar` varchar(255), `domain` varchar(255), `requireVerifiedEmail` boolean NOT NULL, `requireAdminMFA` boolean NOT NULL, PRIMARY KEY (`idOrganisation`))",
+			"CREATE TABLE IF NOT EXISTS `users` (`idUser` bigint unsigned AUTO_INCREMENT, `userName` varchar(255) NOT NULL UNIQUE, `email` varchar(255) NOT NULL UNIQUE, `emailVerified` boolean NOT NULL, `deleted` boolean NOT NULL, `avatar` varchar(255), `password` varchar(255) NOT NULL, `nickName` varchar(255) UNIQUE, `firstName` varchar(255), `lastName` varchar(255), `idOrganisation` bigint unsigned NOT NULL, `idRole` bigint unsigned, `locale` varchar(255), `mfaEnabled` boolean NOT NULL, `mfaSecret` varchar(255), `mfaLastStep` bigint NOT NULL, PRIMARY KEY (`idUser`))",
+			"CREATE TABLE IF NOT EXISTS `refresh_tokens` (`idRefreshToken` bigint unsigned AUTO_INCREMENT, `tokenHash` varchar(255) NOT NULL UNIQUE, `family` varchar(255) NOT NULL, `idUser` bigint unsigned NOT NULL, `issuedAt` bigint NOT NULL, `expiresAt` bigint NOT NULL, `rotated` boolean NOT NULL, `revoked` boolean NOT NULL, PRIMARY KEY (`idRefreshToken`), INDEX `idx_refresh_tokens_family` (`family`), INDEX `idx_refresh_tokens_idUser` (`idUser`))",
+			"CREATE TABLE IF NOT EXISTS `revocations` (`idRevocation` bigint unsigned AUTO_INCREMENT, `kind` varchar(255) NOT NULL, `subject` varchar(255) NOT NULL, `revokedAt` bigint NOT NULL, `expiresAt` bigint NOT NULL, PRIMARY KEY (`idRevocation`), UNIQUE INDEX `idx_revocation_subject` (`kind`, `subject`))",
+			"CREATE TABLE IF NOT EXISTS `invitations` (`idInvitation` bigint unsigned AUTO_INCREMENT, `idInviter` bigint unsigned NOT NULL, `idInviterServiceAccount` bigint unsigned NOT NULL, `email` varchar(255) NOT NULL, `idOrganisation` bigint unsigned NOT NULL, `role` varchar(255) NOT NULL, `status` varchar(255) NOT NULL, `invitedAt` bigint NOT NULL, `expiresAt` bigint NOT NULL, PRIMARY KEY (`idInvitation`), INDEX `idx_invitations_email` (`email`), INDEX `idx_invitations_idOrganisation` (`idOrganisation`))",
+			"CREATE TABLE IF NOT EXISTS `roles` (`idRole` bigint unsigned AUTO_INCREMENT, `idOrganisation` bigint unsigned NOT NULL, `roleName` varchar(255) NOT NULL, `canManage` boolean NOT NULL, `canManageUser` boolean NOT NULL, `canInvite` boolean NOT NULL, PRIMARY KEY (`idRole`), UNIQUE INDEX `idx_role_organisation_name` (`idOrganisation`, `roleName`))",
+			"CREATE TABLE IF NOT EXISTS `password_resets` (`idPasswordReset` bigint unsigned AUTO_INCREMENT, `tokenHash` varchar(255) NOT NULL UNIQUE, `idUser` bigint unsigned NOT NULL, `issuedAt` bigint NOT NULL, `expiresAt` bigint NOT NULL, `used` boolean NOT NULL, PRIMARY KEY (`idPasswordReset`), INDEX `idx_password_resets_idUser` (`idUser`))",
+			"CREATE TABLE IF NOT EXISTS `recovery_codes` (`idRecoveryCode` bigint unsigned AUTO_INCREMENT, `idUser` bigint unsigned NOT NULL, `codeHash` varchar(255) NOT NULL UNIQUE, `used` boolean NOT NULL, PRIMARY KEY (`idRecoveryCode`), INDEX `idx_recovery_codes_idUser` (`idUser`))",
+			"CREATE TABLE IF NOT EXISTS `service_accounts` (`idServiceAccount` bigint unsigned AUTO_INCREMENT, `idOrganisation` bigint unsigned NOT NULL, `name` varchar(255) NOT NULL, `description` varchar(255), `createdAt` bigint NOT NULL, `disabled` boolean NOT NULL, PRIMARY KEY (`idServiceAccount`), UNIQUE INDEX `idx_service_account_organisation_name` (`idOrganisation`, `name`))",
+			"CREATE TABLE IF NOT EXISTS `api_keys` (`idAPIKey` bigint unsigned AUTO_INCREMENT, `idServiceAccount` bigint unsigned NOT NULL, `name` varchar(255), `prefix` varchar(255) NOT NULL UNIQUE, `keyHash` varchar(255) NOT NULL, `scopes` varchar(255) NOT NULL, `createdAt` bigint NOT NULL, `expiresAt` bigint NOT NULL, `lastUsedAt` bigint NOT NULL, `revoked` boolean NOT NULL, PRIMARY KEY (`idAPIKey`), INDEX `idx_api_keys_idServiceAccount` (`idServiceAccount`))",
+			"CREATE TABLE IF NOT EXISTS `o_auth_clients` (`idOAuthClient` bigint unsigned AUTO_INCREMENT, `idOrganisation` bigint unsigned NOT NULL, `clientID` varchar(255) NOT NULL UNIQUE, `secretHash` varchar(255), `name` varchar(255) NOT NULL, `public` boolean NOT NULL, `redirectURIs` text, `grants` varchar(255) NOT NULL, `scopes` varchar(255), `createdAt` bigint NOT NULL, `revoked` boolean NOT NULL, PRIMARY KEY (`idOAuthClient`), INDEX `idx_o_auth_clients_idOrganisation` (`idOrganisation`))",
+			"CREATE TABLE IF NOT EXISTS `o_auth_codes` (`idOAuthCode` bigint unsigned AUTO_INCREMENT, `codeHash` varchar(255) NOT NULL UNIQUE, `idOAuthClient` bigint unsigned NOT NULL, `idUser` bigint unsigned NOT NULL, `redirectURI` varchar(255) NOT NULL, `scope` varchar(255), `codeChallenge` varchar(255) NOT NULL, `expiresAt` bigint NOT NULL, `used` boolean NOT NULL, `tokenID` varchar(255), `nonce` varchar(255), `authTime` bigint NOT NULL, PRIMARY KEY (`idOAuthCode`), INDEX `idx_o_auth_codes_idOAuthClient` (`idOAuthClient`), INDEX `idx_o_auth_codes_idUser` (`idUser`))",
+			"CREATE TABLE IF NOT EXISTS `identity_providers` (`idIdentityProvider` bigint unsigned AUTO_INCREMENT, `idOrganisation` bigint unsigned NOT NULL UNIQUE, `name` varchar(255), `issuer` varchar(255) NOT NULL, `clientID` varchar(255) NOT NULL, `clientSecret` varchar(255), `autoCreate` boolean NOT NULL, `enabled` boolean NOT NULL, `createdAt` bigint NOT NULL, PRIMARY KEY (`idIdentityProvider`))",
+			"CREATE TABLE IF NOT EXISTS `federated_identities` (`idFederatedIdentity` bigint unsigned AUTO_INCREMENT, `idIdentityProvider` bigint unsigned NOT NULL, `subject` varchar(255) NOT NULL, `idUser` bigint unsigned NOT NULL, `createdAt` bigint NOT NULL, PRIMARY KEY (`idFederatedIdentity`), INDEX `idx_federated_identities_idUser` (`idUser`), UNIQUE INDEX `idx_federated_identity_subject` (`idIdentityProvider`, `subject`))",
+			"CREATE TABLE IF NOT EXISTS `allowed_email_domains` (`idAllowedEmailDomain` bigint unsigned AUTO_INCREMENT, `idOrganisation` bigint unsigned NOT NULL, `domain` varchar(255) NOT NULL, `includeSubdomains` boolean NOT NULL, `createdAt` bigint NOT NULL, PRIMARY KEY (`idAllowedEmailDomain`), UNIQUE INDEX `idx_allowed_email_domain_organisation_domain` (`idOrganisation`, `domain`))",
+		},
+		Down: []string{
+			"DROP TABLE `allowed_email_domains`",
+			"DROP TABLE `federated_identities`",
+			"DROP TABLE `identity_providers`",
+			"DROP TABLE `o_auth_codes`",
+			"DROP TABLE `o_auth_clients`",
+			"DROP TABLE `api_keys`",
+			"DROP TABLE `service_accounts`",
+			"DROP TABLE `recovery_codes`",
+			"DROP TABLE `password_resets`",
+			"DROP TABLE `roles`",
+			"DROP TABLE `invitations`",
+			"DROP TABLE `revocations`",
+			"DROP TABLE `refresh_tokens`",
+			"DROP TABLE `users`",
+			"DROP TABLE `organisations`",
+		},
+		Columns: []migrationColumn{
+			{Table: "organisations", Name: "requireVerifiedEmail", Definition: "boolean NOT NULL"},
+			{Table: "organisations", Name: "requireAdminMFA", Definition: "boolean NOT NULL"},
+			{Table: "users", Name: "password", Definition: "varchar(255) NOT NULL"},
+			{Table: "users", Name: "idRole", Definition: "bigint unsigned"},
+			{Table: "users", Name: "locale", Definition: "varchar(255)"},
+			{Table: "users", Name: "mfaEnabled", Definition: "boolean NOT NULL"},
+			{Table: "users", Name: "mfaSecret", Definition: "varchar(255)"},
+			{Table: "users", Name: "mfaLastStep", Definition: "bigint NOT NULL"},
+			{Table: "invitations", Name: "idInviterServiceAccount", Definition: "bigint unsigned NOT NULL"},
+			{Table: "o_auth_codes", Name: "nonce", Definition: "varchar(255)"},
+			{Table: "o_auth_codes", Name: "authTime", Definition: "bigint NOT NULL"},
+		},
+		Backfill: []string{
+			"INSERT INTO `roles` (`idOrganisation`, `roleName`, `canManage`, `canManageUser`, `canInvite`) SELECT `idOrganisation`, 'owner', true, true, true FROM `organisations` WHERE `idOrganisation` NOT IN (SELECT `idOrganisation` FROM `roles` WHERE `roleName` = 'owner')",
+			"INSERT INTO `roles` (`idOrganisation`, `roleName`, `canManage`, `canManageUser`, `canInvite`) SELECT `idOrganisation`, 'admin', false, true, true FROM `organisations` WHERE `idOrganisation` NOT IN (SELECT `idOrganisation` FROM `roles` WHERE `roleName` = 'admin')",
+			"INSERT INTO `roles` (`idOrganisation`, `roleName`, `canManage`, `canManageUser`, `canInvite`) SELECT `idOrganisation`, 'member', false, false, false FROM `organisations` WHERE `idOrganisation` NOT IN (SELECT `idOrganisation` FROM `roles` WHERE `roleName` = 'member')",
+			"UPDATE `users` SET `idRole` = (SELECT `idRole` FROM `roles` WHERE `roles`.`idOrganisation` = `users`.`idOrganisation` AND `roleName` = 'owner') WHERE `idUser` IN (SELECT `idUser` FROM (SELECT MIN(`idUser`) AS `idUser` FROM `users` WHERE `deleted` = false GROUP BY `idOrganisation` HAVING COALESCE(MAX(`idRole`), 0) = 0) AS `firstUsers`)",
+			"UPDATE `users` SET `idRole` = (SELECT `idRole` FROM `roles` WHERE `roles`.`idOrganisation` = `users`.`idOrganisation` AND `roleName` = 'member') WHERE `idRole` IS NULL OR `idRole` = 0",
+		},
+	},
+	{
+		// Rows belonging to an user, an OAuth client, an identity provider or a service account go with it. Rows
+		// left behind by deletions made before the keys existed are removed first, or keys could not be added.
+		Version: 2,
+		Name:    "foreign_keys",
+		Up: []string{
+			"DELETE FROM `refresh_tokens` WHERE `idUser` NOT IN (SELECT `idUser` FROM `users`)",
+			"DELETE FROM `password_resets` WHERE `idUser` NOT IN (SELECT `idUser` FROM `users`)",
+			"DELETE FROM `recovery_codes` WHERE `idUser` NOT IN (SELECT `idUser` FROM `users`)",
+			"DELETE FROM `o_auth_codes` WHERE `idUser` NOT IN (SELECT `idUser` FROM `users`) OR `idOAuthClient` NOT IN (SELECT `idOAuthClient` FROM `o_auth_clients`)",
+			"DELETE FROM `federated_identities` WHERE `idUser` NOT IN (SELECT `idUser` FROM `users`) OR `idIdentityProvider` NOT IN (SELECT `idIdentityProvider` FROM `identity_providers`)",
+			"DELETE FROM `api_keys` WHERE `idServiceAccount` NOT IN (SELECT `idServiceAccount` FROM `service_accounts`)",
+			"CREATE INDEX `idx_users_idOrganisation` ON `users` (`idOrganisation`)",
+			"ALTER TABLE `users` ADD CONSTRAINT `fk_users_idOrganisation` FOREIGN KEY (`idOrganisation`) REFERENCES `organisations` (`idOrganisation`)",
+			"ALTER TABLE `roles` ADD CONSTRAINT `fk_roles_idOrganisation` FOREIGN KEY (`idOrganisation`) REFERENCES `organisations` (`idOrganisation`)",
+			"ALTER TABLE `invitations` ADD CONSTRAINT `fk_invitations_idOrganisation` FOREIGN KEY (`idOrganisation`) REFERENCES `organisations` (`idOrganisation`)",
+			"ALTER TABLE `service_accounts` ADD CONSTRAINT `fk_service_accounts_idOrganisation` FOREIGN KEY (`idOrganisation`) REFERENCES `organisations` (`idOrganisation`)",
+			"ALTER TABLE `o_auth_clients` ADD CONSTRAINT `fk_o_auth_clients_idOrganisation` FOREIGN KEY (`idOrganisation`) REFERENCES `organisations` (`idOrganisation`)",
+			"ALTER TABLE `identity_providers` ADD CONSTRAINT `fk_identity_providers_idOrganisation` FOREIGN KEY (`idOrganisation`) REFERENCES `organisations` (`idOrganisation`)",
+			"ALTER TABLE `allowed_email_domains` ADD CONSTRAINT `fk_allowed_email_domains_idOrganisation` FOREIGN KEY (`idOrganisation`) REFERENCES `organisations` (`idOrganisation`)",
+			"ALTER TABLE `refresh_tokens` ADD CONSTRAINT `fk_refresh_tokens_idUser` FOREIGN KEY (`idUser`) REFERENCES `users` (`idUser`) ON DELETE CASCADE",
+			"ALTER TABLE `password_resets` ADD CONSTRAINT `fk_password_resets_idUser` FOREIGN KEY (`idUser`) REFERENCES `users` (`idUser`) ON DELETE CASCADE",
+			"ALTER TABLE `recovery_codes` ADD CONSTRAINT `fk_recovery_codes_idUser` FOREIGN KEY (`idUser`) REFERENCES `users` (`idUser`) ON DELETE CASCADE",
+			"ALTER TABLE `o_auth_codes` ADD CONSTRAINT `fk_o_auth_codes_idUser` FOREIGN KEY (`idUser`) REFERENCES `users` (`idUser`) ON DELETE CASCADE, ADD CONSTRAINT `fk_o_auth_codes_idOAuthClient` FOREIGN KEY (`idOAuthClient`) REFERENCES `o_auth_clients` (`idOAuthClient`) ON DELETE CASCADE",
+			"ALTER TABLE `federated_identities` ADD CONSTRAINT `fk_federated_identities_idUser` FOREIGN KEY (`idUser`) REFERENCES `users` (`idUser`) ON DELETE CASCADE, ADD CONSTRAINT `fk_federated_identities_idIdentityProvider` FOREIGN KEY (`idIdentityProvider`) REFERENCES `identity_providers` (`idIdentityProvider`) ON DELETE CASCADE",
+			"ALTER TABLE `api_keys` ADD CONSTRAINT `fk_api_keys_idServiceAccount` FOREIGN KEY (`idServiceAccount`) REFERENCES `service_accounts` (`idServiceAccount`) ON DELETE CASCADE",
+		},
+		Down: []string{
+			"ALTER TABLE `api_keys` DROP FOREIGN KEY `fk_api_keys_idServiceAccount`",
+			"ALTER TABLE `federated_identities` DROP FOREIGN KEY `fk_federated_identities_idUser`, DROP FOREIGN KEY `fk_federated_identities_idIdentityProvider`",
+			"ALTER TABLE `o_auth_codes` DROP FOREIGN KEY `fk_o_auth_codes_idUser`, DROP FOREIGN KEY `fk_o_auth_codes_idOAuthClient`",
+			"ALTER TABLE `recovery_codes` DROP FOREIGN KEY `fk_recovery_codes_idUser`",
+			"ALTER TABLE `password_resets` DROP FOREIGN KEY `fk_password_resets_idUser`",
+			"ALTER TABLE `refresh_tokens` DROP FOREIGN KEY `fk_refresh_tokens_idUser`",
+			"ALTER TABLE `allowed_email_domains` DROP FOREIGN KEY `fk_allowed_email_domains_idOrganisation`",
+			"ALTER TABLE `identity_providers` DROP FOREIGN KEY `fk_identity_providers_idOrganisation`",
+			"ALTER TABLE `o_auth_clients` DROP FOREIGN KEY `fk_o_auth_clients_idOrganisation`",
+			"ALTER TABLE `service_accounts` DROP FOREIGN KEY `fk_service_accounts_idOrganisation`",
+			"ALTER TABLE `invitations` DROP FOREIGN KEY `fk_invitations_idOrganisation`",
+			"ALTER TABLE `roles` DROP FOREIGN KEY `fk_roles_idOrganisation`",
+			"ALTER TABLE `users` DROP FOREIGN KEY `fk_users_idOrganisation`",
+			"DROP INDEX `idx_users_idOrganisation` ON `users`",
+		},
+	},
+}
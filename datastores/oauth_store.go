@@ -0,0 +1,121 @@
+package datastores
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// OAuthStoreImpl Used to implement OAuthStore interface
+type OAuthStoreImpl struct{}
+
+// OAuth Generate the struct for oauth store
+func (s StoreImpl) OAuth() OAuthStore {
+	return OAuthStoreImpl{}
+}
+
+// SaveClient Use to save oauth client in DB
+func (osi OAuthStoreImpl) SaveClient(ctx context.Context, client *models.OAuthClient, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	client.PreSave()
+	if appError := client.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("oauthStoreImpl.SaveClient.client.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(client) {
+		transaction.Rollback()
+		return u.NewLocAppError("oauthStoreImpl.SaveClient", "save.transaction.create.already_exist", nil, "Client ID: "+client.ClientID)
+	}
+	if err := transaction.Create(client).Error; err != nil {
+		transaction.Rollback()
+		return storeError("oauthStoreImpl.SaveClient", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetClientByID get oauth client from its database id
+func (osi OAuthStoreImpl) GetClientByID(ctx context.Context, ID uint64, db *gorm.DB) (models.OAuthClient, *u.AppError) {
+	db = withContext(ctx, db)
+	client := models.EmptyOAuthClient
+	if err := db.Where(quoteNames(db, "idOAuthClient = ?"), ID).First(&client).Error; err != nil {
+		return models.EmptyOAuthClient, storeError("oAuthStoreImpl.GetClientByID", "get.transaction.find.encounterError :", err)
+	}
+	return client, nil
+}
+
+// GetClientByClientID get oauth client from its public identifier
+func (osi OAuthStoreImpl) GetClientByClientID(ctx context.Context, clientID string, db *gorm.DB) (models.OAuthClient, *u.AppError) {
+	db = withContext(ctx, db)
+	client := models.EmptyOAuthClient
+	if err := db.Where(quoteNames(db, "clientID = ?"), clientID).First(&client).Error; err != nil {
+		return models.EmptyOAuthClient, storeError("oAuthStoreImpl.GetClientByClientID", "get.transaction.find.encounterError :", err)
+	}
+	return client, nil
+}
+
+// GetClientsByOrganisation get all oauth clients of an organisation
+func (osi OAuthStoreImpl) GetClientsByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.OAuthClient, *u.AppError) {
+	db = withContext(ctx, db)
+	clients := []models.OAuthClient{}
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), IDOrganisation).Order("name").Find(&clients).Error; err != nil {
+		return clients, storeError("oAuthStoreImpl.GetClientsByOrganisation", "get.transaction.find.encounterError :", err)
+	}
+	return clients, nil
+}
+
+// RevokeClient revoke an oauth client. It can not get tokens anymore.
+func (osi OAuthStoreImpl) RevokeClient(ctx context.Context, client *models.OAuthClient, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Model(&models.OAuthClient{}).Where(quoteNames(db, "idOAuthClient = ?"), client.IDOAuthClient).Update("revoked", true).Error; err != nil {
+		return storeError("oauthStoreImpl.RevokeClient", "update.transaction.updates.encounterError :", err)
+	}
+	client.Revoked = true
+	return nil
+}
+
+// SaveCode Use to save authorization code in DB
+func (osi OAuthStoreImpl) SaveCode(ctx context.Context, code *models.OAuthCode, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	if appError := code.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("oauthStoreImpl.SaveCode.code.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if err := transaction.Create(code).Error; err != nil {
+		transaction.Rollback()
+		return storeError("oauthStoreImpl.SaveCode", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetCode get authorization code from its clear value
+func (osi OAuthStoreImpl) GetCode(ctx context.Context, code string, db *gorm.DB) (models.OAuthCode, *u.AppError) {
+	db = withContext(ctx, db)
+	oauthCode := models.EmptyOAuthCode
+	if err := db.Where(quoteNames(db, "codeHash = ?"), models.HashToken(code)).First(&oauthCode).Error; err != nil {
+		return models.EmptyOAuthCode, storeError("oAuthStoreImpl.GetCode", "get.transaction.find.encounterError :", err)
+	}
+	return oauthCode, nil
+}
+
+// ConsumeCode mark authorization code as exchanged for the token identified by tokenID. It fails if code was
+// already used, so a code can only be exchanged once even with concurrent requests.
+func (osi OAuthStoreImpl) ConsumeCode(ctx context.Context, code *models.OAuthCode, tokenID string, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	result := db.Model(&models.OAuthCode{}).
+		Where(quoteNames(db, "idOAuthCode = ? AND used = ?"), code.IDOAuthCode, false).
+		Updates(map[string]interface{}{"used": true, "tokenID": tokenID})
+	if result.Error != nil {
+		return storeError("oauthStoreImpl.ConsumeCode", "update.transaction.updates.encounterError :", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return u.NewAPIError(400, "invalid_grant", "Authorization code was already used.")
+	}
+	code.Used = true
+	code.TokenID = tokenID
+	return nil
+}
@@ -1,6 +1,7 @@
 package datastores
 
 import (
+	"context"
 	"github.com/jinzhu/gorm"
 	"github.com/titouanfreville/popcubeexternalapi/models"
 	u "github.com/titouanfreville/popcubeexternalapi/utils"
@@ -15,8 +16,9 @@ func (s StoreImpl) Organisation() OrganisationStore {
 }
 
 // Save Use to save data in BB
-func (osi OrganisationStoreImpl) Save(organisation *models.Organisation, db *gorm.DB) *u.AppError {
-	transaction := db.Begin()
+func (osi OrganisationStoreImpl) Save(ctx context.Context, organisation *models.Organisation, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
 	organisation.PreSave()
 	if appError := organisation.IsValid(); appError != nil {
 		transaction.Rollback()
@@ -28,16 +30,21 @@ func (osi OrganisationStoreImpl) Save(organisation *models.Organisation, db *gor
 	}
 	if err := transaction.Create(&organisation).Error; err != nil {
 		transaction.Rollback()
-		return u.NewLocAppError("organisationStoreImpl.Save", "save.transaction.create.encounterError: "+err.Error(), nil, "")
+		return storeError("organisationStoreImpl.Save", "save.transaction.create.encounterError: ", err)
+	}
+	if _, err := seedRoles(organisation.IDOrganisation, transaction); err != nil {
+		transaction.Rollback()
+		return storeError("organisationStoreImpl.Save", "save.transaction.create.encounterError: ", err)
 	}
 	transaction.Commit()
 	return nil
 }
 
 // Update Used to update data in DB
-func (osi OrganisationStoreImpl) Update(organisation *models.Organisation, newOrganisation *models.Organisation, db *gorm.DB) *u.AppError {
+func (osi OrganisationStoreImpl) Update(ctx context.Context, organisation *models.Organisation, newOrganisation *models.Organisation, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
 
-	transaction := db.Begin()
+	transaction := begin(db)
 	newOrganisation.PreSave()
 	if appError := organisation.IsValid(); appError != nil {
 		transaction.Rollback()
@@ -49,29 +56,90 @@ func (osi OrganisationStoreImpl) Update(organisation *models.Organisation, newOr
 	// }
 	if err := transaction.Model(&organisation).Updates(&newOrganisation).Error; err != nil {
 		transaction.Rollback()
-		return u.NewLocAppError("organisationStoreImpl.Update", "update.transaction.updates.encounterError: "+err.Error(), nil, "")
+		return storeError("organisationStoreImpl.Update", "update.transaction.updates.encounterError: ", err)
+	}
+	// Updates skip zero values: policies are always written so they can be turned off.
+	if err := transaction.Model(&organisation).Updates(newOrganisation.Policies()).Error; err != nil {
+		transaction.Rollback()
+		return storeError("organisationStoreImpl.Update", "update.transaction.updates.encounterError: ", err)
 	}
 	transaction.Commit()
 	return nil
 }
 
 // Get Used to get organisation from DB
-func (osi OrganisationStoreImpl) Get(db *gorm.DB) []models.Organisation {
+func (osi OrganisationStoreImpl) Get(ctx context.Context, db *gorm.DB) ([]models.Organisation, *u.AppError) {
+	db = withContext(ctx, db)
 	organisation := []models.Organisation{}
-	db.Find(&organisation)
-	return organisation
+	if err := db.Find(&organisation).Error; err != nil {
+		return organisation, storeError("organisationStoreImpl.Get", "get.transaction.find.encounterError :", err)
+	}
+	return organisation, nil
 }
 
-// GeByName Used to get organisation from DB
-func (osi OrganisationStoreImpl) GeByName(name string, db *gorm.DB) models.Organisation {
+// GetByName Used to get organisation from DB
+func (osi OrganisationStoreImpl) GetByName(ctx context.Context, name string, db *gorm.DB) (models.Organisation, *u.AppError) {
+	db = withContext(ctx, db)
 	organisation := models.EmptyOrganisation
-	db.First(&organisation)
-	return organisation
+	if err := db.Where(quoteNames(db, "organisationName = ?"), name).First(&organisation).Error; err != nil {
+		return models.EmptyOrganisation, storeError("organisationStoreImpl.GetByName", "get.transaction.find.encounterError :", err)
+	}
+	return organisation, nil
 }
 
 // GetByID Used to get organisation from DB
-func (osi OrganisationStoreImpl) GetByID(ID uint64, db *gorm.DB) models.Organisation {
+func (osi OrganisationStoreImpl) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Organisation, *u.AppError) {
+	db = withContext(ctx, db)
 	organisation := models.EmptyOrganisation
-	db.Where("idOrganisation = ?", ID).First(&organisation)
-	return organisation
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), ID).First(&organisation).Error; err != nil {
+		return models.EmptyOrganisation, storeError("organisationStoreImpl.GetByID", "get.transaction.find.encounterError :", err)
+	}
+	return organisation, nil
+}
+
+// Bootstrap create organisation, its default roles and its owner from a neworganisation token in a single transaction.
+// consumed is the revocation of the token: saving it fail if token was already used, so a token can only be consumed once.
+func (osi OrganisationStoreImpl) Bootstrap(ctx context.Context, organisation *models.Organisation, owner *models.User, consumed *models.Revocation, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	organisation.PreSave()
+	if appError := organisation.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("organisationStoreImpl.Bootstrap.organisation.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	consumed.PreSave()
+	if appError := consumed.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("organisationStoreImpl.Bootstrap.consumed.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.Where("kind = ? AND subject = ?", consumed.Kind, consumed.Subject).First(&models.Revocation{}).RecordNotFound() {
+		transaction.Rollback()
+		return u.NewAPIError(409, "token.already.used", "This token was already used to create an organisation.")
+	}
+	if err := transaction.Create(consumed).Error; err != nil {
+		transaction.Rollback()
+		return u.NewAPIError(409, "token.already.used", "This token was already used to create an organisation.")
+	}
+	if err := transaction.Create(organisation).Error; err != nil {
+		transaction.Rollback()
+		return storeError("organisationStoreImpl.Bootstrap", "save.transaction.create.encounterError: ", err)
+	}
+	roles, err := seedRoles(organisation.IDOrganisation, transaction)
+	if err != nil {
+		transaction.Rollback()
+		return storeError("organisationStoreImpl.Bootstrap", "save.transaction.create.encounterError: ", err)
+	}
+	owner.IDOrganisation = organisation.IDOrganisation
+	owner.IDRole = roles[models.RoleOwner].IDRole
+	owner.PreSave()
+	if appError := owner.IsValid(false); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("organisationStoreImpl.Bootstrap.owner.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if err := transaction.Create(owner).Error; err != nil {
+		transaction.Rollback()
+		return storeError("organisationStoreImpl.Bootstrap", "save.transaction.create.encounterError: ", err)
+	}
+	transaction.Commit()
+	return nil
 }
@@ -0,0 +1,87 @@
+package datastores
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// PasswordResetStoreImpl Used to implement PasswordResetStore interface
+type PasswordResetStoreImpl struct{}
+
+// PasswordReset Generate the struct for password reset store
+func (s StoreImpl) PasswordReset() PasswordResetStore {
+	return PasswordResetStoreImpl{}
+}
+
+// Save Use to save password reset in DB. Previous resets of the user which were not used can not be used anymore.
+func (prsi PasswordResetStoreImpl) Save(ctx context.Context, passwordReset *models.PasswordReset, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	passwordReset.PreSave()
+	if appError := passwordReset.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("passwordResetStoreImpl.Save.passwordReset.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(passwordReset) {
+		transaction.Rollback()
+		return u.NewLocAppError("passwordResetStoreImpl.Save", "save.transaction.create.already_exist", nil, "")
+	}
+	if err := transaction.Model(&models.PasswordReset{}).Where(quoteNames(transaction, "idUser = ? AND used = ?"), passwordReset.IDUser, false).Update("used", true).Error; err != nil {
+		transaction.Rollback()
+		return storeError("passwordResetStoreImpl.Save", "update.transaction.updates.encounterError :", err)
+	}
+	if err := transaction.Create(passwordReset).Error; err != nil {
+		transaction.Rollback()
+		return storeError("passwordResetStoreImpl.Save", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetByToken get password reset from its clear value
+func (prsi PasswordResetStoreImpl) GetByToken(ctx context.Context, token string, db *gorm.DB) (models.PasswordReset, *u.AppError) {
+	db = withContext(ctx, db)
+	passwordReset := models.EmptyPasswordReset
+	if err := db.Where(quoteNames(db, "tokenHash = ?"), models.HashToken(token)).First(&passwordReset).Error; err != nil {
+		return models.EmptyPasswordReset, storeError("passwordResetStoreImpl.GetByToken", "get.transaction.find.encounterError :", err)
+	}
+	return passwordReset, nil
+}
+
+// Consume mark password reset as used and set the new password hash of its user in a single transaction.
+// Every refresh token of the user is revoked. Consume fail if reset was already used or is expired,
+// so a reset token can only be used once even with concurrent requests.
+func (prsi PasswordResetStoreImpl) Consume(ctx context.Context, passwordReset *models.PasswordReset, passwordHash string, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	if !models.IsHashedPassword(passwordHash) {
+		transaction.Rollback()
+		return u.NewLocAppError("passwordResetStoreImpl.Consume", "model.user.is_valid.password.app_error", nil, "")
+	}
+	result := transaction.Model(&models.PasswordReset{}).
+		Where(quoteNames(transaction, "idPasswordReset = ? AND used = ? AND expiresAt >= ?"), passwordReset.IDPasswordReset, false, time.Now().UTC().Unix()).
+		Update("used", true)
+	if result.Error != nil {
+		transaction.Rollback()
+		return storeError("passwordResetStoreImpl.Consume", "update.transaction.updates.encounterError :", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		transaction.Rollback()
+		return u.NewAPIError(401, "password.reset.invalid", "Password reset link is invalid, expired or was already used.")
+	}
+	if err := transaction.Model(&models.User{}).Where(quoteNames(transaction, "idUser = ?"), passwordReset.IDUser).Update("password", passwordHash).Error; err != nil {
+		transaction.Rollback()
+		return storeError("passwordResetStoreImpl.Consume", "update.transaction.updates.encounterError :", err)
+	}
+	if err := transaction.Model(&models.RefreshToken{}).Where(quoteNames(transaction, "idUser = ?"), passwordReset.IDUser).Update("revoked", true).Error; err != nil {
+		transaction.Rollback()
+		return storeError("passwordResetStoreImpl.Consume", "update.transaction.updates.encounterError :", err)
+	}
+	transaction.Commit()
+	passwordReset.Used = true
+	return nil
+}
@@ -0,0 +1,97 @@
+package datastores
+
+// postgresMigrations schema migrations of postgres databases. They build the schema of mysql migrations. Names are
+// quoted, as postgres folds unquoted ones to lower case and api uses camel case column names.
+var postgresMigrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: []string{
+			`CREATE TABLE "organisations" ("idOrganisation" bigserial, "dockerStack" integer NOT NULL UNIQUE, "organisationName" text NOT NULL UNIQUE, "public" boolean NOT NULL, "description" text, "avatar" text, "domain" text, "requireVerifiedEmail" boolean NOT NULL, "requireAdminMFA" boolean NOT NULL, PRIMARY KEY ("idOrganisation"))`,
+			`CREATE TABLE "users" ("idUser" bigserial, "userName" text NOT NULL UNIQUE, "email" text NOT NULL UNIQUE, "emailVerified" boolean NOT NULL, "deleted" boolean NOT NULL, "avatar" text, "password" text NOT NULL, "nickName" text UNIQUE, "firstName" text, "lastName" text, "idOrganisation" bigint NOT NULL, "idRole" bigint, "locale" text, "mfaEnabled" boolean NOT NULL, "mfaSecret" text, "mfaLastStep" bigint NOT NULL, PRIMARY KEY ("idUser"))`,
+			`CREATE TABLE "refresh_tokens" ("idRefreshToken" bigserial, "tokenHash" text NOT NULL UNIQUE, "family" text NOT NULL, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "rotated" boolean NOT NULL, "revoked" boolean NOT NULL, PRIMARY KEY ("idRefreshToken"))`,
+			`CREATE INDEX "idx_refresh_tokens_family" ON "refresh_tokens" ("family")`,
+			`CREATE INDEX "idx_refresh_tokens_idUser" ON "refresh_tokens" ("idUser")`,
+			`CREATE TABLE "revocations" ("idRevocation" bigserial, "kind" text NOT NULL, "subject" text NOT NULL, "revokedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, PRIMARY KEY ("idRevocation"))`,
+			`CREATE UNIQUE INDEX "idx_revocation_subject" ON "revocations" ("kind", "subject")`,
+			`CREATE TABLE "invitations" ("idInvitation" bigserial, "idInviter" bigint NOT NULL, "idInviterServiceAccount" bigint NOT NULL, "email" text NOT NULL, "idOrganisation" bigint NOT NULL, "role" text NOT NULL, "status" text NOT NULL, "invitedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, PRIMARY KEY ("idInvitation"))`,
+			`CREATE INDEX "idx_invitations_email" ON "invitations" ("email")`,
+			`CREATE INDEX "idx_invitations_idOrganisation" ON "invitations" ("idOrganisation")`,
+			`CREATE TABLE "roles" ("idRole" bigserial, "idOrganisation" bigint NOT NULL, "roleName" text NOT NULL, "canManage" boolean NOT NULL, "canManageUser" boolean NOT NULL, "canInvite" boolean NOT NULL, PRIMARY KEY ("idRole"))`,
+			`CREATE UNIQUE INDEX "idx_role_organisation_name" ON "roles" ("idOrganisation", "roleName")`,
+			`CREATE TABLE "password_resets" ("idPasswordReset" bigserial, "tokenHash" text NOT NULL UNIQUE, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL, PRIMARY KEY ("idPasswordReset"))`,
+			`CREATE INDEX "idx_password_resets_idUser" ON "password_resets" ("idUser")`,
+			`CREATE TABLE "recovery_codes" ("idRecoveryCode" bigserial, "idUser" bigint NOT NULL, "codeHash" text NOT NULL UNIQUE, "used" boolean NOT NULL, PRIMARY KEY ("idRecoveryCode"))`,
+			`CREATE INDEX "idx_recovery_codes_idUser" ON "recovery_codes" ("idUser")`,
+			`CREATE TABLE "service_accounts" ("idServiceAccount" bigserial, "idOrganisation" bigint NOT NULL, "name" text NOT NULL, "description" text, "createdAt" bigint NOT NULL, "disabled" boolean NOT NULL, PRIMARY KEY ("idServiceAccount"))`,
+			`CREATE UNIQUE INDEX "idx_service_account_organisation_name" ON "service_accounts" ("idOrganisation", "name")`,
+			`CREATE TABLE "api_keys" ("idAPIKey" bigserial, "idServiceAccount" bigint NOT NULL, "name" text, "prefix" text NOT NULL UNIQUE, "keyHash" text NOT NULL, "scopes" text NOT NULL, "createdAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "lastUsedAt" bigint NOT NULL, "revoked" boolean NOT NULL, PRIMARY KEY ("idAPIKey"))`,
+			`CREATE INDEX "idx_api_keys_idServiceAccount" ON "api_keys" ("idServiceAccount")`,
+			`CREATE TABLE "o_auth_clients" ("idOAuthClient" bigserial, "idOrganisation" bigint NOT NULL, "clientID" text NOT NULL UNIQUE, "secretHash" text, "name" text NOT NULL, "public" boolean NOT NULL, "redirectURIs" text, "grants" text NOT NULL, "scopes" text, "createdAt" bigint NOT NULL, "revoked" boolean NOT NULL, PRIMARY KEY ("idOAuthClient"))`,
+			`CREATE INDEX "idx_o_auth_clients_idOrganisation" ON "o_auth_clients" ("idOrganisation")`,
+			`CREATE TABLE "o_auth_codes" ("idOAuthCode" bigserial, "codeHash" text NOT NULL UNIQUE, "idOAuthClient" bigint NOT NULL, "idUser" bigint NOT NULL, "redirectURI" text NOT NULL, "scope" text, "codeChallenge" text NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL, "tokenID" text, "nonce" text, "authTime" bigint NOT NULL, PRIMARY KEY ("idOAuthCode"))`,
+			`CREATE INDEX "idx_o_auth_codes_idOAuthClient" ON "o_auth_codes" ("idOAuthClient")`,
+			`CREATE INDEX "idx_o_auth_codes_idUser" ON "o_auth_codes" ("idUser")`,
+			`CREATE TABLE "identity_providers" ("idIdentityProvider" bigserial, "idOrganisation" bigint NOT NULL UNIQUE, "name" text, "issuer" text NOT NULL, "clientID" text NOT NULL, "clientSecret" text, "autoCreate" boolean NOT NULL, "enabled" boolean NOT NULL, "createdAt" bigint NOT NULL, PRIMARY KEY ("idIdentityProvider"))`,
+			`CREATE TABLE "federated_identities" ("idFederatedIdentity" bigserial, "idIdentityProvider" bigint NOT NULL, "subject" text NOT NULL, "idUser" bigint NOT NULL, "createdAt" bigint NOT NULL, PRIMARY KEY ("idFederatedIdentity"))`,
+			`CREATE INDEX "idx_federated_identities_idUser" ON "federated_identities" ("idUser")`,
+			`CREATE UNIQUE INDEX "idx_federated_identity_subject" ON "federated_identities" ("idIdentityProvider", "subject")`,
+			`CREATE TABLE "allowed_email_domains" ("idAllowedEmailDomain" bigserial, "idOrganisation" bigint NOT NULL, "domain" text NOT NULL, "includeSubdomains" boolean NOT NULL, "createdAt" bigint NOT NULL, PRIMARY KEY ("idAllowedEmailDomain"))`,
+			`CREATE UNIQUE INDEX "idx_allowed_email_domain_organisation_domain" ON "allowed_email_domains" ("idOrganisation", "domain")`,
+		},
+		Down: []string{
+			`DROP TABLE "allowed_email_domains"`,
+			`DROP TABLE "federated_identities"`,
+			`DROP TABLE "identity_providers"`,
+			`DROP TABLE "o_auth_codes"`,
+			`DROP TABLE "o_auth_clients"`,
+			`DROP TABLE "api_keys"`,
+			`DROP TABLE "service_accounts"`,
+			`DROP TABLE "recovery_codes"`,
+			`DROP TABLE "password_resets"`,
+			`DROP TABLE "roles"`,
+			`DROP TABLE "invitations"`,
+			`DROP TABLE "revocations"`,
+			`DROP TABLE "refresh_tokens"`,
+			`DROP TABLE "users"`,
+			`DROP TABLE "organisations"`,
+		},
+	},
+	{
+		// Rows belonging to an user, an OAuth client, an identity provider or a service account go with it.
+		Version: 2,
+		Name:    "foreign_keys",
+		Up: []string{
+			`CREATE INDEX "idx_users_idOrganisation" ON "users" ("idOrganisation")`,
+			`ALTER TABLE "users" ADD CONSTRAINT "fk_users_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation")`,
+			`ALTER TABLE "roles" ADD CONSTRAINT "fk_roles_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation")`,
+			`ALTER TABLE "invitations" ADD CONSTRAINT "fk_invitations_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation")`,
+			`ALTER TABLE "service_accounts" ADD CONSTRAINT "fk_service_accounts_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation")`,
+			`ALTER TABLE "o_auth_clients" ADD CONSTRAINT "fk_o_auth_clients_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation")`,
+			`ALTER TABLE "identity_providers" ADD CONSTRAINT "fk_identity_providers_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation")`,
+			`ALTER TABLE "allowed_email_domains" ADD CONSTRAINT "fk_allowed_email_domains_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation")`,
+			`ALTER TABLE "refresh_tokens" ADD CONSTRAINT "fk_refresh_tokens_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE`,
+			`ALTER TABLE "password_resets" ADD CONSTRAINT "fk_password_resets_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE`,
+			`ALTER TABLE "recovery_codes" ADD CONSTRAINT "fk_recovery_codes_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE`,
+			`ALTER TABLE "o_auth_codes" ADD CONSTRAINT "fk_o_auth_codes_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE, ADD CONSTRAINT "fk_o_auth_codes_idOAuthClient" FOREIGN KEY ("idOAuthClient") REFERENCES "o_auth_clients" ("idOAuthClient") ON DELETE CASCADE`,
+			`ALTER TABLE "federated_identities" ADD CONSTRAINT "fk_federated_identities_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE, ADD CONSTRAINT "fk_federated_identities_idIdentityProvider" FOREIGN KEY ("idIdentityProvider") REFERENCES "identity_providers" ("idIdentityProvider") ON DELETE CASCADE`,
+			`ALTER TABLE "api_keys" ADD CONSTRAINT "fk_api_keys_idServiceAccount" FOREIGN KEY ("idServiceAccount") REFERENCES "service_accounts" ("idServiceAccount") ON DELETE CASCADE`,
+		},
+		Down: []string{
+			`ALTER TABLE "api_keys" DROP CONSTRAINT "fk_api_keys_idServiceAccount"`,
+			`ALTER TABLE "federated_identities" DROP CONSTRAINT "fk_federated_identities_idUser", DROP CONSTRAINT "fk_federated_identities_idIdentityProvider"`,
+			`ALTER TABLE "o_auth_codes" DROP CONSTRAINT "fk_o_auth_codes_idUser", DROP CONSTRAINT "fk_o_auth_codes_idOAuthClient"`,
+			`ALTER TABLE "recovery_codes" DROP CONSTRAINT "fk_recovery_codes_idUser"`,
+			`ALTER TABLE "password_resets" DROP CONSTRAINT "fk_password_resets_idUser"`,
+			`ALTER TABLE "refresh_tokens" DROP CONSTRAINT "fk_refresh_tokens_idUser"`,
+			`ALTER TABLE "allowed_email_domains" DROP CONSTRAINT "fk_allowed_email_domains_idOrganisation"`,
+			`ALTER TABLE "identity_providers" DROP CONSTRAINT "fk_identity_providers_idOrganisation"`,
+			`ALTER TABLE "o_auth_clients" DROP CONSTRAINT "fk_o_auth_clients_idOrganisation"`,
+			`ALTER TABLE "service_accounts" DROP CONSTRAINT "fk_service_accounts_idOrganisation"`,
+			`ALTER TABLE "invitations" DROP CONSTRAINT "fk_invitations_idOrganisation"`,
+			`ALTER TABLE "roles" DROP CONSTRAINT "fk_roles_idOrganisation"`,
+			`ALTER TABLE "users" DROP CONSTRAINT "fk_users_idOrganisation"`,
+			`DROP INDEX "idx_users_idOrganisation"`,
+		},
+	},
+}
@@ -0,0 +1,104 @@
+package datastores
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// RefreshTokenStoreImpl Used to implement RefreshTokenStore interface
+type RefreshTokenStoreImpl struct{}
+
+// RefreshToken Generate the struct for refresh token store
+func (s StoreImpl) RefreshToken() RefreshTokenStore {
+	return RefreshTokenStoreImpl{}
+}
+
+// Save Use to save refresh token in DB
+func (rtsi RefreshTokenStoreImpl) Save(ctx context.Context, refreshToken *models.RefreshToken, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	refreshToken.PreSave()
+	if appError := refreshToken.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("refreshTokenStoreImpl.Save.refreshToken.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(refreshToken) {
+		transaction.Rollback()
+		return u.NewLocAppError("refreshTokenStoreImpl.Save", "save.transaction.create.already_exist", nil, "Family: "+refreshToken.Family)
+	}
+	if err := transaction.Create(refreshToken).Error; err != nil {
+		transaction.Rollback()
+		return storeError("refreshTokenStoreImpl.Save", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetByToken get refresh token from its clear value
+func (rtsi RefreshTokenStoreImpl) GetByToken(ctx context.Context, token string, db *gorm.DB) (models.RefreshToken, *u.AppError) {
+	db = withContext(ctx, db)
+	refreshToken := models.EmptyRefreshToken
+	if err := db.Where(quoteNames(db, "tokenHash = ?"), models.HashToken(token)).First(&refreshToken).Error; err != nil {
+		return models.EmptyRefreshToken, storeError("refreshTokenStoreImpl.GetByToken", "get.transaction.find.encounterError :", err)
+	}
+	return refreshToken, nil
+}
+
+// Rotate mark refresh token as used and save the one replacing it. Rotate fail if token was already rotated or revoked,
+// so a token can only be exchanged once even with concurrent requests.
+func (rtsi RefreshTokenStoreImpl) Rotate(ctx context.Context, refreshToken *models.RefreshToken, newRefreshToken *models.RefreshToken, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	newRefreshToken.PreSave()
+	if appError := newRefreshToken.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("refreshTokenStoreImpl.Rotate.newRefreshToken.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	result := transaction.Model(&models.RefreshToken{}).
+		Where(quoteNames(transaction, "idRefreshToken = ? AND rotated = ? AND revoked = ?"), refreshToken.IDRefreshToken, false, false).
+		Update("rotated", true)
+	if result.Error != nil {
+		transaction.Rollback()
+		return storeError("refreshTokenStoreImpl.Rotate", "update.transaction.updates.encounterError :", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		transaction.Rollback()
+		return u.NewAPIError(401, "refresh.token.reused", "Refresh token was already used.")
+	}
+	if err := transaction.Create(newRefreshToken).Error; err != nil {
+		transaction.Rollback()
+		return storeError("refreshTokenStoreImpl.Rotate", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	refreshToken.Rotated = true
+	return nil
+}
+
+// RevokeFamily revoke all refresh tokens created from the same login
+func (rtsi RefreshTokenStoreImpl) RevokeFamily(ctx context.Context, family string, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Model(&models.RefreshToken{}).Where("family = ?", family).Update("revoked", true).Error; err != nil {
+		return storeError("refreshTokenStoreImpl.RevokeFamily", "update.transaction.updates.encounterError :", err)
+	}
+	return nil
+}
+
+// RevokeUser revoke all refresh tokens of an user
+func (rtsi RefreshTokenStoreImpl) RevokeUser(ctx context.Context, IDUser uint64, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Model(&models.RefreshToken{}).Where(quoteNames(db, "idUser = ?"), IDUser).Update("revoked", true).Error; err != nil {
+		return storeError("refreshTokenStoreImpl.RevokeUser", "update.transaction.updates.encounterError :", err)
+	}
+	return nil
+}
+
+// RevokeOrganisation revoke all refresh tokens of the users of an organisation
+func (rtsi RefreshTokenStoreImpl) RevokeOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Model(&models.RefreshToken{}).Where(quoteNames(db, "idUser IN (SELECT idUser FROM users WHERE idOrganisation = ?)"), IDOrganisation).Update("revoked", true).Error; err != nil {
+		return storeError("refreshTokenStoreImpl.RevokeOrganisation", "update.transaction.updates.encounterError :", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package datastores
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// RevocationStoreImpl Used to implement RevocationStore interface
+type RevocationStoreImpl struct{}
+
+// Revocation Generate the struct for revocation store
+func (s StoreImpl) Revocation() RevocationStore {
+	return RevocationStoreImpl{}
+}
+
+// Save Use to save revocation in DB. Revoking an already revoked subject move its revocation date.
+func (rsi RevocationStoreImpl) Save(ctx context.Context, revocation *models.Revocation, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	revocation.PreSave()
+	if appError := revocation.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("revocationStoreImpl.Save.revocation.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	existing := models.EmptyRevocation
+	if !transaction.Where("kind = ? AND subject = ?", revocation.Kind, revocation.Subject).First(&existing).RecordNotFound() {
+		if revocation.ExpiresAt != 0 && existing.ExpiresAt != 0 && existing.ExpiresAt > revocation.ExpiresAt {
+			revocation.ExpiresAt = existing.ExpiresAt
+		}
+		if existing.ExpiresAt == 0 {
+			revocation.ExpiresAt = 0
+		}
+		updates := map[string]interface{}{"revokedAt": revocation.RevokedAt, "expiresAt": revocation.ExpiresAt}
+		if err := transaction.Model(&existing).Updates(updates).Error; err != nil {
+			transaction.Rollback()
+			return storeError("revocationStoreImpl.Save", "update.transaction.updates.encounterError :", err)
+		}
+		revocation.IDRevocation = existing.IDRevocation
+		transaction.Commit()
+		return nil
+	}
+	if err := transaction.Create(revocation).Error; err != nil {
+		transaction.Rollback()
+		return storeError("revocationStoreImpl.Save", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetActive get revocations still useful at provided date
+func (rsi RevocationStoreImpl) GetActive(ctx context.Context, date int64, db *gorm.DB) ([]models.Revocation, *u.AppError) {
+	db = withContext(ctx, db)
+	revocations := []models.Revocation{}
+	if err := db.Where(quoteNames(db, "expiresAt = 0 OR expiresAt > ?"), date).Find(&revocations).Error; err != nil {
+		return revocations, storeError("revocationStoreImpl.GetActive", "get.transaction.find.encounterError :", err)
+	}
+	return revocations, nil
+}
+
+// GetBySubject get revocation of a subject
+func (rsi RevocationStoreImpl) GetBySubject(ctx context.Context, kind string, subject string, db *gorm.DB) (models.Revocation, *u.AppError) {
+	db = withContext(ctx, db)
+	revocation := models.EmptyRevocation
+	if err := db.Where("kind = ? AND subject = ?", kind, subject).First(&revocation).Error; err != nil {
+		return models.EmptyRevocation, storeError("revocationStoreImpl.GetBySubject", "get.transaction.find.encounterError :", err)
+	}
+	return revocation, nil
+}
+
+// DeleteExpired remove revocations which can not match any valid token anymore
+func (rsi RevocationStoreImpl) DeleteExpired(ctx context.Context, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Where(quoteNames(db, "expiresAt <> 0 AND expiresAt < ?"), time.Now().UTC().Unix()).Delete(models.Revocation{}).Error; err != nil {
+		return storeError("revocationStoreImpl.DeleteExpired", "update.transaction.delete.encounterError :", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package datastores
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// RoleStoreImpl Used to implement RoleStore interface
+type RoleStoreImpl struct{}
+
+// Role Generate the struct for role store
+func (s StoreImpl) Role() RoleStore {
+	return RoleStoreImpl{}
+}
+
+// Save Use to save role in DB
+func (rsi RoleStoreImpl) Save(ctx context.Context, role *models.Role, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	role.PreSave()
+	if appError := role.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("roleStoreImpl.Save.role.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(role) {
+		transaction.Rollback()
+		return u.NewLocAppError("roleStoreImpl.Save", "save.transaction.create.already_exist", nil, "Role Name: "+role.RoleName)
+	}
+	if err := transaction.Create(role).Error; err != nil {
+		transaction.Rollback()
+		return storeError("roleStoreImpl.Save", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// Update Used to update role rights in DB. Role name and organisation can not be changed.
+func (rsi RoleStoreImpl) Update(ctx context.Context, role *models.Role, newRole *models.Role, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	if appError := role.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("roleStoreImpl.Update.roleOld.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	rights := map[string]interface{}{
+		"canManage":     newRole.CanManage,
+		"canManageUser": newRole.CanManageUser,
+		"canInvite":     newRole.CanInvite,
+	}
+	if err := transaction.Model(role).Updates(rights).Error; err != nil {
+		transaction.Rollback()
+		return storeError("roleStoreImpl.Update", "update.transaction.updates.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetByID get role from its id
+func (rsi RoleStoreImpl) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.Role, *u.AppError) {
+	db = withContext(ctx, db)
+	role := models.EmptyRole
+	if err := db.Where(quoteNames(db, "idRole = ?"), ID).First(&role).Error; err != nil {
+		return models.EmptyRole, storeError("roleStoreImpl.GetByID", "get.transaction.find.encounterError :", err)
+	}
+	return role, nil
+}
+
+// GetByName get role of an organisation from its name
+func (rsi RoleStoreImpl) GetByName(ctx context.Context, IDOrganisation uint64, roleName string, db *gorm.DB) (models.Role, *u.AppError) {
+	db = withContext(ctx, db)
+	role := models.EmptyRole
+	if err := db.Where(quoteNames(db, "idOrganisation = ? AND roleName = ?"), IDOrganisation, roleName).First(&role).Error; err != nil {
+		return models.EmptyRole, storeError("roleStoreImpl.GetByName", "get.transaction.find.encounterError :", err)
+	}
+	return role, nil
+}
+
+// GetByOrganisation get all roles of an organisation
+func (rsi RoleStoreImpl) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.Role, *u.AppError) {
+	db = withContext(ctx, db)
+	roles := []models.Role{}
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), IDOrganisation).Order(quoteNames(db, "idRole")).Find(&roles).Error; err != nil {
+		return roles, storeError("roleStoreImpl.GetByOrganisation", "get.transaction.find.encounterError :", err)
+	}
+	return roles, nil
+}
+
+// SeedDefaults create default roles the organisation is missing
+func (rsi RoleStoreImpl) SeedDefaults(ctx context.Context, IDOrganisation uint64, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	if _, err := seedRoles(IDOrganisation, transaction); err != nil {
+		transaction.Rollback()
+		return storeError("roleStoreImpl.SeedDefaults", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// seedRoles create default roles missing in organisation inside provided transaction and return them all by name.
+func seedRoles(IDOrganisation uint64, transaction *gorm.DB) (map[string]models.Role, error) {
+	roles := map[string]models.Role{}
+	for _, role := range models.DefaultRoles(IDOrganisation) {
+		existing := models.EmptyRole
+		if !transaction.Where(quoteNames(transaction, "idOrganisation = ? AND roleName = ?"), IDOrganisation, role.RoleName).First(&existing).RecordNotFound() {
+			roles[existing.RoleName] = existing
+			continue
+		}
+		if err := transaction.Create(&role).Error; err != nil {
+			return nil, err
+		}
+		roles[role.RoleName] = role
+	}
+	return roles, nil
+}
@@ -0,0 +1,145 @@
+package datastores
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// ServiceAccountStoreImpl Used to implement ServiceAccountStore interface
+type ServiceAccountStoreImpl struct{}
+
+// ServiceAccount Generate the struct for service account store
+func (s StoreImpl) ServiceAccount() ServiceAccountStore {
+	return ServiceAccountStoreImpl{}
+}
+
+// Save Use to save service account in DB
+func (sasi ServiceAccountStoreImpl) Save(ctx context.Context, serviceAccount *models.ServiceAccount, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	serviceAccount.PreSave()
+	if appError := serviceAccount.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("serviceAccountStoreImpl.Save.serviceAccount.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(serviceAccount) {
+		transaction.Rollback()
+		return u.NewLocAppError("serviceAccountStoreImpl.Save", "save.transaction.create.already_exist", nil, "Name: "+serviceAccount.Name)
+	}
+	if err := transaction.Create(serviceAccount).Error; err != nil {
+		transaction.Rollback()
+		return storeError("serviceAccountStoreImpl.Save", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetByID get service account from its id
+func (sasi ServiceAccountStoreImpl) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.ServiceAccount, *u.AppError) {
+	db = withContext(ctx, db)
+	serviceAccount := models.EmptyServiceAccount
+	if err := db.Where(quoteNames(db, "idServiceAccount = ?"), ID).First(&serviceAccount).Error; err != nil {
+		return models.EmptyServiceAccount, storeError("serviceAccountStoreImpl.GetByID", "get.transaction.find.encounterError :", err)
+	}
+	return serviceAccount, nil
+}
+
+// GetByOrganisation get all service accounts of an organisation
+func (sasi ServiceAccountStoreImpl) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.ServiceAccount, *u.AppError) {
+	db = withContext(ctx, db)
+	serviceAccounts := []models.ServiceAccount{}
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), IDOrganisation).Order("name").Find(&serviceAccounts).Error; err != nil {
+		return serviceAccounts, storeError("serviceAccountStoreImpl.GetByOrganisation", "get.transaction.find.encounterError :", err)
+	}
+	return serviceAccounts, nil
+}
+
+// Disable disable service account and revoke all its keys in a single transaction
+func (sasi ServiceAccountStoreImpl) Disable(ctx context.Context, serviceAccount *models.ServiceAccount, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	if err := transaction.Model(&models.ServiceAccount{}).Where(quoteNames(transaction, "idServiceAccount = ?"), serviceAccount.IDServiceAccount).Update("disabled", true).Error; err != nil {
+		transaction.Rollback()
+		return storeError("serviceAccountStoreImpl.Disable", "update.transaction.updates.encounterError :", err)
+	}
+	if err := transaction.Model(&models.APIKey{}).Where(quoteNames(transaction, "idServiceAccount = ?"), serviceAccount.IDServiceAccount).Update("revoked", true).Error; err != nil {
+		transaction.Rollback()
+		return storeError("serviceAccountStoreImpl.Disable", "update.transaction.updates.encounterError :", err)
+	}
+	transaction.Commit()
+	serviceAccount.Disabled = true
+	return nil
+}
+
+// SaveAPIKey Use to save api key in DB
+func (sasi ServiceAccountStoreImpl) SaveAPIKey(ctx context.Context, apiKey *models.APIKey, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	apiKey.PreSave()
+	if appError := apiKey.IsValid(); appError != nil {
+		transaction.Rollback()
+		return u.NewLocAppError("serviceAccountStoreImpl.SaveAPIKey.apiKey.PreSave", appError.ID, nil, appError.DetailedError)
+	}
+	if !transaction.NewRecord(apiKey) {
+		transaction.Rollback()
+		return u.NewLocAppError("serviceAccountStoreImpl.SaveAPIKey", "save.transaction.create.already_exist", nil, "Prefix: "+apiKey.Prefix)
+	}
+	if err := transaction.Create(apiKey).Error; err != nil {
+		transaction.Rollback()
+		return storeError("serviceAccountStoreImpl.SaveAPIKey", "save.transaction.create.encounterError :", err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// GetAPIKeyByID get api key from its id
+func (sasi ServiceAccountStoreImpl) GetAPIKeyByID(ctx context.Context, ID uint64, db *gorm.DB) (models.APIKey, *u.AppError) {
+	db = withContext(ctx, db)
+	apiKey := models.EmptyAPIKey
+	if err := db.Where(quoteNames(db, "idAPIKey = ?"), ID).First(&apiKey).Error; err != nil {
+		return models.EmptyAPIKey, storeError("serviceAccountStoreImpl.GetAPIKeyByID", "get.transaction.find.encounterError :", err)
+	}
+	return apiKey, nil
+}
+
+// GetAPIKeyByPrefix get api key from its visible prefix
+func (sasi ServiceAccountStoreImpl) GetAPIKeyByPrefix(ctx context.Context, prefix string, db *gorm.DB) (models.APIKey, *u.AppError) {
+	db = withContext(ctx, db)
+	apiKey := models.EmptyAPIKey
+	if err := db.Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		return models.EmptyAPIKey, storeError("serviceAccountStoreImpl.GetAPIKeyByPrefix", "get.transaction.find.encounterError :", err)
+	}
+	return apiKey, nil
+}
+
+// GetAPIKeys get all keys of a service account
+func (sasi ServiceAccountStoreImpl) GetAPIKeys(ctx context.Context, IDServiceAccount uint64, db *gorm.DB) ([]models.APIKey, *u.AppError) {
+	db = withContext(ctx, db)
+	apiKeys := []models.APIKey{}
+	if err := db.Where(quoteNames(db, "idServiceAccount = ?"), IDServiceAccount).Order(quoteNames(db, "createdAt desc")).Find(&apiKeys).Error; err != nil {
+		return apiKeys, storeError("serviceAccountStoreImpl.GetAPIKeys", "get.transaction.find.encounterError :", err)
+	}
+	return apiKeys, nil
+}
+
+// RevokeAPIKey revoke an api key. It can not be used anymore.
+func (sasi ServiceAccountStoreImpl) RevokeAPIKey(ctx context.Context, apiKey *models.APIKey, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Model(&models.APIKey{}).Where(quoteNames(db, "idAPIKey = ?"), apiKey.IDAPIKey).Update("revoked", true).Error; err != nil {
+		return storeError("serviceAccountStoreImpl.RevokeAPIKey", "update.transaction.updates.encounterError :", err)
+	}
+	apiKey.Revoked = true
+	return nil
+}
+
+// TouchAPIKey record the date api key was last used
+func (sasi ServiceAccountStoreImpl) TouchAPIKey(ctx context.Context, apiKey *models.APIKey, date int64, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	if err := db.Model(&models.APIKey{}).Where(quoteNames(db, "idAPIKey = ?"), apiKey.IDAPIKey).Update("lastUsedAt", date).Error; err != nil {
+		return storeError("serviceAccountStoreImpl.TouchAPIKey", "update.transaction.updates.encounterError :", err)
+	}
+	apiKey.LastUsedAt = date
+	return nil
+}
@@ -0,0 +1,213 @@
+package datastores
+
+// sqliteMigrations schema migrations of sqlite databases. They build the schema of mysql migrations. Sqlite can not
+// add foreign keys to a table: migration 2 copies each table to a new one declaring them, as sqlite documentation
+// advises, and recreates its indexes. Parents are copied before the tables pointing to them, so no row is deleted
+// when an old table is dropped.
+var sqliteMigrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: []string{
+			`CREATE TABLE "organisations" ("idOrganisation" integer PRIMARY KEY AUTOINCREMENT, "dockerStack" integer NOT NULL UNIQUE, "organisationName" text NOT NULL UNIQUE, "public" boolean NOT NULL, "description" text, "avatar" text, "domain" text, "requireVerifiedEmail" boolean NOT NULL, "requireAdminMFA" boolean NOT NULL)`,
+			`CREATE TABLE "users" ("idUser" integer PRIMARY KEY AUTOINCREMENT, "userName" text NOT NULL UNIQUE, "email" text NOT NULL UNIQUE, "emailVerified" boolean NOT NULL, "deleted" boolean NOT NULL, "avatar" text, "password" text NOT NULL, "nickName" text UNIQUE, "firstName" text, "lastName" text, "idOrganisation" bigint NOT NULL, "idRole" bigint, "locale" text, "mfaEnabled" boolean NOT NULL, "mfaSecret" text, "mfaLastStep" bigint NOT NULL)`,
+			`CREATE TABLE "refresh_tokens" ("idRefreshToken" integer PRIMARY KEY AUTOINCREMENT, "tokenHash" text NOT NULL UNIQUE, "family" text NOT NULL, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "rotated" boolean NOT NULL, "revoked" boolean NOT NULL)`,
+			`CREATE INDEX "idx_refresh_tokens_family" ON "refresh_tokens" ("family")`,
+			`CREATE INDEX "idx_refresh_tokens_idUser" ON "refresh_tokens" ("idUser")`,
+			`CREATE TABLE "revocations" ("idRevocation" integer PRIMARY KEY AUTOINCREMENT, "kind" text NOT NULL, "subject" text NOT NULL, "revokedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL)`,
+			`CREATE UNIQUE INDEX "idx_revocation_subject" ON "revocations" ("kind", "subject")`,
+			`CREATE TABLE "invitations" ("idInvitation" integer PRIMARY KEY AUTOINCREMENT, "idInviter" bigint NOT NULL, "idInviterServiceAccount" bigint NOT NULL, "email" text NOT NULL, "idOrganisation" bigint NOT NULL, "role" text NOT NULL, "status" text NOT NULL, "invitedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL)`,
+			`CREATE INDEX "idx_invitations_email" ON "invitations" ("email")`,
+			`CREATE INDEX "idx_invitations_idOrganisation" ON "invitations" ("idOrganisation")`,
+			`CREATE TABLE "roles" ("idRole" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "roleName" text NOT NULL, "canManage" boolean NOT NULL, "canManageUser" boolean NOT NULL, "canInvite" boolean NOT NULL)`,
+			`CREATE UNIQUE INDEX "idx_role_organisation_name" ON "roles" ("idOrganisation", "roleName")`,
+			`CREATE TABLE "password_resets" ("idPasswordReset" integer PRIMARY KEY AUTOINCREMENT, "tokenHash" text NOT NULL UNIQUE, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL)`,
+			`CREATE INDEX "idx_password_resets_idUser" ON "password_resets" ("idUser")`,
+			`CREATE TABLE "recovery_codes" ("idRecoveryCode" integer PRIMARY KEY AUTOINCREMENT, "idUser" bigint NOT NULL, "codeHash" text NOT NULL UNIQUE, "used" boolean NOT NULL)`,
+			`CREATE INDEX "idx_recovery_codes_idUser" ON "recovery_codes" ("idUser")`,
+			`CREATE TABLE "service_accounts" ("idServiceAccount" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "name" text NOT NULL, "description" text, "createdAt" bigint NOT NULL, "disabled" boolean NOT NULL)`,
+			`CREATE UNIQUE INDEX "idx_service_account_organisation_name" ON "service_accounts" ("idOrganisation", "name")`,
+			`CREATE TABLE "api_keys" ("idAPIKey" integer PRIMARY KEY AUTOINCREMENT, "idServiceAccount" bigint NOT NULL, "name" text, "prefix" text NOT NULL UNIQUE, "keyHash" text NOT NULL, "scopes" text NOT NULL, "createdAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "lastUsedAt" bigint NOT NULL, "revoked" boolean NOT NULL)`,
+			`CREATE INDEX "idx_api_keys_idServiceAccount" ON "api_keys" ("idServiceAccount")`,
+			`CREATE TABLE "o_auth_clients" ("idOAuthClient" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "clientID" text NOT NULL UNIQUE, "secretHash" text, "name" text NOT NULL, "public" boolean NOT NULL, "redirectURIs" text, "grants" text NOT NULL, "scopes" text, "createdAt" bigint NOT NULL, "revoked" boolean NOT NULL)`,
+			`CREATE INDEX "idx_o_auth_clients_idOrganisation" ON "o_auth_clients" ("idOrganisation")`,
+			`CREATE TABLE "o_auth_codes" ("idOAuthCode" integer PRIMARY KEY AUTOINCREMENT, "codeHash" text NOT NULL UNIQUE, "idOAuthClient" bigint NOT NULL, "idUser" bigint NOT NULL, "redirectURI" text NOT NULL, "scope" text, "codeChallenge" text NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL, "tokenID" text, "nonce" text, "authTime" bigint NOT NULL)`,
+			`CREATE INDEX "idx_o_auth_codes_idOAuthClient" ON "o_auth_codes" ("idOAuthClient")`,
+			`CREATE INDEX "idx_o_auth_codes_idUser" ON "o_auth_codes" ("idUser")`,
+			`CREATE TABLE "identity_providers" ("idIdentityProvider" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL UNIQUE, "name" text, "issuer" text NOT NULL, "clientID" text NOT NULL, "clientSecret" text, "autoCreate" boolean NOT NULL, "enabled" boolean NOT NULL, "createdAt" bigint NOT NULL)`,
+			`CREATE TABLE "federated_identities" ("idFederatedIdentity" integer PRIMARY KEY AUTOINCREMENT, "idIdentityProvider" bigint NOT NULL, "subject" text NOT NULL, "idUser" bigint NOT NULL, "createdAt" bigint NOT NULL)`,
+			`CREATE INDEX "idx_federated_identities_idUser" ON "federated_identities" ("idUser")`,
+			`CREATE UNIQUE INDEX "idx_federated_identity_subject" ON "federated_identities" ("idIdentityProvider", "subject")`,
+			`CREATE TABLE "allowed_email_domains" ("idAllowedEmailDomain" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "domain" text NOT NULL, "includeSubdomains" boolean NOT NULL, "createdAt" bigint NOT NULL)`,
+			`CREATE UNIQUE INDEX "idx_allowed_email_domain_organisation_domain" ON "allowed_email_domains" ("idOrganisation", "domain")`,
+		},
+		Down: []string{
+			`DROP TABLE "allowed_email_domains"`,
+			`DROP TABLE "federated_identities"`,
+			`DROP TABLE "identity_providers"`,
+			`DROP TABLE "o_auth_codes"`,
+			`DROP TABLE "o_auth_clients"`,
+			`DROP TABLE "api_keys"`,
+			`DROP TABLE "service_accounts"`,
+			`DROP TABLE "recovery_codes"`,
+			`DROP TABLE "password_resets"`,
+			`DROP TABLE "roles"`,
+			`DROP TABLE "invitations"`,
+			`DROP TABLE "revocations"`,
+			`DROP TABLE "refresh_tokens"`,
+			`DROP TABLE "users"`,
+			`DROP TABLE "organisations"`,
+		},
+	},
+	{
+		// Rows belonging to an user, an OAuth client, an identity provider or a service account go with it. Rows
+		// left behind by deletions made before the keys existed are removed first.
+		Version: 2,
+		Name:    "foreign_keys",
+		Up: []string{
+			`DELETE FROM "refresh_tokens" WHERE "idUser" NOT IN (SELECT "idUser" FROM "users")`,
+			`DELETE FROM "password_resets" WHERE "idUser" NOT IN (SELECT "idUser" FROM "users")`,
+			`DELETE FROM "recovery_codes" WHERE "idUser" NOT IN (SELECT "idUser" FROM "users")`,
+			`DELETE FROM "o_auth_codes" WHERE "idUser" NOT IN (SELECT "idUser" FROM "users") OR "idOAuthClient" NOT IN (SELECT "idOAuthClient" FROM "o_auth_clients")`,
+			`DELETE FROM "federated_identities" WHERE "idUser" NOT IN (SELECT "idUser" FROM "users") OR "idIdentityProvider" NOT IN (SELECT "idIdentityProvider" FROM "identity_providers")`,
+			`DELETE FROM "api_keys" WHERE "idServiceAccount" NOT IN (SELECT "idServiceAccount" FROM "service_accounts")`,
+			`CREATE TABLE "users_new" ("idUser" integer PRIMARY KEY AUTOINCREMENT, "userName" text NOT NULL UNIQUE, "email" text NOT NULL UNIQUE, "emailVerified" boolean NOT NULL, "deleted" boolean NOT NULL, "avatar" text, "password" text NOT NULL, "nickName" text UNIQUE, "firstName" text, "lastName" text, "idOrganisation" bigint NOT NULL, "idRole" bigint, "locale" text, "mfaEnabled" boolean NOT NULL, "mfaSecret" text, "mfaLastStep" bigint NOT NULL, CONSTRAINT "fk_users_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation"))`,
+			`INSERT INTO "users_new" SELECT * FROM "users"`,
+			`DROP TABLE "users"`,
+			`ALTER TABLE "users_new" RENAME TO "users"`,
+			`CREATE INDEX "idx_users_idOrganisation" ON "users" ("idOrganisation")`,
+			`CREATE TABLE "roles_new" ("idRole" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "roleName" text NOT NULL, "canManage" boolean NOT NULL, "canManageUser" boolean NOT NULL, "canInvite" boolean NOT NULL, CONSTRAINT "fk_roles_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation"))`,
+			`INSERT INTO "roles_new" SELECT * FROM "roles"`,
+			`DROP TABLE "roles"`,
+			`ALTER TABLE "roles_new" RENAME TO "roles"`,
+			`CREATE UNIQUE INDEX "idx_role_organisation_name" ON "roles" ("idOrganisation", "roleName")`,
+			`CREATE TABLE "invitations_new" ("idInvitation" integer PRIMARY KEY AUTOINCREMENT, "idInviter" bigint NOT NULL, "idInviterServiceAccount" bigint NOT NULL, "email" text NOT NULL, "idOrganisation" bigint NOT NULL, "role" text NOT NULL, "status" text NOT NULL, "invitedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, CONSTRAINT "fk_invitations_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation"))`,
+			`INSERT INTO "invitations_new" SELECT * FROM "invitations"`,
+			`DROP TABLE "invitations"`,
+			`ALTER TABLE "invitations_new" RENAME TO "invitations"`,
+			`CREATE INDEX "idx_invitations_email" ON "invitations" ("email")`,
+			`CREATE INDEX "idx_invitations_idOrganisation" ON "invitations" ("idOrganisation")`,
+			`CREATE TABLE "service_accounts_new" ("idServiceAccount" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "name" text NOT NULL, "description" text, "createdAt" bigint NOT NULL, "disabled" boolean NOT NULL, CONSTRAINT "fk_service_accounts_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation"))`,
+			`INSERT INTO "service_accounts_new" SELECT * FROM "service_accounts"`,
+			`DROP TABLE "service_accounts"`,
+			`ALTER TABLE "service_accounts_new" RENAME TO "service_accounts"`,
+			`CREATE UNIQUE INDEX "idx_service_account_organisation_name" ON "service_accounts" ("idOrganisation", "name")`,
+			`CREATE TABLE "o_auth_clients_new" ("idOAuthClient" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "clientID" text NOT NULL UNIQUE, "secretHash" text, "name" text NOT NULL, "public" boolean NOT NULL, "redirectURIs" text, "grants" text NOT NULL, "scopes" text, "createdAt" bigint NOT NULL, "revoked" boolean NOT NULL, CONSTRAINT "fk_o_auth_clients_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation"))`,
+			`INSERT INTO "o_auth_clients_new" SELECT * FROM "o_auth_clients"`,
+			`DROP TABLE "o_auth_clients"`,
+			`ALTER TABLE "o_auth_clients_new" RENAME TO "o_auth_clients"`,
+			`CREATE INDEX "idx_o_auth_clients_idOrganisation" ON "o_auth_clients" ("idOrganisation")`,
+			`CREATE TABLE "identity_providers_new" ("idIdentityProvider" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL UNIQUE, "name" text, "issuer" text NOT NULL, "clientID" text NOT NULL, "clientSecret" text, "autoCreate" boolean NOT NULL, "enabled" boolean NOT NULL, "createdAt" bigint NOT NULL, CONSTRAINT "fk_identity_providers_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation"))`,
+			`INSERT INTO "identity_providers_new" SELECT * FROM "identity_providers"`,
+			`DROP TABLE "identity_providers"`,
+			`ALTER TABLE "identity_providers_new" RENAME TO "identity_providers"`,
+			`CREATE TABLE "allowed_email_domains_new" ("idAllowedEmailDomain" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "domain" text NOT NULL, "includeSubdomains" boolean NOT NULL, "createdAt" bigint NOT NULL, CONSTRAINT "fk_allowed_email_domains_idOrganisation" FOREIGN KEY ("idOrganisation") REFERENCES "organisations" ("idOrganisation"))`,
+			`INSERT INTO "allowed_email_domains_new" SELECT * FROM "allowed_email_domains"`,
+			`DROP TABLE "allowed_email_domains"`,
+			`ALTER TABLE "allowed_email_domains_new" RENAME TO "allowed_email_domains"`,
+			`CREATE UNIQUE INDEX "idx_allowed_email_domain_organisation_domain" ON "allowed_email_domains" ("idOrganisation", "domain")`,
+			`CREATE TABLE "refresh_tokens_new" ("idRefreshToken" integer PRIMARY KEY AUTOINCREMENT, "tokenHash" text NOT NULL UNIQUE, "family" text NOT NULL, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "rotated" boolean NOT NULL, "revoked" boolean NOT NULL, CONSTRAINT "fk_refresh_tokens_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE)`,
+			`INSERT INTO "refresh_tokens_new" SELECT * FROM "refresh_tokens"`,
+			`DROP TABLE "refresh_tokens"`,
+			`ALTER TABLE "refresh_tokens_new" RENAME TO "refresh_tokens"`,
+			`CREATE INDEX "idx_refresh_tokens_family" ON "refresh_tokens" ("family")`,
+			`CREATE INDEX "idx_refresh_tokens_idUser" ON "refresh_tokens" ("idUser")`,
+			`CREATE TABLE "password_resets_new" ("idPasswordReset" integer PRIMARY KEY AUTOINCREMENT, "tokenHash" text NOT NULL UNIQUE, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL, CONSTRAINT "fk_password_resets_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE)`,
+			`INSERT INTO "password_resets_new" SELECT * FROM "password_resets"`,
+			`DROP TABLE "password_resets"`,
+			`ALTER TABLE "password_resets_new" RENAME TO "password_resets"`,
+			`CREATE INDEX "idx_password_resets_idUser" ON "password_resets" ("idUser")`,
+			`CREATE TABLE "recovery_codes_new" ("idRecoveryCode" integer PRIMARY KEY AUTOINCREMENT, "idUser" bigint NOT NULL, "codeHash" text NOT NULL UNIQUE, "used" boolean NOT NULL, CONSTRAINT "fk_recovery_codes_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE)`,
+			`INSERT INTO "recovery_codes_new" SELECT * FROM "recovery_codes"`,
+			`DROP TABLE "recovery_codes"`,
+			`ALTER TABLE "recovery_codes_new" RENAME TO "recovery_codes"`,
+			`CREATE INDEX "idx_recovery_codes_idUser" ON "recovery_codes" ("idUser")`,
+			`CREATE TABLE "o_auth_codes_new" ("idOAuthCode" integer PRIMARY KEY AUTOINCREMENT, "codeHash" text NOT NULL UNIQUE, "idOAuthClient" bigint NOT NULL, "idUser" bigint NOT NULL, "redirectURI" text NOT NULL, "scope" text, "codeChallenge" text NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL, "tokenID" text, "nonce" text, "authTime" bigint NOT NULL, CONSTRAINT "fk_o_auth_codes_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE, CONSTRAINT "fk_o_auth_codes_idOAuthClient" FOREIGN KEY ("idOAuthClient") REFERENCES "o_auth_clients" ("idOAuthClient") ON DELETE CASCADE)`,
+			`INSERT INTO "o_auth_codes_new" SELECT * FROM "o_auth_codes"`,
+			`DROP TABLE "o_auth_codes"`,
+			`ALTER TABLE "o_auth_codes_new" RENAME TO "o_auth_codes"`,
+			`CREATE INDEX "idx_o_auth_codes_idOAuthClient" ON "o_auth_codes" ("idOAuthClient")`,
+			`CREATE INDEX "idx_o_auth_codes_idUser" ON "o_auth_codes" ("idUser")`,
+			`CREATE TABLE "federated_identities_new" ("idFederatedIdentity" integer PRIMARY KEY AUTOINCREMENT, "idIdentityProvider" bigint NOT NULL, "subject" text NOT NULL, "idUser" bigint NOT NULL, "createdAt" bigint NOT NULL, CONSTRAINT "fk_federated_identities_idUser" FOREIGN KEY ("idUser") REFERENCES "users" ("idUser") ON DELETE CASCADE, CONSTRAINT "fk_federated_identities_idIdentityProvider" FOREIGN KEY ("idIdentityProvider") REFERENCES "identity_providers" ("idIdentityProvider") ON DELETE CASCADE)`,
+			`INSERT INTO "federated_identities_new" SELECT * FROM "federated_identities"`,
+			`DROP TABLE "federated_identities"`,
+			`ALTER TABLE "federated_identities_new" RENAME TO "federated_identities"`,
+			`CREATE INDEX "idx_federated_identities_idUser" ON "federated_identities" ("idUser")`,
+			`CREATE UNIQUE INDEX "idx_federated_identity_subject" ON "federated_identities" ("idIdentityProvider", "subject")`,
+			`CREATE TABLE "api_keys_new" ("idAPIKey" integer PRIMARY KEY AUTOINCREMENT, "idServiceAccount" bigint NOT NULL, "name" text, "prefix" text NOT NULL UNIQUE, "keyHash" text NOT NULL, "scopes" text NOT NULL, "createdAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "lastUsedAt" bigint NOT NULL, "revoked" boolean NOT NULL, CONSTRAINT "fk_api_keys_idServiceAccount" FOREIGN KEY ("idServiceAccount") REFERENCES "service_accounts" ("idServiceAccount") ON DELETE CASCADE)`,
+			`INSERT INTO "api_keys_new" SELECT * FROM "api_keys"`,
+			`DROP TABLE "api_keys"`,
+			`ALTER TABLE "api_keys_new" RENAME TO "api_keys"`,
+			`CREATE INDEX "idx_api_keys_idServiceAccount" ON "api_keys" ("idServiceAccount")`,
+		},
+		Down: []string{
+			`CREATE TABLE "api_keys_new" ("idAPIKey" integer PRIMARY KEY AUTOINCREMENT, "idServiceAccount" bigint NOT NULL, "name" text, "prefix" text NOT NULL UNIQUE, "keyHash" text NOT NULL, "scopes" text NOT NULL, "createdAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "lastUsedAt" bigint NOT NULL, "revoked" boolean NOT NULL)`,
+			`INSERT INTO "api_keys_new" SELECT * FROM "api_keys"`,
+			`DROP TABLE "api_keys"`,
+			`ALTER TABLE "api_keys_new" RENAME TO "api_keys"`,
+			`CREATE INDEX "idx_api_keys_idServiceAccount" ON "api_keys" ("idServiceAccount")`,
+			`CREATE TABLE "federated_identities_new" ("idFederatedIdentity" integer PRIMARY KEY AUTOINCREMENT, "idIdentityProvider" bigint NOT NULL, "subject" text NOT NULL, "idUser" bigint NOT NULL, "createdAt" bigint NOT NULL)`,
+			`INSERT INTO "federated_identities_new" SELECT * FROM "federated_identities"`,
+			`DROP TABLE "federated_identities"`,
+			`ALTER TABLE "federated_identities_new" RENAME TO "federated_identities"`,
+			`CREATE INDEX "idx_federated_identities_idUser" ON "federated_identities" ("idUser")`,
+			`CREATE UNIQUE INDEX "idx_federated_identity_subject" ON "federated_identities" ("idIdentityProvider", "subject")`,
+			`CREATE TABLE "o_auth_codes_new" ("idOAuthCode" integer PRIMARY KEY AUTOINCREMENT, "codeHash" text NOT NULL UNIQUE, "idOAuthClient" bigint NOT NULL, "idUser" bigint NOT NULL, "redirectURI" text NOT NULL, "scope" text, "codeChallenge" text NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL, "tokenID" text, "nonce" text, "authTime" bigint NOT NULL)`,
+			`INSERT INTO "o_auth_codes_new" SELECT * FROM "o_auth_codes"`,
+			`DROP TABLE "o_auth_codes"`,
+			`ALTER TABLE "o_auth_codes_new" RENAME TO "o_auth_codes"`,
+			`CREATE INDEX "idx_o_auth_codes_idOAuthClient" ON "o_auth_codes" ("idOAuthClient")`,
+			`CREATE INDEX "idx_o_auth_codes_idUser" ON "o_auth_codes" ("idUser")`,
+			`CREATE TABLE "recovery_codes_new" ("idRecoveryCode" integer PRIMARY KEY AUTOINCREMENT, "idUser" bigint NOT NULL, "codeHash" text NOT NULL UNIQUE, "used" boolean NOT NULL)`,
+			`INSERT INTO "recovery_codes_new" SELECT * FROM "recovery_codes"`,
+			`DROP TABLE "recovery_codes"`,
+			`ALTER TABLE "recovery_codes_new" RENAME TO "recovery_codes"`,
+			`CREATE INDEX "idx_recovery_codes_idUser" ON "recovery_codes" ("idUser")`,
+			`CREATE TABLE "password_resets_new" ("idPasswordReset" integer PRIMARY KEY AUTOINCREMENT, "tokenHash" text NOT NULL UNIQUE, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "used" boolean NOT NULL)`,
+			`INSERT INTO "password_resets_new" SELECT * FROM "password_resets"`,
+			`DROP TABLE "password_resets"`,
+			`ALTER TABLE "password_resets_new" RENAME TO "password_resets"`,
+			`CREATE INDEX "idx_password_resets_idUser" ON "password_resets" ("idUser")`,
+			`CREATE TABLE "refresh_tokens_new" ("idRefreshToken" integer PRIMARY KEY AUTOINCREMENT, "tokenHash" text NOT NULL UNIQUE, "family" text NOT NULL, "idUser" bigint NOT NULL, "issuedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL, "rotated" boolean NOT NULL, "revoked" boolean NOT NULL)`,
+			`INSERT INTO "refresh_tokens_new" SELECT * FROM "refresh_tokens"`,
+			`DROP TABLE "refresh_tokens"`,
+			`ALTER TABLE "refresh_tokens_new" RENAME TO "refresh_tokens"`,
+			`CREATE INDEX "idx_refresh_tokens_family" ON "refresh_tokens" ("family")`,
+			`CREATE INDEX "idx_refresh_tokens_idUser" ON "refresh_tokens" ("idUser")`,
+			`CREATE TABLE "allowed_email_domains_new" ("idAllowedEmailDomain" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "domain" text NOT NULL, "includeSubdomains" boolean NOT NULL, "createdAt" bigint NOT NULL)`,
+			`INSERT INTO "allowed_email_domains_new" SELECT * FROM "allowed_email_domains"`,
+			`DROP TABLE "allowed_email_domains"`,
+			`ALTER TABLE "allowed_email_domains_new" RENAME TO "allowed_email_domains"`,
+			`CREATE UNIQUE INDEX "idx_allowed_email_domain_organisation_domain" ON "allowed_email_domains" ("idOrganisation", "domain")`,
+			`CREATE TABLE "identity_providers_new" ("idIdentityProvider" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL UNIQUE, "name" text, "issuer" text NOT NULL, "clientID" text NOT NULL, "clientSecret" text, "autoCreate" boolean NOT NULL, "enabled" boolean NOT NULL, "createdAt" bigint NOT NULL)`,
+			`INSERT INTO "identity_providers_new" SELECT * FROM "identity_providers"`,
+			`DROP TABLE "identity_providers"`,
+			`ALTER TABLE "identity_providers_new" RENAME TO "identity_providers"`,
+			`CREATE TABLE "o_auth_clients_new" ("idOAuthClient" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "clientID" text NOT NULL UNIQUE, "secretHash" text, "name" text NOT NULL, "public" boolean NOT NULL, "redirectURIs" text, "grants" text NOT NULL, "scopes" text, "createdAt" bigint NOT NULL, "revoked" boolean NOT NULL)`,
+			`INSERT INTO "o_auth_clients_new" SELECT * FROM "o_auth_clients"`,
+			`DROP TABLE "o_auth_clients"`,
+			`ALTER TABLE "o_auth_clients_new" RENAME TO "o_auth_clients"`,
+			`CREATE INDEX "idx_o_auth_clients_idOrganisation" ON "o_auth_clients" ("idOrganisation")`,
+			`CREATE TABLE "service_accounts_new" ("idServiceAccount" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "name" text NOT NULL, "description" text, "createdAt" bigint NOT NULL, "disabled" boolean NOT NULL)`,
+			`INSERT INTO "service_accounts_new" SELECT * FROM "service_accounts"`,
+			`DROP TABLE "service_accounts"`,
+			`ALTER TABLE "service_accounts_new" RENAME TO "service_accounts"`,
+			`CREATE UNIQUE INDEX "idx_service_account_organisation_name" ON "service_accounts" ("idOrganisation", "name")`,
+			`CREATE TABLE "invitations_new" ("idInvitation" integer PRIMARY KEY AUTOINCREMENT, "idInviter" bigint NOT NULL, "idInviterServiceAccount" bigint NOT NULL, "email" text NOT NULL, "idOrganisation" bigint NOT NULL, "role" text NOT NULL, "status" text NOT NULL, "invitedAt" bigint NOT NULL, "expiresAt" bigint NOT NULL)`,
+			`INSERT INTO "invitations_new" SELECT * FROM "invitations"`,
+			`DROP TABLE "invitations"`,
+			`ALTER TABLE "invitations_new" RENAME TO "invitations"`,
+			`CREATE INDEX "idx_invitations_email" ON "invitations" ("email")`,
+			`CREATE INDEX "idx_invitations_idOrganisation" ON "invitations" ("idOrganisation")`,
+			`CREATE TABLE "roles_new" ("idRole" integer PRIMARY KEY AUTOINCREMENT, "idOrganisation" bigint NOT NULL, "roleName" text NOT NULL, "canManage" boolean NOT NULL, "canManageUser" boolean NOT NULL, "canInvite" boolean NOT NULL)`,
+			`INSERT INTO "roles_new" SELECT * FROM "roles"`,
+			`DROP TABLE "roles"`,
+			`ALTER TABLE "roles_new" RENAME TO "roles"`,
+			`CREATE UNIQUE INDEX "idx_role_organisation_name" ON "roles" ("idOrganisation", "roleName")`,
+			`CREATE TABLE "users_new" ("idUser" integer PRIMARY KEY AUTOINCREMENT, "userName" text NOT NULL UNIQUE, "email" text NOT NULL UNIQUE, "emailVerified" boolean NOT NULL, "deleted" boolean NOT NULL, "avatar" text, "password" text NOT NULL, "nickName" text UNIQUE, "firstName" text, "lastName" text, "idOrganisation" bigint NOT NULL, "idRole" bigint, "locale" text, "mfaEnabled" boolean NOT NULL, "mfaSecret" text, "mfaLastStep" bigint NOT NULL)`,
+			`INSERT INTO "users_new" SELECT * FROM "users"`,
+			`DROP TABLE "users"`,
+			`ALTER TABLE "users_new" RENAME TO "users"`,
+		},
+	},
+}
@@ -0,0 +1,320 @@
+package datastores
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/titouanfreville/popcubeexternalapi/models"
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+// testStore store under test with its connection, holding an organisation and its user alice
+type testStore struct {
+	store        StoreInterface
+	db           *gorm.DB
+	organisation models.Organisation
+	alice        models.User
+}
+
+// newTestStores give a memory store and a sqlite one, so the same cases check both behave the same
+func newTestStores(t *testing.T) map[string]*testStore {
+	t.Helper()
+	ctx := context.Background()
+	sqlStore := StoreImpl{Driver: "sqlite"}
+	sqlDB := sqlStore.InitConnection("", filepath.Join(t.TempDir(), "popcube.db"), "", "", "")
+	if sqlDB == nil {
+		t.Fatal("can't open sqlite database")
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if apperr := sqlStore.Migration().MigrateTo(ctx, SchemaVersion, sqlDB); apperr != nil {
+		t.Fatalf("migrate: %v", apperr)
+	}
+	memoryStore := NewMemoryStore()
+	stores := map[string]*testStore{
+		"memory": {store: memoryStore, db: memoryStore.InitConnection("", "", "", "", "")},
+		"sqlite": {store: sqlStore, db: sqlDB},
+	}
+	for name, ts := range stores {
+		ts.organisation = models.Organisation{OrganisationName: "popcube", DockerStack: 1}
+		if apperr := ts.store.Organisation().Save(ctx, &ts.organisation, ts.db); apperr != nil {
+			t.Fatalf("%s: save organisation: %v", name, apperr)
+		}
+		ts.alice = newTestUser(ts.organisation, "alice")
+		if apperr := ts.store.User().Save(ctx, &ts.alice, ts.db); apperr != nil {
+			t.Fatalf("%s: save user: %v", name, apperr)
+		}
+	}
+	return stores
+}
+
+// newTestUser build a valid user of organisation
+func newTestUser(organisation models.Organisation, username string) models.User {
+	return models.User{
+		Username:       username,
+		Email:          username + "@popcube.xyz",
+		Password:       "Password1!",
+		NickName:       username,
+		IDOrganisation: organisation.IDOrganisation,
+	}
+}
+
+// errorOutcome part of an error both stores must agree on. Zero when there is no error.
+type errorOutcome struct {
+	Kind       u.ErrorKind
+	StatusCode int
+	ID         string
+}
+
+func outcome(apperr *u.AppError) errorOutcome {
+	if apperr == nil {
+		return errorOutcome{}
+	}
+	return errorOutcome{Kind: apperr.Kind, StatusCode: apperr.StatusCode, ID: apperr.ID}
+}
+
+func TestStoresBehaveTheSame(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name string
+		run  func(t *testing.T, ts *testStore) *u.AppError
+		want errorOutcome
+	}{
+		{
+			name: "new user gets member role",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				role, _ := ts.store.Role().GetByName(ctx, ts.organisation.IDOrganisation, models.RoleMember, ts.db)
+				if ts.alice.IDRole != role.IDRole || ts.alice.IDRole == 0 {
+					t.Errorf("role is %d, want member %d", ts.alice.IDRole, role.IDRole)
+				}
+				return nil
+			},
+		},
+		{
+			name: "duplicate username",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				user := newTestUser(ts.organisation, "bob")
+				user.Username = "alice"
+				return ts.store.User().Save(ctx, &user, ts.db)
+			},
+			want: errorOutcome{Kind: u.ErrorConflict, StatusCode: 409, ID: "store.record.duplicate"},
+		},
+		{
+			name: "duplicate email",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				user := newTestUser(ts.organisation, "bob")
+				user.Email = ts.alice.Email
+				return ts.store.User().Save(ctx, &user, ts.db)
+			},
+			want: errorOutcome{Kind: u.ErrorConflict, StatusCode: 409, ID: "store.record.duplicate"},
+		},
+		{
+			name: "update to a taken username",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				bob := newTestUser(ts.organisation, "bob")
+				if apperr := ts.store.User().Save(ctx, &bob, ts.db); apperr != nil {
+					return apperr
+				}
+				renamed := bob
+				renamed.Username = "alice"
+				return ts.store.User().Update(ctx, &bob, &renamed, ts.db)
+			},
+			want: errorOutcome{Kind: u.ErrorConflict, StatusCode: 409, ID: "store.record.duplicate"},
+		},
+		{
+			name: "invalid email",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				user := newTestUser(ts.organisation, "bob")
+				user.Email = "bob"
+				return ts.store.User().Save(ctx, &user, ts.db)
+			},
+			want: outcome(invalidUserError("bob")),
+		},
+		{
+			name: "duplicate empty nick name",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				bob, carol := newTestUser(ts.organisation, "bob"), newTestUser(ts.organisation, "carol")
+				bob.NickName, carol.NickName = "", ""
+				if apperr := ts.store.User().Save(ctx, &bob, ts.db); apperr != nil {
+					return apperr
+				}
+				return ts.store.User().Save(ctx, &carol, ts.db)
+			},
+			want: errorOutcome{Kind: u.ErrorConflict, StatusCode: 409, ID: "store.record.duplicate"},
+		},
+		{
+			name: "unknown user",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				_, apperr := ts.store.User().GetByID(ctx, 999, ts.db)
+				return apperr
+			},
+			want: errorOutcome{Kind: u.ErrorNotFound, StatusCode: 404, ID: "store.record.not_found"},
+		},
+		{
+			name: "login with wrong password",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				_, apperr := ts.store.User().Login(ctx, "alice", "wrong password", ts.db)
+				return apperr
+			},
+			want: errorOutcome{StatusCode: 404, ID: "wrong.user.password"},
+		},
+		{
+			name: "login by email",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				user, apperr := ts.store.User().Login(ctx, "Alice@popcube.xyz", "Password1!", ts.db)
+				if apperr == nil && user.IDUser != ts.alice.IDUser {
+					t.Errorf("logged in user %d, want %d", user.IDUser, ts.alice.IDUser)
+				}
+				return apperr
+			},
+		},
+		{
+			name: "client password hash is taken as a clear password",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				user := newTestUser(ts.organisation, "bob")
+				user.Password = models.HashPassword("Password1!")
+				hash := user.Password
+				if apperr := ts.store.User().Save(ctx, &user, ts.db); apperr != nil {
+					return apperr
+				}
+				if _, apperr := ts.store.User().Login(ctx, "bob", hash, ts.db); apperr != nil {
+					t.Errorf("can't login with the sent password: %v", apperr)
+				}
+				_, apperr := ts.store.User().Login(ctx, "bob", "Password1!", ts.db)
+				return apperr
+			},
+			want: errorOutcome{StatusCode: 404, ID: "wrong.user.password"},
+		},
+		{
+			name: "pending user gets member role once verified",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				user := newTestUser(ts.organisation, "bob")
+				user.Pending = true
+				if apperr := ts.store.User().Save(ctx, &user, ts.db); apperr != nil {
+					return apperr
+				}
+				saved, _ := ts.store.User().GetByID(ctx, user.IDUser, ts.db)
+				if saved.IDRole != 0 {
+					t.Errorf("pending user has role %d", saved.IDRole)
+				}
+				if apperr := ts.store.User().VerifyEmail(ctx, &saved, ts.db); apperr != nil {
+					return apperr
+				}
+				saved, _ = ts.store.User().GetByID(ctx, user.IDUser, ts.db)
+				if saved.IDRole != ts.alice.IDRole || !saved.EmailVerified {
+					t.Errorf("verified user has role %d, verified %v", saved.IDRole, saved.EmailVerified)
+				}
+				return nil
+			},
+		},
+		{
+			name: "users are listed by organisation",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				other := models.Organisation{OrganisationName: "other", DockerStack: 2}
+				if apperr := ts.store.Organisation().Save(ctx, &other, ts.db); apperr != nil {
+					return apperr
+				}
+				bob, carol := newTestUser(ts.organisation, "bob"), newTestUser(other, "carol")
+				for _, user := range []*models.User{&bob, &carol} {
+					if apperr := ts.store.User().Save(ctx, user, ts.db); apperr != nil {
+						return apperr
+					}
+				}
+				deleted := bob
+				deleted.Deleted = true
+				if apperr := ts.store.User().Update(ctx, &bob, &deleted, ts.db); apperr != nil {
+					return apperr
+				}
+				users, apperr := ts.store.User().GetByOrganisation(ctx, ts.organisation.IDOrganisation, ts.db)
+				if apperr != nil {
+					return apperr
+				}
+				if len(users) != 2 || users[0].IDOrganisation != ts.organisation.IDOrganisation || users[1].IDOrganisation != ts.organisation.IDOrganisation {
+					t.Errorf("organisation users are %+v", users)
+				}
+				users, apperr = ts.store.User().GetDeleted(ctx, ts.organisation.IDOrganisation, ts.db)
+				if len(users) != 1 || users[0].IDUser != bob.IDUser {
+					t.Errorf("organisation deleted users are %+v", users)
+				}
+				if users, _ = ts.store.User().GetDeleted(ctx, other.IDOrganisation, ts.db); len(users) != 0 {
+					t.Errorf("other organisation deleted users are %+v", users)
+				}
+				return apperr
+			},
+		},
+		{
+			name: "duplicate organisation name",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				organisation := models.Organisation{OrganisationName: "popcube", DockerStack: 2}
+				return ts.store.Organisation().Save(ctx, &organisation, ts.db)
+			},
+			want: errorOutcome{Kind: u.ErrorConflict, StatusCode: 409, ID: "store.record.duplicate"},
+		},
+		{
+			name: "organisation policies can be turned off",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				policies := ts.organisation
+				policies.Public, policies.RequireVerifiedEmail, policies.RequireAdminMFA = true, true, true
+				if apperr := ts.store.Organisation().Update(ctx, &ts.organisation, &policies, ts.db); apperr != nil {
+					return apperr
+				}
+				policies.Public, policies.RequireVerifiedEmail, policies.RequireAdminMFA = false, false, false
+				if apperr := ts.store.Organisation().Update(ctx, &ts.organisation, &policies, ts.db); apperr != nil {
+					return apperr
+				}
+				saved, _ := ts.store.Organisation().GetByID(ctx, ts.organisation.IDOrganisation, ts.db)
+				if saved.Public || saved.RequireVerifiedEmail || saved.RequireAdminMFA {
+					t.Errorf("policies stayed on: %+v", saved)
+				}
+				return nil
+			},
+		},
+		{
+			name: "duplicate role name",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				role := models.Role{IDOrganisation: ts.organisation.IDOrganisation, RoleName: models.RoleMember}
+				return ts.store.Role().Save(ctx, &role, ts.db)
+			},
+			want: errorOutcome{Kind: u.ErrorConflict, StatusCode: 409, ID: "store.record.duplicate"},
+		},
+		{
+			name: "invitation accepted twice",
+			run: func(t *testing.T, ts *testStore) *u.AppError {
+				invitation := models.Invitation{IDInviter: ts.alice.IDUser, Email: "bob@popcube.xyz", IDOrganisation: ts.organisation.IDOrganisation, Role: models.RoleAdmin, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+				if apperr := ts.store.Invitation().Save(ctx, &invitation, ts.db); apperr != nil {
+					return apperr
+				}
+				bob := newTestUser(ts.organisation, "bob")
+				if apperr := ts.store.Invitation().Accept(ctx, &invitation, &bob, ts.db); apperr != nil {
+					return apperr
+				}
+				admin, _ := ts.store.Role().GetByName(ctx, ts.organisation.IDOrganisation, models.RoleAdmin, ts.db)
+				if bob.IDRole != admin.IDRole {
+					t.Errorf("invited user has role %d, want %d", bob.IDRole, admin.IDRole)
+				}
+				carol := newTestUser(ts.organisation, "carol")
+				return ts.store.Invitation().Accept(ctx, &invitation, &carol, ts.db)
+			},
+			want: errorOutcome{StatusCode: 409, ID: "invitation.not.pending"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for name, ts := range newTestStores(t) {
+				if got := outcome(c.run(t, ts)); got != c.want {
+					t.Errorf("%s store: got %+v, want %+v", name, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+// invalidUserError error given by validation of user
+func invalidUserError(username string) *u.AppError {
+	user := newTestUser(models.Organisation{IDOrganisation: 1}, username)
+	user.Email = username
+	user.PreSave()
+	return u.NewLocAppError("", user.IsValid(false).ID, nil, "")
+}
@@ -1,11 +1,17 @@
 package datastores
 
 import (
+	"context"
+	"strings"
+
 	"github.com/jinzhu/gorm"
 	"github.com/titouanfreville/popcubeexternalapi/models"
 	u "github.com/titouanfreville/popcubeexternalapi/utils"
 )
 
+// dummyPasswordHash is compared when login does not match any user.
+var dummyPasswordHash = models.HashPassword("popcube-dummy-password")
+
 // UserStoreImpl Used to implement UserStore interface
 type UserStoreImpl struct{}
 
@@ -15,9 +21,10 @@ func (s StoreImpl) User() UserStore {
 }
 
 // Save Use to save user in BB
-func (usi UserStoreImpl) Save(user *models.User, db *gorm.DB) *u.AppError {
+func (usi UserStoreImpl) Save(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
 
-	transaction := db.Begin()
+	transaction := begin(db)
 	user.PreSave()
 	if appError := user.IsValid(false); appError != nil {
 		transaction.Rollback()
@@ -27,18 +34,26 @@ func (usi UserStoreImpl) Save(user *models.User, db *gorm.DB) *u.AppError {
 		transaction.Rollback()
 		return u.NewLocAppError("userStoreImpl.Save", "save.transaction.create.already_exist", nil, "User Name: "+user.Username)
 	}
+	if user.IDRole == 0 && !user.Pending {
+		role := models.EmptyRole
+		transaction.Where(quoteNames(transaction, "idOrganisation = ? AND roleName = ?"), user.IDOrganisation, models.RoleMember).First(&role)
+		user.IDRole = role.IDRole
+	}
 	if err := transaction.Create(&user).Error; err != nil {
 		transaction.Rollback()
-		return u.NewLocAppError("userStoreImpl.Save", "save.transaction.create.encounterError :"+err.Error(), nil, "")
+		return storeError("userStoreImpl.Save", "save.transaction.create.encounterError :", err)
 	}
 	transaction.Commit()
 	return nil
 }
 
 // Update Used to update user in DB
-func (usi UserStoreImpl) Update(user *models.User, newUser *models.User, db *gorm.DB) *u.AppError {
-	transaction := db.Begin()
-	// newUser.PreUpdate()
+func (usi UserStoreImpl) Update(ctx context.Context, user *models.User, newUser *models.User, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
+	newUser.PreSave()
+	// Two-factor authentication state only changes through MFA store.
+	newUser.MFAEnabled, newUser.MFASecret, newUser.MFALastStep = false, "", 0
 	if appError := user.IsValid(false); appError != nil {
 		transaction.Rollback()
 		return u.NewLocAppError("userStoreImpl.Update.userOld.PreSave", appError.ID, nil, appError.DetailedError)
@@ -49,112 +64,166 @@ func (usi UserStoreImpl) Update(user *models.User, newUser *models.User, db *gor
 	}
 	if err := transaction.Model(&user).Updates(&newUser).Error; err != nil {
 		transaction.Rollback()
-		return u.NewLocAppError("userStoreImpl.Update", "update.transaction.updates.encounterError :"+err.Error(), nil, "")
+		return storeError("userStoreImpl.Update", "update.transaction.updates.encounterError :", err)
 	}
 	transaction.Commit()
 	return nil
 }
 
 // GetAll Used to get user from DB
-func (usi UserStoreImpl) GetAll(db *gorm.DB) []models.User {
+func (usi UserStoreImpl) GetAll(ctx context.Context, db *gorm.DB) ([]models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	users := []models.User{}
-	db.Find(&users)
-	return users
+	if err := db.Find(&users).Error; err != nil {
+		return users, storeError("userStoreImpl.GetAll", "get.transaction.find.encounterError :", err)
+	}
+	return users, nil
 }
 
 // GetByID Used to get user from DB
-func (usi UserStoreImpl) GetByID(ID uint64, db *gorm.DB) models.User {
+func (usi UserStoreImpl) GetByID(ctx context.Context, ID uint64, db *gorm.DB) (models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	user := models.EmptyUser
-	db.Where("idUser = ?", ID).First(&user)
-	return user
+	if err := db.Where(quoteNames(db, "idUser = ?"), ID).First(&user).Error; err != nil {
+		return models.EmptyUser, storeError("userStoreImpl.GetByID", "get.transaction.find.encounterError :", err)
+	}
+	return user, nil
 }
 
 // GetByUserName Used to get user from DB
-func (usi UserStoreImpl) GetByUserName(userName string, db *gorm.DB) models.User {
+func (usi UserStoreImpl) GetByUserName(ctx context.Context, userName string, db *gorm.DB) (models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	user := models.EmptyUser
-	db.Where("userName = ?", userName).First(&user)
-	return user
-}
-
-// Login Used to log user in
-// func (usi UserStoreImpl) Login(login string, pass string, db *gorm.DB) (models.User, *u.AppError) {
-// 	user1 := models.EmptyUser
-// 	user2 := models.EmptyUser
-// 	empty := models.EmptyUser
-// 	err := u.NewAPIError(404, "Wrong user name or password", "Can't proceed to login. Password or user name is not correct")
-// 	db.Where("userName = ?", login).First(&user1)
-// 	db.Where("email = ?", login).First(&user2)
-// 	if user1 == models.EmptyUser && user2 == models.EmptyUser {
-// 		return empty, err
-// 	}
-// 	if models.ComparePassword(user1.Password, pass) {
-// 		return user1, nil
-// 	}
-// 	if models.ComparePassword(user2.Password, pass) {
-// 		return user2, nil
-// 	}
-// 	return empty, err
-// }
+	if err := db.Where(quoteNames(db, "userName = ?"), userName).First(&user).Error; err != nil {
+		return models.EmptyUser, storeError("userStoreImpl.GetByUserName", "get.transaction.find.encounterError :", err)
+	}
+	return user, nil
+}
+
+// Login Used to log user in. Login can either be the user name or the email.
+func (usi UserStoreImpl) Login(ctx context.Context, login string, pass string, db *gorm.DB) (models.User, *u.AppError) {
+	db = withContext(ctx, db)
+	user := models.EmptyUser
+	err := u.NewAPIError(404, "wrong.user.password", "Can't proceed to login. Password or user name is not correct")
+	login = strings.ToLower(login)
+	if dbErr := db.Where(quoteNames(db, "userName = ? OR email = ?"), login, login).First(&user).Error; dbErr != nil {
+		if dbErr != gorm.ErrRecordNotFound {
+			return models.EmptyUser, storeError("userStoreImpl.Login", "get.transaction.find.encounterError :", dbErr)
+		}
+		// Still compare a password so unknown users answer in the same time as known ones.
+		models.ComparePassword(dummyPasswordHash, pass)
+		return models.EmptyUser, err
+	}
+	if user.Deleted || !models.ComparePassword(user.Password, pass) {
+		return models.EmptyUser, err
+	}
+	if models.PasswordNeedsRehash(user.Password) {
+		if hash := models.HashPassword(pass); hash != "" {
+			db.Model(&user).Update("password", hash)
+		}
+	}
+	return user, nil
+}
+
+// VerifyEmail mark user email as verified. Pending users, which have no role yet, get the member role.
+func (usi UserStoreImpl) VerifyEmail(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	updates := map[string]interface{}{"emailVerified": true}
+	if user.IDRole == 0 {
+		role := models.EmptyRole
+		if err := db.Where(quoteNames(db, "idOrganisation = ? AND roleName = ?"), user.IDOrganisation, models.RoleMember).First(&role).Error; err != nil {
+			return storeError("userStoreImpl.VerifyEmail", "update.transaction.find.encounterError :", err)
+		}
+		updates["idRole"] = role.IDRole
+	}
+	if err := db.Model(user).Updates(updates).Error; err != nil {
+		return storeError("userStoreImpl.VerifyEmail", "update.transaction.updates.encounterError :", err)
+	}
+	user.EmailVerified = true
+	return nil
+}
 
 // GetByEmail Used to get user from DB by email
-func (usi UserStoreImpl) GetByEmail(userEmail string, db *gorm.DB) models.User {
+func (usi UserStoreImpl) GetByEmail(ctx context.Context, userEmail string, db *gorm.DB) (models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	user := models.EmptyUser
-	db.Where("email = ?", userEmail).First(&user)
-	return user
+	if err := db.Where("email = ?", userEmail).First(&user).Error; err != nil {
+		return models.EmptyUser, storeError("userStoreImpl.GetByEmail", "get.transaction.find.encounterError :", err)
+	}
+	return user, nil
 }
 
 // GetOrderedByDate get all users ordered by date
-func (usi UserStoreImpl) GetOrderedByDate(userDate int, db *gorm.DB) []models.User {
+func (usi UserStoreImpl) GetOrderedByDate(ctx context.Context, userDate int, db *gorm.DB) ([]models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	users := []models.User{}
-	db.Order("lastUpdate, userName, email").Find(&users)
-	return users
+	if err := db.Order(quoteNames(db, "lastUpdate, userName, email")).Find(&users).Error; err != nil {
+		return users, storeError("userStoreImpl.GetOrderedByDate", "get.transaction.find.encounterError :", err)
+	}
+	return users, nil
 }
 
-// GetDeleted get deleted users
-func (usi UserStoreImpl) GetDeleted(db *gorm.DB) []models.User {
+// GetDeleted get deleted users of an organisation
+func (usi UserStoreImpl) GetDeleted(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	users := []models.User{}
-	db.Where("deleted = ?", true).First(&users)
-	return users
+	if err := db.Where(quoteNames(db, "idOrganisation = ? AND deleted = ?"), IDOrganisation, true).Find(&users).Error; err != nil {
+		return users, storeError("userStoreImpl.GetDeleted", "get.transaction.find.encounterError :", err)
+	}
+	return users, nil
 }
 
 // GetByNickName get user from nick name
-func (usi UserStoreImpl) GetByNickName(nickName string, db *gorm.DB) models.User {
+func (usi UserStoreImpl) GetByNickName(ctx context.Context, nickName string, db *gorm.DB) (models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	user := models.EmptyUser
-	db.Where("nickName = ?", nickName).First(&user)
-	return user
+	if err := db.Where(quoteNames(db, "nickName = ?"), nickName).First(&user).Error; err != nil {
+		return models.EmptyUser, storeError("userStoreImpl.GetByNickName", "get.transaction.find.encounterError :", err)
+	}
+	return user, nil
 }
 
 // GetByFirstName get user by first name
-func (usi UserStoreImpl) GetByFirstName(firstName string, db *gorm.DB) []models.User {
+func (usi UserStoreImpl) GetByFirstName(ctx context.Context, firstName string, db *gorm.DB) ([]models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	users := []models.User{}
-	db.Where("firstName = ?", firstName).Find(&users)
-	return users
+	if err := db.Where(quoteNames(db, "firstName = ?"), firstName).Find(&users).Error; err != nil {
+		return users, storeError("userStoreImpl.GetByFirstName", "get.transaction.find.encounterError :", err)
+	}
+	return users, nil
 }
 
 // GetByLastName get user from last name
-func (usi UserStoreImpl) GetByLastName(lastName string, db *gorm.DB) []models.User {
+func (usi UserStoreImpl) GetByLastName(ctx context.Context, lastName string, db *gorm.DB) ([]models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	users := []models.User{}
-	db.Where("lastName = ?", lastName).Find(&users)
-	return users
+	if err := db.Where(quoteNames(db, "lastName = ?"), lastName).Find(&users).Error; err != nil {
+		return users, storeError("userStoreImpl.GetByLastName", "get.transaction.find.encounterError :", err)
+	}
+	return users, nil
 }
 
-// GetByOrganisation get user from organisation
-func (usi UserStoreImpl) GetByOrganisation(organisation *models.Organisation, db *gorm.DB) []models.User {
+// GetByOrganisation get users of an organisation
+func (usi UserStoreImpl) GetByOrganisation(ctx context.Context, IDOrganisation uint64, db *gorm.DB) ([]models.User, *u.AppError) {
+	db = withContext(ctx, db)
 	users := []models.User{}
-	db.Table("users").Select("*").Joins("natural join organisation").Where("organisation.idOrganisation = ?", organisation.IDOrganisation).Find(&users)
-	return users
+	if err := db.Where(quoteNames(db, "idOrganisation = ?"), IDOrganisation).Find(&users).Error; err != nil {
+		return users, storeError("userStoreImpl.GetByOrganisation", "get.transaction.find.encounterError :", err)
+	}
+	return users, nil
 }
 
 // Delete Used to get user from DB
-func (usi UserStoreImpl) Delete(user *models.User, db *gorm.DB) *u.AppError {
-	transaction := db.Begin()
+func (usi UserStoreImpl) Delete(ctx context.Context, user *models.User, db *gorm.DB) *u.AppError {
+	db = withContext(ctx, db)
+	transaction := begin(db)
 	if appError := user.IsValid(true); appError != nil {
 		transaction.Rollback()
 		return u.NewLocAppError("userStoreImpl.Delete.user.PreSave", appError.ID, nil, appError.DetailedError)
 	}
 	if err := transaction.Delete(&user).Error; err != nil {
 		transaction.Rollback()
-		return u.NewLocAppError("userStoreImpl.Delete", "update.transaction.delete.encounterError :"+err.Error(), nil, "")
+		return storeError("userStoreImpl.Delete", "update.transaction.delete.encounterError :", err)
 	}
 	transaction.Commit()
 	return nil
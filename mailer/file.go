@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer drop each message as an .eml file in Dir instead of sending it. Used in development.
+type FileMailer struct {
+	Dir string
+	// From address messages are sent from
+	From string
+}
+
+// Send implements Mailer
+func (fm FileMailer) Send(message Message) error {
+	if err := os.MkdirAll(fm.Dir, 0755); err != nil {
+		return err
+	}
+	recipient := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, message.To)
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + recipient + ".eml"
+	return ioutil.WriteFile(filepath.Join(fm.Dir, name), message.Bytes(fm.From), 0644)
+}
+
+// MemoryMailer keep messages in memory instead of sending them. Used in tests.
+type MemoryMailer struct {
+	mutex    sync.Mutex
+	messages []Message
+}
+
+// Send implements Mailer
+func (mm *MemoryMailer) Send(message Message) error {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	mm.messages = append(mm.messages, message)
+	return nil
+}
+
+// Messages get a copy of the messages sent so far
+func (mm *MemoryMailer) Messages() []Message {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	return append([]Message{}, mm.messages...)
+}
+
+// Reset forget messages sent so far
+func (mm *MemoryMailer) Reset() {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	mm.messages = nil
+}
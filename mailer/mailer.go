@@ -0,0 +1,111 @@
+// Package mailer send emails to PopCube users (verification links, password resets, invitations, ...).
+//
+// Mailer implementations deliver messages: SMTPMailer for production, FileMailer and MemoryMailer for development
+// and tests, LogMailer when nothing is configured. Queue wrap any of them to send in background with retries.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message email sent by the api
+type Message struct {
+	// To recipient email address
+	To string
+	// Subject of the email
+	Subject string
+	// Text plain text content of the email
+	Text string
+	// HTML content of the email. Optional, email is sent as plain text only if empty.
+	HTML string
+}
+
+// Mailer send messages to users
+type Mailer interface {
+	Send(message Message) error
+}
+
+// LogMailer write messages into the log instead of sending them. Used when no mail server is configured.
+type LogMailer struct{}
+
+// Send implements Mailer
+func (lm LogMailer) Send(message Message) error {
+	log.Printf("Mail to %s: %s\n%s", message.To, message.Subject, message.Text)
+	return nil
+}
+
+// Bytes encode message as a MIME email sent from provided address
+func (message Message) Bytes(from string) []byte {
+	var buffer bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	header.Set("To", message.To)
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", "<"+randomID()+"@"+domainOf(from)+">")
+	header.Set("MIME-Version", "1.0")
+	if message.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buffer, header)
+		writeQuotedPrintable(&buffer, message.Text)
+		return buffer.Bytes()
+	}
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	header.Set("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		writer, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		writeQuotedPrintable(writer, part.content)
+	}
+	parts.Close()
+	writeHeader(&buffer, header)
+	buffer.Write(body.Bytes())
+	return buffer.Bytes()
+}
+
+func writeHeader(buffer *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, key := range []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(buffer, "%s: %s\r\n", key, value)
+		}
+	}
+	buffer.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(writer io.Writer, content string) {
+	encoder := quotedprintable.NewWriter(writer)
+	encoder.Write([]byte(strings.Replace(content, "\n", "\r\n", -1)))
+	encoder.Close()
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domainOf(address string) string {
+	address = strings.TrimSuffix(address, ">")
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return address[at+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull too many messages are waiting to be sent
+	ErrQueueFull = errors.New("mailer: queue is full")
+	// ErrQueueClosed queue does not accept messages anymore
+	ErrQueueClosed = errors.New("mailer: queue is closed")
+)
+
+// Queue send messages in background through another Mailer. Failed sends are retried with an exponential backoff
+// until MaxAttempts is reached, then message is dropped and logged.
+type Queue struct {
+	mailer      Mailer
+	messages    chan Message
+	maxAttempts int
+	backoff     time.Duration
+	mutex       sync.RWMutex
+	closed      bool
+	done        sync.WaitGroup
+}
+
+// NewQueue create a queue of size messages sending through mailer and start its worker.
+func NewQueue(mailer Mailer, size int, maxAttempts int, backoff time.Duration) *Queue {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	queue := &Queue{
+		mailer:      mailer,
+		messages:    make(chan Message, size),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+	queue.done.Add(1)
+	go queue.work()
+	return queue
+}
+
+// Send implements Mailer. Message is only queued: delivery errors are logged by the worker.
+func (q *Queue) Send(message Message) error {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.messages <- message:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stop accepting messages and wait for queued ones to be sent
+func (q *Queue) Close() {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mutex.Unlock()
+	q.done.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.done.Done()
+	for message := range q.messages {
+		q.deliver(message)
+	}
+}
+
+func (q *Queue) deliver(message Message) {
+	delay := q.backoff
+	for attempt := 1; ; attempt++ {
+		err := q.mailer.Send(message)
+		if err == nil {
+			return
+		}
+		if attempt >= q.maxAttempts {
+			log.Printf("Mail to %s dropped after %d attempts: %s", message.To, attempt, err.Error())
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
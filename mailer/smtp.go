@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+)
+
+var (
+	// ErrNoStartTLS server does not offer STARTTLS while it is required
+	ErrNoStartTLS = errors.New("mailer: smtp server does not support STARTTLS")
+)
+
+// SMTPMailer send messages through an SMTP server. Connection is upgraded with STARTTLS when the server offers it,
+// and credentials are only sent over TLS.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// From address messages are sent from
+	From string
+	// RequireTLS refuse to send messages if server does not offer STARTTLS
+	RequireTLS bool
+	// TLSConfig used for STARTTLS. Default one check the certificate against Host.
+	TLSConfig *tls.Config
+}
+
+// Send implements Mailer
+func (sm SMTPMailer) Send(message Message) error {
+	client, err := smtp.Dial(net.JoinHostPort(sm.Host, sm.Port))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := sm.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: sm.Host}
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	} else if sm.RequireTLS {
+		return ErrNoStartTLS
+	}
+	if sm.Username != "" {
+		// PlainAuth refuse to send credentials on a clear connection, except to localhost.
+		if err := client.Auth(smtp.PlainAuth("", sm.Username, sm.Password, sm.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(sm.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(message.To); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message.Bytes(sm.From)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
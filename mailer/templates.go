@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"path/filepath"
+	texttemplate "text/template"
+
+	"github.com/nicksnyder/go-i18n/i18n/bundle"
+	"github.com/nicksnyder/go-i18n/i18n/language"
+)
+
+var (
+	// ErrUnknownTemplate no template exists for message type
+	ErrUnknownTemplate = errors.New("mailer: unknown message template")
+	// ErrNoTemplates templates directory does not contain templates for the default locale
+	ErrNoTemplates = errors.New("mailer: no templates found for default locale")
+)
+
+// Templates render messages from Go templates, one set per locale.
+//
+// Templates directory holds a go-i18n translation file per locale (en.all.json, fr.all.json, ...) giving message
+// subjects under "mail.<type>.subject", and a directory per locale with <type>.txt text/template files and optional
+// <type>.html html/template files. Locale of a message is picked by go-i18n from recipient preferences.
+type Templates struct {
+	bundle        *bundle.Bundle
+	defaultLocale string
+	text          map[string]*texttemplate.Template
+	html          map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parse templates from dir. defaultLocale is used when recipient preferences can not be satisfied.
+func LoadTemplates(dir string, defaultLocale string) (*Templates, error) {
+	templates := &Templates{
+		bundle:        bundle.New(),
+		defaultLocale: language.NormalizeTag(defaultLocale),
+		text:          map[string]*texttemplate.Template{},
+		html:          map[string]*htmltemplate.Template{},
+	}
+	translationFiles, err := filepath.Glob(filepath.Join(dir, "*.all.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, translationFile := range translationFiles {
+		if err := templates.bundle.LoadTranslationFile(translationFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, locale := range templates.bundle.LanguageTags() {
+		textFiles, _ := filepath.Glob(filepath.Join(dir, locale, "*.txt"))
+		if len(textFiles) > 0 {
+			textTemplates, err := texttemplate.ParseFiles(textFiles...)
+			if err != nil {
+				return nil, err
+			}
+			templates.text[locale] = textTemplates
+		}
+		htmlFiles, _ := filepath.Glob(filepath.Join(dir, locale, "*.html"))
+		if len(htmlFiles) > 0 {
+			htmlTemplates, err := htmltemplate.ParseFiles(htmlFiles...)
+			if err != nil {
+				return nil, err
+			}
+			templates.html[locale] = htmlTemplates
+		}
+	}
+	if templates.text[templates.defaultLocale] == nil {
+		return nil, ErrNoTemplates
+	}
+	return templates, nil
+}
+
+// Render build message of provided type from data, in the first locale of preferences having templates.
+// Preferences can be language tags or Accept-Language headers. Recipient has to be set by caller.
+func (t *Templates) Render(messageType string, data interface{}, preferences ...string) (Message, error) {
+	locale := t.locale(preferences)
+	T, err := t.bundle.Tfunc(locale)
+	if err != nil {
+		return Message{}, err
+	}
+	textTemplate := t.text[locale].Lookup(messageType + ".txt")
+	if textTemplate == nil {
+		return Message{}, ErrUnknownTemplate
+	}
+	var text bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	message := Message{
+		Subject: T("mail."+messageType+".subject", data),
+		Text:    text.String(),
+	}
+	if htmlTemplates := t.html[locale]; htmlTemplates != nil {
+		if htmlTemplate := htmlTemplates.Lookup(messageType + ".html"); htmlTemplate != nil {
+			var html bytes.Buffer
+			if err := htmlTemplate.Execute(&html, data); err != nil {
+				return Message{}, err
+			}
+			message.HTML = html.String()
+		}
+	}
+	return message, nil
+}
+
+// locale get the first preferred locale having templates. Regional preferences (fr-ca) fall back on
+// their language (fr) before going to the next preference.
+func (t *Templates) locale(preferences []string) string {
+	for _, preference := range preferences {
+		for _, lang := range language.Parse(preference) {
+			tags := lang.MatchingTags()
+			for i := len(tags) - 1; i >= 0; i-- {
+				if _, supported, err := t.bundle.TfuncAndLanguage(tags[i]); err == nil && t.text[supported.Tag] != nil {
+					return supported.Tag
+				}
+			}
+		}
+	}
+	return t.defaultLocale
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"log"
+	"os"
+
 	"github.com/titouanfreville/popcubeexternalapi/api"
 	"github.com/titouanfreville/popcubeexternalapi/configs"
 	"github.com/titouanfreville/popcubeexternalapi/datastores"
@@ -21,17 +24,32 @@ func initAPI() {
 	api.StartAPI(APIServer.Hostname, APIServer.Port, DbConnectionInfo)
 }
 
+// useDatastore set datastore of configured backend as the one used
+func useDatastore() {
+	store, err := datastores.NewStore(DbConnectionInfo.Backend, DbConnectionInfo.Driver)
+	if err != nil {
+		log.Fatal("Can't use datastore " + DbConnectionInfo.Backend + " (" + DbConnectionInfo.Driver + "): " + err.Error())
+	}
+	datastores.UseStore(store)
+}
+
 func initDatastore() {
+	useDatastore()
 	user := DbConnectionInfo.User
 	db := DbConnectionInfo.Database
 	pass := DbConnectionInfo.Password
 	host := DbConnectionInfo.Host
 	port := DbConnectionInfo.Port
-	datastores.Store().InitDatabase(user, db, pass, host, port)
+	if apperr := datastores.Store().InitDatabase(user, db, pass, host, port); apperr != nil {
+		log.Fatal("Can't use database: " + apperr.Error())
+	}
 }
 
 func main() {
 	getConf(DbConnectionInfo, APIServer)
+	if runCommand(os.Args[1:]) {
+		return
+	}
 	initDatastore()
 	initAPI()
 }
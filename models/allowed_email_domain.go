@@ -0,0 +1,105 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	// EmptyAllowedEmailDomain empty allowed email domain var
+	EmptyAllowedEmailDomain = AllowedEmailDomain{}
+)
+
+// AllowedEmailDomain object
+//
+// Email domain of an organisation. Users with an email in it can join the organisation without invitation.
+// Domain is stored in lower case ASCII form, internationalised domains are punycode encoded.
+//
+// swagger:model
+type AllowedEmailDomain struct {
+	// id of the domain
+	//
+	// min: 0
+	IDAllowedEmailDomain uint64 `gorm:"primary_key;column:idAllowedEmailDomain;AUTO_INCREMENT" json:"id,omitempty"`
+	// Organisation the domain belongs to
+	//
+	// required: true
+	IDOrganisation uint64 `gorm:"column:idOrganisation; not null; unique_index:idx_allowed_email_domain_organisation_domain" json:"id_organisation,omitempty"`
+	// Domain name, like popcube.xyz
+	//
+	// required: true
+	// max length: 253
+	Domain string `gorm:"column:domain; not null; unique_index:idx_allowed_email_domain_organisation_domain" json:"domain,omitempty"`
+	// State if emails of subdomains, like team.popcube.xyz, are allowed too
+	IncludeSubdomains bool `gorm:"column:includeSubdomains; not null" json:"include_subdomains"`
+	// Creation date as unix time
+	CreatedAt int64 `gorm:"column:createdAt; not null" json:"created_at,omitempty"`
+}
+
+// Bind method used in API
+func (allowedEmailDomain *AllowedEmailDomain) Bind(r *http.Request) error {
+	return nil
+}
+
+// IsValid check validity of allowed email domain object
+func (allowedEmailDomain *AllowedEmailDomain) IsValid() *u.AppError {
+	id := "id=" + strconv.FormatUint(allowedEmailDomain.IDAllowedEmailDomain, 10)
+	if allowedEmailDomain.IDOrganisation == 0 {
+		return u.NewLocAppError("AllowedEmailDomain.IsValid", "model.allowed_email_domain.is_valid.id_organisation.app_error", nil, id)
+	}
+	// A single label would allow a whole top level domain.
+	if domain, ok := u.DomainToASCII(allowedEmailDomain.Domain); !ok || domain != allowedEmailDomain.Domain || !strings.Contains(domain, ".") {
+		return u.NewLocAppError("AllowedEmailDomain.IsValid", "model.allowed_email_domain.is_valid.domain.app_error", nil, id)
+	}
+	return nil
+}
+
+// PreSave set creation date and store domain in ASCII form
+func (allowedEmailDomain *AllowedEmailDomain) PreSave() {
+	if allowedEmailDomain.CreatedAt == 0 {
+		allowedEmailDomain.CreatedAt = time.Now().UTC().Unix()
+	}
+	if domain, ok := u.DomainToASCII(allowedEmailDomain.Domain); ok {
+		allowedEmailDomain.Domain = domain
+	}
+}
+
+// Matches state if email belongs to the domain. Subdomains only match if they are included.
+func (allowedEmailDomain *AllowedEmailDomain) Matches(email string) bool {
+	domain := EmailDomain(email)
+	if domain == "" {
+		return false
+	}
+	if domain == allowedEmailDomain.Domain {
+		return true
+	}
+	return allowedEmailDomain.IncludeSubdomains && strings.HasSuffix(domain, "."+allowedEmailDomain.Domain)
+}
+
+// EmailDomain get the ASCII form of the domain of an email. Returns an empty string if it is not valid.
+func EmailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	domain, ok := u.DomainToASCII(email[i+1:])
+	if !ok {
+		return ""
+	}
+	return domain
+}
+
+// ParentDomains get domain and all its parents with at least two labels: a.b.c.d gives a.b.c.d, b.c.d and c.d.
+// They are the domains an allowed email domain has to be to match.
+func ParentDomains(domain string) []string {
+	domains := []string{}
+	for strings.Contains(domain, ".") {
+		domains = append(domains, domain)
+		domain = domain[strings.Index(domain, ".")+1:]
+	}
+	return domains
+}
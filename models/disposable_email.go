@@ -0,0 +1,45 @@
+package models
+
+import (
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	// DisposableEmailDomains domains of throwaway mailboxes refused on public signup. Subdomains are refused too.
+	DisposableEmailDomains = []string{
+		"10minutemail.com",
+		"discard.email",
+		"dispostable.com",
+		"fakeinbox.com",
+		"getairmail.com",
+		"getnada.com",
+		"guerrillamail.com",
+		"guerrillamail.net",
+		"guerrillamailblock.com",
+		"maildrop.cc",
+		"mailinator.com",
+		"mailnesia.com",
+		"mintemail.com",
+		"mohmal.com",
+		"mytemp.email",
+		"sharklasers.com",
+		"spamgourmet.com",
+		"temp-mail.org",
+		"tempail.com",
+		"tempmail.net",
+		"tempr.email",
+		"throwawaymail.com",
+		"trashmail.com",
+		"yopmail.com",
+	}
+)
+
+// IsDisposableEmail state if email belongs to a disposable email domain
+func IsDisposableEmail(email string) bool {
+	for _, domain := range ParentDomains(EmailDomain(email)) {
+		if u.StringInArray(domain, DisposableEmailDomains) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	identityProviderNameMaxRunes = 64
+	// federatedUsernameMaxLength leave room for the suffix added when username is taken
+	federatedUsernameMaxLength = 56
+)
+
+var (
+	// EmptyIdentityProvider empty identity provider var
+	EmptyIdentityProvider = IdentityProvider{}
+	// EmptyFederatedIdentity empty federated identity var
+	EmptyFederatedIdentity = FederatedIdentity{}
+)
+
+// IdentityProvider object
+//
+// Upstream OpenID Connect provider users of an organisation can login with. An organisation has at most one.
+// Endpoints are discovered from the issuer.
+//
+// swagger:model
+type IdentityProvider struct {
+	// id of the identity provider
+	//
+	// min: 0
+	IDIdentityProvider uint64 `gorm:"primary_key;column:idIdentityProvider;AUTO_INCREMENT" json:"id,omitempty"`
+	// Organisation using the provider
+	//
+	// required: true
+	IDOrganisation uint64 `gorm:"column:idOrganisation; not null; unique" json:"id_organisation,omitempty"`
+	// Name shown on the login button
+	//
+	// max length: 64
+	Name string `gorm:"column:name" json:"name,omitempty"`
+	// Issuer url of the provider. Its discovery document is read from /.well-known/openid-configuration.
+	//
+	// required: true
+	Issuer string `gorm:"column:issuer; not null" json:"issuer,omitempty"`
+	// Client id registered for PopCube on the provider
+	//
+	// required: true
+	ClientID string `gorm:"column:clientID; not null" json:"client_id,omitempty"`
+	// Client secret registered for PopCube on the provider. It is needed in clear to call the provider, and never sent back.
+	ClientSecret string `gorm:"column:clientSecret" json:"-"`
+	// State if users logging in for the first time get an account. Otherwise only existing users can login.
+	AutoCreate bool `gorm:"column:autoCreate; not null" json:"auto_create"`
+	// State if provider can be used
+	Enabled bool `gorm:"column:enabled; not null" json:"enabled"`
+	// Creation date as unix time
+	CreatedAt int64 `gorm:"column:createdAt; not null" json:"created_at,omitempty"`
+}
+
+// Bind method used in API
+func (identityProvider *IdentityProvider) Bind(r *http.Request) error {
+	return nil
+}
+
+// IsValid check validity of identity provider object
+func (identityProvider *IdentityProvider) IsValid() *u.AppError {
+	id := "id=" + strconv.FormatUint(identityProvider.IDIdentityProvider, 10)
+	if identityProvider.IDOrganisation == 0 {
+		return u.NewLocAppError("IdentityProvider.IsValid", "model.identity_provider.is_valid.id_organisation.app_error", nil, id)
+	}
+	if len([]rune(identityProvider.Name)) > identityProviderNameMaxRunes {
+		return u.NewLocAppError("IdentityProvider.IsValid", "model.identity_provider.is_valid.name.app_error", nil, id)
+	}
+	if !IsValidIssuer(identityProvider.Issuer) {
+		return u.NewLocAppError("IdentityProvider.IsValid", "model.identity_provider.is_valid.issuer.app_error", nil, id)
+	}
+	if identityProvider.ClientID == "" {
+		return u.NewLocAppError("IdentityProvider.IsValid", "model.identity_provider.is_valid.client_id.app_error", nil, id)
+	}
+	return nil
+}
+
+// PreSave set creation date and normalise issuer
+func (identityProvider *IdentityProvider) PreSave() {
+	if identityProvider.CreatedAt == 0 {
+		identityProvider.CreatedAt = time.Now().UTC().Unix()
+	}
+	identityProvider.Issuer = strings.TrimRight(identityProvider.Issuer, "/")
+}
+
+// IsValidIssuer state if url can be used as an OpenID Connect issuer: same rules as redirect uris, without query.
+// Plain http is only accepted on the local machine, to test against a stub provider.
+func IsValidIssuer(issuer string) bool {
+	parsed, err := url.Parse(issuer)
+	return err == nil && parsed.RawQuery == "" && IsValidRedirectURI(issuer)
+}
+
+// FederatedIdentity object
+//
+// Link between an user and its account on the identity provider of its organisation.
+//
+// swagger:model
+type FederatedIdentity struct {
+	// id of the link
+	//
+	// min: 0
+	IDFederatedIdentity uint64 `gorm:"primary_key;column:idFederatedIdentity;AUTO_INCREMENT" json:"id,omitempty"`
+	// Provider the identity comes from
+	//
+	// required: true
+	IDIdentityProvider uint64 `gorm:"column:idIdentityProvider; not null; unique_index:idx_federated_identity_subject" json:"id_identity_provider,omitempty"`
+	// "sub" claim of the user on the provider
+	//
+	// required: true
+	Subject string `gorm:"column:subject; not null; unique_index:idx_federated_identity_subject" json:"subject,omitempty"`
+	// User logged in by the identity
+	//
+	// required: true
+	IDUser uint64 `gorm:"column:idUser; not null; index" json:"id_user,omitempty"`
+	// Creation date as unix time
+	CreatedAt int64 `gorm:"column:createdAt; not null" json:"created_at,omitempty"`
+}
+
+// IsValid check validity of federated identity object
+func (identity *FederatedIdentity) IsValid() *u.AppError {
+	if identity.IDIdentityProvider == 0 {
+		return u.NewLocAppError("FederatedIdentity.IsValid", "model.federated_identity.is_valid.id_identity_provider.app_error", nil, "")
+	}
+	if identity.Subject == "" || len(identity.Subject) > 255 {
+		return u.NewLocAppError("FederatedIdentity.IsValid", "model.federated_identity.is_valid.subject.app_error", nil, "")
+	}
+	if identity.IDUser == 0 {
+		return u.NewLocAppError("FederatedIdentity.IsValid", "model.federated_identity.is_valid.id_user.app_error", nil, "")
+	}
+	return nil
+}
+
+// PreSave set creation date
+func (identity *FederatedIdentity) PreSave() {
+	if identity.CreatedAt == 0 {
+		identity.CreatedAt = time.Now().UTC().Unix()
+	}
+}
+
+// FederatedUsername build a valid username from the claims of an identity provider: preferred username,
+// or local part of the email. Forbidden characters are replaced. Returns an empty string if nothing usable is left.
+func FederatedUsername(preferredUsername string, email string) string {
+	username := strings.ToLower(preferredUsername)
+	if username == "" {
+		username = strings.ToLower(email)
+	}
+	if i := strings.Index(username, "@"); i >= 0 {
+		username = username[:i]
+	}
+	username = strings.Map(func(r rune) rune {
+		if validUsernameChars.MatchString(string(r)) {
+			return r
+		}
+		return '_'
+	}, username)
+	if len(username) > federatedUsernameMaxLength {
+		username = username[:federatedUsernameMaxLength]
+	}
+	if strings.Trim(username, "_") == "" || !IsValidUsername(username) {
+		return ""
+	}
+	return username
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// InvitationStatusPending invitation can be accepted
+	InvitationStatusPending = "pending"
+	// InvitationStatusAccepted invitation was used to create an user
+	InvitationStatusAccepted = "accepted"
+	// InvitationStatusRevoked invitation was cancelled
+	InvitationStatusRevoked = "revoked"
+	// InvitationStatusExpired invitation was not accepted in time
+	InvitationStatusExpired = "expired"
+	// InvitationDefaultRole role given to invited user if none is specified
+	InvitationDefaultRole = RoleMember
+)
+
+var (
+	// EmptyInvitation empty invitation var
+	EmptyInvitation  = Invitation{}
+	invitationStatus = []string{InvitationStatusPending, InvitationStatusAccepted, InvitationStatusRevoked, InvitationStatusExpired}
+	invitationRoles  = []string{RoleAdmin, RoleMember}
+)
+
+// Invitation object
+//
+// Invitation of an email address to join an organisation.
+//
+// swagger:model
+type Invitation struct {
+	// id of the invitation
+	//
+	// min: 0
+	IDInvitation uint64 `gorm:"primary_key;column:idInvitation;AUTO_INCREMENT" json:"id,omitempty"`
+	// User who sent the invitation. Either it or the inviting service account is set.
+	IDInviter uint64 `gorm:"column:idInviter; not null" json:"id_inviter,omitempty"`
+	// Service account which sent the invitation
+	IDInviterServiceAccount uint64 `gorm:"column:idInviterServiceAccount; not null" json:"id_inviter_service_account,omitempty"`
+	// Invited email
+	//
+	// required: true
+	// max length: 128
+	Email string `gorm:"column:email; not null; index" json:"email,omitempty"`
+	// Organisation the user is invited in
+	//
+	// required: true
+	IDOrganisation uint64 `gorm:"column:idOrganisation; not null; index" json:"id_organisation,omitempty"`
+	// Role given to the user once invitation is accepted
+	Role string `gorm:"column:role; not null" json:"role,omitempty"`
+	// pending, accepted, revoked or expired
+	Status string `gorm:"column:status; not null" json:"status,omitempty"`
+	// Creation date as unix time
+	InvitedAt int64 `gorm:"column:invitedAt; not null" json:"invited_at,omitempty"`
+	// Expiry date as unix time
+	//
+	// required: true
+	ExpiresAt int64 `gorm:"column:expiresAt; not null" json:"expires_at,omitempty"`
+}
+
+// Bind method used in API
+func (invitation *Invitation) Bind(r *http.Request) error {
+	return nil
+}
+
+// IsValid check validity of invitation object
+func (invitation *Invitation) IsValid() *u.AppError {
+	id := "id=" + strconv.FormatUint(invitation.IDInvitation, 10)
+	if len(invitation.Email) > 128 || !IsValidEmail(invitation.Email) {
+		return u.NewLocAppError("Invitation.IsValid", "model.invitation.is_valid.email.app_error", nil, id)
+	}
+	if invitation.IDOrganisation == 0 {
+		return u.NewLocAppError("Invitation.IsValid", "model.invitation.is_valid.id_organisation.app_error", nil, id)
+	}
+	if invitation.IDInviter == 0 && invitation.IDInviterServiceAccount == 0 {
+		return u.NewLocAppError("Invitation.IsValid", "model.invitation.is_valid.id_inviter.app_error", nil, id)
+	}
+	if !u.StringInArray(invitation.Role, invitationRoles) {
+		return u.NewLocAppError("Invitation.IsValid", "model.invitation.is_valid.role.app_error", nil, id)
+	}
+	if !u.StringInArray(invitation.Status, invitationStatus) {
+		return u.NewLocAppError("Invitation.IsValid", "model.invitation.is_valid.status.app_error", nil, id)
+	}
+	if invitation.ExpiresAt <= invitation.InvitedAt {
+		return u.NewLocAppError("Invitation.IsValid", "model.invitation.is_valid.expires_at.app_error", nil, id)
+	}
+	return nil
+}
+
+// PreSave set default values of a new invitation
+func (invitation *Invitation) PreSave() {
+	invitation.Email = strings.ToLower(invitation.Email)
+	if invitation.Role == "" {
+		invitation.Role = InvitationDefaultRole
+	}
+	if invitation.Status == "" {
+		invitation.Status = InvitationStatusPending
+	}
+	if invitation.InvitedAt == 0 {
+		invitation.InvitedAt = time.Now().UTC().Unix()
+	}
+}
+
+// CurrentStatus get invitation status, taking expiry date into account for pending invitations
+func (invitation *Invitation) CurrentStatus() string {
+	if invitation.Status == InvitationStatusPending && invitation.ExpiresAt < time.Now().UTC().Unix() {
+		return InvitationStatusExpired
+	}
+	return invitation.Status
+}
+
+// IsPending state if invitation can still be accepted
+func (invitation *Invitation) IsPending() bool {
+	return invitation.CurrentStatus() == InvitationStatusPending
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// GrantAuthorizationCode OAuth2 grant exchanging a code obtained by an user for a token
+	GrantAuthorizationCode = "authorization_code"
+	// GrantClientCredentials OAuth2 grant letting a confidential client get a token for itself
+	GrantClientCredentials = "client_credentials"
+	// CodeChallengeS256 only PKCE method accepted. Plain challenges would leak the verifier.
+	CodeChallengeS256 = "S256"
+	// ScopeOpenID scope asking for an OpenID Connect id_token
+	ScopeOpenID = "openid"
+	// ScopeProfile scope giving access to the user names
+	ScopeProfile = "profile"
+	// ScopeEmail scope giving access to the user email
+	ScopeEmail              = "email"
+	oauthClientNameMaxRunes = 64
+)
+
+var (
+	// EmptyOAuthClient empty oauth client var
+	EmptyOAuthClient = OAuthClient{}
+	// EmptyOAuthCode empty oauth code var
+	EmptyOAuthCode = OAuthCode{}
+	oauthGrants    = []string{GrantAuthorizationCode, GrantClientCredentials}
+	// validScope scope token as defined by RFC 6749 section 3.3
+	validScope = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+)
+
+// OAuthClient object
+//
+// Application allowed to get tokens for users of an organisation, or for itself. Public clients, like single page
+// applications, have no secret and must use PKCE. Only the hash of the secret is stored.
+//
+// swagger:model
+type OAuthClient struct {
+	// id of the client in database
+	//
+	// min: 0
+	IDOAuthClient uint64 `gorm:"primary_key;column:idOAuthClient;AUTO_INCREMENT" json:"id,omitempty"`
+	// Organisation the client belongs to. Only its users can authorise the client.
+	//
+	// required: true
+	IDOrganisation uint64 `gorm:"column:idOrganisation; not null; index" json:"id_organisation,omitempty"`
+	// Public identifier of the client
+	ClientID string `gorm:"column:clientID; not null; unique" json:"client_id,omitempty"`
+	// Hash of the client secret. Empty for public clients.
+	SecretHash string `gorm:"column:secretHash" json:"-"`
+	// Name shown to users
+	//
+	// required: true
+	// max length: 64
+	Name string `gorm:"column:name; not null" json:"name,omitempty"`
+	// State if client has no secret
+	Public bool `gorm:"column:public; not null" json:"public"`
+	// Space separated redirect uris as stored in database
+	RedirectURIs string `gorm:"column:redirectURIs; type:text" json:"-"`
+	// Uris codes can be sent to. They must match exactly.
+	RedirectURIList []string `gorm:"-" json:"redirect_uris"`
+	// Space separated grants as stored in database
+	Grants string `gorm:"column:grants; not null" json:"-"`
+	// Grants the client can use: authorization_code and client_credentials
+	GrantList []string `gorm:"-" json:"grant_types"`
+	// Space separated scopes as stored in database
+	Scopes string `gorm:"column:scopes" json:"-"`
+	// Scopes the client can ask for
+	ScopeList []string `gorm:"-" json:"scopes"`
+	// Creation date as unix time
+	CreatedAt int64 `gorm:"column:createdAt; not null" json:"created_at,omitempty"`
+	// State if client was revoked
+	Revoked bool `gorm:"column:revoked; not null" json:"revoked"`
+}
+
+// Bind method used in API
+func (client *OAuthClient) Bind(r *http.Request) error {
+	return nil
+}
+
+// IsValid check validity of oauth client object
+func (client *OAuthClient) IsValid() *u.AppError {
+	id := "id=" + strconv.FormatUint(client.IDOAuthClient, 10)
+	if client.IDOrganisation == 0 {
+		return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.id_organisation.app_error", nil, id)
+	}
+	if client.ClientID == "" {
+		return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.client_id.app_error", nil, id)
+	}
+	if client.Name == "" || len([]rune(client.Name)) > oauthClientNameMaxRunes {
+		return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.name.app_error", nil, id)
+	}
+	if client.Public != (client.SecretHash == "") || (!client.Public && len(client.SecretHash) != sha256.Size*2) {
+		return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.secret_hash.app_error", nil, id)
+	}
+	if len(client.GrantList) == 0 {
+		return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.grants.app_error", nil, id)
+	}
+	for _, grant := range client.GrantList {
+		if !u.StringInArray(grant, oauthGrants) || (client.Public && grant == GrantClientCredentials) {
+			return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.grants.app_error", nil, id)
+		}
+	}
+	if u.StringInArray(GrantAuthorizationCode, client.GrantList) && len(client.RedirectURIList) == 0 {
+		return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.redirect_uris.app_error", nil, id)
+	}
+	for _, redirectURI := range client.RedirectURIList {
+		if !IsValidRedirectURI(redirectURI) {
+			return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.redirect_uris.app_error", nil, id)
+		}
+	}
+	for _, scope := range client.ScopeList {
+		if !validScope.MatchString(scope) {
+			return u.NewLocAppError("OAuthClient.IsValid", "model.oauth_client.is_valid.scopes.app_error", nil, id)
+		}
+	}
+	return nil
+}
+
+// PreSave set creation date and store lists
+func (client *OAuthClient) PreSave() {
+	if client.CreatedAt == 0 {
+		client.CreatedAt = time.Now().UTC().Unix()
+	}
+	client.RedirectURIs = strings.Join(client.RedirectURIList, " ")
+	client.Grants = strings.Join(client.GrantList, " ")
+	client.Scopes = strings.Join(client.ScopeList, " ")
+}
+
+// AfterFind fill lists from stored values. It is called by gorm on every loaded client.
+func (client *OAuthClient) AfterFind() error {
+	client.RedirectURIList = strings.Fields(client.RedirectURIs)
+	client.GrantList = strings.Fields(client.Grants)
+	client.ScopeList = strings.Fields(client.Scopes)
+	return nil
+}
+
+// HasRedirectURI state if uri was registered for client
+func (client *OAuthClient) HasRedirectURI(redirectURI string) bool {
+	return u.StringInArray(redirectURI, strings.Fields(client.RedirectURIs))
+}
+
+// HasGrant state if client can use grant
+func (client *OAuthClient) HasGrant(grant string) bool {
+	return u.StringInArray(grant, strings.Fields(client.Grants))
+}
+
+// AllowedScope check requested space separated scopes against the client ones. Empty request get all client scopes.
+func (client *OAuthClient) AllowedScope(requested string) (string, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return client.Scopes, true
+	}
+	allowed := strings.Fields(client.Scopes)
+	for _, scope := range strings.Fields(requested) {
+		if !u.StringInArray(scope, allowed) {
+			return "", false
+		}
+	}
+	return strings.Join(strings.Fields(requested), " "), true
+}
+
+// HasScope state if space separated scopes contain scope
+func HasScope(scopes string, scope string) bool {
+	return u.StringInArray(scope, strings.Fields(scopes))
+}
+
+// IsValidRedirectURI state if uri can be registered as redirect uri: absolute, without fragment,
+// and using https unless it targets the local machine.
+func IsValidRedirectURI(redirectURI string) bool {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" {
+		return false
+	}
+	if parsed.Scheme == "https" {
+		return true
+	}
+	host := parsed.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.Trim(host, "[]")
+	return parsed.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+// OAuthCode object
+//
+// Authorization code given to a client once an user authorised it. Only the hash of the code is stored.
+//
+// swagger:model
+type OAuthCode struct {
+	// id of the code
+	//
+	// min: 0
+	IDOAuthCode uint64 `gorm:"primary_key;column:idOAuthCode;AUTO_INCREMENT" json:"id,omitempty"`
+	// Hash of the code
+	CodeHash string `gorm:"column:codeHash; not null; unique" json:"-"`
+	// Client the code was given to
+	//
+	// required: true
+	IDOAuthClient uint64 `gorm:"column:idOAuthClient; not null; index" json:"id_oauth_client,omitempty"`
+	// User who authorised the client
+	//
+	// required: true
+	IDUser uint64 `gorm:"column:idUser; not null; index" json:"id_user,omitempty"`
+	// Redirect uri used to get the code. Token request must give the same.
+	RedirectURI string `gorm:"column:redirectURI; not null" json:"redirect_uri,omitempty"`
+	// Space separated scopes granted
+	Scope string `gorm:"column:scope" json:"scope,omitempty"`
+	// PKCE challenge
+	CodeChallenge string `gorm:"column:codeChallenge; not null" json:"-"`
+	// Expiry date as unix time
+	//
+	// required: true
+	ExpiresAt int64 `gorm:"column:expiresAt; not null" json:"expires_at,omitempty"`
+	// State if code was already exchanged
+	Used bool `gorm:"column:used; not null" json:"used"`
+	// jti of the token the code was exchanged for. It is revoked if code is used again.
+	TokenID string `gorm:"column:tokenID" json:"-"`
+	// OpenID Connect nonce given by the client, copied in id_token
+	Nonce string `gorm:"column:nonce" json:"-"`
+	// Date the user logged in as unix time
+	AuthTime int64 `gorm:"column:authTime; not null" json:"auth_time,omitempty"`
+}
+
+// IsValid check validity of oauth code object
+func (code *OAuthCode) IsValid() *u.AppError {
+	if len(code.CodeHash) != sha256.Size*2 {
+		return u.NewLocAppError("OAuthCode.IsValid", "model.oauth_code.is_valid.code_hash.app_error", nil, "")
+	}
+	if code.IDOAuthClient == 0 {
+		return u.NewLocAppError("OAuthCode.IsValid", "model.oauth_code.is_valid.id_oauth_client.app_error", nil, "")
+	}
+	if code.IDUser == 0 {
+		return u.NewLocAppError("OAuthCode.IsValid", "model.oauth_code.is_valid.id_user.app_error", nil, "")
+	}
+	if code.RedirectURI == "" {
+		return u.NewLocAppError("OAuthCode.IsValid", "model.oauth_code.is_valid.redirect_uri.app_error", nil, "")
+	}
+	if code.CodeChallenge == "" {
+		return u.NewLocAppError("OAuthCode.IsValid", "model.oauth_code.is_valid.code_challenge.app_error", nil, "")
+	}
+	if code.ExpiresAt == 0 {
+		return u.NewLocAppError("OAuthCode.IsValid", "model.oauth_code.is_valid.expires_at.app_error", nil, "")
+	}
+	return nil
+}
+
+// IsExpired state if code can not be exchanged anymore because of its age
+func (code *OAuthCode) IsExpired() bool {
+	return code.ExpiresAt < time.Now().UTC().Unix()
+}
@@ -47,6 +47,11 @@ type Organisation struct {
 	Avatar      string `gorm:"column:avatar" json:"avatar,omitempty"`
 	// Domain name of the organisation
 	Domain string `gorm:"column:domain" json:"domain,omitempty"`
+	// State if users have to verify their email before they can login. Default is false.
+	RequireVerifiedEmail bool `gorm:"column:requireVerifiedEmail; not null" json:"require_verified_email"`
+	// State if users allowed to manage organisation or its users have to enable two-factor authentication
+	// before using those rights. Default is false.
+	RequireAdminMFA bool `gorm:"column:requireAdminMFA; not null" json:"require_admin_mfa"`
 }
 
 // Bind method used in API
@@ -54,6 +59,15 @@ func (organisation *Organisation) Bind(r *http.Request) error {
 	return nil
 }
 
+// Policies get boolean settings of organisation by column. They are written even when false.
+func (organisation *Organisation) Policies() map[string]interface{} {
+	return map[string]interface{}{
+		"public":               organisation.Public,
+		"requireVerifiedEmail": organisation.RequireVerifiedEmail,
+		"requireAdminMFA":      organisation.RequireAdminMFA,
+	}
+}
+
 // ToJSON transfoorm an Organisation into JSON
 func (organisation *Organisation) ToJSON() string {
 	b, err := json.Marshal(organisation)
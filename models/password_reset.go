@@ -0,0 +1,66 @@
+package models
+
+import (
+	"crypto/sha256"
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	// EmptyPasswordReset empty password reset var
+	EmptyPasswordReset = PasswordReset{}
+)
+
+// PasswordReset object
+//
+// Short lived opaque token sent by email to let an user choose a new password. It can only be used once.
+// Only the hash of the token is stored.
+//
+// swagger:model
+type PasswordReset struct {
+	// id of the password reset
+	//
+	// min: 0
+	IDPasswordReset uint64 `gorm:"primary_key;column:idPasswordReset;AUTO_INCREMENT" json:"id,omitempty"`
+	// Hash of the opaque token
+	TokenHash string `gorm:"column:tokenHash; not null; unique" json:"-"`
+	// User asking for a new password
+	//
+	// required: true
+	IDUser uint64 `gorm:"column:idUser; not null; index" json:"id_user,omitempty"`
+	// Creation date as unix time
+	IssuedAt int64 `gorm:"column:issuedAt; not null" json:"issued_at,omitempty"`
+	// Expiry date as unix time
+	//
+	// required: true
+	ExpiresAt int64 `gorm:"column:expiresAt; not null" json:"expires_at,omitempty"`
+	// State if token was already used or replaced by a newer one
+	Used bool `gorm:"column:used; not null" json:"used"`
+}
+
+// IsValid check validity of password reset object
+func (passwordReset *PasswordReset) IsValid() *u.AppError {
+	if len(passwordReset.TokenHash) != sha256.Size*2 {
+		return u.NewLocAppError("PasswordReset.IsValid", "model.password_reset.is_valid.token_hash.app_error", nil, "")
+	}
+	if passwordReset.IDUser == 0 {
+		return u.NewLocAppError("PasswordReset.IsValid", "model.password_reset.is_valid.id_user.app_error", nil, "")
+	}
+	if passwordReset.ExpiresAt <= passwordReset.IssuedAt {
+		return u.NewLocAppError("PasswordReset.IsValid", "model.password_reset.is_valid.expires_at.app_error", nil, "")
+	}
+	return nil
+}
+
+// PreSave set issue date if it was not provided
+func (passwordReset *PasswordReset) PreSave() {
+	if passwordReset.IssuedAt == 0 {
+		passwordReset.IssuedAt = time.Now().UTC().Unix()
+	}
+}
+
+// IsExpired state if password reset can not be used anymore because of its age
+func (passwordReset *PasswordReset) IsExpired() bool {
+	return passwordReset.ExpiresAt < time.Now().UTC().Unix()
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"crypto/sha256"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// RecoveryCodeCount number of recovery codes generated when two-factor authentication is enabled
+	RecoveryCodeCount = 10
+)
+
+var (
+	// EmptyRecoveryCode empty recovery code var
+	EmptyRecoveryCode = RecoveryCode{}
+)
+
+// RecoveryCode object
+//
+// One-time code letting an user login when its TOTP device is lost. Only the hash of the code is stored.
+//
+// swagger:model
+type RecoveryCode struct {
+	// id of the recovery code
+	//
+	// min: 0
+	IDRecoveryCode uint64 `gorm:"primary_key;column:idRecoveryCode;AUTO_INCREMENT" json:"id,omitempty"`
+	// User owning the code
+	//
+	// required: true
+	IDUser uint64 `gorm:"column:idUser; not null; index" json:"id_user,omitempty"`
+	// Hash of the code
+	CodeHash string `gorm:"column:codeHash; not null; unique" json:"-"`
+	// State if code was already used
+	Used bool `gorm:"column:used; not null" json:"used"`
+}
+
+// IsValid check validity of recovery code object
+func (recoveryCode *RecoveryCode) IsValid() *u.AppError {
+	if len(recoveryCode.CodeHash) != sha256.Size*2 {
+		return u.NewLocAppError("RecoveryCode.IsValid", "model.recovery_code.is_valid.code_hash.app_error", nil, "")
+	}
+	if recoveryCode.IDUser == 0 {
+		return u.NewLocAppError("RecoveryCode.IsValid", "model.recovery_code.is_valid.id_user.app_error", nil, "")
+	}
+	return nil
+}
+
+// NormalizeRecoveryCode remove presentation characters from a code typed by an user, so it can be hashed
+func NormalizeRecoveryCode(code string) string {
+	normalized := make([]rune, 0, len(code))
+	for _, r := range code {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			normalized = append(normalized, r)
+		case r >= 'A' && r <= 'Z':
+			normalized = append(normalized, r-'A'+'a')
+		}
+	}
+	return string(normalized)
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+var (
+	// EmptyRefreshToken empty refresh token var
+	EmptyRefreshToken = RefreshToken{}
+)
+
+// RefreshToken object
+//
+// Long lived opaque token used to get new access tokens. Tokens obtained from a same login share a family.
+// Only the hash of the token is stored.
+//
+// swagger:model
+type RefreshToken struct {
+	// id of the refresh token
+	//
+	// min: 0
+	IDRefreshToken uint64 `gorm:"primary_key;column:idRefreshToken;AUTO_INCREMENT" json:"id,omitempty"`
+	// Hash of the opaque token
+	TokenHash string `gorm:"column:tokenHash; not null; unique" json:"-"`
+	// Login session the token belong to
+	//
+	// required: true
+	Family string `gorm:"column:family; not null; index" json:"family,omitempty"`
+	// User owning the token
+	//
+	// required: true
+	IDUser uint64 `gorm:"column:idUser; not null; index" json:"id_user,omitempty"`
+	// Creation date as unix time
+	IssuedAt int64 `gorm:"column:issuedAt; not null" json:"issued_at,omitempty"`
+	// Expiry date as unix time
+	//
+	// required: true
+	ExpiresAt int64 `gorm:"column:expiresAt; not null" json:"expires_at,omitempty"`
+	// State if token was already exchanged for a new one
+	Rotated bool `gorm:"column:rotated; not null" json:"rotated"`
+	// State if token family was revoked
+	Revoked bool `gorm:"column:revoked; not null" json:"revoked"`
+}
+
+// IsValid check validity of refresh token object
+func (refreshToken *RefreshToken) IsValid() *u.AppError {
+	if len(refreshToken.TokenHash) != sha256.Size*2 {
+		return u.NewLocAppError("RefreshToken.IsValid", "model.refresh_token.is_valid.token_hash.app_error", nil, "")
+	}
+	if refreshToken.Family == "" {
+		return u.NewLocAppError("RefreshToken.IsValid", "model.refresh_token.is_valid.family.app_error", nil, "")
+	}
+	if refreshToken.IDUser == 0 {
+		return u.NewLocAppError("RefreshToken.IsValid", "model.refresh_token.is_valid.id_user.app_error", nil, "")
+	}
+	if refreshToken.ExpiresAt <= refreshToken.IssuedAt {
+		return u.NewLocAppError("RefreshToken.IsValid", "model.refresh_token.is_valid.expires_at.app_error", nil, "")
+	}
+	return nil
+}
+
+// PreSave set issue date if it was not provided
+func (refreshToken *RefreshToken) PreSave() {
+	if refreshToken.IssuedAt == 0 {
+		refreshToken.IssuedAt = time.Now().UTC().Unix()
+	}
+}
+
+// IsExpired state if refresh token can not be used anymore because of its age
+func (refreshToken *RefreshToken) IsExpired() bool {
+	return refreshToken.ExpiresAt < time.Now().UTC().Unix()
+}
+
+// HashToken hash an opaque token so it can be stored and searched without keeping the clear value.
+// Opaque tokens are long random strings, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
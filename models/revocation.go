@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// RevocationKindToken revoke a single token. Subject is the token "jti".
+	RevocationKindToken = "token"
+	// RevocationKindUser revoke all tokens issued to an user before revocation. Subject is the user id.
+	RevocationKindUser = "user"
+	// RevocationKindOrganisation revoke all tokens issued to users of an organisation before revocation. Subject is the organisation id.
+	RevocationKindOrganisation = "organisation"
+	// RevocationKindClient revoke all tokens issued to an OAuth client before revocation. Subject is the client id.
+	RevocationKindClient = "client"
+)
+
+var (
+	// EmptyRevocation empty revocation var
+	EmptyRevocation = Revocation{}
+	revocationKinds = []string{RevocationKindToken, RevocationKindUser, RevocationKindOrganisation, RevocationKindClient}
+)
+
+// Revocation object
+//
+// Entry of the token revocation list. Tokens matching an entry are refused even if their signature is correct.
+//
+// swagger:model
+type Revocation struct {
+	// id of the revocation
+	//
+	// min: 0
+	IDRevocation uint64 `gorm:"primary_key;column:idRevocation;AUTO_INCREMENT" json:"id,omitempty"`
+	// What is revoked: token, user, organisation or client
+	//
+	// required: true
+	Kind string `gorm:"column:kind; not null; unique_index:idx_revocation_subject" json:"kind,omitempty"`
+	// Token jti, user id, organisation id or client id depending on kind
+	//
+	// required: true
+	Subject string `gorm:"column:subject; not null; unique_index:idx_revocation_subject" json:"subject,omitempty"`
+	// Revocation date as unix time. For user, organisation and client, tokens issued up to this date are revoked.
+	RevokedAt int64 `gorm:"column:revokedAt; not null" json:"revoked_at,omitempty"`
+	// Date after which the entry is useless because revoked tokens are expired anyway. 0 keep it forever.
+	ExpiresAt int64 `gorm:"column:expiresAt; not null" json:"expires_at,omitempty"`
+}
+
+// IsValid check validity of revocation object
+func (revocation *Revocation) IsValid() *u.AppError {
+	if !u.StringInArray(revocation.Kind, revocationKinds) {
+		return u.NewLocAppError("Revocation.IsValid", "model.revocation.is_valid.kind.app_error", nil, "kind="+revocation.Kind)
+	}
+	if revocation.Subject == "" || len(revocation.Subject) > 128 {
+		return u.NewLocAppError("Revocation.IsValid", "model.revocation.is_valid.subject.app_error", nil, "")
+	}
+	return nil
+}
+
+// PreSave set revocation date if not provided
+func (revocation *Revocation) PreSave() {
+	if revocation.RevokedAt == 0 {
+		revocation.RevokedAt = time.Now().UTC().Unix()
+	}
+}
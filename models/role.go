@@ -0,0 +1,110 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// RoleOwner role of the user who created the organisation. It holds every permission.
+	RoleOwner = "owner"
+	// RoleAdmin role of users managing organisation members
+	RoleAdmin = "admin"
+	// RoleMember default role of organisation users
+	RoleMember = "member"
+	// PermissionManage right to manage organisation itself
+	PermissionManage = "manage"
+	// PermissionManageUser right to create, update and delete organisation users
+	PermissionManageUser = "manage_user"
+	// PermissionInvite right to invite people in the organisation
+	PermissionInvite = "invite"
+	// PermissionRead right to read organisation and its users. Every role of the organisation grants it.
+	PermissionRead    = "read"
+	roleNameMaxLength = 64
+)
+
+var (
+	// EmptyRole empty role var
+	EmptyRole = Role{}
+)
+
+// Role object
+//
+// Rights of users inside their organisation. Each organisation has its own roles.
+//
+// swagger:model
+type Role struct {
+	// id of the role
+	//
+	// min: 0
+	IDRole uint64 `gorm:"primary_key;column:idRole;AUTO_INCREMENT" json:"id,omitempty"`
+	// Organisation the role belongs to
+	//
+	// required: true
+	IDOrganisation uint64 `gorm:"column:idOrganisation; not null; unique_index:idx_role_organisation_name" json:"id_organisation,omitempty"`
+	// Role name, unique inside organisation
+	//
+	// required: true
+	// max length: 64
+	RoleName string `gorm:"column:roleName; not null; unique_index:idx_role_organisation_name" json:"name,omitempty"`
+	// Can update organisation
+	CanManage bool `gorm:"column:canManage; not null" json:"can_manage"`
+	// Can create, update and delete users
+	CanManageUser bool `gorm:"column:canManageUser; not null" json:"can_manage_user"`
+	// Can invite people in organisation
+	CanInvite bool `gorm:"column:canInvite; not null" json:"can_invite"`
+}
+
+// Bind method used in API
+func (role *Role) Bind(r *http.Request) error {
+	return nil
+}
+
+// IsValid check validity of role object
+func (role *Role) IsValid() *u.AppError {
+	id := "id=" + strconv.FormatUint(role.IDRole, 10)
+	if len(role.RoleName) == 0 || len(role.RoleName) > roleNameMaxLength || !IsValidAlphaNum(role.RoleName, true) {
+		return u.NewLocAppError("Role.IsValid", "model.role.is_valid.role_name.app_error", nil, id)
+	}
+	if role.IDOrganisation == 0 {
+		return u.NewLocAppError("Role.IsValid", "model.role.is_valid.id_organisation.app_error", nil, id)
+	}
+	return nil
+}
+
+// PreSave is used to normalise role before saving in DB
+func (role *Role) PreSave() {
+	role.RoleName = strings.ToLower(role.RoleName)
+}
+
+// HasPermission state if role grant provided permission
+func (role *Role) HasPermission(permission string) bool {
+	switch permission {
+	case PermissionManage:
+		return role.CanManage
+	case PermissionManageUser:
+		return role.CanManageUser
+	case PermissionInvite:
+		return role.CanInvite
+	case PermissionRead:
+		return role.IDOrganisation != 0
+	}
+	return false
+}
+
+// IsAdmin state if role grant rights over the organisation or its users
+func (role *Role) IsAdmin() bool {
+	return role.CanManage || role.CanManageUser
+}
+
+// DefaultRoles roles every organisation is created with
+func DefaultRoles(IDOrganisation uint64) []Role {
+	return []Role{
+		{IDOrganisation: IDOrganisation, RoleName: RoleOwner, CanManage: true, CanManageUser: true, CanInvite: true},
+		{IDOrganisation: IDOrganisation, RoleName: RoleAdmin, CanManageUser: true, CanInvite: true},
+		{IDOrganisation: IDOrganisation, RoleName: RoleMember},
+	}
+}
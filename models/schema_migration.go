@@ -0,0 +1,18 @@
+package models
+
+var (
+	// EmptySchemaMigration empty schema migration var
+	EmptySchemaMigration = SchemaMigration{}
+)
+
+// SchemaMigration object
+//
+// Migration applied to the database schema. Rows are written by migrate command only.
+type SchemaMigration struct {
+	// Number of the migration. Schema version is the highest one applied.
+	Version int `gorm:"primary_key;column:version" json:"version"`
+	// Name of the migration
+	Name string `gorm:"column:name; not null" json:"name"`
+	// Date migration was applied as unix time
+	AppliedAt int64 `gorm:"column:appliedAt; not null" json:"applied_at"`
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	u "github.com/titouanfreville/popcubeexternalapi/utils"
+)
+
+const (
+	// APIKeyPrefix start of every API key, so leaked keys are easy to find in logs or repositories
+	APIKeyPrefix = "pck_"
+	// APIKeyPrefixLength length of the visible part of an API key, prefix included. It is stored in clear to find the key.
+	APIKeyPrefixLength          = len(APIKeyPrefix) + 8
+	serviceAccountNameMaxLength = 64
+	apiKeyNameMaxLength         = 64
+)
+
+var (
+	// EmptyServiceAccount empty service account var
+	EmptyServiceAccount = ServiceAccount{}
+	// EmptyAPIKey empty api key var
+	EmptyAPIKey = APIKey{}
+	// APIKeyScopes scopes an API key can be given. They match role permissions.
+	APIKeyScopes = []string{PermissionManage, PermissionManageUser, PermissionInvite}
+)
+
+// ServiceAccount object
+//
+// Machine account of an organisation. Service accounts login with API keys instead of passwords.
+//
+// swagger:model
+type ServiceAccount struct {
+	// id of the service account
+	//
+	// min: 0
+	IDServiceAccount uint64 `gorm:"primary_key;column:idServiceAccount;AUTO_INCREMENT" json:"id,omitempty"`
+	// Organisation the service account belongs to
+	//
+	// required: true
+	IDOrganisation uint64 `gorm:"column:idOrganisation; not null; unique_index:idx_service_account_organisation_name" json:"id_organisation,omitempty"`
+	// Service account name, unique inside organisation
+	//
+	// required: true
+	// max length: 64
+	Name        string `gorm:"column:name; not null; unique_index:idx_service_account_organisation_name" json:"name,omitempty"`
+	Description string `gorm:"column:description" json:"description,omitempty"`
+	// Creation date as unix time
+	CreatedAt int64 `gorm:"column:createdAt; not null" json:"created_at,omitempty"`
+	// State if service account was disabled. Keys of a disabled account are refused.
+	Disabled bool `gorm:"column:disabled; not null" json:"disabled"`
+}
+
+// Bind method used in API
+func (serviceAccount *ServiceAccount) Bind(r *http.Request) error {
+	return nil
+}
+
+// IsValid check validity of service account object
+func (serviceAccount *ServiceAccount) IsValid() *u.AppError {
+	id := "id=" + strconv.FormatUint(serviceAccount.IDServiceAccount, 10)
+	if len(serviceAccount.Name) == 0 || len(serviceAccount.Name) > serviceAccountNameMaxLength || !IsValidAlphaNum(serviceAccount.Name, true) {
+		return u.NewLocAppError("ServiceAccount.IsValid", "model.service_account.is_valid.name.app_error", nil, id)
+	}
+	if serviceAccount.IDOrganisation == 0 {
+		return u.NewLocAppError("ServiceAccount.IsValid", "model.service_account.is_valid.id_organisation.app_error", nil, id)
+	}
+	return nil
+}
+
+// PreSave is used to normalise service account before saving in DB
+func (serviceAccount *ServiceAccount) PreSave() {
+	serviceAccount.Name = strings.ToLower(serviceAccount.Name)
+	if serviceAccount.CreatedAt == 0 {
+		serviceAccount.CreatedAt = time.Now().UTC().Unix()
+	}
+}
+
+// APIKey object
+//
+// Credential of a service account. Only the visible prefix and the hash of the key are stored.
+//
+// swagger:model
+type APIKey struct {
+	// id of the api key
+	//
+	// min: 0
+	IDAPIKey uint64 `gorm:"primary_key;column:idAPIKey;AUTO_INCREMENT" json:"id,omitempty"`
+	// Service account owning the key
+	//
+	// required: true
+	IDServiceAccount uint64 `gorm:"column:idServiceAccount; not null; index" json:"id_service_account,omitempty"`
+	// Name helping to know where the key is used
+	Name string `gorm:"column:name" json:"name,omitempty"`
+	// Visible start of the key
+	Prefix string `gorm:"column:prefix; not null; unique" json:"prefix,omitempty"`
+	// Hash of the full key
+	KeyHash string `gorm:"column:keyHash; not null" json:"-"`
+	// Space separated scopes as stored in database
+	Scopes string `gorm:"column:scopes; not null" json:"-"`
+	// Permissions granted to the key
+	ScopeList []string `gorm:"-" json:"scopes"`
+	// Creation date as unix time
+	CreatedAt int64 `gorm:"column:createdAt; not null" json:"created_at,omitempty"`
+	// Expiry date as unix time. 0 means the key does not expire.
+	ExpiresAt int64 `gorm:"column:expiresAt; not null" json:"expires_at,omitempty"`
+	// Last date the key was used as unix time
+	LastUsedAt int64 `gorm:"column:lastUsedAt; not null" json:"last_used_at,omitempty"`
+	// State if key was revoked
+	Revoked bool `gorm:"column:revoked; not null" json:"revoked"`
+}
+
+// Bind method used in API
+func (apiKey *APIKey) Bind(r *http.Request) error {
+	return nil
+}
+
+// IsValid check validity of api key object
+func (apiKey *APIKey) IsValid() *u.AppError {
+	id := "id=" + strconv.FormatUint(apiKey.IDAPIKey, 10)
+	if apiKey.IDServiceAccount == 0 {
+		return u.NewLocAppError("APIKey.IsValid", "model.api_key.is_valid.id_service_account.app_error", nil, id)
+	}
+	if len(apiKey.Name) > apiKeyNameMaxLength {
+		return u.NewLocAppError("APIKey.IsValid", "model.api_key.is_valid.name.app_error", nil, id)
+	}
+	if len(apiKey.Prefix) != APIKeyPrefixLength || !strings.HasPrefix(apiKey.Prefix, APIKeyPrefix) {
+		return u.NewLocAppError("APIKey.IsValid", "model.api_key.is_valid.prefix.app_error", nil, id)
+	}
+	if len(apiKey.KeyHash) != sha256.Size*2 {
+		return u.NewLocAppError("APIKey.IsValid", "model.api_key.is_valid.key_hash.app_error", nil, id)
+	}
+	for _, scope := range apiKey.ScopeList {
+		if !u.StringInArray(scope, APIKeyScopes) {
+			return u.NewLocAppError("APIKey.IsValid", "model.api_key.is_valid.scopes.app_error", nil, id)
+		}
+	}
+	if apiKey.ExpiresAt != 0 && apiKey.ExpiresAt <= apiKey.CreatedAt {
+		return u.NewLocAppError("APIKey.IsValid", "model.api_key.is_valid.expires_at.app_error", nil, id)
+	}
+	return nil
+}
+
+// PreSave set creation date and store scope list
+func (apiKey *APIKey) PreSave() {
+	if apiKey.CreatedAt == 0 {
+		apiKey.CreatedAt = time.Now().UTC().Unix()
+	}
+	apiKey.Scopes = strings.Join(apiKey.ScopeList, " ")
+}
+
+// AfterFind fill scope list from stored scopes. It is called by gorm on every loaded key.
+func (apiKey *APIKey) AfterFind() error {
+	apiKey.ScopeList = strings.Fields(apiKey.Scopes)
+	return nil
+}
+
+// IsExpired state if api key can not be used anymore because of its age
+func (apiKey *APIKey) IsExpired() bool {
+	return apiKey.ExpiresAt != 0 && apiKey.ExpiresAt < time.Now().UTC().Unix()
+}
+
+// HasScope state if key was granted provided scope
+func (apiKey *APIKey) HasScope(scope string) bool {
+	return u.StringInArray(scope, strings.Fields(apiKey.Scopes))
+}
+
+// ScopesRole role holding exactly the permissions granted by scopes. It is used for service accounts,
+// so permission checks are the same as for users.
+func ScopesRole(IDOrganisation uint64, scopes []string) Role {
+	return Role{
+		IDOrganisation: IDOrganisation,
+		RoleName:       "service",
+		CanManage:      u.StringInArray(PermissionManage, scopes),
+		CanManageUser:  u.StringInArray(PermissionManageUser, scopes),
+		CanInvite:      u.StringInArray(PermissionInvite, scopes),
+	}
+}
+
+// APIKeyPrefixOf get the visible prefix of a clear API key. It returns an empty string if key is malformed.
+func APIKeyPrefixOf(key string) string {
+	if len(key) <= APIKeyPrefixLength || !strings.HasPrefix(key, APIKeyPrefix) {
+		return ""
+	}
+	return key[:APIKeyPrefixLength]
+}
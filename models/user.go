@@ -10,6 +10,7 @@ import (
 	"unicode/utf8"
 
 	u "github.com/titouanfreville/popcubeexternalapi/utils"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -18,6 +19,11 @@ const (
 	userNotifyNone          = "none"
 	userAuthServiceEmail    = "email"
 	userAuthServiceUsername = "username"
+	passwordMinLength       = 8
+	// bcrypt refuse to hash more than 72 bytes.
+	passwordMaxLength = 72
+	// passwordHashCost is the bcrypt cost used for new hashes. Raising it will rehash user passwords on their next login.
+	passwordHashCost = 12
 )
 
 var (
@@ -66,6 +72,10 @@ type User struct {
 	Deleted bool `gorm:"column:deleted; not null;" json:"deleted,omitempty"`
 	// Avatar used by user
 	Avatar string `gorm:"column:avatar;" json:"avatar, omitempty"`
+	// User password. Only used to provide password, never sent back.
+	//
+	// required: true
+	Password string `gorm:"column:password; not null;" json:"password,omitempty"`
 	// User nickname
 	NickName string `gorm:"column:nickName; unique" json:"nickname, omitempty"`
 	// First name
@@ -77,6 +87,20 @@ type User struct {
 	//
 	// required: true
 	IDOrganisation uint64 `gorm:"column:idOrganisation; not null;" json:"id_organisation,omitempty"`
+	// Role of the user in the organisation
+	IDRole uint64 `gorm:"column:idRole;" json:"id_role,omitempty"`
+	// Preferred language of the user, as a language tag (en, fr, ...). Used for emails.
+	//
+	// max length: 16
+	Locale string `gorm:"column:locale;" json:"locale,omitempty"`
+	// State if user has to give a TOTP code after its password to login
+	MFAEnabled bool `gorm:"column:mfaEnabled; not null;" json:"mfa_enabled"`
+	// TOTP secret of the user. It is set at enrolment and only used once MFAEnabled is confirmed.
+	MFASecret string `gorm:"column:mfaSecret;" json:"-"`
+	// Last TOTP step used to login, so a code can not be replayed
+	MFALastStep int64 `gorm:"column:mfaLastStep; not null;" json:"-"`
+	// State if user is saved without role. Pending users get the member role once their email is verified.
+	Pending bool `gorm:"-" json:"-"`
 }
 
 // Bind method used in API to manage request.
@@ -84,6 +108,14 @@ func (user *User) Bind(r *http.Request) error {
 	return nil
 }
 
+// MarshalJSON make sure password hash never leave the API.
+func (user User) MarshalJSON() ([]byte, error) {
+	type userAlias User
+	safeUser := userAlias(user)
+	safeUser.Password = ""
+	return json.Marshal(safeUser)
+}
+
 // IsValid valwebIDates the user and returns an error if it isn't configured
 // correctly.
 func (user *User) IsValid(isUpdate bool) *u.AppError {
@@ -94,6 +126,13 @@ func (user *User) IsValid(isUpdate bool) *u.AppError {
 		}
 	}
 
+	if !isUpdate || len(user.Password) > 0 {
+		// Password is hashed by PreSave only if it matched password policy.
+		if !IsHashedPassword(user.Password) {
+			return u.NewLocAppError("user.IsValid", "model.user.is_valid.password.app_error", nil, "")
+		}
+	}
+
 	if !IsValidUsername(user.Username) {
 		return u.NewLocAppError("user.IsValid", "model.user.is_valid.Username.app_error", nil, "")
 	}
@@ -114,14 +153,22 @@ func (user *User) IsValid(isUpdate bool) *u.AppError {
 		return u.NewLocAppError("user.IsValid", "model.user.is_valid.last_name.app_error", nil, "")
 	}
 
+	if len(user.Locale) > 16 {
+		return u.NewLocAppError("user.IsValid", "model.user.is_valid.locale.app_error", nil, "")
+	}
+
 	return nil
 }
 
-// PreSave have to be run before saving user in DB. It will fill necessary information (webID, username, etc. ) and hash password
+// PreSave have to be run before saving user in DB. It will fill necessary information (webID, username, etc. ) and hash password.
+// Password is always taken as a clear one, even if it looks like a hash: hashes are only written by stores.
 func (user *User) PreSave() {
 
 	user.Username = strings.ToLower(user.Username)
 	user.Email = strings.ToLower(user.Email)
+	if IsValidPassword(user.Password) {
+		user.Password = HashPassword(user.Password)
+	}
 }
 
 // ToJSON convert a user to a json string
@@ -168,3 +215,34 @@ func IsValidEmail(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil && u.IsLower(email)
 }
+
+// IsValidPassword check that a clear password can be used
+func IsValidPassword(password string) bool {
+	return len(password) >= passwordMinLength && len(password) <= passwordMaxLength
+}
+
+// HashPassword generate a salted bcrypt hash of provided password
+func HashPassword(password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return ""
+	}
+	return string(hash)
+}
+
+// IsHashedPassword check if provided string is already a bcrypt hash
+func IsHashedPassword(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
+
+// ComparePassword check that clear password match the stored hash
+func ComparePassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// PasswordNeedsRehash state if hash was generated with weaker parameters than the current ones
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < passwordHashCost
+}
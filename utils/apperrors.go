@@ -21,12 +21,38 @@ type AppError struct {
 	// Detail of error
 	DetailedError string `json:"detailed_error"` // Internal error string to help the developer
 	// Id of the request if exist
-	RequestID string `json:"request_id,omitempty"` // The RequestID that's also set in the header
-	Where     string `json:"-"`                    // The function where it happened in the form of Struct.Func
-	IsOAuth   bool   `json:"is_oauth,omitempty"`   // Whether the error is OAuth specific
+	RequestID string    `json:"request_id,omitempty"` // The RequestID that's also set in the header
+	Where     string    `json:"-"`                    // The function where it happened in the form of Struct.Func
+	IsOAuth   bool      `json:"is_oauth,omitempty"`   // Whether the error is OAuth specific
+	Kind      ErrorKind `json:"-"`                    // What went wrong, used to choose the http status
 	params    map[string]interface{}
 }
 
+// ErrorKind kind of failure an AppError reports
+type ErrorKind int
+
+const (
+	// ErrorOther failure answered with the status code of the error
+	ErrorOther ErrorKind = iota
+	// ErrorNotFound requested object does not exist
+	ErrorNotFound
+	// ErrorConflict object breaks an unique constraint, or is not in the state the change expects
+	ErrorConflict
+	// ErrorUnavailable datastore can not be reached
+	ErrorUnavailable
+	// ErrorTimeout request was cancelled or ran out of time before datastore answered
+	ErrorTimeout
+)
+
+// kindStatusCodes http status answered for each error kind
+var kindStatusCodes = map[ErrorKind]int{
+	ErrorOther:       500,
+	ErrorNotFound:    404,
+	ErrorConflict:    409,
+	ErrorUnavailable: 503,
+	ErrorTimeout:     504,
+}
+
 // Error return a string for AppError Type
 func (er *AppError) Error() string {
 	return er.Where + ": " + er.Message + ", " + er.DetailedError
@@ -97,3 +123,11 @@ func NewAPIError(statusCode int, id string, message string) *AppError {
 	ap.StatusCode = statusCode
 	return ap
 }
+
+// NewStoreError is used to generate datastore errors. Status code is the one of kind.
+func NewStoreError(kind ErrorKind, where string, id string, details string) *AppError {
+	ap := NewLocAppError(where, id, nil, details)
+	ap.Kind = kind
+	ap.StatusCode = kindStatusCodes[kind]
+	return ap
+}
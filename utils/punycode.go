@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Punycode parameters defined by RFC 3492 section 5
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+	// punycodeACEPrefix prefix of IDN labels encoded in ASCII
+	punycodeACEPrefix = "xn--"
+	domainMaxLength   = 253
+	labelMaxLength    = 63
+)
+
+var (
+	// ErrPunycodeOverflow label is too long to be encoded
+	ErrPunycodeOverflow = errors.New("punycode: overflow")
+)
+
+func punycodeAdapt(delta int, numPoints int, firstTime bool) int {
+	if firstTime {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// PunycodeEncode encode an unicode label as defined by RFC 3492. ACE prefix is not added.
+func PunycodeEncode(label string) (string, error) {
+	runes := []rune(label)
+	output := []byte{}
+	for _, r := range runes {
+		if r < 0x80 {
+			output = append(output, byte(r))
+		}
+	}
+	basic := len(output)
+	handled := basic
+	if basic > 0 {
+		output = append(output, '-')
+	}
+	n, delta, bias := punycodeInitialN, 0, punycodeInitialBias
+	for handled < len(runes) {
+		m := int(utf8.MaxRune) + 1
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		if m-n > (1<<30)/(handled+1) {
+			return "", ErrPunycodeOverflow
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+				if q < t {
+					break
+				}
+				output = append(output, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			output = append(output, punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(output), nil
+}
+
+// DomainToASCII get the lower case ASCII form of a domain name. Unicode labels are punycode encoded with the
+// "xn--" prefix, so a domain written either way gives the same result. Returns false if domain is not valid.
+func DomainToASCII(domain string) (string, bool) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return "", false
+	}
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			encoded, err := PunycodeEncode(label)
+			if err != nil {
+				return "", false
+			}
+			label = punycodeACEPrefix + encoded
+		}
+		if !isValidLabel(label) {
+			return "", false
+		}
+		labels[i] = label
+	}
+	domain = strings.Join(labels, ".")
+	return domain, len(domain) <= domainMaxLength
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidLabel check a DNS label: letters, digits and hyphens, not starting or ending with a hyphen
+func isValidLabel(label string) bool {
+	if len(label) == 0 || len(label) > labelMaxLength || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
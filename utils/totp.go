@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPPeriod duration of a TOTP step in seconds
+	TOTPPeriod = 30
+	// TOTPDigits number of digits of TOTP codes
+	TOTPDigits = 6
+	// totpSkew number of steps accepted before and after current one, to tolerate clock drift
+	totpSkew = 1
+	// totpSecretSize size in bytes of TOTP secrets (RFC 4226 recommend 160 bits)
+	totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret generate a random base32 encoded TOTP secret
+func NewTOTPSecret() string {
+	secret := make([]byte, totpSecretSize)
+	rand.Read(secret)
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPStep get the TOTP step of a date
+func TOTPStep(date time.Time) int64 {
+	return date.Unix() / TOTPPeriod
+}
+
+// TOTPCode compute the RFC 6238 code of secret for a step
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := strconv.FormatUint(uint64(value%1000000), 10)
+	return strings.Repeat("0", TOTPDigits-len(code)) + code, nil
+}
+
+// ValidateTOTP check code against secret around date. It returns the matching step so callers can refuse
+// a code which was already used, or 0 if code is not valid.
+func ValidateTOTP(secret string, code string, date time.Time) int64 {
+	code = strings.Replace(code, " ", "", -1)
+	if len(code) != TOTPDigits {
+		return 0
+	}
+	current := TOTPStep(date)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+// TOTPURI build the otpauth:// provisioning URI authenticator applications read from QR codes
+func TOTPURI(issuer string, account string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", strconv.Itoa(TOTPDigits))
+	values.Set("period", strconv.Itoa(TOTPPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}